@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/aldaircoronel/email-summary/internal/controller"
+	"github.com/aldaircoronel/email-summary/internal/models"
+)
+
+// runAccount implements the "account create|show|list|update|delete" command
+func runAccount(args []string) {
+	fs := flag.NewFlagSet("account", flag.ExitOnError)
+	id := fs.Int("id", 0, "The account ID, required by show, update and delete")
+	holderName := fs.String("holder", "", "The holder name")
+	emails := fs.String("emails", "", "Comma-separated contact emails, the first one is the primary address")
+	currency := fs.String("currency", "", "The ISO 4217 currency, e.g. MXN")
+	locale := fs.String("locale", "", "The locale, e.g. es-MX")
+	timeZone := fs.String("timeZone", "", "The IANA time zone, e.g. America/Mexico_City")
+	status := fs.String("status", "", "The status: active, suspended or closed")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: account create|show|list|update|delete [flags]")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	action := args[0]
+	fs.Parse(args[1:])
+
+	ctx := context.Background()
+	db, err := openRepository(ctx, os.Getenv("DATABASE_URL"))
+	if err != nil {
+		fatal(err)
+	}
+	defer db.Close()
+
+	ctrl := controller.NewAccountController(db)
+
+	// Only the flags given on the command line change the profile
+	apply := func(account *models.Account) {
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "holder":
+				account.HolderName = *holderName
+			case "emails":
+				account.Emails = splitList(*emails)
+			case "currency":
+				account.Currency = *currency
+			case "locale":
+				account.Locale = *locale
+			case "timeZone":
+				account.TimeZone = *timeZone
+			case "status":
+				account.Status = *status
+			}
+		})
+	}
+
+	if action != "create" && action != "list" && *id == 0 {
+		usageError("The -id flag is required by account %s", action)
+	}
+
+	switch action {
+	case "create":
+		account := &models.Account{}
+		apply(account)
+		if _, err := ctrl.CreateAccount(ctx, account); err != nil {
+			fatal(err)
+		}
+		printAccount(account)
+	case "show":
+		account, err := ctrl.GetAccount(ctx, *id)
+		if err != nil {
+			fatal(err)
+		}
+		printAccount(account)
+	case "list":
+		accounts, err := ctrl.ListAccounts(ctx)
+		if err != nil {
+			fatal(err)
+		}
+		for _, account := range accounts {
+			printAccount(account)
+		}
+	case "update":
+		account, err := ctrl.GetAccount(ctx, *id)
+		if err != nil {
+			fatal(err)
+		}
+		apply(account)
+		if err := ctrl.UpdateAccount(ctx, account); err != nil {
+			fatal(err)
+		}
+		printAccount(account)
+	case "delete":
+		if err := ctrl.DeleteAccount(ctx, *id); err != nil {
+			fatal(err)
+		}
+		log.Printf("Account %d deleted", *id)
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
+// printAccount writes the account profile on one line
+func printAccount(account *models.Account) {
+	fmt.Printf("%d\t%s\t%s\t%s\t%s\t%s\t%s\n", account.AccountID, account.HolderName, strings.Join(account.Emails, ","),
+		account.Currency, account.Locale, account.TimeZone, account.Status)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/controller"
+	"github.com/aldaircoronel/email-summary/internal/repository"
+)
+
+// runAudit implements the "audit list|export" command, which queries the audit log
+func runAudit(args []string) {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	entity := fs.String("entity", "", "Only events of this entity, e.g. account, transaction, summary or email")
+	entityID := fs.String("entityID", "", "Only events of the entity with this ID")
+	actor := fs.String("actor", "", "Only events of this actor")
+	action := fs.String("action", "", "Only events of this action, e.g. create, update, delete, import or send")
+	from := fs.String("from", "", "Only events at or after this time, as 2006-01-02 or RFC 3339")
+	to := fs.String("to", "", "Only events before this time, as 2006-01-02 or RFC 3339")
+	limit := fs.Int("limit", 50, "list: the number of events per page")
+	cursor := fs.String("cursor", "", "list: the cursor printed at the end of the previous page")
+	out := fs.String("out", "", "export: the NDJSON file to write, stdout by default")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: audit list|export [flags]")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	verb := args[0]
+	fs.Parse(args[1:])
+
+	q := repository.AuditQuery{
+		Entity:   *entity,
+		EntityID: *entityID,
+		Actor:    *actor,
+		Action:   *action,
+		Limit:    *limit,
+		Cursor:   *cursor,
+	}
+	var err error
+	if q.From, err = parseTime(*from); err != nil {
+		fatal(err)
+	}
+	if q.To, err = parseTime(*to); err != nil {
+		fatal(err)
+	}
+
+	ctx := context.Background()
+	db, err := openRepository(ctx, os.Getenv("DATABASE_URL"))
+	if err != nil {
+		fatal(err)
+	}
+	defer db.Close()
+
+	ctrl := controller.NewAuditController(db)
+	switch verb {
+	case "list":
+		page, err := ctrl.ListEvents(ctx, q)
+		if err != nil {
+			fatal(err)
+		}
+		for _, e := range page.Events {
+			fmt.Printf("%d\t%s\t%s\t%s\t%s %s\t%s\n", e.EventID, e.OccurredAt.Format(time.RFC3339), e.Actor, e.Action, e.Entity, e.EntityID, e.Details)
+		}
+		if page.NextCursor != "" {
+			fmt.Printf("Next page: -cursor %s\n", page.NextCursor)
+		}
+	case "export":
+		var w io.Writer = os.Stdout
+		if *out != "" {
+			// An existing export is never overwritten
+			file, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+			if err != nil {
+				fatal(fmt.Errorf("failed to create export file: %w", err))
+			}
+			defer file.Close()
+			w = file
+		}
+		exported, err := ctrl.Export(ctx, q, w)
+		if err != nil {
+			fatal(err)
+		}
+		log.Printf("Exported %d audit events", exported)
+	default:
+		usageError("Unknown audit action %q, expected list or export", verb)
+	}
+}
+
+// parseTime parses a time flag given as a date or in RFC 3339, the zero time when empty
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, apperrors.Invalid("invalid time %q, expected 2006-01-02 or RFC 3339", value)
+	}
+	return t, nil
+}
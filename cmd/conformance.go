@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/aldaircoronel/email-summary/internal/database"
+	"github.com/aldaircoronel/email-summary/internal/repository"
+	"github.com/aldaircoronel/email-summary/internal/repository/repotest"
+)
+
+// runConformance implements the "conformance" command, which runs the repository conformance suite
+// against a disposable database on the configured server
+func runConformance(args []string) {
+	fs := flag.NewFlagSet("conformance", flag.ExitOnError)
+	databaseURL := fs.String("url", os.Getenv("DATABASE_URL"), "The database whose backend is checked; the suite runs in a new database next to it")
+	fs.Parse(args)
+
+	ctx := context.Background()
+	options, err := database.OptionsFromEnv()
+	if err != nil {
+		fatal(err)
+	}
+	db, cleanup, err := database.OpenDisposable(ctx, *databaseURL, options)
+	if err != nil {
+		fatal(err)
+	}
+
+	failed := repotest.Check(func(t repotest.T) repository.Repository { return db }, os.Stdout)
+	if err := cleanup(); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	if failed > 0 {
+		fmt.Printf("FAIL: %d of %d cases\n", failed, len(repotest.Cases))
+		os.Exit(1)
+	}
+	fmt.Printf("ok: %d cases\n", len(repotest.Cases))
+}
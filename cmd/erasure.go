@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/aldaircoronel/email-summary/internal/controller"
+	"github.com/aldaircoronel/email-summary/internal/models"
+)
+
+// runErase implements the "erase" command, which erases or pseudonymizes the personal data of an account
+func runErase(args []string) {
+	fs := flag.NewFlagSet("erase", flag.ExitOnError)
+	accountID := fs.Int("accountID", 0, "The account whose personal data is erased")
+	mode := fs.String("mode", models.ErasureDelete, "erase removes the personal data and transactions, pseudonymize replaces the personal data with pseudonyms")
+	reason := fs.String("reason", "", "Why the data is erased, e.g. the ticket of the deletion request")
+	requestedBy := fs.String("requestedBy", currentUser(), "Who requested the erasure")
+	fs.Parse(args)
+
+	if *accountID == 0 {
+		usageError("The -accountID flag is required")
+	}
+
+	ctx := context.Background()
+	db, err := openRepository(ctx, os.Getenv("DATABASE_URL"))
+	if err != nil {
+		fatal(err)
+	}
+	defer db.Close()
+
+	result, err := controller.NewErasureController(db).Erase(ctx, controller.ErasureRequest{
+		AccountID:   *accountID,
+		Mode:        *mode,
+		Reason:      *reason,
+		RequestedBy: *requestedBy,
+	})
+	if err != nil {
+		fatal(err)
+	}
+	log.Printf("Account %d: personal data %sd, %d statements wiped, %d outbox messages and %d transactions deleted (erasure record %d)",
+		*accountID, *mode, result.Statements, result.Messages, result.Transactions, result.Record.ErasureID)
+}
+
+// runErasures implements the "erasures" command, which lists the erasure log and verifies its hash chain
+func runErasures(args []string) {
+	fs := flag.NewFlagSet("erasures", flag.ExitOnError)
+	fs.Parse(args)
+
+	ctx := context.Background()
+	db, err := openRepository(ctx, os.Getenv("DATABASE_URL"))
+	if err != nil {
+		fatal(err)
+	}
+	defer db.Close()
+
+	records, err := controller.NewErasureController(db).VerifyErasureLog(ctx)
+	for _, r := range records {
+		fmt.Printf("%d\t%s\taccount %d\t%s\t%s\t%s\t%s\n", r.ErasureID, r.ErasedAt.Format("2006-01-02 15:04:05"),
+			r.AccountID, r.Mode, r.RequestedBy, r.Reason, r.Hash)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	log.Printf("Erasure log verified, %d records", len(records))
+}
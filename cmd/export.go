@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/aldaircoronel/email-summary/internal/controller"
+)
+
+// runExport implements the "export" command, which writes an account and all its data to a zip archive
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	accountID := fs.Int("accountID", 0, "The account to export")
+	out := fs.String("out", "", "The archive file to write, account-<id>.zip by default")
+	fs.Parse(args)
+
+	if *accountID == 0 {
+		usageError("The -accountID flag is required")
+	}
+	if *out == "" {
+		*out = fmt.Sprintf("account-%d.zip", *accountID)
+	}
+
+	ctx := context.Background()
+	db, err := openRepository(ctx, os.Getenv("DATABASE_URL"))
+	if err != nil {
+		fatal(err)
+	}
+	defer db.Close()
+
+	// An existing archive is never overwritten
+	file, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		fatal(fmt.Errorf("failed to create archive: %w", err))
+	}
+	manifest, err := controller.NewExportController(db).Export(ctx, *accountID, file)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write archive: %w", closeErr)
+	}
+	if err != nil {
+		os.Remove(*out)
+		fatal(err)
+	}
+
+	for _, f := range manifest.Files {
+		log.Printf("Exported %d records to %s", f.Records, f.Name)
+	}
+	log.Printf("Account %d exported to %s", *accountID, *out)
+}
+
+// runImport implements the "import" command, which restores an account archive as a new account
+func runImport(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	in := fs.String("in", "", "The archive file written by the export command")
+	fs.Parse(args)
+
+	if *in == "" {
+		usageError("The -in flag is required")
+	}
+
+	ctx := context.Background()
+	db, err := openRepository(ctx, os.Getenv("DATABASE_URL"))
+	if err != nil {
+		fatal(err)
+	}
+	defer db.Close()
+
+	file, err := os.Open(*in)
+	if err != nil {
+		fatal(fmt.Errorf("failed to open archive: %w", err))
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		fatal(fmt.Errorf("failed to open archive: %w", err))
+	}
+
+	result, err := controller.NewExportController(db).Import(ctx, file, info.Size())
+	if err != nil {
+		fatal(err)
+	}
+	log.Printf("Imported %d transactions, %d summaries and %d month summaries", result.Transactions, result.Summaries, result.MonthSummaries)
+	log.Printf("New account created with ID: %d", result.AccountID)
+}
@@ -2,94 +2,389 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"io/fs"
 	"log"
 	"os"
+	"os/user"
 	"path/filepath"
+	"strings"
+	_ "time/tzdata" // Embed the IANA time zone database so account time zones resolve in minimal images
 
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
 	"github.com/aldaircoronel/email-summary/internal/controller"
 	"github.com/aldaircoronel/email-summary/internal/database"
+	"github.com/aldaircoronel/email-summary/internal/models"
 	"github.com/aldaircoronel/email-summary/internal/repository"
 	"github.com/aldaircoronel/email-summary/internal/view"
 	"github.com/joho/godotenv"
 )
 
 func main() {
+	// Commands other than sending the summary come first on the command line
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			loadEnv()
+			runMigrate(os.Args[2:])
+			return
+		case "account":
+			loadEnv()
+			runAccount(os.Args[2:])
+			return
+		case "statements":
+			loadEnv()
+			runStatements(os.Args[2:])
+			return
+		case "resend":
+			loadEnv()
+			runResend(os.Args[2:])
+			return
+		case "retention":
+			loadEnv()
+			runRetention(os.Args[2:])
+			return
+		case "purge":
+			loadEnv()
+			runPurge(os.Args[2:])
+			return
+		case "export":
+			loadEnv()
+			runExport(os.Args[2:])
+			return
+		case "import":
+			loadEnv()
+			runImport(os.Args[2:])
+			return
+		case "erase":
+			loadEnv()
+			runErase(os.Args[2:])
+			return
+		case "erasures":
+			loadEnv()
+			runErasures(os.Args[2:])
+			return
+		case "audit":
+			loadEnv()
+			runAudit(os.Args[2:])
+			return
+		case "conformance":
+			loadEnv()
+			runConformance(os.Args[2:])
+			return
+		case "outbox":
+			loadEnv()
+			runOutbox(os.Args[2:])
+			return
+		case "preview":
+			loadEnv()
+			runPreview(os.Args[2:])
+			return
+		}
+	}
+
+	// Get EMAIL_TO flag value
+	emailTo := flag.String("emailTo", "", "Comma-separated email addresses to send the summary to, instead of the account contact emails")
+
+	// Get ACCOUNT_ID flag value
+	accountID := flag.Int("accountID", 0, "Load the transactions into this existing account instead of creating a new one")
+
+	// Get the profile flag values of the new account
+	holderName := flag.String("holder", "", "The holder name of the new account")
+	currency := flag.String("currency", models.DefaultCurrency, "The ISO 4217 currency of the new account")
+	locale := flag.String("locale", models.DefaultLocale, "The locale of the new account, e.g. es-MX")
+	timeZone := flag.String("timeZone", models.DefaultTimeZone, "The IANA time zone of the new account, e.g. America/Mexico_City")
+
+	// Get ATTACH flag value
+	attach := flag.String("attach", "", "Comma-separated attachments of the summary email: csv, pdf or none; EMAIL_ATTACHMENTS by default")
+
+	// Get IN_MEMORY flag value
+	inMemory := flag.Bool("inMemory", false, "Keep all data in memory instead of PostgreSQL, for quick local runs")
+
+	// Parse flags
+	flag.Parse()
+
+	if *emailTo == "" && *accountID == 0 {
+		usageError("The -emailTo flag is required when creating a new account")
+	}
+
 	// Get the file path of the input csv files.
 	csvFilePath, _ := filepath.Abs("./sample/txns.csv")
 
-	err := godotenv.Load()
+	loadEnv()
+
+	// Check the attachments and the email templates before any data is written
+	attachKinds := attachmentKinds(*attach)
+	if err := view.CheckAttachmentKinds(attachKinds); err != nil {
+		fatal(err)
+	}
+	templates, err := view.LoadTemplates(os.Getenv("TEMPLATE_DIR"))
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		fatal(err)
 	}
 
-	// Load database connection string from environment variable
+	// Load database connection string from environment variable.
+	// Its scheme selects the backend: postgres://, sqlite:// or memory://
 	connStr := os.Getenv("DATABASE_URL")
+	if *inMemory {
+		connStr = "memory://"
+	}
 
-	// Instanciate a new PostgreSQL repository
-	db, err := database.NewPostgresRepository(connStr)
+	// Instanciate the repository for the configured backend
+	db, err := openRepository(context.Background(), connStr)
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
+	defer db.Close()
 
-	// Set the repository to our concrete PostgreSQL repository
-	repository.SetRepository(db)
+	emailService, err := newEmailService(db)
+	if err != nil {
+		fatal(err)
+	}
 
-	// Initialize the controller with the database as the repository
+	// Initialize the controller, injecting the repository it works on
 	ctrl := controller.NewTransactionController(db)
 
-	// Create a new account
-	accountID, err := ctrl.CreateAccount(context.Background())
-	if err != nil {
-		log.Fatal(err)
+	// Create a new account, unless an existing one was given
+	if *accountID == 0 {
+		*accountID, err = ctrl.CreateAccount(context.Background(), &models.Account{
+			HolderName: *holderName,
+			Emails:     splitList(*emailTo),
+			Currency:   *currency,
+			Locale:     *locale,
+			TimeZone:   *timeZone,
+		})
+		if err != nil {
+			fatal(err)
+		}
+		log.Printf("New account created with ID: %d", *accountID)
 	}
-	log.Printf("New account created with ID: %d", accountID)
 
 	// Store the account ID somewhere in the controller because we will need it later
-	ctrl.SetAccountID(accountID)
+	ctrl.SetAccountID(*accountID)
+
+	// The stored profile decides who gets the summary and how it looks
+	account, err := ctrl.Account(context.Background())
+	if err != nil {
+		fatal(err)
+	}
 
 	// Process the CSV file and save transactions to the database
 	if err := ctrl.ProcessCSVFile(context.Background(), csvFilePath); err != nil {
-		log.Fatal(err)
+		fatal(err)
+	}
+
+	// Send to the account contact emails unless -emailTo overrides them
+	to := account.Emails
+	if *emailTo != "" {
+		to = splitList(*emailTo)
+	}
+	if len(to) == 0 {
+		fatal(apperrors.Invalid("account %d has no contact email, pass the -emailTo flag", account.AccountID))
+	}
+
+	// Generate the email summary and queue its email in one transaction, so a summary is never stored
+	// without the email that delivers it, which the outbox delivers even if sending it now fails
+	var queued *models.OutboxMessage
+	err = db.InTx(context.Background(), func(tx repository.Repository) error {
+		var err error
+		queued, err = queueStatement(context.Background(), tx, templates, attachKinds, account, to)
+		return err
+	})
+	if err != nil {
+		fatal(err)
 	}
-	// Generate the email summary
-	summary, monthSummaries, err := ctrl.GenerateEmailSummary(context.Background())
+
+	sent, err := deliverNow(context.Background(), db, emailService, queued)
+	if err != nil {
+		fatal(err)
+	}
+	// Print message when email is successfully sent
+	if sent {
+		log.Println("Email summary sent!")
+	}
+}
+
+// queueStatement generates the summary of the account, renders its email and queues it in the outbox.
+// The statement is archived as it is delivered, so it can be re-sent later.
+func queueStatement(ctx context.Context, db repository.Repository, templates *view.Templates, attachKinds []string, account *models.Account, to []string) (*models.OutboxMessage, error) {
+	ctrl := controller.NewTransactionController(db)
+	ctrl.SetAccountID(account.AccountID)
+	summary, monthSummaries, err := ctrl.GenerateEmailSummary(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
+	subject := templates.Subject(account)
+	body, err := templates.RenderEmailBody(account, summary, monthSummaries)
+	if err != nil {
+		return nil, err
+	}
+	text, err := templates.RenderEmailText(account, summary, monthSummaries)
+	if err != nil {
+		return nil, err
+	}
+	charts, err := view.RenderCharts(account, monthSummaries)
+	if err != nil {
+		return nil, err
+	}
+	attachments, err := statementAttachments(ctx, db, attachKinds, account, summary, monthSummaries)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &view.Message{
+		From:        os.Getenv("EMAIL_FROM"),
+		To:          to,
+		Subject:     subject,
+		HTML:        body,
+		Text:        text,
+		Inline:      view.ReferencedImages(body, charts),
+		Attachments: attachments,
+	}
+	payload, err := view.EncodeOutboxPayload(msg)
+	if err != nil {
+		return nil, err
+	}
+	return controller.NewStatementController(db).QueueDelivery(ctx, summary, subject, body, text, to, payload)
+}
+
+// splitList splits a comma-separated flag value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// newEmailService creates the email service from the configuration in the environment. EMAIL_TRANSPORT
+// selects how emails are sent: smtp (the default), http, sendmail, file or maildir. With DKIM_PRIVATE_KEY_FILE
+// the emails are DKIM-signed. Every email it sends is written to the audit log of the repository.
+func newEmailService(db repository.Repository) (view.EmailService, error) {
 	// Load email service configuration from environment variables
-	emailCfg := &view.SMTPConfig{
-		Host:     os.Getenv("EMAIL_HOST"),
-		Port:     os.Getenv("EMAIL_PORT"),
-		Username: os.Getenv("EMAIL_USERNAME"),
-		Password: os.Getenv("EMAIL_PASSWORD"),
-		From:     os.Getenv("EMAIL_FROM"),
+	from := os.Getenv("EMAIL_FROM")
+
+	var service view.EmailService
+	switch transport := os.Getenv("EMAIL_TRANSPORT"); transport {
+	case "", "smtp":
+		smtpService, err := view.NewSMTPService(&view.SMTPConfig{
+			Host:     os.Getenv("EMAIL_HOST"),
+			Port:     os.Getenv("EMAIL_PORT"),
+			Username: os.Getenv("EMAIL_USERNAME"),
+			Password: os.Getenv("EMAIL_PASSWORD"),
+			From:     from,
+			TLS:      os.Getenv("EMAIL_TLS"),
+			CAFile:   os.Getenv("EMAIL_TLS_CA_FILE"),
+			CertFile: os.Getenv("EMAIL_TLS_CERT_FILE"),
+			KeyFile:  os.Getenv("EMAIL_TLS_KEY_FILE"),
+			Auth:     os.Getenv("EMAIL_AUTH"),
+			Timeout:  envDuration("EMAIL_TIMEOUT"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		service = smtpService
+	case "http":
+		url := os.Getenv("EMAIL_HTTP_URL")
+		if url == "" {
+			return nil, apperrors.Invalid("EMAIL_HTTP_URL is required by the http email transport")
+		}
+		service = view.NewHTTPService(&view.HTTPConfig{
+			URL:     url,
+			APIKey:  os.Getenv("EMAIL_HTTP_API_KEY"),
+			From:    from,
+			Timeout: envDuration("EMAIL_HTTP_TIMEOUT"),
+		})
+	case "sendmail":
+		service = view.NewSendmailService(&view.SendmailConfig{
+			Path: os.Getenv("EMAIL_SENDMAIL_PATH"),
+			From: from,
+		})
+	case "file", "maildir":
+		dir := os.Getenv("EMAIL_FILE_DIR")
+		if dir == "" {
+			return nil, apperrors.Invalid("EMAIL_FILE_DIR is required by the %s email transport", transport)
+		}
+		service = view.NewFileService(&view.FileConfig{
+			Dir:     dir,
+			Maildir: transport == "maildir",
+			From:    from,
+		})
+	default:
+		return nil, apperrors.Invalid("unknown EMAIL_TRANSPORT %q, expected smtp, http, sendmail, file or maildir", transport)
 	}
 
-	// Initialize email service with SMTP configuration
-	emailService := view.NewSMTPService(emailCfg)
+	// Sign the emails of our own domain, so receivers can tell they are genuine
+	if keyFile := os.Getenv("DKIM_PRIVATE_KEY_FILE"); keyFile != "" {
+		signer, err := view.NewDKIMSigner(&view.DKIMConfig{
+			Domain:   os.Getenv("DKIM_DOMAIN"),
+			Selector: os.Getenv("DKIM_SELECTOR"),
+			KeyFile:  keyFile,
+		})
+		if err != nil {
+			return nil, err
+		}
+		service = view.NewSigningEmailService(service, signer)
+	}
 
-	// Get EMAIL_TO flag value
-	emailTo := flag.String("emailTo", "", "The email address to send the summary to")
+	return view.NewAuditedEmailService(service, db), nil
+}
 
-	// Parse flags
-	flag.Parse()
+// fatal logs the error and exits with the exit code of its kind, see apperrors.ExitCode
+func fatal(err error) {
+	log.Println(err)
+	os.Exit(apperrors.ExitCode(err))
+}
+
+// usageError logs a command line mistake and exits with the usage exit code
+func usageError(format string, args ...interface{}) {
+	log.Printf(format, args...)
+	os.Exit(apperrors.ExitUsage)
+}
 
-	to := []string{*emailTo}
-	if *emailTo == "" {
-		log.Fatal("The -emailTo flag is required")
+// loadEnv loads the configuration from the .env file into the environment. Without a .env file the
+// configuration comes from the environment alone, as in quick -inMemory runs.
+func loadEnv() {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Fatalf("Error loading .env file: %v", err)
 	}
-	subject := "Transaction Summary"
-	body, err := view.RenderEmailBody(summary, monthSummaries)
+}
+
+// openRepository creates the repository for the given DATABASE_URL and checks that its schema
+// matches this binary. The caller owns the repository and must close it.
+func openRepository(ctx context.Context, connStr string) (repository.Repository, error) {
+	options, err := database.OptionsFromEnv()
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	if err := emailService.SendEmail(to, subject, body); err != nil {
-		log.Fatal(err)
+	db, err := database.Open(ctx, connStr, options)
+	if err != nil {
+		return nil, err
 	}
 
-	// Print message when email is successfully sent
-	log.Println("Email summary sent!")
+	// Refuse to run against a schema that doesn't match this binary
+	if migrator, ok := db.(database.Migrator); ok {
+		if err := migrator.CheckSchema(ctx); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
 
+	// Every change is written to the audit log, attributed to the user running the command
+	return repository.NewAuditedRepository(db, currentUser()), nil
+}
+
+// currentUser returns the name of the user running the command, the default actor of the changes it makes
+func currentUser() string {
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
 }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/aldaircoronel/email-summary/internal/database"
+)
+
+// runMigrate implements the "migrate up|down|status" command
+func runMigrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	steps := fs.Int("steps", 1, "Number of migrations to revert with migrate down")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: migrate up | down [-steps N] | status")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	action := args[0]
+	fs.Parse(args[1:])
+
+	ctx := context.Background()
+	options, err := database.OptionsFromEnv()
+	if err != nil {
+		fatal(err)
+	}
+	db, err := database.Open(ctx, os.Getenv("DATABASE_URL"), options)
+	if err != nil {
+		fatal(err)
+	}
+	defer db.Close()
+
+	migrator, ok := db.(database.Migrator)
+	if !ok {
+		usageError("The configured database has no migrations")
+	}
+
+	switch action {
+	case "up":
+		applied, err := migrator.MigrateUp(ctx)
+		for _, m := range applied {
+			log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			fatal(err)
+		}
+		if len(applied) == 0 {
+			log.Println("Database schema is up to date")
+		}
+	case "down":
+		reverted, err := migrator.MigrateDown(ctx, *steps)
+		for _, m := range reverted {
+			log.Printf("Reverted migration %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			fatal(err)
+		}
+	case "status":
+		status, err := migrator.MigrationStatus(ctx)
+		if err != nil {
+			fatal(err)
+		}
+		for _, s := range status {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, state)
+		}
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+}
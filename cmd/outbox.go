@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/controller"
+	"github.com/aldaircoronel/email-summary/internal/models"
+	"github.com/aldaircoronel/email-summary/internal/repository"
+	"github.com/aldaircoronel/email-summary/internal/view"
+)
+
+// runOutbox implements the "outbox list|show|retry|cancel|run" command, which inspects and delivers the
+// queue of emails waiting to be sent
+func runOutbox(args []string) {
+	fs := flag.NewFlagSet("outbox", flag.ExitOnError)
+	id := fs.Int("id", 0, "show, retry, cancel: the outbox message")
+	accountID := fs.Int("accountID", 0, "list: only messages of this account")
+	status := fs.String("status", "", "list: only messages in this status: pending, sending, sent, dead or cancelled")
+	limit := fs.Int("limit", 50, "list: the number of messages per page; run: the number of due messages delivered per pass")
+	cursor := fs.String("cursor", "", "list: the cursor printed at the end of the previous page")
+	watch := fs.Duration("watch", 0, "run: keep delivering, checking for due messages at this interval, e.g. 30s, until interrupted")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: outbox list|show|retry|cancel|run [flags]")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	verb := args[0]
+	fs.Parse(args[1:])
+
+	if (verb == "show" || verb == "retry" || verb == "cancel") && *id == 0 {
+		usageError("The -id flag is required")
+	}
+
+	ctx := context.Background()
+	db, err := openRepository(ctx, os.Getenv("DATABASE_URL"))
+	if err != nil {
+		fatal(err)
+	}
+	defer db.Close()
+
+	ctrl := controller.NewOutboxController(db, retryPolicy())
+	switch verb {
+	case "list":
+		page, err := ctrl.ListMessages(ctx, repository.OutboxQuery{
+			AccountID: *accountID,
+			Status:    *status,
+			Limit:     *limit,
+			Cursor:    *cursor,
+		})
+		if err != nil {
+			fatal(err)
+		}
+		for _, msg := range page.Messages {
+			subject, recipients := outboxEnvelope(msg)
+			next := "-"
+			if msg.Awaiting() {
+				next = msg.NextAttemptAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%d\t%s\t%d attempts\t%s\taccount %d\t%s\t%s\t%s\n", msg.OutboxID, msg.Status, msg.Attempts,
+				next, msg.AccountID, recipients, subject, msg.LastError)
+		}
+		if page.NextCursor != "" {
+			fmt.Printf("Next page: -cursor %s\n", page.NextCursor)
+		}
+	case "show":
+		msg, err := ctrl.GetMessage(ctx, *id)
+		if err != nil {
+			fatal(err)
+		}
+		printOutboxMessage(msg)
+	case "retry":
+		msg, err := ctrl.Retry(ctx, *id)
+		if err != nil {
+			fatal(err)
+		}
+		log.Printf("Outbox message %d is pending again, it is sent by the next outbox run", msg.OutboxID)
+	case "cancel":
+		msg, err := ctrl.Cancel(ctx, *id)
+		if err != nil {
+			fatal(err)
+		}
+		log.Printf("Outbox message %d is cancelled", msg.OutboxID)
+	case "run":
+		emailService, err := newEmailService(db)
+		if err != nil {
+			fatal(err)
+		}
+		runOutboxWorker(ctrl, view.NewOutboxSender(emailService), *limit, *watch)
+	default:
+		usageError("Unknown outbox action %q, expected list, show, retry, cancel or run", verb)
+	}
+}
+
+// runOutboxWorker delivers the due messages, once or, with a watch interval, until interrupted
+func runOutboxWorker(ctrl *controller.OutboxController, sender controller.Sender, limit int, watch time.Duration) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	for {
+		result, err := ctrl.Run(ctx, sender, limit)
+		if err != nil && ctx.Err() == nil {
+			fatal(err)
+		}
+		if result != nil && result.Sent+result.Retrying+result.Dead > 0 {
+			log.Printf("Outbox: %d sent, %d to retry, %d dead", result.Sent, result.Retrying, result.Dead)
+		}
+		if watch <= 0 {
+			return
+		}
+		// A full batch may mean more messages are due
+		if result != nil && result.Sent+result.Retrying+result.Dead == limit {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(watch):
+		}
+	}
+}
+
+// deliverNow sends a message just queued, leaving it to the outbox worker if that fails for a reason
+// that may pass. It fails when the message can never be delivered.
+func deliverNow(ctx context.Context, db repository.Repository, service view.EmailService, msg *models.OutboxMessage) (bool, error) {
+	sender := view.NewOutboxSender(service)
+	msg, err := controller.NewOutboxController(db, retryPolicy()).Deliver(ctx, sender, msg.OutboxID)
+	if err != nil {
+		return false, err
+	}
+	switch msg.Status {
+	case models.OutboxSent:
+		return true, nil
+	case models.OutboxDead:
+		return false, &apperrors.DeliveryError{Err: fmt.Errorf("outbox message %d is dead: %s", msg.OutboxID, msg.LastError)}
+	default:
+		log.Printf("Delivery of outbox message %d failed, it is retried by the outbox worker after %s: %s",
+			msg.OutboxID, msg.NextAttemptAt.Format(time.RFC3339), msg.LastError)
+		return false, nil
+	}
+}
+
+// retryPolicy reads the retries of the outbox from the environment:
+//
+//	OUTBOX_MAX_ATTEMPTS   attempts before a message is dead
+//	OUTBOX_BACKOFF        delay after the first failed attempt, doubled on every attempt, such as 1m
+//	OUTBOX_MAX_BACKOFF    longest delay between attempts, such as 6h
+//	OUTBOX_LEASE          how long a worker keeps a message it is sending, such as 10m
+func retryPolicy() controller.RetryPolicy {
+	return controller.RetryPolicy{
+		MaxAttempts: envInt("OUTBOX_MAX_ATTEMPTS"),
+		Backoff:     envDuration("OUTBOX_BACKOFF"),
+		MaxBackoff:  envDuration("OUTBOX_MAX_BACKOFF"),
+		Lease:       envDuration("OUTBOX_LEASE"),
+	}
+}
+
+// envDuration reads a duration setting from the environment, 0 when it isn't set
+func envDuration(name string) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		fatal(apperrors.Invalid("invalid %s: %w", name, err))
+	}
+	return d
+}
+
+// outboxEnvelope returns the subject and recipients of a queued message, for listing it
+func outboxEnvelope(msg *models.OutboxMessage) (string, string) {
+	email, err := view.DecodeOutboxPayload(msg.Payload)
+	if err != nil {
+		return "", ""
+	}
+	return email.Subject, strings.Join(email.To, ",")
+}
+
+// printOutboxMessage writes a message and the state of its delivery to stdout
+func printOutboxMessage(msg *models.OutboxMessage) {
+	subject, recipients := outboxEnvelope(msg)
+	fmt.Printf("ID:           %d\n", msg.OutboxID)
+	fmt.Printf("Account:      %d\n", msg.AccountID)
+	if msg.SummaryID != 0 {
+		fmt.Printf("Statement:    %d\n", msg.SummaryID)
+	}
+	fmt.Printf("To:           %s\n", recipients)
+	fmt.Printf("Subject:      %s\n", subject)
+	fmt.Printf("Status:       %s\n", msg.Status)
+	fmt.Printf("Attempts:     %d\n", msg.Attempts)
+	if msg.Awaiting() {
+		fmt.Printf("Next attempt: %s\n", msg.NextAttemptAt.Format(time.RFC3339))
+	}
+	if !msg.SentAt.IsZero() {
+		fmt.Printf("Sent:         %s\n", msg.SentAt.Format(time.RFC3339))
+	}
+	if msg.LastError != "" {
+		fmt.Printf("Last error:   %s\n", msg.LastError)
+	}
+	fmt.Printf("Queued:       %s\n", msg.CreatedAt.Format(time.RFC3339))
+}
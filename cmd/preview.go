@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/controller"
+	"github.com/aldaircoronel/email-summary/internal/repository"
+	"github.com/aldaircoronel/email-summary/internal/view"
+)
+
+// runPreview implements the "preview" command, which renders the summary email of a stored summary, or of
+// a sample statement, with the templates as they are on disk. It serves the email on a local web page,
+// rendered again on every request, or writes it to a file with -out.
+func runPreview(args []string) {
+	fs := flag.NewFlagSet("preview", flag.ExitOnError)
+	summaryID := fs.Int("summaryID", 0, "The stored summary to render; a sample statement when 0")
+	locale := fs.String("locale", "", "Render in this locale instead of the one of the account, e.g. es-MX")
+	addr := fs.String("addr", "localhost:8025", "The address the preview server listens on")
+	out := fs.String("out", "", "Write the email to this file instead of serving it: .eml for the message, .html or .txt for one of its parts")
+	fs.Parse(args)
+	if *out != "" {
+		if _, err := outputPart(*out); err != nil {
+			usageError("%v", err)
+		}
+	}
+
+	ctx := context.Background()
+	db, err := openRepository(ctx, os.Getenv("DATABASE_URL"))
+	if err != nil {
+		fatal(err)
+	}
+	defer db.Close()
+
+	p := &preview{db: db, templateDir: os.Getenv("TEMPLATE_DIR"), from: os.Getenv("EMAIL_FROM")}
+	if *out != "" {
+		if err := p.writeFile(ctx, *out, *summaryID, *locale); err != nil {
+			fatal(err)
+		}
+		log.Printf("Email written to %s", *out)
+		return
+	}
+
+	server := &http.Server{Addr: *addr, Handler: p.handler(), ReadHeaderTimeout: 10 * time.Second}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Previewing emails on http://%s/, reload the page to see template changes", *addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fatal(fmt.Errorf("failed to start preview server: %w", err))
+	}
+}
+
+// preview renders summary emails with the templates of templateDir, loaded again for every email
+type preview struct {
+	db          repository.Repository
+	templateDir string
+	// from is the sender of the rendered emails
+	from string
+}
+
+// handler returns the routes of the preview server: the page at / and the email it shows at /email
+func (p *preview) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", p.handlePage)
+	mux.HandleFunc("/email", p.handleEmail)
+	return mux
+}
+
+// render renders the email of a stored summary, or of the sample statement when summaryID is 0, as it
+// would be sent, without attachments. An empty locale keeps the one of the account.
+func (p *preview) render(ctx context.Context, summaryID int, locale string) (*view.Message, error) {
+	templates, err := view.LoadTemplates(p.templateDir)
+	if err != nil {
+		return nil, err
+	}
+
+	account, summary, monthSummaries := view.SampleStatement()
+	to := account.Emails
+	if summaryID != 0 {
+		if summary, err = controller.NewStatementController(p.db).GetStatement(ctx, summaryID); err != nil {
+			return nil, err
+		}
+		if account, err = p.db.GetAccountByID(ctx, summary.AccountID); err != nil {
+			return nil, err
+		}
+		if monthSummaries, err = p.db.GetMonthSummaryBySummaryID(ctx, summaryID); err != nil {
+			return nil, err
+		}
+		to = account.Emails
+		if len(summary.Recipients) > 0 {
+			to = summary.Recipients
+		}
+	}
+	if locale != "" {
+		localized := *account
+		localized.Locale = locale
+		account = &localized
+	}
+
+	html, err := templates.RenderEmailBody(account, summary, monthSummaries)
+	if err != nil {
+		return nil, err
+	}
+	text, err := templates.RenderEmailText(account, summary, monthSummaries)
+	if err != nil {
+		return nil, err
+	}
+	charts, err := view.RenderCharts(account, monthSummaries)
+	if err != nil {
+		return nil, err
+	}
+	return &view.Message{
+		From:    p.from,
+		To:      to,
+		Subject: templates.Subject(account),
+		HTML:    html,
+		Text:    text,
+		Inline:  view.ReferencedImages(html, charts),
+	}, nil
+}
+
+// part returns one part of a rendered email and its media type: "html", with the images embedded so it
+// shows on its own, "text", or "eml", the whole message
+func part(msg *view.Message, name string) ([]byte, string, error) {
+	switch name {
+	case "", "html":
+		return []byte(view.EmbedImages(msg.HTML, msg.Inline)), "text/html; charset=utf-8", nil
+	case "text":
+		return []byte(msg.Text), "text/plain; charset=utf-8", nil
+	case "eml":
+		data, err := msg.Bytes()
+		return data, "message/rfc822", err
+	}
+	return nil, "", apperrors.Invalid("unknown email part %q, expected html, text or eml", name)
+}
+
+// outputPart returns the part of the email a file gets by its extension
+func outputPart(name string) (string, error) {
+	parts := map[string]string{".eml": "eml", ".html": "html", ".htm": "html", ".txt": "text"}
+	if partName, ok := parts[strings.ToLower(filepath.Ext(name))]; ok {
+		return partName, nil
+	}
+	return "", apperrors.Invalid("the -out file %q must end in .eml, .html or .txt", name)
+}
+
+// writeFile renders an email to a file, the part chosen by its extension
+func (p *preview) writeFile(ctx context.Context, name string, summaryID int, locale string) error {
+	partName, err := outputPart(name)
+	if err != nil {
+		return err
+	}
+	msg, err := p.render(ctx, summaryID, locale)
+	if err != nil {
+		return err
+	}
+	data, _, err := part(msg, partName)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(name, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	return nil
+}
+
+// previewQuery reads the summary, locale and part of a preview request
+func previewQuery(r *http.Request) (int, string, string, error) {
+	q := r.URL.Query()
+	summaryID := 0
+	if value := q.Get("summaryID"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, "", "", apperrors.Invalid("invalid summaryID %q", value)
+		}
+		summaryID = id
+	}
+	return summaryID, q.Get("locale"), q.Get("part"), nil
+}
+
+// handleEmail serves one part of the email the query asks for, rendered with the current templates
+func (p *preview) handleEmail(w http.ResponseWriter, r *http.Request) {
+	summaryID, locale, name, err := previewQuery(r)
+	var msg *view.Message
+	if err == nil {
+		msg, err = p.render(r.Context(), summaryID, locale)
+	}
+	var data []byte
+	var mediaType string
+	if err == nil {
+		data, mediaType, err = part(msg, name)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), apperrors.HTTPStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Cache-Control", "no-store")
+	if name == "eml" {
+		w.Header().Set("Content-Disposition", `attachment; filename="summary.eml"`)
+	}
+	w.Write(data)
+}
+
+// previewPage is the page around the previewed email, with the controls that choose what it shows
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Email preview</title>
+<style>
+body { margin: 0; font-family: sans-serif; }
+form { padding: 8px 12px; background: #f0f0f0; border-bottom: 1px solid #ccc; }
+iframe { width: 100%; height: calc(100vh - 50px); border: 0; }
+</style>
+</head>
+<body>
+<form>
+<label>Summary ID <input name="summaryID" value="{{if .SummaryID}}{{.SummaryID}}{{end}}" placeholder="sample" size="8"></label>
+<label>Locale <input name="locale" value="{{.Locale}}" placeholder="account" size="8"></label>
+<label><input type="radio" name="part" value="html"{{if ne .Part "text"}} checked{{end}}> HTML</label>
+<label><input type="radio" name="part" value="text"{{if eq .Part "text"}} checked{{end}}> Text</label>
+<button>Render</button>
+<a href="{{.EMLURL}}">Download .eml</a>
+</form>
+<iframe src="{{.EmailURL}}"></iframe>
+</body>
+</html>
+`))
+
+// handlePage serves the preview page, which shows the email in a frame
+func (p *preview) handlePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	summaryID, locale, name, err := previewQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), apperrors.HTTPStatus(err))
+		return
+	}
+
+	// The frame shows the email the form asks for; the URLs are built from the parsed query, so they are safe
+	q := r.URL.Query()
+	emailURL := template.URL("/email?" + q.Encode())
+	q.Set("part", "eml")
+	data := struct {
+		SummaryID int
+		Locale    string
+		Part      string
+		EmailURL  template.URL
+		EMLURL    template.URL
+	}{summaryID, locale, name, emailURL, template.URL("/email?" + q.Encode())}
+	w.Header().Set("Cache-Control", "no-store")
+	if err := previewPage.Execute(w, data); err != nil {
+		log.Println(err)
+	}
+}
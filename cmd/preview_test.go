@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/database"
+	"github.com/aldaircoronel/email-summary/internal/i18n"
+	"github.com/aldaircoronel/email-summary/internal/models"
+)
+
+// previewTestRepository stores an account in Mexico and a delivered statement of it with two months
+func previewTestRepository(t *testing.T) (*database.MemoryRepository, int) {
+	t.Helper()
+	ctx := context.Background()
+	repo := database.NewMemoryRepository()
+	account := &models.Account{HolderName: "Ana López", Emails: []string{"ana@example.com"}, Currency: "MXN", Locale: "es-MX", TimeZone: "America/Mexico_City"}
+	accountID, err := repo.SaveAccount(ctx, account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary := &models.Summary{AccountID: accountID, TotalBalance: 12345.5, TotalTransactions: 2}
+	if err := repo.SaveSummary(ctx, summary); err != nil {
+		t.Fatal(err)
+	}
+	summary.Subject, summary.HTMLBody, summary.TextBody = "Resumen", "<p>Resumen</p>", "Resumen"
+	summary.Recipients = []string{"contabilidad@example.com"}
+	if err := repo.SaveSummaryContent(ctx, summary); err != nil {
+		t.Fatal(err)
+	}
+	for _, month := range []string{"2023-02", "2023-01"} {
+		if err := repo.SaveMonthSummary(ctx, &models.MonthSummary{Month: month, TotalTransactions: 1}, summary.SummaryID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return repo, summary.SummaryID
+}
+
+func TestPreviewWriteFile(t *testing.T) {
+	ctx := context.Background()
+	repo, summaryID := previewTestRepository(t)
+	p := &preview{db: repo, from: "statements@example.com"}
+	dir := t.TempDir()
+
+	// The HTML part opens on its own, with its charts embedded
+	html := filepath.Join(dir, "sample.html")
+	if err := p.writeFile(ctx, html, 0, ""); err != nil {
+		t.Fatalf("writeFile: %v", err)
+	}
+	data, err := os.ReadFile(html)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("<!DOCTYPE html>")) || !bytes.Contains(data, []byte("Sample Holder")) {
+		t.Errorf("%s doesn't hold the HTML email of the sample statement:\n%s", html, data)
+	}
+	if bytes.Contains(data, []byte("cid:")) || !bytes.Contains(data, []byte("data:image/png;base64,")) {
+		t.Errorf("%s doesn't embed its charts", html)
+	}
+
+	// The text part of a stored statement, in another locale
+	text := filepath.Join(dir, "statement.TXT")
+	if err := p.writeFile(ctx, text, summaryID, "en"); err != nil {
+		t.Fatalf("writeFile: %v", err)
+	}
+	if data, err = os.ReadFile(text); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte("Ana López")) || !bytes.Contains(data, []byte("January 2023")) {
+		t.Errorf("%s doesn't hold the English text of the statement:\n%s", text, data)
+	}
+
+	// The whole message, to the recipients the statement was delivered to
+	eml := filepath.Join(dir, "statement.eml")
+	if err := p.writeFile(ctx, eml, summaryID, ""); err != nil {
+		t.Fatalf("writeFile: %v", err)
+	}
+	if data, err = os.ReadFile(eml); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("%s isn't an email: %v", eml, err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if subject != i18n.Lookup("es-MX").T("subject") || msg.Header.Get("To") != "<contabilidad@example.com>" || msg.Header.Get("From") != "<statements@example.com>" {
+		t.Errorf("%s is from %q to %q with subject %q", eml, msg.Header.Get("From"), msg.Header.Get("To"), subject)
+	}
+	if mediaType := msg.Header.Get("Content-Type"); !strings.HasPrefix(mediaType, "multipart/alternative") {
+		t.Errorf("%s is %s, want the text and HTML parts", eml, mediaType)
+	}
+
+	// Nothing is written for an unknown extension or summary
+	for name, summaryID := range map[string]int{"statement.pdf": 0, "missing.eml": 999} {
+		err := p.writeFile(ctx, filepath.Join(dir, name), summaryID, "")
+		if !errors.Is(err, apperrors.ErrValidation) && !errors.Is(err, apperrors.ErrNotFound) {
+			t.Errorf("writeFile of %s returned %v, want a validation or not found error", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, name)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("writeFile wrote %s", name)
+		}
+	}
+}
+
+// get requests a page of the preview server and returns its status and body
+func get(t *testing.T, server *httptest.Server, path string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(server.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestPreviewReloadsTemplates(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, "summary.txt"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeTemplate(`First draft for account {{ .Account.AccountID }}`)
+	server := httptest.NewServer((&preview{db: database.NewMemoryRepository(), templateDir: dir}).handler())
+	defer server.Close()
+
+	if status, body := get(t, server, "/email?part=text"); status != http.StatusOK || body != "First draft for account 1" {
+		t.Errorf("text part = %d %q, want the first draft", status, body)
+	}
+	// An edit shows on the next request, without restarting the server
+	writeTemplate(`Second draft for account {{ .Account.AccountID }}`)
+	if status, body := get(t, server, "/email?part=text"); status != http.StatusOK || body != "Second draft for account 1" {
+		t.Errorf("text part after the edit = %d %q, want the second draft", status, body)
+	}
+	// and so does a mistake, as an error on the page
+	writeTemplate(`{{ .Summary.Balance }}`)
+	if status, body := get(t, server, "/email?part=text"); status != http.StatusUnprocessableEntity || !strings.Contains(body, "Balance") {
+		t.Errorf("text part of a broken template = %d %q, want the template error", status, body)
+	}
+	writeTemplate(`Fixed`)
+	if status, body := get(t, server, "/email?part=text"); status != http.StatusOK || body != "Fixed" {
+		t.Errorf("text part after the fix = %d %q", status, body)
+	}
+
+	// The page frames the email the query asks for
+	if status, body := get(t, server, "/?locale=es&part=text"); status != http.StatusOK || !strings.Contains(body, `src="/email?locale=es&amp;part=text"`) {
+		t.Errorf("page = %d, want a frame of the text part in Spanish:\n%s", status, body)
+	}
+	for path, want := range map[string]int{"/missing": http.StatusNotFound, "/?summaryID=abc": http.StatusUnprocessableEntity, "/email?part=pdf": http.StatusUnprocessableEntity} {
+		if status, _ := get(t, server, path); status != want {
+			t.Errorf("GET %s = %d, want %d", path, status, want)
+		}
+	}
+}
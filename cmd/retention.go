@@ -0,0 +1,188 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/controller"
+	"github.com/aldaircoronel/email-summary/internal/models"
+)
+
+// runRetention implements the "retention show|set|clear" command, which manages the retention policy of an account
+func runRetention(args []string) {
+	fs := flag.NewFlagSet("retention", flag.ExitOnError)
+	accountID := fs.Int("accountID", 0, "The account whose retention policy is managed")
+	transactionMonths := fs.Int("transactionMonths", 0, "Months to keep the transactions of the account, 0 keeps them forever")
+	summaryMonths := fs.Int("summaryMonths", 0, "Months to keep the summaries of the account, 0 keeps them forever")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: retention show|set|clear -accountID <id> [flags]")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	action := args[0]
+	fs.Parse(args[1:])
+
+	if *accountID == 0 {
+		usageError("The -accountID flag is required")
+	}
+
+	ctx := context.Background()
+	db, err := openRepository(ctx, os.Getenv("DATABASE_URL"))
+	if err != nil {
+		fatal(err)
+	}
+	defer db.Close()
+
+	ctrl := controller.NewRetentionController(db)
+	switch action {
+	case "show":
+		policy, err := ctrl.GetPolicy(ctx, *accountID)
+		if err != nil {
+			fatal(err)
+		}
+		printRetentionPolicy(policy)
+	case "set":
+		policy, err := ctrl.GetPolicy(ctx, *accountID)
+		if err != nil {
+			fatal(err)
+		}
+		// Only the rules given on the command line change
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "transactionMonths":
+				policy.TransactionMonths = transactionMonths
+			case "summaryMonths":
+				policy.SummaryMonths = summaryMonths
+			}
+		})
+		if err := ctrl.SetPolicy(ctx, policy); err != nil {
+			fatal(err)
+		}
+		printRetentionPolicy(policy)
+	case "clear":
+		if err := ctrl.ClearPolicy(ctx, *accountID); err != nil {
+			fatal(err)
+		}
+		log.Printf("Account %d follows the global retention rules", *accountID)
+	default:
+		usageError("Unknown retention action %q, expected show, set or clear", action)
+	}
+}
+
+// printRetentionPolicy writes the rules of an account to stdout
+func printRetentionPolicy(policy *models.RetentionPolicy) {
+	rule := func(months *int) string {
+		switch {
+		case months == nil:
+			return "global rule"
+		case *months == 0:
+			return "forever"
+		default:
+			return fmt.Sprintf("%d months", *months)
+		}
+	}
+	fmt.Printf("Account:      %d\n", policy.AccountID)
+	fmt.Printf("Transactions: %s\n", rule(policy.TransactionMonths))
+	fmt.Printf("Summaries:    %s\n", rule(policy.SummaryMonths))
+}
+
+// runPurge implements the "purge" command, which deletes the data older than the retention rules
+func runPurge(args []string) {
+	fs := flag.NewFlagSet("purge", flag.ExitOnError)
+	accountID := fs.Int("accountID", 0, "Purge only this account instead of every account")
+	transactionMonths := fs.Int("transactionMonths", envInt("RETENTION_TRANSACTION_MONTHS"), "Global rule: months to keep transactions, 0 keeps them forever")
+	summaryMonths := fs.Int("summaryMonths", envInt("RETENTION_SUMMARY_MONTHS"), "Global rule: months to keep summaries, 0 keeps them forever")
+	dryRun := fs.Bool("dryRun", false, "Only count the rows that would be deleted")
+	archivePath := fs.String("archive", "", "Write the purged rows to this gzip-compressed NDJSON file before deleting them")
+	fs.Parse(args)
+
+	if *dryRun && *archivePath != "" {
+		usageError("The -archive flag can't be used with -dryRun")
+	}
+
+	ctx := context.Background()
+	db, err := openRepository(ctx, os.Getenv("DATABASE_URL"))
+	if err != nil {
+		fatal(err)
+	}
+	defer db.Close()
+
+	opts := controller.PurgeOptions{
+		Rules: controller.RetentionRules{
+			TransactionMonths: *transactionMonths,
+			SummaryMonths:     *summaryMonths,
+		},
+		AccountID: *accountID,
+		DryRun:    *dryRun,
+	}
+
+	// An existing archive is never overwritten
+	var archive *purgeArchive
+	var archiveFile *os.File
+	if *archivePath != "" {
+		archiveFile, err = os.OpenFile(*archivePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			fatal(fmt.Errorf("failed to create archive: %w", err))
+		}
+		archive = &purgeArchive{Writer: gzip.NewWriter(archiveFile), file: archiveFile}
+		opts.Archive = archive
+	}
+
+	result, purgeErr := controller.NewRetentionController(db).Purge(ctx, opts)
+
+	// Close the archive even if the purge failed, it holds the rows deleted so far
+	if archive != nil {
+		if err := archive.Close(); err != nil && purgeErr == nil {
+			purgeErr = fmt.Errorf("failed to write archive: %w", err)
+		}
+		if err := archiveFile.Sync(); err != nil && purgeErr == nil {
+			purgeErr = fmt.Errorf("failed to write archive: %w", err)
+		}
+		if err := archiveFile.Close(); err != nil && purgeErr == nil {
+			purgeErr = fmt.Errorf("failed to write archive: %w", err)
+		}
+	}
+	if purgeErr != nil {
+		fatal(purgeErr)
+	}
+
+	verb := "Purged"
+	if *dryRun {
+		verb = "Would purge"
+	}
+	log.Printf("%s %d transactions, %d summaries and %d month summaries from %d accounts",
+		verb, result.Transactions, result.Summaries, result.MonthSummaries, result.Accounts)
+}
+
+// purgeArchive is the compressed file of a purge. The purge flushes and syncs it before deleting every
+// batch of rows, so rows are only deleted once the archive holding them is on disk.
+type purgeArchive struct {
+	*gzip.Writer
+	file *os.File
+}
+
+func (a *purgeArchive) Sync() error {
+	return a.file.Sync()
+}
+
+// envInt reads an integer setting from the environment, 0 when it isn't set
+func envInt(name string) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		fatal(apperrors.Invalid("invalid %s: %w", name, err))
+	}
+	return n
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/controller"
+	"github.com/aldaircoronel/email-summary/internal/database"
+	"github.com/aldaircoronel/email-summary/internal/models"
+	"github.com/aldaircoronel/email-summary/internal/repository"
+)
+
+// archivedTransactions reads the transaction IDs in the archive file as another process would see it,
+// up to where its compressed stream was flushed
+func archivedTransactions(path string) (map[int]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	ids := make(map[int]bool)
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		// Nothing has been flushed yet
+		return ids, nil
+	}
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		var record controller.ArchivedRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// The line cut where the stream was flushed
+			break
+		}
+		if record.Transaction != nil {
+			ids[record.Transaction.TransactionID] = true
+		}
+	}
+	return ids, nil
+}
+
+// diskCheckingRepository fails the deletes of transactions that aren't in the archive file yet
+type diskCheckingRepository struct {
+	repository.Repository
+	path string
+}
+
+func (r *diskCheckingRepository) DeleteTransactions(ctx context.Context, ids []int) (int, error) {
+	archived, err := archivedTransactions(r.path)
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if !archived[id] {
+			return 0, fmt.Errorf("transaction %d is deleted before it is in the archive file", id)
+		}
+	}
+	return r.Repository.DeleteTransactions(ctx, ids)
+}
+
+func TestPurgeArchiveFile(t *testing.T) {
+	ctx := context.Background()
+	memory := database.NewMemoryRepository()
+	accountID, err := memory.SaveAccount(ctx, &models.Account{HolderName: "Ana López"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id := 1; id <= repository.MaxPageSize+10; id++ {
+		transaction := &models.Transaction{ID: id, Date: time.Date(2020, time.January, 1, 0, id, 0, 0, time.UTC), Amount: 10, AccountID: accountID}
+		if err := memory.SaveTransaction(ctx, transaction); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "purge.ndjson.gz")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := &purgeArchive{Writer: gzip.NewWriter(file), file: file}
+	result, err := controller.NewRetentionController(&diskCheckingRepository{Repository: memory, path: path}).Purge(ctx, controller.PurgeOptions{
+		Rules:   controller.RetentionRules{TransactionMonths: 1},
+		Archive: archive,
+	})
+	if err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if result.Transactions != repository.MaxPageSize+10 {
+		t.Errorf("purged %d transactions, want %d", result.Transactions, repository.MaxPageSize+10)
+	}
+	if archived, err := archivedTransactions(path); err != nil || len(archived) != result.Transactions {
+		t.Errorf("the archive holds %d transactions, %v, want every purged one", len(archived), err)
+	}
+}
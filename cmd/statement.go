@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/controller"
+	"github.com/aldaircoronel/email-summary/internal/models"
+	"github.com/aldaircoronel/email-summary/internal/repository"
+	"github.com/aldaircoronel/email-summary/internal/view"
+)
+
+// runStatements implements the "statements" command, which lists the statement history of an account
+func runStatements(args []string) {
+	fs := flag.NewFlagSet("statements", flag.ExitOnError)
+	accountID := fs.Int("accountID", 0, "The account whose statements are listed")
+	limit := fs.Int("limit", 20, "The number of statements per page")
+	cursor := fs.String("cursor", "", "The cursor printed at the end of the previous page")
+	fs.Parse(args)
+
+	if *accountID == 0 {
+		usageError("The -accountID flag is required")
+	}
+
+	ctx := context.Background()
+	db, err := openRepository(ctx, os.Getenv("DATABASE_URL"))
+	if err != nil {
+		fatal(err)
+	}
+	defer db.Close()
+
+	page, err := controller.NewStatementController(db).ListStatements(ctx, *accountID, repository.SummaryPageRequest{
+		Limit:  *limit,
+		Cursor: *cursor,
+	})
+	if err != nil {
+		fatal(err)
+	}
+
+	for _, s := range page.Summaries {
+		fmt.Printf("%d\t%s\t%s - %s\t%.2f\t%s\n", s.SummaryID, s.GeneratedAt.Format("2006-01-02 15:04:05"),
+			s.PeriodStart.Format("2006-01-02"), s.PeriodEnd.Format("2006-01-02"), s.TotalBalance, strings.Join(s.Recipients, ","))
+	}
+	if page.NextCursor != "" {
+		fmt.Printf("Next page: -cursor %s\n", page.NextCursor)
+	}
+}
+
+// runResend implements the "resend" command, which sends a past statement again exactly as it was delivered
+func runResend(args []string) {
+	fs := flag.NewFlagSet("resend", flag.ExitOnError)
+	summaryID := fs.Int("summaryID", 0, "The summary ID of the statement to re-send")
+	emailTo := fs.String("emailTo", "", "Comma-separated email addresses to send to, instead of the original recipients")
+	fs.Parse(args)
+
+	if *summaryID == 0 {
+		usageError("The -summaryID flag is required")
+	}
+
+	ctx := context.Background()
+	db, err := openRepository(ctx, os.Getenv("DATABASE_URL"))
+	if err != nil {
+		fatal(err)
+	}
+	defer db.Close()
+
+	emailService, err := newEmailService(db)
+	if err != nil {
+		fatal(err)
+	}
+
+	statements := controller.NewStatementController(db)
+	statement, err := statements.GetStatement(ctx, *summaryID)
+	if err != nil {
+		fatal(err)
+	}
+
+	to := statement.Recipients
+	if *emailTo != "" {
+		to = splitList(*emailTo)
+	}
+	if len(to) == 0 {
+		fatal(apperrors.Invalid("statement %d has no recipients, pass the -emailTo flag", *summaryID))
+	}
+
+	// The email is sent again as it was delivered, with its charts and attachments, rather than
+	// rendered from data that may have changed or been purged since
+	var msg *view.Message
+	delivered, err := statements.DeliveredMessage(ctx, statement.SummaryID)
+	switch {
+	case err == nil:
+		if msg, err = view.DecodeOutboxPayload(delivered.Payload); err != nil {
+			fatal(err)
+		}
+	case errors.Is(err, apperrors.ErrNotFound):
+		// Statements archived before emails were queued only kept their text and HTML bodies
+		log.Printf("Statement %d was archived without its images and attachments, re-sending its text and HTML only", *summaryID)
+		msg = &view.Message{
+			From:    os.Getenv("EMAIL_FROM"),
+			Subject: statement.Subject,
+			HTML:    statement.HTMLBody,
+			Text:    statement.TextBody,
+		}
+	default:
+		fatal(err)
+	}
+	msg.To = to
+	msg.Date = time.Time{}
+	msg.MessageID = ""
+
+	payload, err := view.EncodeOutboxPayload(msg)
+	if err != nil {
+		fatal(err)
+	}
+	queued, err := controller.NewOutboxController(db, retryPolicy()).Enqueue(ctx, statement.AccountID, statement.SummaryID, payload)
+	if err != nil {
+		fatal(err)
+	}
+	sent, err := deliverNow(ctx, db, emailService, queued)
+	if err != nil {
+		fatal(err)
+	}
+	if sent {
+		log.Printf("Statement %d re-sent to %s", *summaryID, strings.Join(to, ", "))
+	}
+}
+
+// attachmentKinds returns the attachments a statement email is sent with, from the -attach flag or
+// EMAIL_ATTACHMENTS when the flag is empty. "none" sends no attachment.
+func attachmentKinds(flagValue string) []string {
+	if flagValue == "" {
+		flagValue = os.Getenv("EMAIL_ATTACHMENTS")
+	}
+	if flagValue == "none" {
+		return nil
+	}
+	return splitList(flagValue)
+}
+
+// statementAttachments renders the attachments of a statement email
+func statementAttachments(ctx context.Context, db repository.Repository, kinds []string, account *models.Account, summary *models.Summary, monthSummaries []*models.MonthSummary) ([]view.Attachment, error) {
+	var transactions []*models.Transaction
+	for _, kind := range kinds {
+		if kind == view.AttachmentCSV {
+			var err error
+			if transactions, err = controller.NewStatementController(db).PeriodTransactions(ctx, summary); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	return view.StatementAttachments(kinds, account, summary, monthSummaries, transactions)
+}
@@ -5,3 +5,5 @@ go 1.19
 require github.com/lib/pq v1.10.7
 
 require github.com/joho/godotenv v1.5.1
+
+require github.com/mattn/go-sqlite3 v1.14.16
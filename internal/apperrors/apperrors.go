@@ -0,0 +1,183 @@
+// Package apperrors defines the kinds of errors shared by the repository, controller and view
+// packages, and how the CLI and a future HTTP API report each kind.
+//
+// Errors are wrapped with %w along the way, so callers test their kind with errors.Is:
+//
+//	if errors.Is(err, apperrors.ErrNotFound) { ... }
+package apperrors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Sentinel errors, one per kind
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrValidation = errors.New("validation failed")
+	ErrConflict   = errors.New("conflict")
+	ErrTransient  = errors.New("temporary failure")
+	ErrDelivery   = errors.New("email delivery failed")
+)
+
+// NotFoundError reports that an entity doesn't exist
+type NotFoundError struct {
+	Entity string
+	ID     interface{}
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s with id %v not found", e.Entity, e.ID)
+}
+
+// Is makes errors.Is(err, ErrNotFound) true
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// NotFound returns a NotFoundError for the entity with the given ID
+func NotFound(entity string, id interface{}) error {
+	return &NotFoundError{Entity: entity, ID: id}
+}
+
+// ValidationError reports invalid input: a malformed file, flag or field value
+type ValidationError struct {
+	Message string
+	Err     error
+}
+
+func (e *ValidationError) Error() string {
+	switch {
+	case e.Message == "":
+		return e.Err.Error()
+	case e.Err != nil:
+		return e.Message + ": " + e.Err.Error()
+	default:
+		return e.Message
+	}
+}
+
+// Is makes errors.Is(err, ErrValidation) true
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Invalid returns a ValidationError with a formatted message. A trailing error argument
+// formatted with %w is kept as the cause.
+func Invalid(format string, args ...interface{}) error {
+	return &ValidationError{Err: fmt.Errorf(format, args...)}
+}
+
+// ConflictError reports a change that clashes with the stored data, such as a duplicate key
+// or a row that is still referenced by others
+type ConflictError struct {
+	Err error
+}
+
+func (e *ConflictError) Error() string {
+	return "conflict: " + e.Err.Error()
+}
+
+// Is makes errors.Is(err, ErrConflict) true
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+func (e *ConflictError) Unwrap() error {
+	return e.Err
+}
+
+// TransientError reports a failure that may succeed when retried, such as a lost
+// connection or a serialization failure
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string {
+	return "temporary failure: " + e.Err.Error()
+}
+
+// Is makes errors.Is(err, ErrTransient) true
+func (e *TransientError) Is(target error) bool {
+	return target == ErrTransient
+}
+
+func (e *TransientError) Unwrap() error {
+	return e.Err
+}
+
+// DeliveryError reports that an email couldn't be delivered
+type DeliveryError struct {
+	Err error
+}
+
+func (e *DeliveryError) Error() string {
+	return "failed to send email: " + e.Err.Error()
+}
+
+// Is makes errors.Is(err, ErrDelivery) true
+func (e *DeliveryError) Is(target error) bool {
+	return target == ErrDelivery
+}
+
+func (e *DeliveryError) Unwrap() error {
+	return e.Err
+}
+
+// CLI exit codes of each kind of error
+const (
+	ExitOK         = 0
+	ExitFailure    = 1
+	ExitUsage      = 2
+	ExitNotFound   = 3
+	ExitValidation = 4
+	ExitConflict   = 5
+	ExitDelivery   = 6
+	// Same as EX_TEMPFAIL from sysexits.h, so schedulers know to retry later
+	ExitTransient = 75
+)
+
+// ExitCode returns the CLI exit code for the error
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, ErrTransient):
+		return ExitTransient
+	case errors.Is(err, ErrNotFound):
+		return ExitNotFound
+	case errors.Is(err, ErrValidation):
+		return ExitValidation
+	case errors.Is(err, ErrConflict):
+		return ExitConflict
+	case errors.Is(err, ErrDelivery):
+		return ExitDelivery
+	default:
+		return ExitFailure
+	}
+}
+
+// HTTPStatus returns the HTTP status code an API reports for the error
+func HTTPStatus(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, ErrTransient):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrValidation):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, ErrDelivery):
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aldaircoronel/email-summary/internal/models"
+	"github.com/aldaircoronel/email-summary/internal/repository"
+)
+
+// AccountController defines a controller for managing account profiles.
+type AccountController struct {
+	repo repository.Repository
+}
+
+// NewAccountController creates a new instance of AccountController.
+func NewAccountController(repo repository.Repository) *AccountController {
+	return &AccountController{
+		repo: repo,
+	}
+}
+
+// CreateAccount validates the profile and stores it as a new account
+func (c *AccountController) CreateAccount(ctx context.Context, account *models.Account) (int, error) {
+	if err := account.Validate(); err != nil {
+		return 0, fmt.Errorf("error creating account: %w", err)
+	}
+
+	accountID, err := c.repo.SaveAccount(ctx, account)
+	if err != nil {
+		return 0, fmt.Errorf("error creating account: %w", err)
+	}
+	return accountID, nil
+}
+
+// GetAccount returns the account with the given ID
+func (c *AccountController) GetAccount(ctx context.Context, accountID int) (*models.Account, error) {
+	account, err := c.repo.GetAccountByID(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting account: %w", err)
+	}
+	return account, nil
+}
+
+// ListAccounts returns every account
+func (c *AccountController) ListAccounts(ctx context.Context) ([]*models.Account, error) {
+	accounts, err := c.repo.ListAccounts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing accounts: %w", err)
+	}
+	return accounts, nil
+}
+
+// UpdateAccount validates the profile and stores it over the existing account
+func (c *AccountController) UpdateAccount(ctx context.Context, account *models.Account) error {
+	if err := account.Validate(); err != nil {
+		return fmt.Errorf("error updating account: %w", err)
+	}
+	if err := c.repo.UpdateAccount(ctx, account); err != nil {
+		return fmt.Errorf("error updating account: %w", err)
+	}
+	return nil
+}
+
+// DeleteAccount deletes the account with the given ID
+func (c *AccountController) DeleteAccount(ctx context.Context, accountID int) error {
+	if err := c.repo.DeleteAccount(ctx, accountID); err != nil {
+		return fmt.Errorf("error deleting account: %w", err)
+	}
+	return nil
+}
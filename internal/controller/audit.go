@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/aldaircoronel/email-summary/internal/repository"
+)
+
+// AuditController defines a controller for querying and exporting the audit log.
+type AuditController struct {
+	repo repository.Repository
+}
+
+// NewAuditController creates a new instance of AuditController.
+func NewAuditController(repo repository.Repository) *AuditController {
+	return &AuditController{
+		repo: repo,
+	}
+}
+
+// ListEvents returns one page of the audit events matching the query, oldest first
+func (c *AuditController) ListEvents(ctx context.Context, q repository.AuditQuery) (*repository.AuditPage, error) {
+	page, err := c.repo.ListAuditEvents(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	return page, nil
+}
+
+// Export writes every audit event matching the query to w, one JSON object per line, and returns how many were written.
+// The page size and cursor of the query are ignored.
+func (c *AuditController) Export(ctx context.Context, q repository.AuditQuery, w io.Writer) (int, error) {
+	q.Limit = repository.MaxPageSize
+	q.Cursor = ""
+
+	encoder := json.NewEncoder(w)
+	exported := 0
+	for {
+		page, err := c.repo.ListAuditEvents(ctx, q)
+		if err != nil {
+			return exported, fmt.Errorf("failed to export audit events: %w", err)
+		}
+		for _, event := range page.Events {
+			if err := encoder.Encode(event); err != nil {
+				return exported, fmt.Errorf("failed to export audit events: %w", err)
+			}
+			exported++
+		}
+		if page.NextCursor == "" {
+			return exported, nil
+		}
+		q.Cursor = page.NextCursor
+	}
+}
@@ -2,13 +2,18 @@ package controller
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
 	"github.com/aldaircoronel/email-summary/internal/models"
 	"github.com/aldaircoronel/email-summary/internal/repository"
 )
@@ -27,12 +32,13 @@ func NewTransactionController(repo repository.Repository) *TransactionController
 }
 
 // CreateAccount creates a new account and returns its ID
-func (c *TransactionController) CreateAccount(ctx context.Context) (int, error) {
-	accountID, err := c.repo.SaveAccount(ctx)
-	if err != nil {
-		return 0, fmt.Errorf("error creating account: %v", err)
-	}
-	return accountID, nil
+func (c *TransactionController) CreateAccount(ctx context.Context, account *models.Account) (int, error) {
+	return NewAccountController(c.repo).CreateAccount(ctx, account)
+}
+
+// Account returns the profile of the account stored in the controller
+func (c *TransactionController) Account(ctx context.Context) (*models.Account, error) {
+	return NewAccountController(c.repo).GetAccount(ctx, c.accountID)
 }
 
 // SetAccountID stores the account ID in the controller
@@ -40,28 +46,103 @@ func (c *TransactionController) SetAccountID(accountID int) {
 	c.accountID = accountID
 }
 
+// location returns the time zone of the account stored in the controller
+func (c *TransactionController) location(ctx context.Context) (*time.Location, error) {
+	account, err := c.repo.GetAccountByID(ctx, c.accountID)
+	if err != nil {
+		return nil, err
+	}
+	return account.Location()
+}
+
+// Layouts accepted for the Date column of the CSV file. Layouts without a zone are interpreted in the account time zone.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"1/2/2006 15:04",
+	"1/2/2006",
+}
+
+// yearlessLayout is the month/day layout of files without years. Its dates are resolved to the latest
+// year in which they aren't after the import.
+const yearlessLayout = "1/2"
+
+// parseDate parses a CSV date using the first matching layout. now is the time of the import,
+// which gives dates without a year theirs.
+func parseDate(value string, loc *time.Location, now time.Time) (time.Time, error) {
+	var lastErr error
+	for _, layout := range dateLayouts {
+		date, err := time.ParseInLocation(layout, value, loc)
+		if err == nil {
+			return date, nil
+		}
+		lastErr = err
+	}
+	if date, err := time.ParseInLocation(yearlessLayout, value, loc); err == nil {
+		return resolveYear(date, now.In(loc)), nil
+	}
+	return time.Time{}, lastErr
+}
+
+// resolveYear moves a date parsed without a year to the latest year in which it exists and isn't after
+// now. February 29 goes back to the latest leap year.
+func resolveYear(date time.Time, now time.Time) time.Time {
+	for year := now.Year(); ; year-- {
+		resolved := time.Date(year, date.Month(), date.Day(), date.Hour(), date.Minute(), date.Second(), date.Nanosecond(), date.Location())
+		if resolved.Day() == date.Day() && !resolved.After(now) {
+			return resolved
+		}
+	}
+}
+
 // ProcessCSVFile reads a CSV file from the given file path and inserts its contents into the database
 func (c *TransactionController) ProcessCSVFile(ctx context.Context, filePath string) error {
+	// Dates without a zone belong to the account time zone, and dates without a year to the latest
+	// year up to now
+	now := time.Now()
+	loc, err := c.location(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get account time zone: %w", err)
+	}
+
 	// Open the CSV file
 	file, err := os.Open(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to open file: %v", err)
+		return apperrors.Invalid("failed to open file: %w", err)
 	}
 	defer file.Close()
 
-	// Create a new CSV reader
-	reader := csv.NewReader(file)
+	// Create a new CSV reader, hashing the file as it is read for the audit log
+	checksum := sha256.New()
+	reader := csv.NewReader(io.TeeReader(file, checksum))
 
 	// Set the delimiter to comma
 	reader.Comma = ','
 
+	// Rows may have the optional Category column
+	reader.FieldsPerRecord = -1
+
 	// Skip the first row
 	_, err = reader.Read()
 	if err != nil {
-		return fmt.Errorf("failed to skip first row: %v", err)
+		return apperrors.Invalid("failed to skip first row: %w", err)
+	}
+
+	// Rows the account already has are skipped, so importing a file again doesn't count them twice
+	existing, err := c.repo.GetTransactionByAccountID(ctx, c.accountID)
+	if err != nil {
+		return fmt.Errorf("failed to get account transactions: %w", err)
+	}
+	seen := make(map[int]bool, len(existing))
+	for _, transaction := range existing {
+		seen[transaction.ID] = true
 	}
 
 	// Loop through the remaining rows
+	imported, skipped := 0, 0
 	for {
 		// Read the next row
 		row, err := reader.Read()
@@ -73,41 +154,75 @@ func (c *TransactionController) ProcessCSVFile(ctx context.Context, filePath str
 
 		// Check for other errors
 		if err != nil {
-			return fmt.Errorf("failed to read row: %v", err)
+			return apperrors.Invalid("failed to read row: %w", err)
+		}
+
+		// Rows have any number of columns, so the required ones are checked before reading them
+		line, _ := reader.FieldPos(0)
+		if len(row) < 3 {
+			return apperrors.Invalid("row %d: expected at least 3 columns, got %d", line, len(row))
+		}
+		if row[2] == "" {
+			return apperrors.Invalid("row %d: the amount is empty", line)
 		}
 
 		// Parse the row values
 		id, err := strconv.Atoi(row[0])
 		if err != nil {
-			return fmt.Errorf("failed to parse ID: %v", err)
+			return apperrors.Invalid("row %d: failed to parse ID: %w", line, err)
+		}
+		if seen[id] {
+			skipped++
+			continue
 		}
-		date, err := time.Parse("1/2", row[1])
+		date, err := parseDate(row[1], loc, now)
 		if err != nil {
-			return fmt.Errorf("failed to parse date: %v", err)
+			return apperrors.Invalid("row %d: failed to parse date: %w", line, err)
 		}
 		amount, err := strconv.ParseFloat(row[2], 64)
 		if err != nil {
-			return fmt.Errorf("failed to parse amount: %v", err)
+			return apperrors.Invalid("row %d: failed to parse amount: %w", line, err)
 		}
 		isCredit := false
 		if row[2][0] == '+' {
 			isCredit = true
 		}
 
+		// The Category column is optional
+		category := ""
+		if len(row) > 3 {
+			category = strings.TrimSpace(row[3])
+		}
+
 		// Create a new transaction object
 		transaction := &models.Transaction{
 			ID:        id,
 			Date:      date,
 			Amount:    amount,
 			IsCredit:  isCredit,
+			Category:  category,
 			AccountID: c.accountID,
 		}
 
 		// Save the transaction to the database
 		err = c.repo.SaveTransaction(ctx, transaction)
 		if err != nil {
-			return fmt.Errorf("failed to save transaction: %v", err)
+			return fmt.Errorf("failed to save transaction: %w", err)
 		}
+		seen[id] = true
+		imported++
+	}
+
+	// Record which file was imported into the account
+	err = c.repo.SaveAuditEvent(ctx, &models.AuditEvent{
+		Action:    models.AuditImport,
+		Entity:    "csv_file",
+		EntityID:  filePath,
+		AfterHash: hex.EncodeToString(checksum.Sum(nil)),
+		Details:   fmt.Sprintf("%d transactions into account %d, %d already imported", imported, c.accountID, skipped),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record import: %w", err)
 	}
 
 	return nil
@@ -117,6 +232,10 @@ func (c *TransactionController) ProcessCSVFile(ctx context.Context, filePath str
 This function takes a slice of *models.Transaction and returns a pointer to models.Summary and an error. It computes summary statistics for all transactions in the slice, including total balance, total transactions, number of credit and debit transactions, and average credit and debit amounts. If successful, it returns a pointer to the computed models.Summary and a nil error. If there was an error, it returns a nil pointer and an error.
 */
 func computeSummary(transactions []*models.Transaction) (*models.Summary, error) {
+	if len(transactions) == 0 {
+		return nil, apperrors.Invalid("there are no transactions to summarize")
+	}
+
 	var totalBalance, totalCredit, totalDebit float64
 	var totalTransactions, numCreditTransactions, numDebitTransactions int
 
@@ -143,6 +262,17 @@ func computeSummary(transactions []*models.Transaction) (*models.Summary, error)
 		totalAverageDebit = totalDebit / float64(numDebitTransactions)
 	}
 
+	// The statement period spans from the first to the last transaction
+	periodStart, periodEnd := transactions[0].Date, transactions[0].Date
+	for _, transaction := range transactions {
+		if transaction.Date.Before(periodStart) {
+			periodStart = transaction.Date
+		}
+		if transaction.Date.After(periodEnd) {
+			periodEnd = transaction.Date
+		}
+	}
+
 	summary := &models.Summary{
 		AccountID:               transactions[0].AccountID,
 		TotalBalance:            totalBalance,
@@ -151,21 +281,24 @@ func computeSummary(transactions []*models.Transaction) (*models.Summary, error)
 		NumOfDebitTransactions:  numDebitTransactions,
 		TotalAverageCredit:      totalAverageCredit,
 		TotalAverageDebit:       totalAverageDebit,
+		PeriodStart:             periodStart,
+		PeriodEnd:               periodEnd,
+		GeneratedAt:             time.Now(),
 	}
 
 	return summary, nil
 }
 
 /*
-This function takes a slice of *models.Transaction and returns a slice of *models.MonthSummary and an error. It computes summary statistics for each month in the transactions, including total balance, total transactions, number of credit and debit transactions, and average credit and debit amounts. If successful, it returns a slice of pointers to the computed models.MonthSummary structs and a nil error. If there was an error, it returns a nil slice and an error.
+This function takes a slice of *models.Transaction and the account time zone and returns a slice of *models.MonthSummary and an error. It computes summary statistics for each month in the transactions, as seen from the account time zone, including total balance, total transactions, number of credit and debit transactions, and average credit and debit amounts. If successful, it returns a slice of pointers to the computed models.MonthSummary structs and a nil error. If there was an error, it returns a nil slice and an error.
 */
-func computeMonthSummaries(transactions []*models.Transaction) ([]*models.MonthSummary, error) {
+func computeMonthSummaries(transactions []*models.Transaction, loc *time.Location) ([]*models.MonthSummary, error) {
 	// Create a map to hold the month summaries
 	monthSummaries := make(map[string]*models.MonthSummary)
 
 	// Iterate over the transactions and add them to the month summaries
 	for _, transaction := range transactions {
-		month := transaction.Date.Month().String() // Get the month name
+		month := transaction.Date.In(loc).Format(models.MonthLayout) // Get the year and month in the account time zone
 
 		// Check if a month summary already exists for this month
 		if _, ok := monthSummaries[month]; !ok {
@@ -199,11 +332,12 @@ func computeMonthSummaries(transactions []*models.Transaction) ([]*models.MonthS
 		}
 	}
 
-	// Convert the map to a slice of month summaries and return it
+	// Convert the map to a slice of month summaries, in chronological order, and return it
 	result := make([]*models.MonthSummary, 0, len(monthSummaries))
 	for _, monthSummary := range monthSummaries {
 		result = append(result, monthSummary)
 	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Month < result[j].Month })
 	return result, nil
 }
 
@@ -217,31 +351,37 @@ func (tc *TransactionController) GenerateEmailSummary(ctx context.Context) (*mod
 	// Get all transactions for the account from the repository
 	transactions, err := tc.repo.GetTransactionByAccountID(ctx, accountID)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get transactions for account %d: %v", accountID, err)
+		return nil, nil, fmt.Errorf("failed to get transactions for account %d: %w", accountID, err)
 	}
 
 	// Compute the summary statistics for all transactions
 	summary, err := computeSummary(transactions)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to compute summary: %v", err)
+		return nil, nil, fmt.Errorf("failed to compute summary: %w", err)
 	}
 
 	// Save the summary to the repository
 	if err := tc.repo.SaveSummary(ctx, summary); err != nil {
-		return nil, nil, fmt.Errorf("failed to save summary: %v", err)
+		return nil, nil, fmt.Errorf("failed to save summary: %w", err)
+	}
+
+	// Transactions are assigned to months in the account time zone
+	loc, err := tc.location(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get account time zone: %w", err)
 	}
 
 	// Compute the month summary statistics for each month
-	monthSummaries, err := computeMonthSummaries(transactions)
+	monthSummaries, err := computeMonthSummaries(transactions, loc)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to compute month summaries: %v", err)
+		return nil, nil, fmt.Errorf("failed to compute month summaries: %w", err)
 	}
 
 	// Save the month summaries to the repository
 	summaryID := summary.SummaryID
 	for _, monthSummary := range monthSummaries {
 		if err := tc.repo.SaveMonthSummary(ctx, monthSummary, summaryID); err != nil {
-			return nil, nil, fmt.Errorf("failed to save month summary: %v", err)
+			return nil, nil, fmt.Errorf("failed to save month summary: %w", err)
 		}
 	}
 
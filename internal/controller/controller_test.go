@@ -0,0 +1,194 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/database"
+	"github.com/aldaircoronel/email-summary/internal/models"
+	"github.com/aldaircoronel/email-summary/internal/repository"
+)
+
+// mexicoCity observed daylight saving time until October 2022: it began on April 3 at 2:00 and ended
+// on October 30 at 2:00
+func mexicoCity(t *testing.T) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation("America/Mexico_City")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+	return loc
+}
+
+func TestParseDate(t *testing.T) {
+	loc := mexicoCity(t)
+	now := time.Date(2023, time.June, 15, 12, 0, 0, 0, loc)
+
+	tests := []struct {
+		name  string
+		value string
+		want  time.Time
+	}{
+		{"31st at 23:30", "2022-03-31 23:30", time.Date(2022, time.April, 1, 5, 30, 0, 0, time.UTC)},
+		{"day DST begins, before the switch", "2022-04-03 01:30", time.Date(2022, time.April, 3, 7, 30, 0, 0, time.UTC)},
+		{"day DST begins, after the switch", "2022-04-03 03:30", time.Date(2022, time.April, 3, 8, 30, 0, 0, time.UTC)},
+		{"day DST ends, after the switch", "2022-10-30 23:30", time.Date(2022, time.October, 31, 5, 30, 0, 0, time.UTC)},
+		{"with a zone", "2022-10-31T05:30:00Z", time.Date(2022, time.October, 31, 5, 30, 0, 0, time.UTC)},
+		{"US layout", "12/31/2022 23:30", time.Date(2023, time.January, 1, 5, 30, 0, 0, time.UTC)},
+		{"without a year, earlier this year", "1/31", time.Date(2023, time.January, 31, 6, 0, 0, 0, time.UTC)},
+		{"without a year, later than now", "7/15", time.Date(2022, time.July, 15, 5, 0, 0, 0, time.UTC)},
+		{"without a year, today", "6/15", time.Date(2023, time.June, 15, 6, 0, 0, 0, time.UTC)},
+		{"without a year, leap day", "2/29", time.Date(2020, time.February, 29, 6, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDate(tt.value, loc, now)
+			if err != nil {
+				t.Fatalf("parseDate(%q): %v", tt.value, err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseDate(%q) = %v, want %v", tt.value, got, tt.want.In(loc))
+			}
+		})
+	}
+
+	for _, value := range []string{"", "31/12", "2/30", "2022-13-01"} {
+		if got, err := parseDate(value, loc, now); err == nil {
+			t.Errorf("parseDate(%q) = %v, want an error", value, got)
+		}
+	}
+}
+
+func TestComputeMonthSummaries(t *testing.T) {
+	loc := mexicoCity(t)
+	at := func(value string) time.Time {
+		t.Helper()
+		date, err := parseDate(value, loc, time.Date(2023, time.June, 15, 12, 0, 0, 0, loc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return date
+	}
+
+	transactions := []*models.Transaction{
+		// In UTC these are in April and November, in the account time zone still in March and October
+		{Date: at("2022-03-31 23:30"), Amount: 10, IsCredit: true},
+		{Date: at("2022-10-30 23:30"), Amount: 4},
+		// The same month of different years
+		{Date: at("2023-03-01"), Amount: 20, IsCredit: true},
+		{Date: at("2023-03-31 23:30"), Amount: 30, IsCredit: true},
+		{Date: at("2022-04-03 03:30"), Amount: 6},
+		{Date: at("2022-04-03 01:30"), Amount: 8, IsCredit: true},
+	}
+	got, err := computeMonthSummaries(transactions, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []models.MonthSummary{
+		{Month: "2022-03", TotalBalance: 10, TotalTransactions: 1, NumOfCreditTransactions: 1, AverageCredit: 10},
+		{Month: "2022-04", TotalBalance: 2, TotalTransactions: 2, NumOfCreditTransactions: 1, NumOfDebitTransactions: 1, AverageCredit: 8, AverageDebit: 6},
+		{Month: "2022-10", TotalBalance: -4, TotalTransactions: 1, NumOfDebitTransactions: 1, AverageDebit: 4},
+		{Month: "2023-03", TotalBalance: 50, TotalTransactions: 2, NumOfCreditTransactions: 2, AverageCredit: 25},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d month summaries, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if *got[i] != want[i] {
+			t.Errorf("month summary %d = %+v, want %+v", i, *got[i], want[i])
+		}
+	}
+}
+
+// newTestAccount creates an account in the repository and returns its ID
+func newTestAccount(t *testing.T, repo repository.Repository) int {
+	t.Helper()
+	accountID, err := NewAccountController(repo).CreateAccount(context.Background(), &models.Account{
+		HolderName: "Ana López",
+		Emails:     []string{"ana@example.com"},
+		Currency:   "MXN",
+		Locale:     "es",
+		TimeZone:   "America/Mexico_City",
+	})
+	if err != nil {
+		t.Fatalf("CreateAccount: %v", err)
+	}
+	return accountID
+}
+
+// writeCSV writes a transactions file with the header of sample/txns.csv and the given rows
+func writeCSV(t *testing.T, rows ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "txns.csv")
+	content := "Id,Date,Transaction,Category\n" + strings.Join(rows, "\n") + "\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestProcessCSVFile(t *testing.T) {
+	ctx := context.Background()
+	repo := database.NewMemoryRepository()
+	c := NewTransactionController(repo)
+	c.SetAccountID(newTestAccount(t, repo))
+
+	if err := c.ProcessCSVFile(ctx, writeCSV(t, "0,2022-07-15,+60.5,salary", "1,2022-07-28,-10.3", "2,2022-08-02,-20.46, groceries ")); err != nil {
+		t.Fatalf("ProcessCSVFile: %v", err)
+	}
+	transactions, err := repo.GetTransactionByAccountID(ctx, c.accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transactions) != 3 {
+		t.Fatalf("imported %d transactions, want 3", len(transactions))
+	}
+	byID := make(map[int]*models.Transaction)
+	for _, transaction := range transactions {
+		byID[transaction.ID] = transaction
+	}
+	if tr := byID[0]; !tr.IsCredit || tr.Amount != 60.5 || tr.Category != "salary" {
+		t.Errorf("transaction 0 = %+v, want a 60.5 credit in salary", *tr)
+	}
+	if tr := byID[1]; tr.IsCredit || tr.Amount != -10.3 || tr.Category != "" {
+		t.Errorf("transaction 1 = %+v, want a -10.3 debit without category", *tr)
+	}
+	if tr := byID[2]; tr.Category != "groceries" {
+		t.Errorf("transaction 2 category = %q, want it trimmed", tr.Category)
+	}
+}
+
+func TestProcessCSVFileInvalidRows(t *testing.T) {
+	tests := []struct {
+		name string
+		row  string
+		want string
+	}{
+		{"short row", "1,7/28", "row 3: expected at least 3 columns, got 2"},
+		{"ID only", "1", "row 3: expected at least 3 columns, got 1"},
+		{"empty amount", "1,7/28,", "row 3: the amount is empty"},
+		{"empty amount with a category", "1,7/28,,groceries", "row 3: the amount is empty"},
+		{"invalid amount", "1,7/28,ten", "row 3: failed to parse amount"},
+		{"invalid date", "1,28/7,+10", "row 3: failed to parse date"},
+		{"invalid ID", "one,7/28,+10", "row 3: failed to parse ID"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := database.NewMemoryRepository()
+			c := NewTransactionController(repo)
+			c.SetAccountID(newTestAccount(t, repo))
+
+			err := c.ProcessCSVFile(context.Background(), writeCSV(t, "0,7/15,+60.5", tt.row))
+			if !errors.Is(err, apperrors.ErrValidation) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ProcessCSVFile returned %v, want a validation error with %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package controller
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/models"
+	"github.com/aldaircoronel/email-summary/internal/repository"
+)
+
+// ErrErasureLogTampered is returned by VerifyErasureLog when a record of the log was changed or removed
+var ErrErasureLogTampered = errors.New("erasure log has been tampered with")
+
+// ErasureRequest describes the erasure of the personal data of an account
+type ErasureRequest struct {
+	AccountID int
+	// Mode is models.ErasureDelete or models.ErasurePseudonymize
+	Mode        string
+	Reason      string
+	RequestedBy string
+}
+
+// ErasureResult reports what an erasure changed
+type ErasureResult struct {
+	Record *models.ErasureRecord
+
+	// Transactions deleted, only by models.ErasureDelete
+	Transactions int
+	// Statements whose delivered content was wiped
+	Statements int
+	// Outbox messages deleted, sent or not
+	Messages int
+}
+
+// ErasureController defines a controller for erasing the personal data of an account.
+type ErasureController struct {
+	repo repository.Repository
+}
+
+// NewErasureController creates a new instance of ErasureController.
+func NewErasureController(repo repository.Repository) *ErasureController {
+	return &ErasureController{
+		repo: repo,
+	}
+}
+
+// Erase removes or pseudonymizes the personal data of an account: its holder name and contact
+// emails, and the subject, body and recipients of its delivered statements. Its outbox messages are
+// deleted, so none is delivered anymore. The summary and month summary figures are kept for
+// reporting, now anonymous. The delete mode also removes the raw transactions. The account is closed, and the erasure is appended to the erasure log.
+//
+// The erasure runs in one transaction, so the log never records an erasure that was left halfway.
+// Erasing an account twice is harmless.
+func (c *ErasureController) Erase(ctx context.Context, req ErasureRequest) (*ErasureResult, error) {
+	if req.Mode != models.ErasureDelete && req.Mode != models.ErasurePseudonymize {
+		return nil, apperrors.Invalid("invalid erasure mode %q, expected %s or %s", req.Mode, models.ErasureDelete, models.ErasurePseudonymize)
+	}
+	if req.RequestedBy == "" {
+		return nil, apperrors.Invalid("an erasure needs the name of whoever requested it")
+	}
+
+	pseudonym, err := newPseudonymizer()
+	if err != nil {
+		return nil, fmt.Errorf("failed to erase account %d: %w", req.AccountID, err)
+	}
+	var result *ErasureResult
+	err = c.repo.InTx(ctx, func(tx repository.Repository) error {
+		var err error
+		result, err = erase(ctx, tx, req, pseudonym)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// erase makes the changes of the erasure and logs it
+func erase(ctx context.Context, repo repository.Repository, req ErasureRequest, pseudonym func(value string) string) (*ErasureResult, error) {
+	account, err := repo.GetAccountByID(ctx, req.AccountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to erase account: %w", err)
+	}
+
+	result := &ErasureResult{}
+	if req.Mode == models.ErasureDelete {
+		account.HolderName = ""
+		account.Emails = nil
+	} else {
+		if account.HolderName != "" {
+			account.HolderName = "pseudonym-" + pseudonym(account.HolderName)
+		}
+		for i, email := range account.Emails {
+			account.Emails[i] = pseudonym(email) + "@erased.invalid"
+		}
+	}
+	account.Status = models.AccountClosed
+	if err := repo.UpdateAccount(ctx, account); err != nil {
+		return nil, fmt.Errorf("failed to erase account %d: %w", req.AccountID, err)
+	}
+
+	if result.Statements, err = wipeStatements(ctx, repo, req.AccountID); err != nil {
+		return nil, fmt.Errorf("failed to erase statements of account %d: %w", req.AccountID, err)
+	}
+	if result.Messages, err = deleteOutboxMessages(ctx, repo, req.AccountID); err != nil {
+		return nil, fmt.Errorf("failed to erase outbox messages of account %d: %w", req.AccountID, err)
+	}
+	if req.Mode == models.ErasureDelete {
+		if result.Transactions, err = deleteTransactions(ctx, repo, req.AccountID); err != nil {
+			return nil, fmt.Errorf("failed to erase transactions of account %d: %w", req.AccountID, err)
+		}
+	}
+
+	result.Record = &models.ErasureRecord{
+		AccountID:   req.AccountID,
+		Mode:        req.Mode,
+		Reason:      req.Reason,
+		RequestedBy: req.RequestedBy,
+	}
+	if err := repo.AppendErasureRecord(ctx, result.Record); err != nil {
+		return nil, fmt.Errorf("failed to log erasure of account %d: %w", req.AccountID, err)
+	}
+	return result, nil
+}
+
+// wipeStatements clears the delivered content of the statements of the account, which holds the holder name and addresses
+func wipeStatements(ctx context.Context, repo repository.Repository, accountID int) (int, error) {
+	wiped := 0
+	request := repository.SummaryPageRequest{Limit: repository.MaxPageSize}
+	for {
+		page, err := repo.ListSummariesByAccount(ctx, accountID, request)
+		if err != nil {
+			return wiped, err
+		}
+		for _, summary := range page.Summaries {
+			if summary.Subject == "" && summary.HTMLBody == "" && summary.TextBody == "" && len(summary.Recipients) == 0 {
+				continue
+			}
+			summary.Subject = ""
+			summary.HTMLBody = ""
+			summary.TextBody = ""
+			summary.Recipients = nil
+			if err := repo.SaveSummaryContent(ctx, summary); err != nil {
+				return wiped, err
+			}
+			wiped++
+		}
+		if page.NextCursor == "" {
+			return wiped, nil
+		}
+		request.Cursor = page.NextCursor
+	}
+}
+
+// deleteOutboxMessages deletes every outbox message of the account, which hold its name and addresses
+func deleteOutboxMessages(ctx context.Context, repo repository.Repository, accountID int) (int, error) {
+	deleted := 0
+	query := repository.OutboxQuery{AccountID: accountID, Limit: repository.MaxPageSize}
+	for {
+		page, err := repo.ListOutboxMessages(ctx, query)
+		if err != nil {
+			return deleted, err
+		}
+		ids := make([]int, len(page.Messages))
+		for i, msg := range page.Messages {
+			ids[i] = msg.OutboxID
+		}
+		n, err := repo.DeleteOutboxMessages(ctx, ids)
+		if err != nil {
+			return deleted, err
+		}
+		deleted += n
+		if page.NextCursor == "" {
+			return deleted, nil
+		}
+		query.Cursor = page.NextCursor
+	}
+}
+
+// deleteTransactions deletes every transaction of the account
+func deleteTransactions(ctx context.Context, repo repository.Repository, accountID int) (int, error) {
+	deleted := 0
+	query := repository.TransactionQuery{AccountID: accountID, SortBy: repository.SortByID, Limit: repository.MaxPageSize}
+	for {
+		page, err := repo.QueryTransactions(ctx, query)
+		if err != nil {
+			return deleted, err
+		}
+		ids := make([]int, len(page.Transactions))
+		for i, trx := range page.Transactions {
+			ids[i] = trx.TransactionID
+		}
+		n, err := repo.DeleteTransactions(ctx, ids)
+		if err != nil {
+			return deleted, err
+		}
+		deleted += n
+		if page.NextCursor == "" {
+			return deleted, nil
+		}
+		query.Cursor = page.NextCursor
+	}
+}
+
+// newPseudonymizer returns a function that maps values to pseudonyms with a random key that is
+// never stored, so the pseudonyms can't be reversed or recomputed from the original values
+func newPseudonymizer() (func(value string) string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate pseudonym key: %w", err)
+	}
+	return func(value string) string {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(value))
+		return hex.EncodeToString(mac.Sum(nil))[:16]
+	}, nil
+}
+
+// VerifyErasureLog checks the hash chain of the erasure log and returns its records.
+// It fails with ErrErasureLogTampered at the first record that doesn't match.
+func (c *ErasureController) VerifyErasureLog(ctx context.Context) ([]*models.ErasureRecord, error) {
+	records, err := c.repo.ListErasureRecords(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify erasure log: %w", err)
+	}
+
+	prevHash := models.GenesisHash
+	for _, record := range records {
+		if record.PrevHash != prevHash {
+			return records, fmt.Errorf("%w: record %d doesn't follow the previous one", ErrErasureLogTampered, record.ErasureID)
+		}
+		if record.ComputeHash() != record.Hash {
+			return records, fmt.Errorf("%w: record %d was modified", ErrErasureLogTampered, record.ErasureID)
+		}
+		prevHash = record.Hash
+	}
+	return records, nil
+}
@@ -0,0 +1,319 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/database"
+	"github.com/aldaircoronel/email-summary/internal/models"
+	"github.com/aldaircoronel/email-summary/internal/repository"
+)
+
+// newErasureTestAccount stores an account with two transactions, a delivered statement with one
+// month summary and a queued email
+func newErasureTestAccount(t *testing.T, repo repository.Repository) int {
+	t.Helper()
+	ctx := context.Background()
+	accountID := newTestAccount(t, repo)
+	saveTransactions(t, repo, accountID,
+		time.Date(2023, time.January, 9, 0, 0, 0, 0, time.UTC),
+		time.Date(2023, time.February, 14, 0, 0, 0, 0, time.UTC),
+	)
+	summaryID := saveSummary(t, repo, accountID, time.Date(2023, time.March, 1, 0, 0, 0, 0, time.UTC), "2023-01")
+	content := &models.Summary{
+		SummaryID:  summaryID,
+		Subject:    "Estado de cuenta de Ana López",
+		HTMLBody:   "<p>Hola Ana López</p>",
+		TextBody:   "Hola Ana López",
+		Recipients: []string{"ana@example.com"},
+	}
+	if err := repo.SaveSummaryContent(ctx, content); err != nil {
+		t.Fatalf("SaveSummaryContent: %v", err)
+	}
+	if err := repo.EnqueueMessage(ctx, &models.OutboxMessage{AccountID: accountID, Payload: []byte("To: ana@example.com")}); err != nil {
+		t.Fatalf("EnqueueMessage: %v", err)
+	}
+	return accountID
+}
+
+// checkStatementsWiped fails unless the account keeps its summary figures without the delivered statement
+func checkStatementsWiped(t *testing.T, repo repository.Repository, accountID int) {
+	t.Helper()
+	ctx := context.Background()
+	summary, err := repo.GetSummaryByAccountID(ctx, accountID)
+	if err != nil {
+		t.Fatalf("GetSummaryByAccountID: %v", err)
+	}
+	if summary.Subject != "" || summary.HTMLBody != "" || summary.TextBody != "" || len(summary.Recipients) != 0 {
+		t.Errorf("the statement still holds %q, %q, %q and %v", summary.Subject, summary.HTMLBody, summary.TextBody, summary.Recipients)
+	}
+	if summary.TotalTransactions != 1 {
+		t.Errorf("the summary figures were changed: %+v", summary)
+	}
+	if months, err := repo.GetMonthSummaryBySummaryID(ctx, summary.SummaryID); err != nil || len(months) != 1 {
+		t.Errorf("%d month summaries remain, %v, want the one stored", len(months), err)
+	}
+	page, err := repo.ListOutboxMessages(ctx, repository.OutboxQuery{AccountID: accountID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Messages) != 0 {
+		t.Errorf("%d outbox messages remain", len(page.Messages))
+	}
+}
+
+func TestEraseDelete(t *testing.T) {
+	ctx := context.Background()
+	repo := database.NewMemoryRepository()
+	accountID := newErasureTestAccount(t, repo)
+
+	result, err := NewErasureController(repo).Erase(ctx, ErasureRequest{
+		AccountID:   accountID,
+		Mode:        models.ErasureDelete,
+		Reason:      "Deletion request #123",
+		RequestedBy: "dpo",
+	})
+	if err != nil {
+		t.Fatalf("Erase: %v", err)
+	}
+	if result.Transactions != 2 || result.Statements != 1 || result.Messages != 1 {
+		t.Errorf("Erase = %+v, want 2 transactions, 1 statement and 1 message", result)
+	}
+
+	account, err := repo.GetAccountByID(ctx, accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.HolderName != "" || len(account.Emails) != 0 || account.Status != models.AccountClosed {
+		t.Errorf("erased account = %+v, want a closed account without name or emails", account)
+	}
+	if ids := remainingTransactions(t, repo, accountID); len(ids) != 0 {
+		t.Errorf("transactions %v remain", ids)
+	}
+	checkStatementsWiped(t, repo, accountID)
+
+	records, err := NewErasureController(repo).VerifyErasureLog(ctx)
+	if err != nil {
+		t.Fatalf("VerifyErasureLog: %v", err)
+	}
+	if len(records) != 1 || records[0].AccountID != accountID || records[0].Mode != models.ErasureDelete || records[0].RequestedBy != "dpo" {
+		t.Errorf("erasure log = %+v, want the erasure of account %d", records, accountID)
+	}
+}
+
+func TestErasePseudonymize(t *testing.T) {
+	ctx := context.Background()
+	repo := database.NewMemoryRepository()
+	accountID := newErasureTestAccount(t, repo)
+
+	result, err := NewErasureController(repo).Erase(ctx, ErasureRequest{
+		AccountID:   accountID,
+		Mode:        models.ErasurePseudonymize,
+		RequestedBy: "dpo",
+	})
+	if err != nil {
+		t.Fatalf("Erase: %v", err)
+	}
+	if result.Transactions != 0 || result.Statements != 1 || result.Messages != 1 {
+		t.Errorf("Erase = %+v, want no transactions, 1 statement and 1 message", result)
+	}
+
+	account, err := repo.GetAccountByID(ctx, accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(account.HolderName, "pseudonym-") || strings.Contains(account.HolderName, "Ana") {
+		t.Errorf("holder name = %q, want a pseudonym", account.HolderName)
+	}
+	if len(account.Emails) != 1 || !strings.HasSuffix(account.Emails[0], "@erased.invalid") || strings.Contains(account.Emails[0], "ana") {
+		t.Errorf("emails = %v, want one pseudonym", account.Emails)
+	}
+	if account.Status != models.AccountClosed {
+		t.Errorf("status = %q, want %q", account.Status, models.AccountClosed)
+	}
+	if ids := remainingTransactions(t, repo, accountID); len(ids) != 2 {
+		t.Errorf("transactions %v remain, want both kept", ids)
+	}
+	checkStatementsWiped(t, repo, accountID)
+
+	// The key of the pseudonyms isn't kept, so erasing the same data again gives other pseudonyms
+	other := newTestAccount(t, repo)
+	if _, err := NewErasureController(repo).Erase(ctx, ErasureRequest{AccountID: other, Mode: models.ErasurePseudonymize, RequestedBy: "dpo"}); err != nil {
+		t.Fatalf("Erase: %v", err)
+	}
+	if again, err := repo.GetAccountByID(ctx, other); err != nil || again.HolderName == account.HolderName {
+		t.Errorf("the same name got the pseudonym %q twice, %v", account.HolderName, err)
+	}
+}
+
+// failingErasureLog fails to append to the erasure log, the last step of an erasure
+type failingErasureLog struct {
+	repository.Repository
+}
+
+func (r failingErasureLog) InTx(ctx context.Context, fn func(repo repository.Repository) error) error {
+	return r.Repository.InTx(ctx, func(tx repository.Repository) error {
+		return fn(failingErasureLog{tx})
+	})
+}
+
+func (r failingErasureLog) AppendErasureRecord(ctx context.Context, record *models.ErasureRecord) error {
+	return errors.New("erasure log unavailable")
+}
+
+func TestEraseRollsBack(t *testing.T) {
+	sqlite, drop, err := database.OpenDisposable(context.Background(), "sqlite://", database.Options{})
+	if err != nil {
+		t.Fatalf("OpenDisposable: %v", err)
+	}
+	defer drop()
+
+	for name, repo := range map[string]repository.Repository{"memory": database.NewMemoryRepository(), "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			accountID := newErasureTestAccount(t, repo)
+
+			_, err := NewErasureController(failingErasureLog{repo}).Erase(ctx, ErasureRequest{AccountID: accountID, Mode: models.ErasureDelete, RequestedBy: "dpo"})
+			if err == nil || !strings.Contains(err.Error(), "erasure log unavailable") {
+				t.Fatalf("Erase returned %v, want the error of the erasure log", err)
+			}
+
+			// Nothing is erased without its record in the log
+			account, err := repo.GetAccountByID(ctx, accountID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if account.HolderName != "Ana López" || account.Status == models.AccountClosed {
+				t.Errorf("account = %+v after the failed erasure, want it unchanged", account)
+			}
+			if ids := remainingTransactions(t, repo, accountID); len(ids) != 2 {
+				t.Errorf("transactions %v remain, want both", ids)
+			}
+			summary, err := repo.GetSummaryByAccountID(ctx, accountID)
+			if err != nil || summary.Subject == "" {
+				t.Errorf("the statement was wiped by the failed erasure: %+v, %v", summary, err)
+			}
+			page, err := repo.ListOutboxMessages(ctx, repository.OutboxQuery{AccountID: accountID})
+			if err != nil || len(page.Messages) != 1 {
+				t.Errorf("the outbox message was deleted by the failed erasure, %v", err)
+			}
+		})
+	}
+}
+
+func TestEraseAuditEventsHoldNoPersonalData(t *testing.T) {
+	ctx := context.Background()
+	memory := database.NewMemoryRepository()
+	repo := repository.NewAuditedRepository(memory, "dpo")
+	accountID := newErasureTestAccount(t, repo)
+	before, err := memory.GetAccountByID(ctx, accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewErasureController(repo).Erase(ctx, ErasureRequest{AccountID: accountID, Mode: models.ErasureDelete, RequestedBy: "dpo"}); err != nil {
+		t.Fatalf("Erase: %v", err)
+	}
+
+	// A plain hash of the account would let anyone confirm a guess of the erased name and emails
+	data, err := json.Marshal(before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	plain := hex.EncodeToString(sum[:])
+	guess := *before
+	guess.HolderName = "Someone Else"
+	guess.Emails = []string{"someone@example.com"}
+	if models.StateHash(&guess) != models.StateHash(before) {
+		t.Errorf("the audited state of an account depends on its name and emails")
+	}
+
+	page, err := memory.ListAuditEvents(ctx, repository.AuditQuery{Entity: "account", EntityID: strconv.Itoa(accountID), Limit: repository.MaxPageSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Events) == 0 {
+		t.Fatal("the erasure of the account wasn't audited")
+	}
+	for _, event := range page.Events {
+		if event.BeforeHash == plain || event.AfterHash == plain {
+			t.Errorf("audit event %d holds the plain hash of the account", event.EventID)
+		}
+	}
+}
+
+// tamperedErasureLog returns the erasure log as changed by edit
+type tamperedErasureLog struct {
+	repository.Repository
+	edit func(records []*models.ErasureRecord) []*models.ErasureRecord
+}
+
+func (r tamperedErasureLog) ListErasureRecords(ctx context.Context) ([]*models.ErasureRecord, error) {
+	records, err := r.Repository.ListErasureRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.edit(records), nil
+}
+
+func TestVerifyErasureLog(t *testing.T) {
+	ctx := context.Background()
+	repo := database.NewMemoryRepository()
+	for i := 0; i < 3; i++ {
+		accountID := newTestAccount(t, repo)
+		if _, err := NewErasureController(repo).Erase(ctx, ErasureRequest{AccountID: accountID, Mode: models.ErasureDelete, RequestedBy: "dpo"}); err != nil {
+			t.Fatalf("Erase: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		edit func(records []*models.ErasureRecord) []*models.ErasureRecord
+		want string
+	}{
+		{"intact", func(records []*models.ErasureRecord) []*models.ErasureRecord {
+			return records
+		}, ""},
+		{"modified reason", func(records []*models.ErasureRecord) []*models.ErasureRecord {
+			records[1].Reason = "changed"
+			return records
+		}, "record 2 was modified"},
+		{"modified and rehashed", func(records []*models.ErasureRecord) []*models.ErasureRecord {
+			records[1].AccountID = 99
+			records[1].Hash = records[1].ComputeHash()
+			return records
+		}, "record 3 doesn't follow the previous one"},
+		{"reordered", func(records []*models.ErasureRecord) []*models.ErasureRecord {
+			records[1], records[2] = records[2], records[1]
+			return records
+		}, "record 3 doesn't follow the previous one"},
+		{"first removed", func(records []*models.ErasureRecord) []*models.ErasureRecord {
+			return records[1:]
+		}, "record 2 doesn't follow the previous one"},
+		{"middle removed", func(records []*models.ErasureRecord) []*models.ErasureRecord {
+			return append(records[:1], records[2:]...)
+		}, "record 3 doesn't follow the previous one"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := NewErasureController(tamperedErasureLog{repo, tt.edit}).VerifyErasureLog(ctx)
+			if tt.want == "" {
+				if err != nil || len(records) != 3 {
+					t.Errorf("VerifyErasureLog = %d records, %v, want the 3 erasures", len(records), err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrErasureLogTampered) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("VerifyErasureLog returned %v, want ErrErasureLogTampered at %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,408 @@
+package controller
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/models"
+	"github.com/aldaircoronel/email-summary/internal/repository"
+)
+
+// Format and version of the account archives. The version changes whenever the files or their fields do.
+const (
+	ExportFormat  = "email-summary/account"
+	ExportVersion = 1
+)
+
+// Files of an account archive
+const (
+	manifestFile     = "manifest.json"
+	accountFile      = "account.json"
+	transactionsFile = "transactions.ndjson"
+	summariesFile    = "summaries.ndjson"
+	monthSummaryFile = "month_summaries.ndjson"
+)
+
+// maxArchiveRecords bounds the lines read from each file of an archive
+const maxArchiveRecords = 10000000
+
+// ExportManifest describes an account archive and the checksum of each of its files
+type ExportManifest struct {
+	Format     string       `json:"format"`
+	Version    int          `json:"version"`
+	ExportedAt time.Time    `json:"exported_at"`
+	AccountID  int          `json:"account_id"`
+	Files      []ExportFile `json:"files"`
+}
+
+// ExportFile is a file of an account archive
+type ExportFile struct {
+	Name    string `json:"name"`
+	SHA256  string `json:"sha256"`
+	Records int    `json:"records"`
+}
+
+// ImportResult counts the rows restored from an account archive
+type ImportResult struct {
+	AccountID      int
+	Transactions   int
+	Summaries      int
+	MonthSummaries int
+}
+
+// ExportController defines a controller for exporting an account to a portable archive and restoring it.
+type ExportController struct {
+	repo repository.Repository
+}
+
+// NewExportController creates a new instance of ExportController.
+func NewExportController(repo repository.Repository) *ExportController {
+	return &ExportController{
+		repo: repo,
+	}
+}
+
+// Export writes the account, its transactions, summaries and month summaries to w as a zip archive.
+// Each file is listed in manifest.json with its SHA-256 checksum.
+func (c *ExportController) Export(ctx context.Context, accountID int, w io.Writer) (*ExportManifest, error) {
+	account, err := c.repo.GetAccountByID(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export account: %w", err)
+	}
+
+	transactions, err := c.transactions(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export account: %w", err)
+	}
+	summaries, err := c.summaries(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export account: %w", err)
+	}
+	var monthSummaries []*models.MonthSummary
+	for _, summary := range summaries {
+		months, err := c.repo.GetMonthSummaryBySummaryID(ctx, summary.SummaryID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export account: %w", err)
+		}
+		monthSummaries = append(monthSummaries, months...)
+	}
+
+	manifest := &ExportManifest{
+		Format:     ExportFormat,
+		Version:    ExportVersion,
+		ExportedAt: time.Now().UTC(),
+		AccountID:  accountID,
+	}
+	archive := zip.NewWriter(w)
+	files := []struct {
+		name    string
+		records []interface{}
+	}{
+		{accountFile, []interface{}{account}},
+		{transactionsFile, records(transactions)},
+		{summariesFile, records(summaries)},
+		{monthSummaryFile, records(monthSummaries)},
+	}
+	for _, file := range files {
+		entry, err := writeArchiveFile(archive, file.name, file.records)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", file.name, err)
+		}
+		manifest.Files = append(manifest.Files, *entry)
+	}
+
+	out, err := archive.Create(manifestFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", manifestFile, err)
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", manifestFile, err)
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+	return manifest, nil
+}
+
+// transactions returns every transaction of the account, oldest ID first
+func (c *ExportController) transactions(ctx context.Context, accountID int) ([]*models.Transaction, error) {
+	query := repository.TransactionQuery{AccountID: accountID, SortBy: repository.SortByID, Limit: repository.MaxPageSize}
+	var transactions []*models.Transaction
+	for {
+		page, err := c.repo.QueryTransactions(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, page.Transactions...)
+		if page.NextCursor == "" {
+			return transactions, nil
+		}
+		query.Cursor = page.NextCursor
+	}
+}
+
+// summaries returns every summary of the account, oldest first
+func (c *ExportController) summaries(ctx context.Context, accountID int) ([]*models.Summary, error) {
+	request := repository.SummaryPageRequest{Limit: repository.MaxPageSize}
+	var summaries []*models.Summary
+	for {
+		page, err := c.repo.ListSummariesByAccount(ctx, accountID, request)
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, page.Summaries...)
+		if page.NextCursor == "" {
+			break
+		}
+		request.Cursor = page.NextCursor
+	}
+	sort.SliceStable(summaries, func(i, j int) bool {
+		return repository.NewerSummary(summaries[j], summaries[i])
+	})
+	return summaries, nil
+}
+
+// records converts a slice of rows into the records of an archive file
+func records[T any](rows []T) []interface{} {
+	result := make([]interface{}, len(rows))
+	for i, row := range rows {
+		result[i] = row
+	}
+	return result
+}
+
+// writeArchiveFile writes the records to the archive as one JSON object per line, and returns its manifest entry
+func writeArchiveFile(archive *zip.Writer, name string, records []interface{}) (*ExportFile, error) {
+	out, err := archive.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	checksum := sha256.New()
+	encoder := json.NewEncoder(io.MultiWriter(out, checksum))
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return nil, err
+		}
+	}
+	return &ExportFile{Name: name, SHA256: hex.EncodeToString(checksum.Sum(nil)), Records: len(records)}, nil
+}
+
+// Import restores an account archive written by Export as a new account. Every row gets a new ID,
+// so the archive can be restored next to the account it came from. The rows are restored in one
+// transaction, so a failed import leaves nothing behind.
+func (c *ExportController) Import(ctx context.Context, r io.ReaderAt, size int64) (*ImportResult, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, apperrors.Invalid("invalid account archive: %w", err)
+	}
+	files, err := verifyArchive(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	var account models.Account
+	if err := readArchiveFile(files[accountFile], func(decoder *json.Decoder) error {
+		return decoder.Decode(&account)
+	}); err != nil {
+		return nil, err
+	}
+	if err := account.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid account archive: %w", err)
+	}
+
+	oldAccountID := account.AccountID
+	var result *ImportResult
+	err = c.repo.InTx(ctx, func(tx repository.Repository) error {
+		// The transaction may run again, so it starts from the archive every time
+		restored := account
+		accountID, err := tx.SaveAccount(ctx, &restored)
+		if err != nil {
+			return err
+		}
+		result = &ImportResult{AccountID: accountID}
+		return importRows(ctx, tx, files, result)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to import account %d: %w", oldAccountID, err)
+	}
+	return result, nil
+}
+
+// importRows restores the transactions, summaries and month summaries of the archive into the new account
+func importRows(ctx context.Context, repo repository.Repository, files map[string]*zip.File, result *ImportResult) error {
+	err := readArchiveFile(files[transactionsFile], func(decoder *json.Decoder) error {
+		var trx models.Transaction
+		if err := decoder.Decode(&trx); err != nil {
+			return err
+		}
+		trx.TransactionID = 0
+		trx.AccountID = result.AccountID
+		if err := repo.SaveTransaction(ctx, &trx); err != nil {
+			return err
+		}
+		result.Transactions++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Summary IDs of the archive mapped to the ones they got on import
+	summaryIDs := make(map[int]int)
+	err = readArchiveFile(files[summariesFile], func(decoder *json.Decoder) error {
+		var summary models.Summary
+		if err := decoder.Decode(&summary); err != nil {
+			return err
+		}
+		oldID := summary.SummaryID
+		summary.AccountID = result.AccountID
+		if err := repo.SaveSummary(ctx, &summary); err != nil {
+			return err
+		}
+		summaryIDs[oldID] = summary.SummaryID
+		result.Summaries++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return readArchiveFile(files[monthSummaryFile], func(decoder *json.Decoder) error {
+		var ms models.MonthSummary
+		if err := decoder.Decode(&ms); err != nil {
+			return err
+		}
+		summaryID, ok := summaryIDs[ms.SummaryID]
+		if !ok {
+			return apperrors.Invalid("invalid account archive: month summary %d belongs to summary %d, which isn't in the archive", ms.MonthSummaryID, ms.SummaryID)
+		}
+		if err := repo.SaveMonthSummary(ctx, &ms, summaryID); err != nil {
+			return err
+		}
+		result.MonthSummaries++
+		return nil
+	})
+}
+
+// verifyArchive checks the manifest of an account archive and the checksum of every file it lists.
+// It returns the files of the archive by name.
+func verifyArchive(archive *zip.Reader) (map[string]*zip.File, error) {
+	files := make(map[string]*zip.File)
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	var manifest ExportManifest
+	if err := readArchiveFile(files[manifestFile], func(decoder *json.Decoder) error {
+		return decoder.Decode(&manifest)
+	}); err != nil {
+		return nil, err
+	}
+	if manifest.Format != ExportFormat {
+		return nil, apperrors.Invalid("invalid account archive: unknown format %q", manifest.Format)
+	}
+	if manifest.Version < 1 || manifest.Version > ExportVersion {
+		return nil, apperrors.Invalid("invalid account archive: version %d isn't supported, this binary reads up to version %d", manifest.Version, ExportVersion)
+	}
+
+	listed := make(map[string]bool)
+	for _, entry := range manifest.Files {
+		file, ok := files[entry.Name]
+		if !ok {
+			return nil, apperrors.Invalid("invalid account archive: %s is missing", entry.Name)
+		}
+		checksum, records, err := checksumArchiveFile(file)
+		if err != nil {
+			return nil, apperrors.Invalid("invalid account archive: failed to read %s: %w", entry.Name, err)
+		}
+		if checksum != entry.SHA256 {
+			return nil, apperrors.Invalid("invalid account archive: checksum mismatch in %s", entry.Name)
+		}
+		if records != entry.Records {
+			return nil, apperrors.Invalid("invalid account archive: %s has %d records, the manifest lists %d", entry.Name, records, entry.Records)
+		}
+		if entry.Name == accountFile && records != 1 {
+			return nil, apperrors.Invalid("invalid account archive: %s must hold exactly one account", accountFile)
+		}
+		listed[entry.Name] = true
+	}
+	for _, name := range []string{accountFile, transactionsFile, summariesFile, monthSummaryFile} {
+		if !listed[name] {
+			return nil, apperrors.Invalid("invalid account archive: %s isn't listed in the manifest", name)
+		}
+	}
+	return files, nil
+}
+
+// checksumArchiveFile returns the SHA-256 checksum and the number of lines of a file of the archive
+func checksumArchiveFile(file *zip.File) (string, int, error) {
+	in, err := file.Open()
+	if err != nil {
+		return "", 0, err
+	}
+	defer in.Close()
+
+	checksum := sha256.New()
+	lines := &lineCounter{Hash: checksum}
+	if _, err := io.Copy(lines, in); err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(checksum.Sum(nil)), lines.lines, nil
+}
+
+// lineCounter hashes what is written to it and counts its newlines
+type lineCounter struct {
+	hash.Hash
+	lines int
+}
+
+func (l *lineCounter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if b == '\n' {
+			l.lines++
+			if l.lines > maxArchiveRecords {
+				return 0, errors.New("too many records")
+			}
+		}
+	}
+	return l.Hash.Write(p)
+}
+
+// readArchiveFile calls read for every JSON value of a file of the archive, until the end of the file.
+// The data files were checked by verifyArchive, so only the manifest can be missing.
+func readArchiveFile(file *zip.File, read func(decoder *json.Decoder) error) error {
+	if file == nil {
+		return apperrors.Invalid("invalid account archive: %s is missing", manifestFile)
+	}
+	in, err := file.Open()
+	if err != nil {
+		return apperrors.Invalid("invalid account archive: failed to read %s: %w", file.Name, err)
+	}
+	defer in.Close()
+
+	decoder := json.NewDecoder(bufio.NewReader(in))
+	for decoder.More() {
+		if err := read(decoder); err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+				return apperrors.Invalid("invalid account archive: failed to read %s: %w", file.Name, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+package controller
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/database"
+	"github.com/aldaircoronel/email-summary/internal/models"
+	"github.com/aldaircoronel/email-summary/internal/repository"
+)
+
+// exportTestAccount exports an account with three transactions and two summaries, the older one with
+// two month summaries and the newer one with a single month
+func exportTestAccount(t *testing.T, repo repository.Repository) []byte {
+	t.Helper()
+	accountID := newTestAccount(t, repo)
+	saveTransactions(t, repo, accountID,
+		time.Date(2022, time.November, 3, 0, 0, 0, 0, time.UTC),
+		time.Date(2022, time.December, 20, 0, 0, 0, 0, time.UTC),
+		time.Date(2023, time.January, 9, 0, 0, 0, 0, time.UTC),
+	)
+	saveSummary(t, repo, accountID, time.Date(2022, time.December, 31, 0, 0, 0, 0, time.UTC), "2022-11", "2022-12")
+	saveSummary(t, repo, accountID, time.Date(2023, time.January, 31, 0, 0, 0, 0, time.UTC), "2023-01")
+
+	var buf bytes.Buffer
+	if _, err := NewExportController(repo).Export(context.Background(), accountID, &buf); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// readArchive returns the contents of the files of an archive by name
+func readArchive(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte)
+	for _, file := range archive.File {
+		in, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if _, err := buf.ReadFrom(in); err != nil {
+			t.Fatal(err)
+		}
+		in.Close()
+		files[file.Name] = buf.Bytes()
+	}
+	return files
+}
+
+// writeArchive zips the files again, in the order Export writes them
+func writeArchive(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, name := range []string{accountFile, transactionsFile, summariesFile, monthSummaryFile, manifestFile} {
+		out, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := out.Write(files[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// editManifest changes the manifest of the archive files
+func editManifest(t *testing.T, files map[string][]byte, edit func(manifest *ExportManifest)) {
+	t.Helper()
+	var manifest ExportManifest
+	if err := json.Unmarshal(files[manifestFile], &manifest); err != nil {
+		t.Fatal(err)
+	}
+	edit(&manifest)
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files[manifestFile] = data
+}
+
+// resealFile lists the current checksum and records of a file in the manifest, as a forged archive would
+func resealFile(t *testing.T, files map[string][]byte, name string) {
+	t.Helper()
+	checksum := sha256.Sum256(files[name])
+	editManifest(t, files, func(manifest *ExportManifest) {
+		for i := range manifest.Files {
+			if manifest.Files[i].Name == name {
+				manifest.Files[i].SHA256 = hex.EncodeToString(checksum[:])
+				manifest.Files[i].Records = bytes.Count(files[name], []byte("\n"))
+			}
+		}
+	})
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	sqlite, drop, err := database.OpenDisposable(context.Background(), "sqlite://", database.Options{})
+	if err != nil {
+		t.Fatalf("OpenDisposable: %v", err)
+	}
+	defer drop()
+
+	for name, repo := range map[string]repository.Repository{"memory": database.NewMemoryRepository(), "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			data := exportTestAccount(t, repo)
+			var manifest ExportManifest
+			if err := json.Unmarshal(readArchive(t, data)[manifestFile], &manifest); err != nil {
+				t.Fatal(err)
+			}
+			oldID := manifest.AccountID
+			// Another summary in between, so the imported summaries can't get the IDs they had
+			saveSummary(t, repo, newTestAccount(t, repo), time.Date(2023, time.February, 28, 0, 0, 0, 0, time.UTC), "2023-02")
+
+			c := NewExportController(repo)
+			result, err := c.Import(ctx, bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("Import: %v", err)
+			}
+			if want := (ImportResult{AccountID: result.AccountID, Transactions: 3, Summaries: 2, MonthSummaries: 3}); *result != want {
+				t.Errorf("Import = %+v, want %+v", *result, want)
+			}
+			if result.AccountID == oldID {
+				t.Fatalf("the archive was imported into account %d, which it came from", oldID)
+			}
+
+			account, err := repo.GetAccountByID(ctx, result.AccountID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if account.HolderName != "Ana López" || len(account.Emails) != 1 || account.Emails[0] != "ana@example.com" || account.Currency != "MXN" {
+				t.Errorf("imported account = %+v, want the exported one", account)
+			}
+			if ids := remainingTransactions(t, repo, result.AccountID); len(ids) != 3 || !ids[1] || !ids[2] || !ids[3] {
+				t.Errorf("imported transactions %v, want 1, 2 and 3", ids)
+			}
+
+			oldSummaries, err := c.summaries(ctx, oldID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			newSummaries, err := c.summaries(ctx, result.AccountID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(newSummaries) != len(oldSummaries) {
+				t.Fatalf("imported %d summaries, want %d", len(newSummaries), len(oldSummaries))
+			}
+			for i, summary := range newSummaries {
+				old := oldSummaries[i]
+				if summary.SummaryID == old.SummaryID || !summary.GeneratedAt.Equal(old.GeneratedAt) {
+					t.Errorf("summary %d was imported as %+v", old.SummaryID, summary)
+				}
+				// Each month summary follows its summary to the new ID
+				months, err := repo.GetMonthSummaryBySummaryID(ctx, summary.SummaryID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				oldMonths, err := repo.GetMonthSummaryBySummaryID(ctx, old.SummaryID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, want := monthNames(months), monthNames(oldMonths); got != want {
+					t.Errorf("summary %d holds months %s, want %s", summary.SummaryID, got, want)
+				}
+			}
+		})
+	}
+}
+
+// monthNames joins the months of the month summaries
+func monthNames(months []*models.MonthSummary) string {
+	names := make([]string, len(months))
+	for i, ms := range months {
+		names[i] = ms.Month
+	}
+	return strings.Join(names, ",")
+}
+
+func TestImportInvalidArchive(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(t *testing.T, files map[string][]byte)
+		want string
+	}{
+		{"checksum mismatch", func(t *testing.T, files map[string][]byte) {
+			files[transactionsFile] = bytes.Replace(files[transactionsFile], []byte(`"Amount":10`), []byte(`"Amount":1000`), 1)
+		}, "checksum mismatch in " + transactionsFile},
+		{"record count mismatch", func(t *testing.T, files map[string][]byte) {
+			editManifest(t, files, func(manifest *ExportManifest) {
+				for i := range manifest.Files {
+					if manifest.Files[i].Name == transactionsFile {
+						manifest.Files[i].Records = 2
+					}
+				}
+			})
+		}, transactionsFile + " has 3 records, the manifest lists 2"},
+		{"unsupported version", func(t *testing.T, files map[string][]byte) {
+			editManifest(t, files, func(manifest *ExportManifest) {
+				manifest.Version = ExportVersion + 1
+			})
+		}, "version 2 isn't supported"},
+		{"unknown format", func(t *testing.T, files map[string][]byte) {
+			editManifest(t, files, func(manifest *ExportManifest) {
+				manifest.Format = "other/account"
+			})
+		}, "unknown format"},
+		{"missing file", func(t *testing.T, files map[string][]byte) {
+			editManifest(t, files, func(manifest *ExportManifest) {
+				manifest.Files = manifest.Files[:len(manifest.Files)-1]
+			})
+		}, monthSummaryFile + " isn't listed in the manifest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := database.NewMemoryRepository()
+			files := readArchive(t, exportTestAccount(t, repo))
+			tt.edit(t, files)
+			data := writeArchive(t, files)
+
+			_, err := NewExportController(repo).Import(ctx, bytes.NewReader(data), int64(len(data)))
+			if !errors.Is(err, apperrors.ErrValidation) || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Import returned %v, want a validation error with %q", err, tt.want)
+			}
+			if accounts, err := repo.ListAccounts(ctx); err != nil || len(accounts) != 1 {
+				t.Errorf("%d accounts after the failed import, %v, want only the exported one", len(accounts), err)
+			}
+		})
+	}
+}
+
+func TestImportRollsBack(t *testing.T) {
+	sqlite, drop, err := database.OpenDisposable(context.Background(), "sqlite://", database.Options{})
+	if err != nil {
+		t.Fatalf("OpenDisposable: %v", err)
+	}
+	defer drop()
+
+	for name, repo := range map[string]repository.Repository{"memory": database.NewMemoryRepository(), "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			files := readArchive(t, exportTestAccount(t, repo))
+			// The last month summary points at a summary the archive doesn't hold, which is only found
+			// after the account, its transactions and summaries are saved
+			lines := strings.SplitAfter(strings.TrimSuffix(string(files[monthSummaryFile]), "\n"), "\n")
+			var last models.MonthSummary
+			if err := json.Unmarshal([]byte(lines[len(lines)-1]), &last); err != nil {
+				t.Fatal(err)
+			}
+			last.SummaryID = 999
+			line, err := json.Marshal(last)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines[len(lines)-1] = string(line) + "\n"
+			files[monthSummaryFile] = []byte(strings.Join(lines, ""))
+			resealFile(t, files, monthSummaryFile)
+			data := writeArchive(t, files)
+
+			_, err = NewExportController(repo).Import(ctx, bytes.NewReader(data), int64(len(data)))
+			if !errors.Is(err, apperrors.ErrValidation) || !strings.Contains(err.Error(), "which isn't in the archive") {
+				t.Fatalf("Import returned %v, want a validation error for the unknown summary", err)
+			}
+			accounts, err := repo.ListAccounts(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(accounts) != 1 {
+				t.Fatalf("%d accounts after the failed import, want only the exported one", len(accounts))
+			}
+			// The rows saved before the failure are gone with the account
+			if ids := remainingTransactions(t, repo, accounts[0].AccountID+1); len(ids) != 0 {
+				t.Errorf("the failed import left transactions %v", ids)
+			}
+			if _, err := repo.GetSummaryByAccountID(ctx, accounts[0].AccountID+1); !errors.Is(err, apperrors.ErrNotFound) {
+				t.Errorf("GetSummaryByAccountID of the failed import returned %v, want not found", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/models"
+	"github.com/aldaircoronel/email-summary/internal/repository"
+)
+
+// Sender delivers the messages of the outbox. Errors marked transient with apperrors.TransientError
+// are retried; any other error makes the message dead at once.
+type Sender interface {
+	Send(msg *models.OutboxMessage) error
+}
+
+// RetryPolicy decides how many times and how often the delivery of a message is attempted.
+// Zero values take the defaults below.
+type RetryPolicy struct {
+	// MaxAttempts is how many times a message is sent before it is dead
+	MaxAttempts int
+	// Backoff is the delay after the first failed attempt. It doubles on every attempt, up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Lease is how long a worker keeps a message it claimed; past it, another worker may claim it again
+	Lease time.Duration
+}
+
+// Defaults of RetryPolicy
+const (
+	DefaultMaxAttempts = 8
+	DefaultBackoff     = time.Minute
+	DefaultMaxBackoff  = 6 * time.Hour
+	DefaultOutboxLease = 10 * time.Minute
+)
+
+const (
+	// defaultOutboxBatch is how many due messages a run delivers when it isn't given a limit
+	defaultOutboxBatch = 50
+	// maxOutboxErrorBytes bounds the error kept with a failed message
+	maxOutboxErrorBytes = 1000
+)
+
+// withDefaults returns the policy with the zero values replaced by the defaults
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = DefaultMaxAttempts
+	}
+	if p.Backoff == 0 {
+		p.Backoff = DefaultBackoff
+	}
+	if p.MaxBackoff == 0 {
+		p.MaxBackoff = DefaultMaxBackoff
+	}
+	if p.Lease == 0 {
+		p.Lease = DefaultOutboxLease
+	}
+	return p
+}
+
+// delay returns how long to wait before the next attempt of a message that failed its nth attempt,
+// between half and all of the doubled backoff so failed messages don't all come back at once
+func (p RetryPolicy) delay(attempts int) time.Duration {
+	backoff := p.Backoff
+	for i := 1; i < attempts && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// DeliveryResult counts what a run of the outbox did
+type DeliveryResult struct {
+	Sent int
+	// Retrying messages failed and wait for their next attempt
+	Retrying int
+	// Dead messages failed permanently or ran out of attempts
+	Dead int
+}
+
+// OutboxController defines a controller for the queue of emails waiting to be delivered.
+type OutboxController struct {
+	repo   repository.Repository
+	policy RetryPolicy
+}
+
+// NewOutboxController creates a new instance of OutboxController.
+func NewOutboxController(repo repository.Repository, policy RetryPolicy) *OutboxController {
+	return &OutboxController{
+		repo:   repo,
+		policy: policy.withDefaults(),
+	}
+}
+
+// Enqueue queues a rendered message of the account for delivery
+func (c *OutboxController) Enqueue(ctx context.Context, accountID int, summaryID int, payload []byte) (*models.OutboxMessage, error) {
+	msg := &models.OutboxMessage{AccountID: accountID, SummaryID: summaryID, Payload: payload}
+	if err := c.repo.EnqueueMessage(ctx, msg); err != nil {
+		return nil, fmt.Errorf("failed to enqueue message: %w", err)
+	}
+	return msg, nil
+}
+
+// ListMessages returns one page of the outbox messages matching the query
+func (c *OutboxController) ListMessages(ctx context.Context, q repository.OutboxQuery) (*repository.OutboxPage, error) {
+	page, err := c.repo.ListOutboxMessages(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list outbox messages: %w", err)
+	}
+	return page, nil
+}
+
+// GetMessage returns the outbox message with the given ID
+func (c *OutboxController) GetMessage(ctx context.Context, id int) (*models.OutboxMessage, error) {
+	msg, err := c.repo.GetOutboxMessage(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get outbox message: %w", err)
+	}
+	return msg, nil
+}
+
+// Run delivers the messages that are due, up to limit of them (a batch of 50 when limit is 0), and
+// reports what happened to them. Messages another worker claims first are skipped.
+func (c *OutboxController) Run(ctx context.Context, sender Sender, limit int) (*DeliveryResult, error) {
+	if limit <= 0 {
+		limit = defaultOutboxBatch
+	}
+	page, err := c.repo.ListOutboxMessages(ctx, repository.OutboxQuery{Due: time.Now(), Limit: limit})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list due outbox messages: %w", err)
+	}
+
+	result := &DeliveryResult{}
+	for _, msg := range page.Messages {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		if err := c.deliver(ctx, sender, msg); err != nil {
+			if errors.Is(err, apperrors.ErrConflict) {
+				continue
+			}
+			return result, err
+		}
+		switch msg.Status {
+		case models.OutboxSent:
+			result.Sent++
+		case models.OutboxDead:
+			result.Dead++
+		default:
+			result.Retrying++
+		}
+	}
+	return result, nil
+}
+
+// Deliver attempts to send a pending or dead message now, whether or not it is due, and returns it with
+// the outcome of the attempt. Sent, cancelled and claimed messages fail with a conflict error.
+func (c *OutboxController) Deliver(ctx context.Context, sender Sender, id int) (*models.OutboxMessage, error) {
+	msg, err := c.repo.GetOutboxMessage(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to deliver outbox message: %w", err)
+	}
+	if msg.Status == models.OutboxSent || msg.Status == models.OutboxCancelled || claimed(msg) {
+		return nil, &apperrors.ConflictError{Err: fmt.Errorf("outbox message %d is %s", id, msg.Status)}
+	}
+	if err := c.deliver(ctx, sender, msg); err != nil {
+		return nil, fmt.Errorf("failed to deliver outbox message: %w", err)
+	}
+	return msg, nil
+}
+
+// claimed reports whether a worker is sending the message now. A message whose claim expired is
+// treated as pending, its worker stopped.
+func claimed(msg *models.OutboxMessage) bool {
+	return msg.Status == models.OutboxSending && msg.NextAttemptAt.After(time.Now())
+}
+
+// deliver claims a message, sends it and stores the outcome. The claim fails with a conflict error
+// if another worker claimed the message first. A failed send isn't an error, it is the outcome.
+func (c *OutboxController) deliver(ctx context.Context, sender Sender, msg *models.OutboxMessage) error {
+	prevStatus, prevAttempts := msg.Status, msg.Attempts
+	msg.Status = models.OutboxSending
+	msg.Attempts++
+	msg.NextAttemptAt = time.Now().Add(c.policy.Lease)
+	if err := c.repo.UpdateOutboxMessage(ctx, msg, prevStatus, prevAttempts); err != nil {
+		return err
+	}
+
+	sendErr := sender.Send(msg)
+	now := time.Now()
+	switch {
+	case sendErr == nil:
+		msg.Status = models.OutboxSent
+		msg.SentAt = now
+		msg.LastError = ""
+	case errors.Is(sendErr, apperrors.ErrTransient) && msg.Attempts < c.policy.MaxAttempts:
+		msg.Status = models.OutboxPending
+		msg.NextAttemptAt = now.Add(c.policy.delay(msg.Attempts))
+		msg.LastError = truncateError(sendErr)
+	default:
+		msg.Status = models.OutboxDead
+		msg.LastError = truncateError(sendErr)
+	}
+
+	// The outcome is stored even if ctx was cancelled while sending, so a sent message isn't sent again
+	if err := c.repo.UpdateOutboxMessage(context.Background(), msg, models.OutboxSending, msg.Attempts); err != nil {
+		return fmt.Errorf("failed to store the outcome of outbox message %d: %w", msg.OutboxID, err)
+	}
+	return nil
+}
+
+// truncateError returns the message of err, cut to a length that fits in a log line
+func truncateError(err error) string {
+	message := err.Error()
+	if len(message) > maxOutboxErrorBytes {
+		message = message[:maxOutboxErrorBytes] + "..."
+	}
+	return message
+}
+
+// Retry makes a dead, cancelled or pending message due now, with all its attempts again. Sent and
+// claimed messages fail with a conflict error.
+func (c *OutboxController) Retry(ctx context.Context, id int) (*models.OutboxMessage, error) {
+	msg, err := c.repo.GetOutboxMessage(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retry outbox message: %w", err)
+	}
+	if msg.Status == models.OutboxSent || claimed(msg) {
+		return nil, &apperrors.ConflictError{Err: fmt.Errorf("outbox message %d is %s", id, msg.Status)}
+	}
+
+	prevStatus, prevAttempts := msg.Status, msg.Attempts
+	msg.Status = models.OutboxPending
+	msg.Attempts = 0
+	msg.NextAttemptAt = time.Now()
+	if err := c.repo.UpdateOutboxMessage(ctx, msg, prevStatus, prevAttempts); err != nil {
+		return nil, fmt.Errorf("failed to retry outbox message: %w", err)
+	}
+	return msg, nil
+}
+
+// Cancel stops the delivery of a pending or dead message. Sent and claimed messages fail with a conflict error.
+func (c *OutboxController) Cancel(ctx context.Context, id int) (*models.OutboxMessage, error) {
+	msg, err := c.repo.GetOutboxMessage(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel outbox message: %w", err)
+	}
+	if msg.Status == models.OutboxCancelled {
+		return msg, nil
+	}
+	if msg.Status == models.OutboxSent || claimed(msg) {
+		return nil, &apperrors.ConflictError{Err: fmt.Errorf("outbox message %d is %s", id, msg.Status)}
+	}
+
+	prevStatus := msg.Status
+	msg.Status = models.OutboxCancelled
+	if err := c.repo.UpdateOutboxMessage(ctx, msg, prevStatus, msg.Attempts); err != nil {
+		return nil, fmt.Errorf("failed to cancel outbox message: %w", err)
+	}
+	return msg, nil
+}
@@ -0,0 +1,378 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/database"
+	"github.com/aldaircoronel/email-summary/internal/models"
+	"github.com/aldaircoronel/email-summary/internal/repository"
+)
+
+// fakeSender fails every send with err, and records the messages it was given
+type fakeSender struct {
+	err  error
+	sent []int
+	// onSend, when set, runs before every send
+	onSend func(msg *models.OutboxMessage)
+}
+
+func (s *fakeSender) Send(msg *models.OutboxMessage) error {
+	if s.onSend != nil {
+		s.onSend(msg)
+	}
+	s.sent = append(s.sent, msg.OutboxID)
+	return s.err
+}
+
+// testPolicy retries quickly, with backoffs that still leave messages in the future
+var testPolicy = RetryPolicy{MaxAttempts: 3, Backoff: time.Minute, MaxBackoff: 5 * time.Minute, Lease: time.Minute}
+
+// enqueueTestMessage queues a message of a new account
+func enqueueTestMessage(t *testing.T, repo repository.Repository) *models.OutboxMessage {
+	t.Helper()
+	msg, err := NewOutboxController(repo, testPolicy).Enqueue(context.Background(), newTestAccount(t, repo), 0, []byte("payload"))
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	return msg
+}
+
+// getMessage returns the stored state of the message
+func getMessage(t *testing.T, repo repository.Repository, id int) *models.OutboxMessage {
+	t.Helper()
+	msg, err := repo.GetOutboxMessage(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetOutboxMessage: %v", err)
+	}
+	return msg
+}
+
+func TestOutboxRunSends(t *testing.T) {
+	ctx := context.Background()
+	repo := database.NewMemoryRepository()
+	c := NewOutboxController(repo, testPolicy)
+	first, second := enqueueTestMessage(t, repo), enqueueTestMessage(t, repo)
+
+	sender := &fakeSender{}
+	result, err := c.Run(ctx, sender, 0)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if *result != (DeliveryResult{Sent: 2}) {
+		t.Errorf("Run = %+v, want 2 sent", *result)
+	}
+	for _, id := range []int{first.OutboxID, second.OutboxID} {
+		msg := getMessage(t, repo, id)
+		if msg.Status != models.OutboxSent || msg.Attempts != 1 || msg.SentAt.IsZero() || msg.LastError != "" {
+			t.Errorf("message %d = %s after %d attempts, sent at %v, want sent once", id, msg.Status, msg.Attempts, msg.SentAt)
+		}
+	}
+
+	// Sent messages aren't due any more
+	if result, err := c.Run(ctx, sender, 0); err != nil || *result != (DeliveryResult{}) || len(sender.sent) != 2 {
+		t.Errorf("second Run = %+v, %v after %d sends, want nothing sent", result, err, len(sender.sent))
+	}
+}
+
+func TestOutboxTransientError(t *testing.T) {
+	ctx := context.Background()
+	repo := database.NewMemoryRepository()
+	c := NewOutboxController(repo, testPolicy)
+	msg := enqueueTestMessage(t, repo)
+
+	sender := &fakeSender{err: &apperrors.TransientError{Err: errors.New("421 try again later")}}
+	start := time.Now()
+	result, err := c.Run(ctx, sender, 0)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if *result != (DeliveryResult{Retrying: 1}) {
+		t.Errorf("Run = %+v, want 1 retrying", *result)
+	}
+	stored := getMessage(t, repo, msg.OutboxID)
+	if stored.Status != models.OutboxPending || stored.Attempts != 1 || !strings.Contains(stored.LastError, "421 try again later") {
+		t.Errorf("message = %s after %d attempts with error %q, want pending after 1 attempt", stored.Status, stored.Attempts, stored.LastError)
+	}
+	if !stored.NextAttemptAt.After(start) || stored.NextAttemptAt.After(time.Now().Add(testPolicy.MaxBackoff)) {
+		t.Errorf("next attempt in %v, want in the future within %v", stored.NextAttemptAt.Sub(start), testPolicy.MaxBackoff)
+	}
+
+	// Until it is due, the message isn't sent again
+	if result, err := c.Run(ctx, sender, 0); err != nil || *result != (DeliveryResult{}) || len(sender.sent) != 1 {
+		t.Errorf("Run before the next attempt = %+v, %v after %d sends, want nothing sent", result, err, len(sender.sent))
+	}
+}
+
+func TestOutboxPermanentError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"delivery error", &apperrors.DeliveryError{Err: errors.New("550 no such user")}},
+		{"unmarked error", errors.New("550 no such user")},
+		// Errors too long for a log line are cut
+		{"long error", &apperrors.DeliveryError{Err: errors.New("550 no such user " + strings.Repeat("x", 2*maxOutboxErrorBytes))}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := database.NewMemoryRepository()
+			msg := enqueueTestMessage(t, repo)
+
+			result, err := NewOutboxController(repo, testPolicy).Run(context.Background(), &fakeSender{err: tt.err}, 0)
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if *result != (DeliveryResult{Dead: 1}) {
+				t.Errorf("Run = %+v, want 1 dead", *result)
+			}
+			stored := getMessage(t, repo, msg.OutboxID)
+			if stored.Status != models.OutboxDead || stored.Attempts != 1 {
+				t.Errorf("message = %s after %d attempts, want dead after the first", stored.Status, stored.Attempts)
+			}
+			if !strings.Contains(stored.LastError, "550 no such user") || len(stored.LastError) > maxOutboxErrorBytes+len("...") {
+				t.Errorf("last error = %d bytes starting %q", len(stored.LastError), excerptError(stored.LastError, 60))
+			}
+		})
+	}
+}
+
+// excerptError returns the start of an error message, for failure messages
+func excerptError(message string, n int) string {
+	if len(message) > n {
+		return message[:n]
+	}
+	return message
+}
+
+func TestOutboxMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	repo := database.NewMemoryRepository()
+	c := NewOutboxController(repo, testPolicy)
+	msg := enqueueTestMessage(t, repo)
+
+	sender := &fakeSender{err: &apperrors.TransientError{Err: errors.New("421 try again later")}}
+	for attempt := 1; attempt <= testPolicy.MaxAttempts; attempt++ {
+		delivered, err := c.Deliver(ctx, sender, msg.OutboxID)
+		if err != nil {
+			t.Fatalf("Deliver attempt %d: %v", attempt, err)
+		}
+		want := models.OutboxPending
+		if attempt == testPolicy.MaxAttempts {
+			want = models.OutboxDead
+		}
+		if delivered.Status != want || delivered.Attempts != attempt {
+			t.Errorf("attempt %d left the message %s after %d attempts, want %s", attempt, delivered.Status, delivered.Attempts, want)
+		}
+	}
+
+	// Retrying gives it all its attempts again, due now
+	retried, err := c.Retry(ctx, msg.OutboxID)
+	if err != nil {
+		t.Fatalf("Retry: %v", err)
+	}
+	if retried.Status != models.OutboxPending || retried.Attempts != 0 || retried.NextAttemptAt.After(time.Now()) {
+		t.Errorf("retried message = %s after %d attempts, due at %v, want pending and due", retried.Status, retried.Attempts, retried.NextAttemptAt)
+	}
+	sender.err = nil
+	if result, err := c.Run(ctx, sender, 0); err != nil || *result != (DeliveryResult{Sent: 1}) {
+		t.Errorf("Run after Retry = %+v, %v, want the message sent", result, err)
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{Backoff: time.Minute, MaxBackoff: 10 * time.Minute}.withDefaults()
+	for attempts := 1; attempts <= 20; attempts++ {
+		// 1, 2, 4 and 8 minutes, then the maximum
+		backoff := policy.MaxBackoff
+		if attempts <= 4 {
+			backoff = time.Minute << (attempts - 1)
+		}
+		for i := 0; i < 20; i++ {
+			if delay := policy.delay(attempts); delay < backoff/2 || delay > backoff {
+				t.Fatalf("delay after %d attempts = %v, want between %v and %v", attempts, delay, backoff/2, backoff)
+			}
+		}
+	}
+}
+
+func TestOutboxExpiredLease(t *testing.T) {
+	sqlite, drop, err := database.OpenDisposable(context.Background(), "sqlite://", database.Options{})
+	if err != nil {
+		t.Fatalf("OpenDisposable: %v", err)
+	}
+	defer drop()
+
+	for name, repo := range map[string]repository.Repository{"memory": database.NewMemoryRepository(), "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			c := NewOutboxController(repo, testPolicy)
+			// A worker claimed both messages and stopped; the claim of the first one expired
+			expired, held := enqueueTestMessage(t, repo), enqueueTestMessage(t, repo)
+			for msg, until := range map[*models.OutboxMessage]time.Time{expired: time.Now().Add(-time.Second), held: time.Now().Add(time.Hour)} {
+				msg.Status, msg.Attempts, msg.NextAttemptAt = models.OutboxSending, 1, until
+				if err := repo.UpdateOutboxMessage(ctx, msg, models.OutboxPending, 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			sender := &fakeSender{}
+			result, err := c.Run(ctx, sender, 0)
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if *result != (DeliveryResult{Sent: 1}) || len(sender.sent) != 1 || sender.sent[0] != expired.OutboxID {
+				t.Errorf("Run = %+v sending %v, want only the message whose claim expired", *result, sender.sent)
+			}
+			if stored := getMessage(t, repo, expired.OutboxID); stored.Status != models.OutboxSent || stored.Attempts != 2 {
+				t.Errorf("expired message = %s after %d attempts, want sent on the second", stored.Status, stored.Attempts)
+			}
+
+			// The message still claimed can't be sent, retried nor cancelled
+			if _, err := c.Deliver(ctx, sender, held.OutboxID); !errors.Is(err, apperrors.ErrConflict) {
+				t.Errorf("Deliver of a claimed message returned %v, want a conflict", err)
+			}
+			if _, err := c.Retry(ctx, held.OutboxID); !errors.Is(err, apperrors.ErrConflict) {
+				t.Errorf("Retry of a claimed message returned %v, want a conflict", err)
+			}
+			if _, err := c.Cancel(ctx, held.OutboxID); !errors.Is(err, apperrors.ErrConflict) {
+				t.Errorf("Cancel of a claimed message returned %v, want a conflict", err)
+			}
+			// until its claim expires too
+			held.NextAttemptAt = time.Now().Add(-time.Second)
+			if err := repo.UpdateOutboxMessage(ctx, held, models.OutboxSending, 1); err != nil {
+				t.Fatal(err)
+			}
+			if delivered, err := c.Deliver(ctx, sender, held.OutboxID); err != nil || delivered.Status != models.OutboxSent {
+				t.Errorf("Deliver of a message whose claim expired = %+v, %v, want it sent", delivered, err)
+			}
+		})
+	}
+}
+
+// racingRepository lets another worker claim every message just before the controller does
+type racingRepository struct {
+	repository.Repository
+}
+
+func (r racingRepository) UpdateOutboxMessage(ctx context.Context, msg *models.OutboxMessage, prevStatus string, prevAttempts int) error {
+	if msg.Status == models.OutboxSending {
+		other := *msg
+		if err := r.Repository.UpdateOutboxMessage(ctx, &other, prevStatus, prevAttempts); err != nil {
+			return err
+		}
+	}
+	return r.Repository.UpdateOutboxMessage(ctx, msg, prevStatus, prevAttempts)
+}
+
+func TestOutboxConcurrentClaim(t *testing.T) {
+	sqlite, drop, err := database.OpenDisposable(context.Background(), "sqlite://", database.Options{})
+	if err != nil {
+		t.Fatalf("OpenDisposable: %v", err)
+	}
+	defer drop()
+
+	for name, repo := range map[string]repository.Repository{"memory": database.NewMemoryRepository(), "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			msg := enqueueTestMessage(t, repo)
+			c := NewOutboxController(racingRepository{repo}, testPolicy)
+
+			// The run skips the message the other worker claimed, without sending it
+			sender := &fakeSender{}
+			result, err := c.Run(ctx, sender, 0)
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if *result != (DeliveryResult{}) || len(sender.sent) != 0 {
+				t.Errorf("Run = %+v after %d sends, want the claimed message skipped", *result, len(sender.sent))
+			}
+			if stored := getMessage(t, repo, msg.OutboxID); stored.Status != models.OutboxSending || stored.Attempts != 1 {
+				t.Errorf("message = %s after %d attempts, want the claim of the other worker", stored.Status, stored.Attempts)
+			}
+		})
+	}
+
+	// Delivering a message on request reports the conflict
+	repo := database.NewMemoryRepository()
+	msg := enqueueTestMessage(t, repo)
+	sender := &fakeSender{}
+	if _, err := NewOutboxController(racingRepository{repo}, testPolicy).Deliver(context.Background(), sender, msg.OutboxID); !errors.Is(err, apperrors.ErrConflict) || len(sender.sent) != 0 {
+		t.Errorf("Deliver returned %v after %d sends, want a conflict", err, len(sender.sent))
+	}
+}
+
+func TestOutboxCancelledWhileSending(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo := database.NewMemoryRepository()
+	first, second := enqueueTestMessage(t, repo), enqueueTestMessage(t, repo)
+
+	// The run is cancelled while the first message is being sent
+	sender := &fakeSender{onSend: func(*models.OutboxMessage) { cancel() }}
+	result, err := NewOutboxController(repo, testPolicy).Run(ctx, sender, 0)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Run returned %v, want the cancellation", err)
+	}
+	if result == nil || *result != (DeliveryResult{Sent: 1}) {
+		t.Errorf("Run = %+v, want the first message sent", result)
+	}
+	// The outcome of the send is stored all the same, so the message isn't sent twice
+	if stored := getMessage(t, repo, first.OutboxID); stored.Status != models.OutboxSent {
+		t.Errorf("first message = %s, want sent", stored.Status)
+	}
+	if stored := getMessage(t, repo, second.OutboxID); stored.Status != models.OutboxPending || stored.Attempts != 0 {
+		t.Errorf("second message = %s after %d attempts, want it left pending", stored.Status, stored.Attempts)
+	}
+}
+
+func TestOutboxCancelAndRetry(t *testing.T) {
+	ctx := context.Background()
+	repo := database.NewMemoryRepository()
+	c := NewOutboxController(repo, testPolicy)
+	pending, sent := enqueueTestMessage(t, repo), enqueueTestMessage(t, repo)
+	if _, err := c.Deliver(ctx, &fakeSender{}, sent.OutboxID); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+
+	cancelled, err := c.Cancel(ctx, pending.OutboxID)
+	if err != nil || cancelled.Status != models.OutboxCancelled {
+		t.Fatalf("Cancel = %+v, %v, want the message cancelled", cancelled, err)
+	}
+	// Cancelling again changes nothing
+	if again, err := c.Cancel(ctx, pending.OutboxID); err != nil || again.Status != models.OutboxCancelled {
+		t.Errorf("second Cancel = %+v, %v", again, err)
+	}
+	sender := &fakeSender{}
+	if result, err := c.Run(ctx, sender, 0); err != nil || *result != (DeliveryResult{}) {
+		t.Errorf("Run = %+v, %v, want the cancelled message left alone", result, err)
+	}
+	if _, err := c.Deliver(ctx, sender, pending.OutboxID); !errors.Is(err, apperrors.ErrConflict) {
+		t.Errorf("Deliver of a cancelled message returned %v, want a conflict", err)
+	}
+
+	// A cancelled message can be queued again
+	if retried, err := c.Retry(ctx, pending.OutboxID); err != nil || retried.Status != models.OutboxPending {
+		t.Fatalf("Retry = %+v, %v, want the message pending", retried, err)
+	}
+	if result, err := c.Run(ctx, sender, 0); err != nil || *result != (DeliveryResult{Sent: 1}) {
+		t.Errorf("Run after Retry = %+v, %v, want the message sent", result, err)
+	}
+
+	// Sent messages are final
+	for name, op := range map[string]func(context.Context, int) (*models.OutboxMessage, error){"Cancel": c.Cancel, "Retry": c.Retry} {
+		if _, err := op(ctx, sent.OutboxID); !errors.Is(err, apperrors.ErrConflict) {
+			t.Errorf("%s of a sent message returned %v, want a conflict", name, err)
+		}
+	}
+	if _, err := c.Deliver(ctx, sender, sent.OutboxID); !errors.Is(err, apperrors.ErrConflict) {
+		t.Errorf("Deliver of a sent message returned %v, want a conflict", err)
+	}
+	if _, err := c.Cancel(ctx, 999); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("Cancel of an unknown message returned %v, want not found", err)
+	}
+}
@@ -0,0 +1,281 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/models"
+	"github.com/aldaircoronel/email-summary/internal/repository"
+)
+
+// RetentionRules are the global retention rules, in months. 0 keeps the rows forever.
+type RetentionRules struct {
+	TransactionMonths int
+	SummaryMonths     int
+}
+
+// PurgeOptions configures a purge run
+type PurgeOptions struct {
+	// Rules apply to the accounts without a retention policy of their own
+	Rules RetentionRules
+
+	// AccountID limits the purge to one account, 0 purges every account
+	AccountID int
+
+	// DryRun only counts the rows that would be deleted
+	DryRun bool
+
+	// Archive receives every purged row as a line of JSON before it is deleted, nil to skip the archive.
+	// When it has Flush or Sync methods, as a compressed file does, they run before every delete.
+	Archive io.Writer
+
+	// Now is the reference time of the retention rules, the current time when zero
+	Now time.Time
+}
+
+// PurgeResult counts the rows deleted by a purge, or that would be deleted by a dry run
+type PurgeResult struct {
+	Accounts       int
+	Transactions   int
+	Summaries      int
+	MonthSummaries int
+}
+
+// ArchivedRecord is one line of a purge archive
+type ArchivedRecord struct {
+	Type         string               `json:"type"`
+	Transaction  *models.Transaction  `json:"transaction,omitempty"`
+	Summary      *models.Summary      `json:"summary,omitempty"`
+	MonthSummary *models.MonthSummary `json:"month_summary,omitempty"`
+}
+
+// RetentionController defines a controller for the retention rules and the purge of old data.
+type RetentionController struct {
+	repo repository.Repository
+}
+
+// NewRetentionController creates a new instance of RetentionController.
+func NewRetentionController(repo repository.Repository) *RetentionController {
+	return &RetentionController{
+		repo: repo,
+	}
+}
+
+// GetPolicy returns the retention policy of an account. Accounts without one get an empty policy, which follows the global rules.
+func (c *RetentionController) GetPolicy(ctx context.Context, accountID int) (*models.RetentionPolicy, error) {
+	if _, err := c.repo.GetAccountByID(ctx, accountID); err != nil {
+		return nil, fmt.Errorf("failed to get retention policy: %w", err)
+	}
+	policy, err := c.repo.GetRetentionPolicy(ctx, accountID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return &models.RetentionPolicy{AccountID: accountID}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get retention policy: %w", err)
+	}
+	return policy, nil
+}
+
+// SetPolicy validates and stores the retention policy of an account
+func (c *RetentionController) SetPolicy(ctx context.Context, policy *models.RetentionPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return fmt.Errorf("failed to set retention policy: %w", err)
+	}
+	if _, err := c.repo.GetAccountByID(ctx, policy.AccountID); err != nil {
+		return fmt.Errorf("failed to set retention policy: %w", err)
+	}
+	if err := c.repo.SaveRetentionPolicy(ctx, policy); err != nil {
+		return fmt.Errorf("failed to set retention policy: %w", err)
+	}
+	return nil
+}
+
+// ClearPolicy removes the retention policy of an account, so the global rules apply to it
+func (c *RetentionController) ClearPolicy(ctx context.Context, accountID int) error {
+	if err := c.repo.DeleteRetentionPolicy(ctx, accountID); err != nil {
+		return fmt.Errorf("failed to clear retention policy: %w", err)
+	}
+	return nil
+}
+
+// Purge deletes the transactions and summaries older than the retention rules of their account.
+// Month summaries are deleted along with their summary. When an archive is given, each page of
+// rows is written to it before being deleted.
+func (c *RetentionController) Purge(ctx context.Context, opts PurgeOptions) (*PurgeResult, error) {
+	if opts.Rules.TransactionMonths < 0 || opts.Rules.SummaryMonths < 0 {
+		return nil, apperrors.Invalid("invalid retention rules, months must not be negative")
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+
+	var accounts []*models.Account
+	if opts.AccountID != 0 {
+		account, err := c.repo.GetAccountByID(ctx, opts.AccountID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to purge: %w", err)
+		}
+		accounts = append(accounts, account)
+	} else {
+		var err error
+		if accounts, err = c.repo.ListAccounts(ctx); err != nil {
+			return nil, fmt.Errorf("failed to purge: %w", err)
+		}
+	}
+
+	result := &PurgeResult{}
+	var archive *json.Encoder
+	if opts.Archive != nil {
+		archive = json.NewEncoder(opts.Archive)
+	}
+	for _, account := range accounts {
+		policy, err := c.GetPolicy(ctx, account.AccountID)
+		if err != nil {
+			return result, err
+		}
+		transactionMonths := opts.Rules.TransactionMonths
+		if policy.TransactionMonths != nil {
+			transactionMonths = *policy.TransactionMonths
+		}
+		summaryMonths := opts.Rules.SummaryMonths
+		if policy.SummaryMonths != nil {
+			summaryMonths = *policy.SummaryMonths
+		}
+
+		if transactionMonths > 0 {
+			cutoff := opts.Now.AddDate(0, -transactionMonths, 0)
+			if err := c.purgeTransactions(ctx, account.AccountID, cutoff, opts, archive, result); err != nil {
+				return result, err
+			}
+		}
+		if summaryMonths > 0 {
+			cutoff := opts.Now.AddDate(0, -summaryMonths, 0)
+			if err := c.purgeSummaries(ctx, account.AccountID, cutoff, opts, archive, result); err != nil {
+				return result, err
+			}
+		}
+		result.Accounts++
+	}
+	return result, nil
+}
+
+// purgeTransactions deletes the transactions of the account dated before the cutoff, one page at a time
+func (c *RetentionController) purgeTransactions(ctx context.Context, accountID int, cutoff time.Time, opts PurgeOptions, archive *json.Encoder, result *PurgeResult) error {
+	query := repository.TransactionQuery{
+		AccountID: accountID,
+		To:        cutoff,
+		SortBy:    repository.SortByID,
+		Limit:     repository.MaxPageSize,
+	}
+	for {
+		page, err := c.repo.QueryTransactions(ctx, query)
+		if err != nil {
+			return fmt.Errorf("failed to purge transactions of account %d: %w", accountID, err)
+		}
+
+		ids := make([]int, 0, len(page.Transactions))
+		for _, trx := range page.Transactions {
+			if archive != nil && !opts.DryRun {
+				if err := archive.Encode(ArchivedRecord{Type: "transaction", Transaction: trx}); err != nil {
+					return fmt.Errorf("failed to archive transaction %d: %w", trx.TransactionID, err)
+				}
+			}
+			ids = append(ids, trx.TransactionID)
+		}
+
+		if opts.DryRun {
+			result.Transactions += len(ids)
+		} else if len(ids) > 0 {
+			if err := flushArchive(opts.Archive); err != nil {
+				return err
+			}
+			deleted, err := c.repo.DeleteTransactions(ctx, ids)
+			if err != nil {
+				return fmt.Errorf("failed to purge transactions of account %d: %w", accountID, err)
+			}
+			result.Transactions += deleted
+		}
+
+		if page.NextCursor == "" {
+			return nil
+		}
+		query.Cursor = page.NextCursor
+	}
+}
+
+// purgeSummaries deletes the summaries of the account generated before the cutoff, along with their month summaries
+func (c *RetentionController) purgeSummaries(ctx context.Context, accountID int, cutoff time.Time, opts PurgeOptions, archive *json.Encoder, result *PurgeResult) error {
+	request := repository.SummaryPageRequest{Limit: repository.MaxPageSize}
+	for {
+		page, err := c.repo.ListSummariesByAccount(ctx, accountID, request)
+		if err != nil {
+			return fmt.Errorf("failed to purge summaries of account %d: %w", accountID, err)
+		}
+
+		var ids []int
+		monthSummaries := 0
+		for _, summary := range page.Summaries {
+			// Pages are newest first, so the old summaries are at the end
+			if !summary.GeneratedAt.Before(cutoff) {
+				continue
+			}
+			months, err := c.repo.GetMonthSummaryBySummaryID(ctx, summary.SummaryID)
+			if err != nil {
+				return fmt.Errorf("failed to purge summaries of account %d: %w", accountID, err)
+			}
+			if archive != nil && !opts.DryRun {
+				if err := archive.Encode(ArchivedRecord{Type: "summary", Summary: summary}); err != nil {
+					return fmt.Errorf("failed to archive summary %d: %w", summary.SummaryID, err)
+				}
+				for _, ms := range months {
+					if err := archive.Encode(ArchivedRecord{Type: "month_summary", MonthSummary: ms}); err != nil {
+						return fmt.Errorf("failed to archive month summary %d: %w", ms.MonthSummaryID, err)
+					}
+				}
+			}
+			ids = append(ids, summary.SummaryID)
+			monthSummaries += len(months)
+		}
+
+		if opts.DryRun {
+			result.Summaries += len(ids)
+			result.MonthSummaries += monthSummaries
+		} else if len(ids) > 0 {
+			if err := flushArchive(opts.Archive); err != nil {
+				return err
+			}
+			deleted, err := c.repo.DeleteSummaries(ctx, ids)
+			if err != nil {
+				return fmt.Errorf("failed to purge summaries of account %d: %w", accountID, err)
+			}
+			result.Summaries += deleted
+			result.MonthSummaries += monthSummaries
+		}
+
+		if page.NextCursor == "" {
+			return nil
+		}
+		request.Cursor = page.NextCursor
+	}
+}
+
+// flushArchive makes sure the archived rows have left the buffers of a compressing writer, and reached
+// the disk, before they are deleted
+func flushArchive(archive io.Writer) error {
+	if flusher, ok := archive.(interface{ Flush() error }); ok {
+		if err := flusher.Flush(); err != nil {
+			return fmt.Errorf("failed to write archive: %w", err)
+		}
+	}
+	if syncer, ok := archive.(interface{ Sync() error }); ok {
+		if err := syncer.Sync(); err != nil {
+			return fmt.Errorf("failed to write archive: %w", err)
+		}
+	}
+	return nil
+}
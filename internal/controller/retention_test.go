@@ -0,0 +1,335 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/database"
+	"github.com/aldaircoronel/email-summary/internal/models"
+	"github.com/aldaircoronel/email-summary/internal/repository"
+)
+
+// purgeNow is the reference time of the purge tests
+var purgeNow = time.Date(2023, time.June, 15, 12, 0, 0, 0, time.UTC)
+
+// saveTransactions stores a transaction of the account at each date, with IDs from 1
+func saveTransactions(t *testing.T, repo repository.Repository, accountID int, dates ...time.Time) {
+	t.Helper()
+	for i, date := range dates {
+		transaction := &models.Transaction{ID: i + 1, Date: date, Amount: 10, IsCredit: true, AccountID: accountID}
+		if err := repo.SaveTransaction(context.Background(), transaction); err != nil {
+			t.Fatalf("SaveTransaction: %v", err)
+		}
+	}
+}
+
+// saveSummary stores a summary of the account generated at the given time, with one month summary per month
+func saveSummary(t *testing.T, repo repository.Repository, accountID int, generatedAt time.Time, months ...string) int {
+	t.Helper()
+	ctx := context.Background()
+	summary := &models.Summary{AccountID: accountID, TotalTransactions: len(months), GeneratedAt: generatedAt}
+	if err := repo.SaveSummary(ctx, summary); err != nil {
+		t.Fatalf("SaveSummary: %v", err)
+	}
+	for _, month := range months {
+		if err := repo.SaveMonthSummary(ctx, &models.MonthSummary{Month: month, TotalTransactions: 1}, summary.SummaryID); err != nil {
+			t.Fatalf("SaveMonthSummary: %v", err)
+		}
+	}
+	return summary.SummaryID
+}
+
+// remainingTransactions returns the IDs of the transactions the account still has
+func remainingTransactions(t *testing.T, repo repository.Repository, accountID int) map[int]bool {
+	t.Helper()
+	transactions, err := repo.GetTransactionByAccountID(context.Background(), accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[int]bool)
+	for _, transaction := range transactions {
+		ids[transaction.ID] = true
+	}
+	return ids
+}
+
+func TestPurgeCutoff(t *testing.T) {
+	ctx := context.Background()
+	repo := database.NewMemoryRepository()
+	accountID := newTestAccount(t, repo)
+
+	// 3 months before the purge is March 15 at 12:00, and rows from that instant on are kept
+	saveTransactions(t, repo, accountID,
+		time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2023, time.March, 15, 11, 59, 0, 0, time.UTC),
+		time.Date(2023, time.March, 15, 12, 0, 0, 0, time.UTC),
+		time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC),
+	)
+	// 6 months before the purge is December 15, 2022 at 12:00
+	old := saveSummary(t, repo, accountID, time.Date(2022, time.December, 15, 11, 0, 0, 0, time.UTC), "2022-11", "2022-12")
+	kept := saveSummary(t, repo, accountID, time.Date(2022, time.December, 15, 12, 0, 0, 0, time.UTC), "2022-12")
+
+	result, err := NewRetentionController(repo).Purge(ctx, PurgeOptions{
+		Rules: RetentionRules{TransactionMonths: 3, SummaryMonths: 6},
+		Now:   purgeNow,
+	})
+	if err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if want := (PurgeResult{Accounts: 1, Transactions: 2, Summaries: 1, MonthSummaries: 2}); *result != want {
+		t.Errorf("Purge = %+v, want %+v", *result, want)
+	}
+	if ids := remainingTransactions(t, repo, accountID); len(ids) != 2 || !ids[3] || !ids[4] {
+		t.Errorf("transactions %v remain, want 3 and 4", ids)
+	}
+	if _, err := repo.GetSummaryByID(ctx, old); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("GetSummaryByID of the purged summary returned %v, want not found", err)
+	}
+	if _, err := repo.GetSummaryByID(ctx, kept); err != nil {
+		t.Errorf("GetSummaryByID of the kept summary: %v", err)
+	}
+}
+
+func TestPurgeAccountPolicy(t *testing.T) {
+	ctx := context.Background()
+	repo := database.NewMemoryRepository()
+	dates := []time.Time{
+		time.Date(2022, time.June, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2023, time.February, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC),
+	}
+	global := newTestAccount(t, repo)
+	forever := newTestAccount(t, repo)
+	shorter := newTestAccount(t, repo)
+	for _, accountID := range []int{global, forever, shorter} {
+		saveTransactions(t, repo, accountID, dates...)
+	}
+
+	retention := NewRetentionController(repo)
+	zero, one := 0, 1
+	if err := retention.SetPolicy(ctx, &models.RetentionPolicy{AccountID: forever, TransactionMonths: &zero}); err != nil {
+		t.Fatal(err)
+	}
+	if err := retention.SetPolicy(ctx, &models.RetentionPolicy{AccountID: shorter, TransactionMonths: &one}); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := retention.Purge(ctx, PurgeOptions{Rules: RetentionRules{TransactionMonths: 12}, Now: purgeNow})
+	if err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if result.Accounts != 3 || result.Transactions != 3 {
+		t.Errorf("Purge = %+v, want 3 transactions of 3 accounts", *result)
+	}
+	for _, tt := range []struct {
+		name      string
+		accountID int
+		remaining int
+	}{
+		{"the global rule", global, 2},
+		{"a policy that keeps transactions forever", forever, 3},
+		{"a policy shorter than the global rule", shorter, 1},
+	} {
+		if ids := remainingTransactions(t, repo, tt.accountID); len(ids) != tt.remaining {
+			t.Errorf("the account with %s has %d transactions left, want %d", tt.name, len(ids), tt.remaining)
+		}
+	}
+
+	// A purge limited to one account leaves the others alone
+	saveSummary(t, repo, global, time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC))
+	saveSummary(t, repo, shorter, time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC))
+	result, err = retention.Purge(ctx, PurgeOptions{Rules: RetentionRules{SummaryMonths: 12}, AccountID: shorter, Now: purgeNow})
+	if err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if result.Accounts != 1 || result.Summaries != 1 {
+		t.Errorf("Purge of one account = %+v, want its summary only", *result)
+	}
+}
+
+func TestPurgeInvalidRules(t *testing.T) {
+	_, err := NewRetentionController(database.NewMemoryRepository()).Purge(context.Background(), PurgeOptions{Rules: RetentionRules{SummaryMonths: -1}})
+	if !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("Purge with a negative rule returned %v, want a validation error", err)
+	}
+}
+
+func TestPurgeDryRun(t *testing.T) {
+	ctx := context.Background()
+	repo := database.NewMemoryRepository()
+	accountID := newTestAccount(t, repo)
+	saveTransactions(t, repo, accountID, time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, time.February, 1, 0, 0, 0, 0, time.UTC))
+	summaryID := saveSummary(t, repo, accountID, time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC), "2020-01", "2020-02")
+
+	var archive bytes.Buffer
+	opts := PurgeOptions{Rules: RetentionRules{TransactionMonths: 1, SummaryMonths: 1}, DryRun: true, Archive: &archive, Now: purgeNow}
+	dryRun, err := NewRetentionController(repo).Purge(ctx, opts)
+	if err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if want := (PurgeResult{Accounts: 1, Transactions: 2, Summaries: 1, MonthSummaries: 2}); *dryRun != want {
+		t.Errorf("dry run = %+v, want %+v", *dryRun, want)
+	}
+	if archive.Len() != 0 {
+		t.Errorf("the dry run archived %q", archive.String())
+	}
+	if ids := remainingTransactions(t, repo, accountID); len(ids) != 2 {
+		t.Errorf("the dry run deleted transactions, %d are left", len(ids))
+	}
+	if months, err := repo.GetMonthSummaryBySummaryID(ctx, summaryID); err != nil || len(months) != 2 {
+		t.Errorf("the dry run deleted month summaries: %v, %v", months, err)
+	}
+
+	// The real purge deletes what the dry run counted
+	opts.DryRun = false
+	result, err := NewRetentionController(repo).Purge(ctx, opts)
+	if err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if *result != *dryRun {
+		t.Errorf("Purge = %+v, want what the dry run counted, %+v", *result, *dryRun)
+	}
+}
+
+// syncedArchive records the rows of an archive, and which of them had been flushed and synced
+type syncedArchive struct {
+	buf     bytes.Buffer
+	flushed int
+	synced  map[string]bool
+}
+
+func (a *syncedArchive) Write(p []byte) (int, error) {
+	return a.buf.Write(p)
+}
+
+func (a *syncedArchive) Flush() error {
+	a.flushed = a.buf.Len()
+	return nil
+}
+
+// Sync marks the flushed rows as synced, by type and ID
+func (a *syncedArchive) Sync() error {
+	a.synced = make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(a.buf.Bytes()[:a.flushed]))
+	for scanner.Scan() {
+		var record ArchivedRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return err
+		}
+		switch record.Type {
+		case "transaction":
+			a.synced[fmt.Sprintf("transaction %d", record.Transaction.TransactionID)] = true
+		case "summary":
+			a.synced[fmt.Sprintf("summary %d", record.Summary.SummaryID)] = true
+		case "month_summary":
+			a.synced[fmt.Sprintf("month_summary %d", record.MonthSummary.MonthSummaryID)] = true
+		}
+	}
+	return scanner.Err()
+}
+
+// archiveCheckingRepository fails the deletes of rows the archive hasn't synced
+type archiveCheckingRepository struct {
+	repository.Repository
+	archive *syncedArchive
+	batches int
+}
+
+func (r *archiveCheckingRepository) DeleteTransactions(ctx context.Context, ids []int) (int, error) {
+	r.batches++
+	for _, id := range ids {
+		if !r.archive.synced[fmt.Sprintf("transaction %d", id)] {
+			return 0, fmt.Errorf("transaction %d is deleted before its archive is synced", id)
+		}
+	}
+	return r.Repository.DeleteTransactions(ctx, ids)
+}
+
+func (r *archiveCheckingRepository) DeleteSummaries(ctx context.Context, ids []int) (int, error) {
+	r.batches++
+	for _, id := range ids {
+		if !r.archive.synced[fmt.Sprintf("summary %d", id)] {
+			return 0, fmt.Errorf("summary %d is deleted before its archive is synced", id)
+		}
+		months, err := r.Repository.GetMonthSummaryBySummaryID(ctx, id)
+		if err != nil {
+			return 0, err
+		}
+		for _, ms := range months {
+			if !r.archive.synced[fmt.Sprintf("month_summary %d", ms.MonthSummaryID)] {
+				return 0, fmt.Errorf("month summary %d is deleted before its archive is synced", ms.MonthSummaryID)
+			}
+		}
+	}
+	return r.Repository.DeleteSummaries(ctx, ids)
+}
+
+func TestPurgeArchivesBeforeDeleting(t *testing.T) {
+	ctx := context.Background()
+	memory := database.NewMemoryRepository()
+	accountID := newTestAccount(t, memory)
+
+	// More transactions than a page, so they are deleted in two batches
+	dates := make([]time.Time, repository.MaxPageSize+10)
+	for i := range dates {
+		dates[i] = time.Date(2020, time.January, 1, 0, i, 0, 0, time.UTC)
+	}
+	saveTransactions(t, memory, accountID, dates...)
+	saveSummary(t, memory, accountID, time.Date(2020, time.February, 1, 0, 0, 0, 0, time.UTC), "2020-01")
+	saveSummary(t, memory, accountID, time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC), "2020-02")
+
+	archive := &syncedArchive{}
+	repo := &archiveCheckingRepository{Repository: memory, archive: archive}
+	result, err := NewRetentionController(repo).Purge(ctx, PurgeOptions{
+		Rules:   RetentionRules{TransactionMonths: 1, SummaryMonths: 1},
+		Archive: archive,
+		Now:     purgeNow,
+	})
+	if err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if result.Transactions != len(dates) || result.Summaries != 2 || result.MonthSummaries != 2 {
+		t.Errorf("Purge = %+v, want every row", *result)
+	}
+	if repo.batches != 3 {
+		t.Errorf("the rows were deleted in %d batches, want 2 of transactions and 1 of summaries", repo.batches)
+	}
+	if lines := bytes.Count(archive.buf.Bytes(), []byte("\n")); lines != len(dates)+4 {
+		t.Errorf("the archive has %d rows, want %d", lines, len(dates)+4)
+	}
+}
+
+func TestPurgeDeletesMonthSummariesFirst(t *testing.T) {
+	// SQLite enforces the foreign key of month_summary on summary, which fails a delete of the summary first
+	sqlite, drop, err := database.OpenDisposable(context.Background(), "sqlite://", database.Options{})
+	if err != nil {
+		t.Fatalf("OpenDisposable: %v", err)
+	}
+	defer drop()
+
+	for name, repo := range map[string]repository.Repository{"memory": database.NewMemoryRepository(), "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			accountID := newTestAccount(t, repo)
+			summaryID := saveSummary(t, repo, accountID, time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC), "2020-01", "2020-02")
+
+			result, err := NewRetentionController(repo).Purge(ctx, PurgeOptions{Rules: RetentionRules{SummaryMonths: 1}, AccountID: accountID, Now: purgeNow})
+			if err != nil {
+				t.Fatalf("Purge: %v", err)
+			}
+			if result.Summaries != 1 || result.MonthSummaries != 2 {
+				t.Errorf("Purge = %+v, want the summary and its 2 month summaries", *result)
+			}
+			if months, err := repo.GetMonthSummaryBySummaryID(ctx, summaryID); err != nil || len(months) != 0 {
+				t.Errorf("month summaries %v, %v are left of the purged summary", months, err)
+			}
+		})
+	}
+}
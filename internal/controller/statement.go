@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/models"
+	"github.com/aldaircoronel/email-summary/internal/repository"
+)
+
+// StatementController defines a controller for the archive of generated statements.
+type StatementController struct {
+	repo repository.Repository
+}
+
+// NewStatementController creates a new instance of StatementController.
+func NewStatementController(repo repository.Repository) *StatementController {
+	return &StatementController{
+		repo: repo,
+	}
+}
+
+// QueueDelivery archives the subject, HTML and text bodies and recipients the statement is delivered with,
+// and queues the rendered message in the outbox, at once: a statement is never archived without the
+// message that delivers it
+func (c *StatementController) QueueDelivery(ctx context.Context, summary *models.Summary, subject string, htmlBody string, textBody string, recipients []string, payload []byte) (*models.OutboxMessage, error) {
+	summary.Subject = subject
+	summary.HTMLBody = htmlBody
+	summary.TextBody = textBody
+	summary.Recipients = recipients
+	msg := &models.OutboxMessage{AccountID: summary.AccountID, SummaryID: summary.SummaryID, Payload: payload}
+	if err := c.repo.EnqueueStatement(ctx, summary, msg); err != nil {
+		return nil, fmt.Errorf("failed to queue statement %d: %w", summary.SummaryID, err)
+	}
+	return msg, nil
+}
+
+// GetStatement returns the archived statement with the given summary ID
+func (c *StatementController) GetStatement(ctx context.Context, summaryID int) (*models.Summary, error) {
+	summary, err := c.repo.GetSummaryByID(ctx, summaryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get statement: %w", err)
+	}
+	if summary.HTMLBody == "" {
+		return nil, apperrors.Invalid("statement %d has no archived content to send", summaryID)
+	}
+	return summary, nil
+}
+
+// DeliveredMessage returns the outbox message that delivered the statement, whose payload is the email
+// as it was sent, with its images and attachments. Statements archived before emails were queued have none.
+func (c *StatementController) DeliveredMessage(ctx context.Context, summaryID int) (*models.OutboxMessage, error) {
+	// The first message of the statement delivered it, and later ones re-sent it
+	page, err := c.repo.ListOutboxMessages(ctx, repository.OutboxQuery{SummaryID: summaryID, Limit: 1})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get delivered email of statement %d: %w", summaryID, err)
+	}
+	if len(page.Messages) == 0 {
+		return nil, apperrors.NotFound("delivered email of statement", summaryID)
+	}
+	return page.Messages[0], nil
+}
+
+// ListStatements returns one page of the statements of an account, newest first
+func (c *StatementController) ListStatements(ctx context.Context, accountID int, page repository.SummaryPageRequest) (*repository.SummaryPage, error) {
+	if _, err := c.repo.GetAccountByID(ctx, accountID); err != nil {
+		return nil, fmt.Errorf("failed to list statements: %w", err)
+	}
+	statements, err := c.repo.ListSummariesByAccount(ctx, accountID, page)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statements: %w", err)
+	}
+	return statements, nil
+}
+
+// PeriodTransactions returns the transactions of the statement period, oldest first
+func (c *StatementController) PeriodTransactions(ctx context.Context, summary *models.Summary) ([]*models.Transaction, error) {
+	q := repository.TransactionQuery{
+		AccountID: summary.AccountID,
+		From:      summary.PeriodStart,
+		SortBy:    repository.SortByDate,
+		Limit:     repository.MaxPageSize,
+	}
+	// The period ends on the date of its last transaction, and To is exclusive
+	if !summary.PeriodEnd.IsZero() {
+		q.To = summary.PeriodEnd.Add(time.Second)
+	}
+
+	var transactions []*models.Transaction
+	for {
+		page, err := c.repo.QueryTransactions(ctx, q)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the transactions of statement %d: %w", summary.SummaryID, err)
+		}
+		transactions = append(transactions, page.Transactions...)
+		if page.NextCursor == "" {
+			return transactions, nil
+		}
+		q.Cursor = page.NextCursor
+	}
+}
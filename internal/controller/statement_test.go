@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/database"
+	"github.com/aldaircoronel/email-summary/internal/models"
+	"github.com/aldaircoronel/email-summary/internal/repository"
+)
+
+func TestPeriodTransactions(t *testing.T) {
+	sqlite, drop, err := database.OpenDisposable(context.Background(), "sqlite://", database.Options{})
+	if err != nil {
+		t.Fatalf("OpenDisposable: %v", err)
+	}
+	defer drop()
+
+	for name, repo := range map[string]repository.Repository{"memory": database.NewMemoryRepository(), "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			accountID := newTestAccount(t, repo)
+			start := time.Date(2023, time.January, 5, 8, 0, 0, 0, time.UTC)
+			end := time.Date(2023, time.January, 31, 10, 0, 0, 0, time.UTC)
+			// IDs 2 to 4 are in the period, which includes its first and last transaction
+			saveTransactions(t, repo, accountID,
+				start.Add(-time.Second),
+				start,
+				time.Date(2023, time.January, 20, 0, 0, 0, 0, time.UTC),
+				end,
+				end.Add(time.Second),
+				time.Date(2023, time.February, 2, 0, 0, 0, 0, time.UTC),
+			)
+			// Another account with a transaction in the period
+			saveTransactions(t, repo, newTestAccount(t, repo), time.Date(2023, time.January, 20, 0, 0, 0, 0, time.UTC))
+
+			summary := &models.Summary{AccountID: accountID, PeriodStart: start, PeriodEnd: end}
+			transactions, err := NewStatementController(repo).PeriodTransactions(ctx, summary)
+			if err != nil {
+				t.Fatalf("PeriodTransactions: %v", err)
+			}
+			var ids []int
+			for _, trx := range transactions {
+				if trx.AccountID != accountID {
+					t.Errorf("transaction %d of account %d is in the statement of account %d", trx.ID, trx.AccountID, accountID)
+				}
+				ids = append(ids, trx.ID)
+			}
+			if len(ids) != 3 || ids[0] != 2 || ids[1] != 3 || ids[2] != 4 {
+				t.Errorf("PeriodTransactions returned transactions %v, want 2, 3 and 4 in date order", ids)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/models"
+)
+
+// Implement the SaveAccount method of the Repository interface
+func (pr *sqlRepository) SaveAccount(ctx context.Context, account *models.Account) (int, error) {
+	// Construct the SQL query
+	query := `
+		INSERT INTO accounts (holder_name, currency, locale, time_zone, status) VALUES ($1, $2, $3, $4, $5)
+		RETURNING account_id
+	`
+
+	account.SetDefaults()
+
+	// Execute the query and retrieve the new account_id, storing the emails along with it
+	var accountID int
+	err := pr.withTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query, account.HolderName, account.Currency, account.Locale, account.TimeZone, account.Status).Scan(&accountID)
+		if err != nil {
+			return err
+		}
+		return saveAccountEmails(ctx, tx, accountID, account.Emails)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to save account: %w", classify(err))
+	}
+
+	account.AccountID = accountID
+	return accountID, nil
+}
+
+// saveAccountEmails replaces the contact emails of an account
+func saveAccountEmails(ctx context.Context, tx *sql.Tx, accountID int, emails []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM account_emails WHERE account_id = $1`, accountID); err != nil {
+		return err
+	}
+	for position, email := range emails {
+		query := `INSERT INTO account_emails (account_id, position, email) VALUES ($1, $2, $3)`
+		if _, err := tx.ExecContext(ctx, query, accountID, position, email); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getAccountEmails returns the contact emails of an account, primary address first
+func (pr *sqlRepository) getAccountEmails(ctx context.Context, accountID int) ([]string, error) {
+	query := `SELECT email FROM account_emails WHERE account_id = $1 ORDER BY position`
+	rows, err := pr.db.QueryContext(ctx, query, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var emails []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+	return emails, rows.Err()
+}
+
+// GetAccountByID retrieves the account with the given ID
+func (pr *sqlRepository) GetAccountByID(ctx context.Context, id int) (*models.Account, error) {
+	query := `SELECT account_id, holder_name, currency, locale, time_zone, status FROM accounts WHERE account_id = $1`
+
+	account := &models.Account{}
+	err := pr.db.QueryRowContext(ctx, query, id).Scan(&account.AccountID, &account.HolderName, &account.Currency, &account.Locale, &account.TimeZone, &account.Status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, apperrors.NotFound("account", id)
+		}
+		return nil, fmt.Errorf("error getting account from database: %w", classify(err))
+	}
+
+	account.Emails, err = pr.getAccountEmails(ctx, account.AccountID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting account emails from database: %w", classify(err))
+	}
+	return account, nil
+}
+
+// ListAccounts returns every account ordered by ID
+func (pr *sqlRepository) ListAccounts(ctx context.Context) ([]*models.Account, error) {
+	query := `SELECT account_id, holder_name, currency, locale, time_zone, status FROM accounts ORDER BY account_id`
+	rows, err := pr.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list accounts: %w", classify(err))
+	}
+	defer rows.Close()
+
+	accounts := []*models.Account{}
+	for rows.Next() {
+		account := &models.Account{}
+		if err := rows.Scan(&account.AccountID, &account.HolderName, &account.Currency, &account.Locale, &account.TimeZone, &account.Status); err != nil {
+			return nil, fmt.Errorf("failed to scan account: %w", classify(err))
+		}
+		accounts = append(accounts, account)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate accounts: %w", classify(err))
+	}
+	// The emails are read once the rows are closed; SQLite runs on a single connection
+	rows.Close()
+
+	for _, account := range accounts {
+		if account.Emails, err = pr.getAccountEmails(ctx, account.AccountID); err != nil {
+			return nil, fmt.Errorf("failed to list account emails: %w", classify(err))
+		}
+	}
+	return accounts, nil
+}
+
+// UpdateAccount stores the profile of an existing account
+func (pr *sqlRepository) UpdateAccount(ctx context.Context, account *models.Account) error {
+	query := `UPDATE accounts SET holder_name = $1, currency = $2, locale = $3, time_zone = $4, status = $5 WHERE account_id = $6`
+
+	account.SetDefaults()
+
+	var found bool
+	err := pr.withTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, account.HolderName, account.Currency, account.Locale, account.TimeZone, account.Status, account.AccountID)
+		if err != nil {
+			return err
+		}
+		if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+			return err
+		}
+		found = true
+		return saveAccountEmails(ctx, tx, account.AccountID, account.Emails)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update account: %w", classify(err))
+	}
+	if !found {
+		return apperrors.NotFound("account", account.AccountID)
+	}
+	return nil
+}
+
+// DeleteAccount deletes an account and its contact emails. Accounts that still have transactions or summaries can't be deleted.
+func (pr *sqlRepository) DeleteAccount(ctx context.Context, id int) error {
+	var found bool
+	err := pr.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM account_emails WHERE account_id = $1`, id); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, `DELETE FROM accounts WHERE account_id = $1`, id)
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		found = rows > 0
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete account: %w", classify(err))
+	}
+	if !found {
+		return apperrors.NotFound("account", id)
+	}
+	return nil
+}
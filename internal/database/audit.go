@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/models"
+	"github.com/aldaircoronel/email-summary/internal/repository"
+)
+
+// SaveAuditEvent appends an event to the audit log
+func (pr *sqlRepository) SaveAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+	event.OccurredAt = event.OccurredAt.UTC().Truncate(time.Microsecond)
+
+	query := `
+		INSERT INTO audit_events (occurred_at, actor, action, entity, entity_id, before_hash, after_hash, details)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING event_id
+	`
+	err := pr.db.QueryRowContext(ctx, query,
+		event.OccurredAt,
+		event.Actor,
+		event.Action,
+		event.Entity,
+		event.EntityID,
+		event.BeforeHash,
+		event.AfterHash,
+		event.Details,
+	).Scan(&event.EventID)
+	if err != nil {
+		return fmt.Errorf("failed to save audit event: %w", classify(err))
+	}
+	return nil
+}
+
+// ListAuditEvents returns one page of the audit events matching the query, oldest first
+func (pr *sqlRepository) ListAuditEvents(ctx context.Context, q repository.AuditQuery) (*repository.AuditPage, error) {
+	afterID, err := q.Normalize()
+	if err != nil {
+		return nil, fmt.Errorf("invalid audit query: %w", err)
+	}
+
+	var conditions []string
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	columns := []struct {
+		name  string
+		value string
+	}{
+		{"entity", q.Entity},
+		{"entity_id", q.EntityID},
+		{"actor", q.Actor},
+		{"action", q.Action},
+	}
+	for _, column := range columns {
+		if column.value != "" {
+			conditions = append(conditions, column.name+" = "+arg(column.value))
+		}
+	}
+	if !q.From.IsZero() {
+		conditions = append(conditions, "occurred_at >= "+arg(q.From.UTC()))
+	}
+	if !q.To.IsZero() {
+		conditions = append(conditions, "occurred_at < "+arg(q.To.UTC()))
+	}
+	if afterID != 0 {
+		conditions = append(conditions, "event_id > "+arg(afterID))
+	}
+
+	query := `SELECT event_id, occurred_at, actor, action, entity, entity_id, before_hash, after_hash, details FROM audit_events`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	// Fetch one extra row to know whether there is a next page
+	query += fmt.Sprintf(" ORDER BY event_id LIMIT %d", q.Limit+1)
+
+	rows, err := pr.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", classify(err))
+	}
+	defer rows.Close()
+
+	events := []*models.AuditEvent{}
+	for rows.Next() {
+		e := &models.AuditEvent{}
+		if err := rows.Scan(&e.EventID, &e.OccurredAt, &e.Actor, &e.Action, &e.Entity, &e.EntityID, &e.BeforeHash, &e.AfterHash, &e.Details); err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", classify(err))
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", classify(err))
+	}
+
+	page := &repository.AuditPage{Events: events}
+	if len(events) > q.Limit {
+		page.Events = events[:q.Limit]
+		page.NextCursor = repository.NewAuditCursor(page.Events[q.Limit-1])
+	}
+	return page, nil
+}
@@ -0,0 +1,47 @@
+package database_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aldaircoronel/email-summary/internal/database"
+	"github.com/aldaircoronel/email-summary/internal/repository"
+	"github.com/aldaircoronel/email-summary/internal/repository/repotest"
+)
+
+// runConformance runs the suite against a disposable database of the URL, shared by all the cases
+func runConformance(t *testing.T, databaseURL string) {
+	repo, drop, err := database.OpenDisposable(context.Background(), databaseURL, database.Options{})
+	if err != nil {
+		t.Fatalf("OpenDisposable(%s): %v", databaseURL, err)
+	}
+	t.Cleanup(func() {
+		if err := drop(); err != nil {
+			t.Errorf("failed to drop the disposable database: %v", err)
+		}
+	})
+	repotest.Run(t, func(t repotest.T) repository.Repository { return repo })
+}
+
+func TestMemoryConformance(t *testing.T) {
+	// Every case gets a new repository, which the in-memory one makes cheap
+	repotest.Run(t, func(t repotest.T) repository.Repository {
+		return database.NewMemoryRepository()
+	})
+}
+
+func TestSQLiteConformance(t *testing.T) {
+	runConformance(t, "sqlite://")
+}
+
+// TestPostgresConformance runs against a database created next to the one in DATABASE_URL, whose user
+// needs the CREATEDB privilege
+func TestPostgresConformance(t *testing.T) {
+	databaseURL := os.Getenv("DATABASE_URL")
+	if !strings.HasPrefix(databaseURL, "postgres://") && !strings.HasPrefix(databaseURL, "postgresql://") {
+		t.Skip("DATABASE_URL is not a PostgreSQL URL")
+	}
+	runConformance(t, databaseURL)
+}
@@ -0,0 +1,181 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+)
+
+// conn wraps the connection pool of a SQL repository, running statements again
+// when they fail with a transient error such as a serialization failure or a
+// dropped connection.
+type conn struct {
+	*sql.DB
+	options Options
+
+	// tx is the transaction the statements run in, for the repository InTx hands out. Its statements
+	// aren't retried one by one: the whole transaction is.
+	tx *sql.Tx
+}
+
+// openConn opens the pool for the driver, applies the pool options and checks that the database is reachable
+func openConn(ctx context.Context, driverName, dsn string, options Options) (*conn, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	db.SetMaxOpenConns(options.MaxOpenConns)
+	db.SetMaxIdleConns(options.MaxIdleConns)
+	db.SetConnMaxLifetime(options.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(options.ConnMaxIdleTime)
+
+	c := &conn{DB: db, options: options}
+
+	// sql.Open doesn't connect, so a wrong DATABASE_URL would only show up at the first query
+	pingCtx, cancel := context.WithTimeout(ctx, options.ConnectTimeout)
+	defer cancel()
+	if err := c.ping(pingCtx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	return c, nil
+}
+
+// ping checks that the database is reachable, retrying while it isn't
+func (c *conn) ping(ctx context.Context) error {
+	err := c.retry(ctx, func() error {
+		return c.PingContext(ctx)
+	})
+	if err != nil {
+		// Running out of time waiting for the database is worth trying again later
+		if ctx.Err() == context.DeadlineExceeded {
+			return &apperrors.TransientError{Err: err}
+		}
+		return classify(err)
+	}
+	return nil
+}
+
+// ExecContext runs a statement, retrying it on transient errors
+func (c *conn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if c.tx != nil {
+		return c.tx.ExecContext(ctx, query, args...)
+	}
+	var result sql.Result
+	err := c.retry(ctx, func() error {
+		var err error
+		result, err = c.DB.ExecContext(ctx, query, args...)
+		return markUncertain(query, err)
+	})
+	return result, unwrapUncertain(err)
+}
+
+// QueryContext runs a query, retrying it on transient errors. Errors while reading
+// the rows aren't retried, as some of them may have been consumed already.
+func (c *conn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if c.tx != nil {
+		return c.tx.QueryContext(ctx, query, args...)
+	}
+	var rows *sql.Rows
+	err := c.retry(ctx, func() error {
+		var err error
+		rows, err = c.DB.QueryContext(ctx, query, args...)
+		return markUncertain(query, err)
+	})
+	return rows, unwrapUncertain(err)
+}
+
+// QueryRowContext returns a row whose Scan runs the query, retrying it on transient errors
+func (c *conn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *row {
+	return &row{conn: c, ctx: ctx, query: query, args: args}
+}
+
+// row is the result of conn.QueryRowContext
+type row struct {
+	conn  *conn
+	ctx   context.Context
+	query string
+	args  []interface{}
+}
+
+// Scan runs the query and copies the columns of the first row into dest, like sql.Row.Scan
+func (r *row) Scan(dest ...interface{}) error {
+	if r.conn.tx != nil {
+		return r.conn.tx.QueryRowContext(r.ctx, r.query, r.args...).Scan(dest...)
+	}
+	err := r.conn.retry(r.ctx, func() error {
+		err := r.conn.DB.QueryRowContext(r.ctx, r.query, r.args...).Scan(dest...)
+		return markUncertain(r.query, err)
+	})
+	return unwrapUncertain(err)
+}
+
+// retry runs fn until it succeeds, fails with an error that isn't worth retrying,
+// or runs out of attempts. The delay between attempts grows exponentially, with jitter
+// so concurrent callers don't retry in lockstep.
+func (c *conn) retry(ctx context.Context, fn func() error) error {
+	if c.tx != nil {
+		return fn()
+	}
+	backoff := c.options.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= c.options.MaxRetries || !retryable(err) {
+			return err
+		}
+
+		delay := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > c.options.MaxRetryBackoff {
+			backoff = c.options.MaxRetryBackoff
+		}
+	}
+}
+
+// uncertainError marks a write whose connection was lost before its result arrived.
+// The database may have applied it, so it isn't retried.
+type uncertainError struct {
+	err error
+}
+
+func (e *uncertainError) Error() string {
+	return e.err.Error()
+}
+
+func (e *uncertainError) Unwrap() error {
+	return e.err
+}
+
+// markUncertain wraps err in an uncertainError when the statement writes and its connection was lost mid-flight
+func markUncertain(query string, err error) error {
+	if err == nil || readOnly(query) || !lostInFlight(err) {
+		return err
+	}
+	return &uncertainError{err: err}
+}
+
+// unwrapUncertain removes the mark added by markUncertain
+func unwrapUncertain(err error) error {
+	if uncertain, ok := err.(*uncertainError); ok {
+		return uncertain.err
+	}
+	return err
+}
+
+// readOnly reports whether the statement only reads, so running it twice is harmless
+func readOnly(query string) bool {
+	return strings.HasPrefix(strings.ToUpper(strings.TrimSpace(query)), "SELECT")
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/repository"
+)
+
+// OpenDisposable creates an empty, migrated database next to the one in databaseURL and opens it. The
+// returned function closes the repository and drops the database, so it can be used by tests and by
+// the conformance command without touching real data:
+//
+//	postgres://  a new database on the same server, created through the connection in the URL
+//	sqlite://    a new file in the temporary directory; the path of the URL is ignored
+//	memory://    a new in-memory repository
+func OpenDisposable(ctx context.Context, databaseURL string, options Options) (repository.Repository, func() error, error) {
+	u, err := url.Parse(databaseURL)
+	if err != nil {
+		return nil, nil, apperrors.Invalid("invalid database url: %w", err)
+	}
+
+	switch u.Scheme {
+	case "postgres", "postgresql":
+		return openDisposablePostgres(ctx, u, options)
+	case "sqlite", "sqlite3":
+		return openDisposableSQLite(ctx, options)
+	case "memory":
+		repo := NewMemoryRepository()
+		return repo, repo.Close, nil
+	default:
+		return nil, nil, apperrors.Invalid("invalid database url: unsupported scheme %q", u.Scheme)
+	}
+}
+
+func openDisposablePostgres(ctx context.Context, u *url.URL, options Options) (repository.Repository, func() error, error) {
+	admin, err := openConn(ctx, "postgres", u.String(), options.withDefaults())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer admin.Close()
+
+	name, err := disposableName()
+	if err != nil {
+		return nil, nil, err
+	}
+	// The name is generated, so it is safe to put in the statement, which takes no parameters
+	if _, err := admin.ExecContext(ctx, "CREATE DATABASE "+name); err != nil {
+		return nil, nil, fmt.Errorf("failed to create database %s: %w", name, classify(err))
+	}
+	drop := func() error {
+		admin, err := sql.Open("postgres", u.String())
+		if err != nil {
+			return fmt.Errorf("failed to drop database %s: %w", name, err)
+		}
+		defer admin.Close()
+		if _, err := admin.ExecContext(context.Background(), "DROP DATABASE IF EXISTS "+name); err != nil {
+			return fmt.Errorf("failed to drop database %s: %w", name, err)
+		}
+		return nil
+	}
+
+	disposable := *u
+	disposable.Path = "/" + name
+	repo, err := NewPostgresRepository(ctx, disposable.String(), options)
+	if err != nil {
+		drop()
+		return nil, nil, err
+	}
+	cleanup := func() error {
+		repo.Close()
+		return drop()
+	}
+	if _, err := repo.MigrateUp(ctx); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return repo, cleanup, nil
+}
+
+func openDisposableSQLite(ctx context.Context, options Options) (repository.Repository, func() error, error) {
+	dir, err := os.MkdirTemp("", "email-summary-")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	repo, err := NewSQLiteRepository(ctx, filepath.Join(dir, "statements.db"), options)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, nil, err
+	}
+	cleanup := func() error {
+		repo.Close()
+		return os.RemoveAll(dir)
+	}
+	if _, err := repo.MigrateUp(ctx); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return repo, cleanup, nil
+}
+
+// disposableName returns a random database name that needs no quoting
+func disposableName() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate database name: %w", err)
+	}
+	return "email_summary_test_" + hex.EncodeToString(b), nil
+}
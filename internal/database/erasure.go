@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/models"
+)
+
+// AppendErasureRecord adds a record to the end of the erasure log, chaining it to the last one
+func (pr *sqlRepository) AppendErasureRecord(ctx context.Context, record *models.ErasureRecord) error {
+	if record.ErasedAt.IsZero() {
+		record.ErasedAt = time.Now()
+	}
+	// PostgreSQL keeps microseconds, the hash has to match the stored time
+	record.ErasedAt = record.ErasedAt.UTC().Truncate(time.Microsecond)
+
+	query := `
+		INSERT INTO erasure_log (account_id, mode, reason, requested_by, erased_at, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING erasure_id
+	`
+	err := pr.withTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `SELECT hash FROM erasure_log ORDER BY erasure_id DESC LIMIT 1`).Scan(&record.PrevHash)
+		if errors.Is(err, sql.ErrNoRows) {
+			record.PrevHash = models.GenesisHash
+		} else if err != nil {
+			return err
+		}
+		record.Hash = record.ComputeHash()
+
+		// prev_hash is unique, so two records appended at once can't fork the chain
+		return tx.QueryRowContext(ctx, query,
+			record.AccountID,
+			record.Mode,
+			record.Reason,
+			record.RequestedBy,
+			record.ErasedAt,
+			record.PrevHash,
+			record.Hash,
+		).Scan(&record.ErasureID)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to append erasure record: %w", classify(err))
+	}
+	return nil
+}
+
+// ListErasureRecords returns the erasure log, oldest record first
+func (pr *sqlRepository) ListErasureRecords(ctx context.Context) ([]*models.ErasureRecord, error) {
+	query := `SELECT erasure_id, account_id, mode, reason, requested_by, erased_at, prev_hash, hash FROM erasure_log ORDER BY erasure_id`
+	rows, err := pr.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list erasure records: %w", classify(err))
+	}
+	defer rows.Close()
+
+	records := []*models.ErasureRecord{}
+	for rows.Next() {
+		r := &models.ErasureRecord{}
+		if err := rows.Scan(&r.ErasureID, &r.AccountID, &r.Mode, &r.Reason, &r.RequestedBy, &r.ErasedAt, &r.PrevHash, &r.Hash); err != nil {
+			return nil, fmt.Errorf("failed to scan erasure record: %w", classify(err))
+		}
+		records = append(records, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate erasure records: %w", classify(err))
+	}
+	return records, nil
+}
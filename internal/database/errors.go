@@ -0,0 +1,100 @@
+package database
+
+import (
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// classify wraps a database error in the apperrors type of its kind, so callers can tell
+// conflicts, invalid data and transient failures apart. Other errors are returned as they are.
+func classify(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "08", // connection exception
+			"40", // transaction rollback: serialization failure, deadlock
+			"53", // insufficient resources
+			"57": // operator intervention: admin shutdown, query canceled
+			return &apperrors.TransientError{Err: err}
+		case "22": // data exception
+			return &apperrors.ValidationError{Message: "invalid data", Err: err}
+		case "23": // integrity constraint violation
+			switch pqErr.Code.Name() {
+			case "not_null_violation", "check_violation":
+				return &apperrors.ValidationError{Message: "invalid data", Err: err}
+			default:
+				return &apperrors.ConflictError{Err: err}
+			}
+		}
+		return err
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code {
+		case sqlite3.ErrBusy, sqlite3.ErrLocked:
+			return &apperrors.TransientError{Err: err}
+		case sqlite3.ErrConstraint:
+			switch sqliteErr.ExtendedCode {
+			case sqlite3.ErrConstraintNotNull, sqlite3.ErrConstraintCheck:
+				return &apperrors.ValidationError{Message: "invalid data", Err: err}
+			default:
+				return &apperrors.ConflictError{Err: err}
+			}
+		}
+		return err
+	}
+
+	// Connections dropped by the network or the server
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.As(err, &netErr) {
+		return &apperrors.TransientError{Err: err}
+	}
+	return err
+}
+
+// retryable reports whether an operation that failed with err is worth running again
+func retryable(err error) bool {
+	var uncertain *uncertainError
+	if errors.As(err, &uncertain) {
+		return false
+	}
+	return errors.Is(classify(err), apperrors.ErrTransient)
+}
+
+// lostInFlight reports whether the connection dropped after the statement was sent,
+// so it isn't known whether the database ran it
+func lostInFlight(err error) bool {
+	// Failing to connect means the statement was never sent
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return false
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code.Class() == "08"
+	}
+
+	var netErr net.Error
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.As(err, &netErr)
+}
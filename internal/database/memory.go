@@ -0,0 +1,829 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/models"
+	"github.com/aldaircoronel/email-summary/internal/repository"
+)
+
+// Define the in-memory repository struct. It mirrors the semantics of the
+// PostgreSQL repository and is safe for concurrent use.
+type MemoryRepository struct {
+	mu sync.RWMutex
+	// txMu runs one transaction at a time
+	txMu sync.Mutex
+
+	accounts       map[int]*models.Account
+	transactions   []*models.Transaction
+	summaries      []*models.Summary
+	monthSummaries []*models.MonthSummary
+
+	retentionPolicies map[int]*models.RetentionPolicy
+	erasureLog        []*models.ErasureRecord
+	auditEvents       []*models.AuditEvent
+	outbox            []*models.OutboxMessage
+
+	// Last value handed out by each SERIAL column
+	lastAccountID      int
+	lastTransactionID  int
+	lastSummaryID      int
+	lastMonthSummaryID int
+	lastErasureID      int
+	lastAuditEventID   int
+	lastOutboxID       int
+}
+
+// Create a new in-memory repository instance
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		accounts:          make(map[int]*models.Account),
+		retentionPolicies: make(map[int]*models.RetentionPolicy),
+	}
+}
+
+// copyAccount returns a copy of the account that shares no memory with it
+func copyAccount(account *models.Account) *models.Account {
+	result := *account
+	result.Emails = append([]string(nil), account.Emails...)
+	return &result
+}
+
+// Implement the SaveAccount method of the Repository interface
+func (mr *MemoryRepository) SaveAccount(ctx context.Context, account *models.Account) (int, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	account.SetDefaults()
+
+	mr.lastAccountID++
+	account.AccountID = mr.lastAccountID
+	mr.accounts[account.AccountID] = copyAccount(account)
+	return account.AccountID, nil
+}
+
+// GetAccountByID retrieves the account with the given ID
+func (mr *MemoryRepository) GetAccountByID(ctx context.Context, id int) (*models.Account, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	account, ok := mr.accounts[id]
+	if !ok {
+		return nil, apperrors.NotFound("account", id)
+	}
+	return copyAccount(account), nil
+}
+
+// ListAccounts returns every account ordered by ID
+func (mr *MemoryRepository) ListAccounts(ctx context.Context) ([]*models.Account, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	accounts := make([]*models.Account, 0, len(mr.accounts))
+	for _, account := range mr.accounts {
+		accounts = append(accounts, copyAccount(account))
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].AccountID < accounts[j].AccountID
+	})
+	return accounts, nil
+}
+
+// UpdateAccount stores the profile of an existing account
+func (mr *MemoryRepository) UpdateAccount(ctx context.Context, account *models.Account) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if _, ok := mr.accounts[account.AccountID]; !ok {
+		return apperrors.NotFound("account", account.AccountID)
+	}
+	account.SetDefaults()
+	mr.accounts[account.AccountID] = copyAccount(account)
+	return nil
+}
+
+// DeleteAccount deletes an account. Accounts that still have transactions or summaries can't be deleted.
+func (mr *MemoryRepository) DeleteAccount(ctx context.Context, id int) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if _, ok := mr.accounts[id]; !ok {
+		return apperrors.NotFound("account", id)
+	}
+
+	// Enforce the foreign keys referencing the account
+	for _, trx := range mr.transactions {
+		if trx.AccountID == id {
+			return &apperrors.ConflictError{Err: fmt.Errorf("failed to delete account: account %d still has transactions", id)}
+		}
+	}
+	for _, s := range mr.summaries {
+		if s.AccountID == id {
+			return &apperrors.ConflictError{Err: fmt.Errorf("failed to delete account: account %d still has summaries", id)}
+		}
+	}
+
+	delete(mr.accounts, id)
+	delete(mr.retentionPolicies, id)
+	kept := mr.outbox[:0]
+	for _, msg := range mr.outbox {
+		if msg.AccountID != id {
+			kept = append(kept, msg)
+		}
+	}
+	mr.outbox = kept
+	return nil
+}
+
+// Implement the SaveTransaction method of the Repository interface
+func (mr *MemoryRepository) SaveTransaction(ctx context.Context, trx *models.Transaction) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	// Enforce the foreign key on account_id
+	if _, ok := mr.accounts[trx.AccountID]; !ok {
+		return &apperrors.ConflictError{Err: fmt.Errorf("failed to save transaction: account with id %d does not exist", trx.AccountID)}
+	}
+
+	// Enforce the unique index on (account_id, id)
+	for _, existing := range mr.transactions {
+		if existing.AccountID == trx.AccountID && existing.ID == trx.ID {
+			return &apperrors.ConflictError{Err: fmt.Errorf("failed to save transaction: account %d already has transaction %d", trx.AccountID, trx.ID)}
+		}
+	}
+
+	mr.lastTransactionID++
+	stored := *trx
+	stored.TransactionID = mr.lastTransactionID
+	mr.transactions = append(mr.transactions, &stored)
+	trx.TransactionID = stored.TransactionID
+	return nil
+}
+
+// Implement the GetTransactionByAccountID method of the Repository interface
+func (mr *MemoryRepository) GetTransactionByAccountID(ctx context.Context, accountID int) ([]*models.Transaction, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	var transactions []*models.Transaction
+	for _, trx := range mr.transactions {
+		if trx.AccountID == accountID {
+			result := *trx
+			transactions = append(transactions, &result)
+		}
+	}
+	return transactions, nil
+}
+
+// Implement the ListTransactions method of the Repository interface
+func (mr *MemoryRepository) ListTransactions(ctx context.Context) ([]*models.Transaction, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	transactions := make([]*models.Transaction, 0, len(mr.transactions))
+	for _, trx := range mr.transactions {
+		result := *trx
+		transactions = append(transactions, &result)
+	}
+
+	// Same order as ORDER BY date DESC
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].Date.After(transactions[j].Date)
+	})
+	return transactions, nil
+}
+
+// Implement the QueryTransactions method of the Repository interface
+func (mr *MemoryRepository) QueryTransactions(ctx context.Context, q repository.TransactionQuery) (*repository.TransactionPage, error) {
+	cursor, err := q.Normalize()
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction query: %w", err)
+	}
+
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	var matches []*models.Transaction
+	for _, trx := range mr.transactions {
+		if !q.Matches(trx) || cursor != nil && !cursor.After(trx) {
+			continue
+		}
+		result := *trx
+		matches = append(matches, &result)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return q.Less(matches[i], matches[j])
+	})
+
+	page := &repository.TransactionPage{Transactions: matches}
+	if page.Transactions == nil {
+		page.Transactions = []*models.Transaction{}
+	}
+	if len(matches) > q.Limit {
+		page.Transactions = matches[:q.Limit]
+		page.NextCursor = q.NewCursor(page.Transactions[q.Limit-1])
+	}
+	return page, nil
+}
+
+// copySummary returns a copy of the summary that shares no memory with it
+func copySummary(s *models.Summary) *models.Summary {
+	result := *s
+	result.Recipients = append([]string(nil), s.Recipients...)
+	return &result
+}
+
+// Implement the SaveSummary method of the Repository interface
+func (mr *MemoryRepository) SaveSummary(ctx context.Context, s *models.Summary) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if _, ok := mr.accounts[s.AccountID]; !ok {
+		return &apperrors.ConflictError{Err: fmt.Errorf("failed to save summary: account with id %d does not exist", s.AccountID)}
+	}
+
+	if s.GeneratedAt.IsZero() {
+		s.GeneratedAt = time.Now()
+	}
+	mr.lastSummaryID++
+	s.SummaryID = mr.lastSummaryID
+	mr.summaries = append(mr.summaries, copySummary(s))
+	return nil
+}
+
+// SaveSummaryContent stores the subject, bodies and recipients of the statement as it was delivered
+func (mr *MemoryRepository) SaveSummaryContent(ctx context.Context, s *models.Summary) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	for _, stored := range mr.summaries {
+		if stored.SummaryID == s.SummaryID {
+			stored.Subject = s.Subject
+			stored.HTMLBody = s.HTMLBody
+			stored.TextBody = s.TextBody
+			stored.Recipients = append([]string(nil), s.Recipients...)
+			return nil
+		}
+	}
+	return apperrors.NotFound("summary", s.SummaryID)
+}
+
+// Implement the GetSummaryByAccountID method of the Repository interface. It returns the latest summary of the account.
+func (mr *MemoryRepository) GetSummaryByAccountID(ctx context.Context, accountID int) (*models.Summary, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	var latest *models.Summary
+	for _, s := range mr.summaries {
+		if s.AccountID == accountID && (latest == nil || repository.NewerSummary(s, latest)) {
+			latest = s
+		}
+	}
+	if latest == nil {
+		return nil, apperrors.NotFound("summary for account", accountID)
+	}
+	return copySummary(latest), nil
+}
+
+// GetSummaryByID retrieves the summary with the given ID
+func (mr *MemoryRepository) GetSummaryByID(ctx context.Context, summaryID int) (*models.Summary, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	for _, s := range mr.summaries {
+		if s.SummaryID == summaryID {
+			return copySummary(s), nil
+		}
+	}
+	return nil, apperrors.NotFound("summary", summaryID)
+}
+
+// ListSummaries returns a list of all summaries for all accounts.
+func (mr *MemoryRepository) ListSummaries(ctx context.Context) ([]*models.Summary, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	summaries := make([]*models.Summary, 0, len(mr.summaries))
+	for _, s := range mr.summaries {
+		summaries = append(summaries, copySummary(s))
+	}
+	return summaries, nil
+}
+
+// ListSummariesByAccount returns one page of the statements of an account, newest first
+func (mr *MemoryRepository) ListSummariesByAccount(ctx context.Context, accountID int, page repository.SummaryPageRequest) (*repository.SummaryPage, error) {
+	cursor, err := page.Normalize()
+	if err != nil {
+		return nil, fmt.Errorf("invalid summary page: %w", err)
+	}
+
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	summaries := make([]*models.Summary, 0)
+	for _, s := range mr.summaries {
+		if s.AccountID != accountID || cursor != nil && !cursor.After(s) {
+			continue
+		}
+		summaries = append(summaries, copySummary(s))
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return repository.NewerSummary(summaries[i], summaries[j])
+	})
+
+	result := &repository.SummaryPage{Summaries: summaries}
+	if len(summaries) > page.Limit {
+		result.Summaries = summaries[:page.Limit]
+		result.NextCursor = repository.NewSummaryCursor(result.Summaries[page.Limit-1])
+	}
+	return result, nil
+}
+
+// Implement the SaveMonthSummary method of the Repository interface
+func (mr *MemoryRepository) SaveMonthSummary(ctx context.Context, ms *models.MonthSummary, summaryID int) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	// Enforce the foreign key on summary_id
+	found := false
+	for _, s := range mr.summaries {
+		if s.SummaryID == summaryID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return &apperrors.ConflictError{Err: fmt.Errorf("failed to save month summary: summary with id %d does not exist", summaryID)}
+	}
+
+	mr.lastMonthSummaryID++
+	stored := *ms
+	stored.MonthSummaryID = mr.lastMonthSummaryID
+	stored.SummaryID = summaryID
+	mr.monthSummaries = append(mr.monthSummaries, &stored)
+	ms.MonthSummaryID = stored.MonthSummaryID
+	return nil
+}
+
+// GetMonthSummaryBySummaryID returns a month summary by summary id
+func (mr *MemoryRepository) GetMonthSummaryBySummaryID(ctx context.Context, summaryID int) ([]*models.MonthSummary, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	var monthSummaries []*models.MonthSummary
+	for _, ms := range mr.monthSummaries {
+		if ms.SummaryID == summaryID {
+			result := *ms
+			monthSummaries = append(monthSummaries, &result)
+		}
+	}
+	return monthSummaries, nil
+}
+
+// DeleteTransactions deletes the transactions with the given IDs and returns how many were deleted
+func (mr *MemoryRepository) DeleteTransactions(ctx context.Context, ids []int) (int, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	remove := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		remove[id] = true
+	}
+	kept := mr.transactions[:0]
+	for _, trx := range mr.transactions {
+		if !remove[trx.TransactionID] {
+			kept = append(kept, trx)
+		}
+	}
+	deleted := len(mr.transactions) - len(kept)
+	mr.transactions = kept
+	return deleted, nil
+}
+
+// DeleteSummaries deletes the summaries with the given IDs along with their month summaries,
+// and returns how many summaries were deleted
+func (mr *MemoryRepository) DeleteSummaries(ctx context.Context, ids []int) (int, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	remove := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		remove[id] = true
+	}
+	keptMonths := mr.monthSummaries[:0]
+	for _, ms := range mr.monthSummaries {
+		if !remove[ms.SummaryID] {
+			keptMonths = append(keptMonths, ms)
+		}
+	}
+	mr.monthSummaries = keptMonths
+
+	kept := mr.summaries[:0]
+	for _, s := range mr.summaries {
+		if !remove[s.SummaryID] {
+			kept = append(kept, s)
+		}
+	}
+	deleted := len(mr.summaries) - len(kept)
+	mr.summaries = kept
+
+	// The outbox keeps the messages of deleted summaries, unlinked from them
+	for _, msg := range mr.outbox {
+		if remove[msg.SummaryID] {
+			msg.SummaryID = 0
+		}
+	}
+	return deleted, nil
+}
+
+// copyRetentionPolicy returns a copy of the policy that shares no memory with it
+func copyRetentionPolicy(policy *models.RetentionPolicy) *models.RetentionPolicy {
+	result := models.RetentionPolicy{AccountID: policy.AccountID}
+	if policy.TransactionMonths != nil {
+		months := *policy.TransactionMonths
+		result.TransactionMonths = &months
+	}
+	if policy.SummaryMonths != nil {
+		months := *policy.SummaryMonths
+		result.SummaryMonths = &months
+	}
+	return &result
+}
+
+// GetRetentionPolicy returns the retention rules of an account
+func (mr *MemoryRepository) GetRetentionPolicy(ctx context.Context, accountID int) (*models.RetentionPolicy, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	policy, ok := mr.retentionPolicies[accountID]
+	if !ok {
+		return nil, apperrors.NotFound("retention policy for account", accountID)
+	}
+	return copyRetentionPolicy(policy), nil
+}
+
+// SaveRetentionPolicy creates or replaces the retention rules of an account
+func (mr *MemoryRepository) SaveRetentionPolicy(ctx context.Context, policy *models.RetentionPolicy) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	// Enforce the foreign key on account_id
+	if _, ok := mr.accounts[policy.AccountID]; !ok {
+		return &apperrors.ConflictError{Err: fmt.Errorf("failed to save retention policy: account with id %d does not exist", policy.AccountID)}
+	}
+	mr.retentionPolicies[policy.AccountID] = copyRetentionPolicy(policy)
+	return nil
+}
+
+// DeleteRetentionPolicy removes the retention rules of an account, so the global rules apply to it
+func (mr *MemoryRepository) DeleteRetentionPolicy(ctx context.Context, accountID int) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if _, ok := mr.retentionPolicies[accountID]; !ok {
+		return apperrors.NotFound("retention policy for account", accountID)
+	}
+	delete(mr.retentionPolicies, accountID)
+	return nil
+}
+
+// AppendErasureRecord adds a record to the end of the erasure log, chaining it to the last one
+func (mr *MemoryRepository) AppendErasureRecord(ctx context.Context, record *models.ErasureRecord) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if record.ErasedAt.IsZero() {
+		record.ErasedAt = time.Now()
+	}
+	record.ErasedAt = record.ErasedAt.UTC().Truncate(time.Microsecond)
+
+	record.PrevHash = models.GenesisHash
+	if n := len(mr.erasureLog); n > 0 {
+		record.PrevHash = mr.erasureLog[n-1].Hash
+	}
+	record.Hash = record.ComputeHash()
+
+	mr.lastErasureID++
+	record.ErasureID = mr.lastErasureID
+	stored := *record
+	mr.erasureLog = append(mr.erasureLog, &stored)
+	return nil
+}
+
+// ListErasureRecords returns the erasure log, oldest record first
+func (mr *MemoryRepository) ListErasureRecords(ctx context.Context) ([]*models.ErasureRecord, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	records := make([]*models.ErasureRecord, 0, len(mr.erasureLog))
+	for _, record := range mr.erasureLog {
+		result := *record
+		records = append(records, &result)
+	}
+	return records, nil
+}
+
+// SaveAuditEvent appends an event to the audit log
+func (mr *MemoryRepository) SaveAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+	event.OccurredAt = event.OccurredAt.UTC().Truncate(time.Microsecond)
+
+	mr.lastAuditEventID++
+	event.EventID = mr.lastAuditEventID
+	stored := *event
+	mr.auditEvents = append(mr.auditEvents, &stored)
+	return nil
+}
+
+// ListAuditEvents returns one page of the audit events matching the query, oldest first
+func (mr *MemoryRepository) ListAuditEvents(ctx context.Context, q repository.AuditQuery) (*repository.AuditPage, error) {
+	afterID, err := q.Normalize()
+	if err != nil {
+		return nil, fmt.Errorf("invalid audit query: %w", err)
+	}
+
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	page := &repository.AuditPage{Events: []*models.AuditEvent{}}
+	for _, event := range mr.auditEvents {
+		if event.EventID <= afterID || !q.Matches(event) {
+			continue
+		}
+		if len(page.Events) == q.Limit {
+			page.NextCursor = repository.NewAuditCursor(page.Events[q.Limit-1])
+			break
+		}
+		result := *event
+		page.Events = append(page.Events, &result)
+	}
+	return page, nil
+}
+
+// copyOutboxMessage returns a copy of the message that shares no memory with it
+func copyOutboxMessage(msg *models.OutboxMessage) *models.OutboxMessage {
+	result := *msg
+	result.Payload = append([]byte(nil), msg.Payload...)
+	return &result
+}
+
+// enqueue queues a message; the caller holds the lock
+func (mr *MemoryRepository) enqueue(msg *models.OutboxMessage) error {
+	// Enforce the foreign keys on account_id and summary_id
+	if _, ok := mr.accounts[msg.AccountID]; !ok {
+		return &apperrors.ConflictError{Err: fmt.Errorf("failed to enqueue message: account with id %d does not exist", msg.AccountID)}
+	}
+	if msg.SummaryID != 0 && mr.summary(msg.SummaryID) == nil {
+		return &apperrors.ConflictError{Err: fmt.Errorf("failed to enqueue message: summary with id %d does not exist", msg.SummaryID)}
+	}
+
+	newOutboxMessage(msg)
+	mr.lastOutboxID++
+	msg.OutboxID = mr.lastOutboxID
+	mr.outbox = append(mr.outbox, copyOutboxMessage(msg))
+	return nil
+}
+
+// summary returns the stored summary with the given ID, nil if there is none; the caller holds the lock
+func (mr *MemoryRepository) summary(id int) *models.Summary {
+	for _, s := range mr.summaries {
+		if s.SummaryID == id {
+			return s
+		}
+	}
+	return nil
+}
+
+// EnqueueStatement archives the delivered content of the summary and queues the message that delivers it, at once
+func (mr *MemoryRepository) EnqueueStatement(ctx context.Context, s *models.Summary, msg *models.OutboxMessage) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	stored := mr.summary(s.SummaryID)
+	if stored == nil {
+		return apperrors.NotFound("summary", s.SummaryID)
+	}
+	if err := mr.enqueue(msg); err != nil {
+		return err
+	}
+	stored.Subject = s.Subject
+	stored.HTMLBody = s.HTMLBody
+	stored.TextBody = s.TextBody
+	stored.Recipients = append([]string(nil), s.Recipients...)
+	return nil
+}
+
+// EnqueueMessage queues a message for delivery
+func (mr *MemoryRepository) EnqueueMessage(ctx context.Context, msg *models.OutboxMessage) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	return mr.enqueue(msg)
+}
+
+// GetOutboxMessage retrieves the outbox message with the given ID
+func (mr *MemoryRepository) GetOutboxMessage(ctx context.Context, id int) (*models.OutboxMessage, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	for _, msg := range mr.outbox {
+		if msg.OutboxID == id {
+			return copyOutboxMessage(msg), nil
+		}
+	}
+	return nil, apperrors.NotFound("outbox message", id)
+}
+
+// ListOutboxMessages returns one page of the outbox messages matching the query, oldest first
+func (mr *MemoryRepository) ListOutboxMessages(ctx context.Context, q repository.OutboxQuery) (*repository.OutboxPage, error) {
+	afterID, err := q.Normalize()
+	if err != nil {
+		return nil, fmt.Errorf("invalid outbox query: %w", err)
+	}
+
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	page := &repository.OutboxPage{Messages: []*models.OutboxMessage{}}
+	for _, msg := range mr.outbox {
+		if msg.OutboxID <= afterID || !q.Matches(msg) {
+			continue
+		}
+		if len(page.Messages) == q.Limit {
+			page.NextCursor = repository.NewOutboxCursor(page.Messages[q.Limit-1])
+			break
+		}
+		page.Messages = append(page.Messages, copyOutboxMessage(msg))
+	}
+	return page, nil
+}
+
+// UpdateOutboxMessage stores the delivery state of the message, unless another worker or an operator changed it first
+func (mr *MemoryRepository) UpdateOutboxMessage(ctx context.Context, msg *models.OutboxMessage, prevStatus string, prevAttempts int) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	for _, stored := range mr.outbox {
+		if stored.OutboxID != msg.OutboxID {
+			continue
+		}
+		if stored.Status != prevStatus || stored.Attempts != prevAttempts {
+			return &apperrors.ConflictError{Err: fmt.Errorf("outbox message %d changed since it was read", msg.OutboxID)}
+		}
+		msg.NextAttemptAt = outboxTime(msg.NextAttemptAt)
+		msg.UpdatedAt = outboxTime(time.Now())
+		if !msg.SentAt.IsZero() {
+			msg.SentAt = outboxTime(msg.SentAt)
+		}
+		stored.Status = msg.Status
+		stored.Attempts = msg.Attempts
+		stored.NextAttemptAt = msg.NextAttemptAt
+		stored.LastError = msg.LastError
+		stored.UpdatedAt = msg.UpdatedAt
+		stored.SentAt = msg.SentAt
+		return nil
+	}
+	return apperrors.NotFound("outbox message", msg.OutboxID)
+}
+
+// DeleteOutboxMessages deletes the outbox messages with the given IDs and returns how many were deleted
+func (mr *MemoryRepository) DeleteOutboxMessages(ctx context.Context, ids []int) (int, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	remove := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		remove[id] = true
+	}
+	kept := mr.outbox[:0]
+	for _, msg := range mr.outbox {
+		if !remove[msg.OutboxID] {
+			kept = append(kept, msg)
+		}
+	}
+	deleted := len(mr.outbox) - len(kept)
+	mr.outbox = kept
+	return deleted, nil
+}
+
+// memoryState is a copy of the rows of a MemoryRepository, taken when a transaction begins to restore
+// them if it fails
+type memoryState struct {
+	accounts          map[int]*models.Account
+	transactions      []*models.Transaction
+	summaries         []*models.Summary
+	monthSummaries    []*models.MonthSummary
+	retentionPolicies map[int]*models.RetentionPolicy
+	erasureLog        []*models.ErasureRecord
+	auditEvents       []*models.AuditEvent
+	outbox            []*models.OutboxMessage
+
+	lastAccountID, lastTransactionID, lastSummaryID, lastMonthSummaryID, lastErasureID, lastAuditEventID, lastOutboxID int
+}
+
+// copyRows returns a slice holding copies of the rows, which the repository updates in place
+func copyRows[T any](rows []*T) []*T {
+	result := make([]*T, len(rows))
+	for i, row := range rows {
+		copied := *row
+		result[i] = &copied
+	}
+	return result
+}
+
+// snapshot copies the rows of the repository. Accounts and retention policies are replaced rather than
+// updated when they change, so their maps only need a copy.
+func (mr *MemoryRepository) snapshot() *memoryState {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	state := &memoryState{
+		accounts:           make(map[int]*models.Account, len(mr.accounts)),
+		transactions:       copyRows(mr.transactions),
+		summaries:          copyRows(mr.summaries),
+		monthSummaries:     copyRows(mr.monthSummaries),
+		retentionPolicies:  make(map[int]*models.RetentionPolicy, len(mr.retentionPolicies)),
+		erasureLog:         copyRows(mr.erasureLog),
+		auditEvents:        copyRows(mr.auditEvents),
+		outbox:             copyRows(mr.outbox),
+		lastAccountID:      mr.lastAccountID,
+		lastTransactionID:  mr.lastTransactionID,
+		lastSummaryID:      mr.lastSummaryID,
+		lastMonthSummaryID: mr.lastMonthSummaryID,
+		lastErasureID:      mr.lastErasureID,
+		lastAuditEventID:   mr.lastAuditEventID,
+		lastOutboxID:       mr.lastOutboxID,
+	}
+	for id, account := range mr.accounts {
+		state.accounts[id] = account
+	}
+	for id, policy := range mr.retentionPolicies {
+		state.retentionPolicies[id] = policy
+	}
+	return state
+}
+
+// restore puts back the rows of a snapshot
+func (mr *MemoryRepository) restore(state *memoryState) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	mr.accounts = state.accounts
+	mr.transactions = state.transactions
+	mr.summaries = state.summaries
+	mr.monthSummaries = state.monthSummaries
+	mr.retentionPolicies = state.retentionPolicies
+	mr.erasureLog = state.erasureLog
+	mr.auditEvents = state.auditEvents
+	mr.outbox = state.outbox
+	mr.lastAccountID = state.lastAccountID
+	mr.lastTransactionID = state.lastTransactionID
+	mr.lastSummaryID = state.lastSummaryID
+	mr.lastMonthSummaryID = state.lastMonthSummaryID
+	mr.lastErasureID = state.lastErasureID
+	mr.lastAuditEventID = state.lastAuditEventID
+	mr.lastOutboxID = state.lastOutboxID
+}
+
+// InTx runs fn with the repository, putting back the rows as they were if it fails. Transactions run
+// one at a time, and changes made outside them while one runs are undone with it.
+func (mr *MemoryRepository) InTx(ctx context.Context, fn func(repo repository.Repository) error) error {
+	mr.txMu.Lock()
+	defer mr.txMu.Unlock()
+
+	state := mr.snapshot()
+	if err := fn(&memoryTx{mr}); err != nil {
+		mr.restore(state)
+		return err
+	}
+	return nil
+}
+
+// memoryTx is the repository InTx hands out, which joins the transaction when InTx is called again
+type memoryTx struct {
+	*MemoryRepository
+}
+
+func (tx *memoryTx) InTx(ctx context.Context, fn func(repo repository.Repository) error) error {
+	return fn(tx)
+}
+
+// Ping always succeeds for the in-memory repository
+func (mr *MemoryRepository) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Close is a no-op for the in-memory repository; the data is kept until the process exits.
+func (mr *MemoryRepository) Close() error {
+	return nil
+}
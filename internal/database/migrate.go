@@ -0,0 +1,295 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+)
+
+// Numbered up/down migrations for each SQL dialect, named <version>_<name>.<up|down>.sql
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Migration is one numbered schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a migration has been applied to the database
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// ErrSchemaOutOfDate is returned by CheckSchema, wrapped in an apperrors.ConflictError, when the database
+// schema doesn't match this binary
+var ErrSchemaOutOfDate = errors.New("database schema is out of date")
+
+// Migrator is implemented by the repositories whose schema is managed by migrations
+type Migrator interface {
+	MigrateUp(ctx context.Context) ([]Migration, error)
+	MigrateDown(ctx context.Context, steps int) ([]Migration, error)
+	MigrationStatus(ctx context.Context) ([]MigrationStatus, error)
+	CheckSchema(ctx context.Context) error
+}
+
+// loadMigrations reads the migrations of the given dialect sorted by version
+func loadMigrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s migrations: %w", dialect, err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+
+		// Split "0001_init.up.sql" into version, name and direction
+		base := strings.TrimSuffix(name, ".sql")
+		direction := path.Ext(base)
+		base = strings.TrimSuffix(base, direction)
+		parts := strings.SplitN(base, "_", 2)
+		if len(parts) != 2 || (direction != ".up" && direction != ".down") {
+			return nil, fmt.Errorf("invalid migration file name %q", name)
+		}
+		version, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %q: %w", name, err)
+		}
+
+		content, err := fs.ReadFile(migrationFiles, path.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %q: %w", name, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = m
+		}
+		if direction == ".up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// ensureMigrationsTable creates the schema_migrations table if it doesn't exist
+func (r *sqlRepository) ensureMigrationsTable(ctx context.Context) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		)
+	`
+	if _, err := r.db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", classify(err))
+	}
+	return nil
+}
+
+// migrationsTableExists reports whether the schema_migrations table has been created, without creating it
+func (r *sqlRepository) migrationsTableExists(ctx context.Context) (bool, error) {
+	query := `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = 'schema_migrations'`
+	if r.dialect == "sqlite" {
+		query = `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`
+	}
+	var count int
+	if err := r.db.QueryRowContext(ctx, query).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to look up the schema_migrations table: %w", classify(err))
+	}
+	return count > 0, nil
+}
+
+// appliedMigrations returns the time each applied migration version was applied. It only reads the
+// database: without a schema_migrations table no migration has been applied.
+func (r *sqlRepository) appliedMigrations(ctx context.Context) (map[int]time.Time, error) {
+	applied := make(map[int]time.Time)
+	if exists, err := r.migrationsTableExists(ctx); err != nil || !exists {
+		return applied, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", classify(err))
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan applied migration: %w", classify(err))
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", classify(err))
+	}
+	return applied, nil
+}
+
+// runMigration executes a migration script and records it in schema_migrations within one transaction
+func (r *sqlRepository) runMigration(ctx context.Context, script string, record func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := record(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// MigrateUp applies every pending migration in order and returns the ones applied
+func (r *sqlRepository) MigrateUp(ctx context.Context) ([]Migration, error) {
+	migrations, err := loadMigrations(r.dialect)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.ensureMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := r.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		err := r.runMigration(ctx, m.Up, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`, m.Version, m.Name, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("failed to apply migration %04d_%s: %w", m.Version, m.Name, classify(err))
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// MigrateDown reverts the given number of most recently applied migrations and returns the ones reverted
+func (r *sqlRepository) MigrateDown(ctx context.Context, steps int) ([]Migration, error) {
+	migrations, err := loadMigrations(r.dialect)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := r.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		err := r.runMigration(ctx, m.Down, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("failed to revert migration %04d_%s: %w", m.Version, m.Name, classify(err))
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// MigrationStatus lists every known migration and whether it has been applied
+func (r *sqlRepository) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(r.dialect)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := r.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		appliedAt, ok := applied[m.Version]
+		status = append(status, MigrationStatus{
+			Version:   m.Version,
+			Name:      m.Name,
+			Applied:   ok,
+			AppliedAt: appliedAt,
+		})
+	}
+	return status, nil
+}
+
+// CheckSchema returns a conflict error wrapping ErrSchemaOutOfDate unless the database is at the schema
+// version this binary expects. It only reads the database, so it works with read-only credentials.
+func (r *sqlRepository) CheckSchema(ctx context.Context) error {
+	migrations, err := loadMigrations(r.dialect)
+	if err != nil {
+		return err
+	}
+	applied, err := r.appliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	known := make(map[int]bool, len(migrations))
+	var pending []string
+	for _, m := range migrations {
+		known[m.Version] = true
+		if _, ok := applied[m.Version]; !ok {
+			pending = append(pending, fmt.Sprintf("%04d_%s", m.Version, m.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return &apperrors.ConflictError{Err: fmt.Errorf("%w, pending migrations: %s (run the migrate up command)", ErrSchemaOutOfDate, strings.Join(pending, ", "))}
+	}
+
+	// A newer binary has migrated the database past what this one knows about
+	for version := range applied {
+		if !known[version] {
+			return &apperrors.ConflictError{Err: fmt.Errorf("%w, version %04d is newer than this binary supports", ErrSchemaOutOfDate, version)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/database"
+	"github.com/aldaircoronel/email-summary/internal/models"
+)
+
+// openReadOnly opens the SQLite file without write access, as a read-only database credential would
+func openReadOnly(t *testing.T, path string) *database.SQLiteRepository {
+	t.Helper()
+	repo, err := database.NewSQLiteRepository(context.Background(), "file:"+path+"?mode=ro", database.Options{})
+	if err != nil {
+		t.Fatalf("NewSQLiteRepository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func TestCheckSchemaReadOnly(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "statements.db")
+	// An empty file is an empty SQLite database
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a schema_migrations table every migration is pending
+	err := openReadOnly(t, path).CheckSchema(ctx)
+	if !errors.Is(err, database.ErrSchemaOutOfDate) || !errors.Is(err, apperrors.ErrConflict) {
+		t.Fatalf("CheckSchema of an empty database returned %v, want a conflict wrapping ErrSchemaOutOfDate", err)
+	}
+	if code := apperrors.ExitCode(err); code != apperrors.ExitConflict {
+		t.Errorf("ExitCode = %d, want %d", code, apperrors.ExitConflict)
+	}
+	status, err := openReadOnly(t, path).MigrationStatus(ctx)
+	if err != nil {
+		t.Fatalf("MigrationStatus: %v", err)
+	}
+	for _, m := range status {
+		if m.Applied {
+			t.Errorf("migration %04d_%s is applied in an empty database", m.Version, m.Name)
+		}
+	}
+
+	repo, err := database.NewSQLiteRepository(ctx, path, database.Options{})
+	if err != nil {
+		t.Fatalf("NewSQLiteRepository: %v", err)
+	}
+	defer repo.Close()
+	if _, err := repo.MigrateUp(ctx); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	if err := openReadOnly(t, path).CheckSchema(ctx); err != nil {
+		t.Errorf("CheckSchema of a migrated database returned %v", err)
+	}
+}
+
+func TestTransactionIDMigrationKeepsDuplicates(t *testing.T) {
+	ctx := context.Background()
+	repo, err := database.NewSQLiteRepository(ctx, filepath.Join(t.TempDir(), "statements.db"), database.Options{})
+	if err != nil {
+		t.Fatalf("NewSQLiteRepository: %v", err)
+	}
+	defer repo.Close()
+	if _, err := repo.MigrateUp(ctx); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+
+	// Import the same file twice into a database from before the unique index
+	if reverted, err := repo.MigrateDown(ctx, 1); err != nil || len(reverted) != 1 || reverted[0].Name != "transaction_id_unique" {
+		t.Fatalf("MigrateDown reverted %v, %v, want the transaction_id_unique migration", reverted, err)
+	}
+	accountID, err := repo.SaveAccount(ctx, &models.Account{HolderName: "Ana López"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		for id := 0; id < 3; id++ {
+			transaction := &models.Transaction{ID: id, Date: time.Date(2022, time.July, 15, 0, 0, 0, 0, time.UTC), Amount: 10, IsCredit: true, AccountID: accountID}
+			if err := repo.SaveTransaction(ctx, transaction); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	count := func() int {
+		t.Helper()
+		transactions, err := repo.GetTransactionByAccountID(ctx, accountID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(transactions)
+	}
+	if _, err := repo.MigrateUp(ctx); err != nil {
+		t.Fatalf("MigrateUp with duplicate transactions: %v", err)
+	}
+	if n := count(); n != 3 {
+		t.Errorf("the account has %d transactions after the migration, want one of each ID", n)
+	}
+	// The copies are set aside rather than deleted, and reverting the migration puts them back
+	if _, err := repo.MigrateDown(ctx, 1); err != nil {
+		t.Fatalf("MigrateDown: %v", err)
+	}
+	if n := count(); n != 6 {
+		t.Errorf("the account has %d transactions after reverting the migration, want all 6", n)
+	}
+}
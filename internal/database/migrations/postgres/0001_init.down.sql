@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS month_summary;
+DROP TABLE IF EXISTS summary;
+DROP TABLE IF EXISTS transactions;
+DROP TABLE IF EXISTS accounts;
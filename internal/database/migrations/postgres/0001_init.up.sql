@@ -1,14 +1,10 @@
 -- create the accounts table
-DROP TABLE IF EXISTS accounts CASCADE;
-
-CREATE TABLE accounts (
+CREATE TABLE IF NOT EXISTS accounts (
     account_id SERIAL PRIMARY KEY
 );
 
 -- create the transactions table
-DROP TABLE IF EXISTS transactions;
-
-CREATE TABLE transactions (
+CREATE TABLE IF NOT EXISTS transactions (
     transaction_id SERIAL PRIMARY KEY,
     account_id SERIAL NOT NULL,
     id INTEGER NOT NULL,
@@ -19,9 +15,7 @@ CREATE TABLE transactions (
 );
 
 -- create the summary table
-DROP TABLE IF EXISTS summary CASCADE;
-
-CREATE TABLE summary (
+CREATE TABLE IF NOT EXISTS summary (
     summary_id SERIAL PRIMARY KEY,
     account_id SERIAL NOT NULL,
     total_balance FLOAT NOT NULL,
@@ -34,9 +28,7 @@ CREATE TABLE summary (
 );
 
 -- create the month_summary table
-DROP TABLE IF EXISTS month_summary;
-
-CREATE TABLE month_summary (
+CREATE TABLE IF NOT EXISTS month_summary (
     month_summary_id SERIAL PRIMARY KEY,
     month VARCHAR(10) NOT NULL,
     total_balance FLOAT NOT NULL,
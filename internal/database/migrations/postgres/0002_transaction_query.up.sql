@@ -0,0 +1,8 @@
+-- categorize transactions so they can be filtered by category
+ALTER TABLE transactions ADD COLUMN category VARCHAR(64) NOT NULL DEFAULT '';
+
+-- indexes backing QueryTransactions: every sort order is paginated on (sort column, transaction_id)
+CREATE INDEX transactions_account_date_idx ON transactions (account_id, date, transaction_id);
+CREATE INDEX transactions_account_amount_idx ON transactions (account_id, amount, transaction_id);
+CREATE INDEX transactions_account_category_idx ON transactions (account_id, category);
+CREATE INDEX transactions_date_idx ON transactions (date, transaction_id);
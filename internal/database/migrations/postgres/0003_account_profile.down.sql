@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS account_emails;
+
+ALTER TABLE accounts DROP COLUMN status;
+ALTER TABLE accounts DROP COLUMN locale;
+ALTER TABLE accounts DROP COLUMN currency;
+ALTER TABLE accounts DROP COLUMN holder_name;
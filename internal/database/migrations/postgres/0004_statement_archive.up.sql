@@ -0,0 +1,10 @@
+-- keep every generated summary as a statement: its period, generation time and delivered content
+ALTER TABLE summary ADD COLUMN period_start TIMESTAMPTZ;
+ALTER TABLE summary ADD COLUMN period_end TIMESTAMPTZ;
+ALTER TABLE summary ADD COLUMN generated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE summary ADD COLUMN subject VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE summary ADD COLUMN html_body TEXT NOT NULL DEFAULT '';
+ALTER TABLE summary ADD COLUMN recipients TEXT NOT NULL DEFAULT '';
+
+-- index backing ListSummariesByAccount, newest first
+CREATE INDEX summary_account_generated_idx ON summary (account_id, generated_at, summary_id);
@@ -0,0 +1,2 @@
+-- keep the plain-text part of the delivered statement next to its HTML body
+ALTER TABLE summary ADD COLUMN text_body TEXT NOT NULL DEFAULT '';
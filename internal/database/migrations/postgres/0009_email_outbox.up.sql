@@ -0,0 +1,21 @@
+-- rendered emails waiting to be delivered, with the state of their delivery attempts. Statements
+-- are queued in the same transaction that archives their content, so none is lost if sending fails.
+CREATE TABLE email_outbox (
+    outbox_id SERIAL PRIMARY KEY,
+    account_id INTEGER NOT NULL,
+    summary_id INTEGER,
+    payload BYTEA NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    sent_at TIMESTAMPTZ,
+    FOREIGN KEY (account_id) REFERENCES accounts(account_id) ON DELETE CASCADE,
+    FOREIGN KEY (summary_id) REFERENCES summary(summary_id) ON DELETE SET NULL
+);
+
+-- indexes backing the due messages the outbox worker claims, and the messages of an account
+CREATE INDEX email_outbox_due_idx ON email_outbox (status, next_attempt_at);
+CREATE INDEX email_outbox_account_idx ON email_outbox (account_id, outbox_id);
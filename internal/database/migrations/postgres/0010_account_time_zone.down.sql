@@ -0,0 +1,3 @@
+ALTER TABLE transactions ALTER COLUMN date TYPE TIMESTAMP USING date AT TIME ZONE 'UTC';
+
+ALTER TABLE accounts DROP COLUMN time_zone;
@@ -0,0 +1,5 @@
+-- time zone of each account, which dates without a zone are read in and months are grouped by
+ALTER TABLE accounts ADD COLUMN time_zone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+
+-- store instants: the dates written before were UTC times without a zone
+ALTER TABLE transactions ALTER COLUMN date TYPE TIMESTAMPTZ USING date AT TIME ZONE 'UTC';
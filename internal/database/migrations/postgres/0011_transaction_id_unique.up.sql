@@ -0,0 +1,9 @@
+-- a transaction ID appears once per account, so importing a file again doesn't count its rows twice;
+-- the copies imported before are moved to transactions_duplicates, keeping the first one, rather than
+-- dropped, and the down migration puts them back
+CREATE TABLE transactions_duplicates AS
+    SELECT * FROM transactions WHERE transaction_id NOT IN (
+        SELECT MIN(transaction_id) FROM transactions GROUP BY account_id, id
+    );
+DELETE FROM transactions WHERE transaction_id IN (SELECT transaction_id FROM transactions_duplicates);
+CREATE UNIQUE INDEX transactions_account_id_idx ON transactions (account_id, id);
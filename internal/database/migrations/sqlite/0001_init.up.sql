@@ -0,0 +1,42 @@
+-- create the accounts table
+CREATE TABLE IF NOT EXISTS accounts (
+    account_id INTEGER PRIMARY KEY AUTOINCREMENT
+);
+
+-- create the transactions table
+CREATE TABLE IF NOT EXISTS transactions (
+    transaction_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    account_id INTEGER NOT NULL,
+    id INTEGER NOT NULL,
+    date TIMESTAMP NOT NULL,
+    amount FLOAT NOT NULL,
+    is_credit BOOLEAN NOT NULL,
+    FOREIGN KEY (account_id) REFERENCES accounts(account_id)
+);
+
+-- create the summary table
+CREATE TABLE IF NOT EXISTS summary (
+    summary_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    account_id INTEGER NOT NULL,
+    total_balance FLOAT NOT NULL,
+    total_transactions INTEGER NOT NULL,
+    num_of_credit_transactions INTEGER NOT NULL,
+    num_of_debit_transactions INTEGER NOT NULL,
+    total_average_credit FLOAT NOT NULL,
+    total_average_debit FLOAT NOT NULL,
+    FOREIGN KEY (account_id) REFERENCES accounts(account_id)
+);
+
+-- create the month_summary table
+CREATE TABLE IF NOT EXISTS month_summary (
+    month_summary_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    month VARCHAR(10) NOT NULL,
+    total_balance FLOAT NOT NULL,
+    total_transactions INTEGER NOT NULL,
+    num_of_credit_transactions INTEGER NOT NULL,
+    num_of_debit_transactions INTEGER NOT NULL,
+    average_credit FLOAT NOT NULL,
+    average_debit FLOAT NOT NULL,
+    summary_id INTEGER NOT NULL,
+    FOREIGN KEY (summary_id) REFERENCES summary(summary_id)
+);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS transactions_date_idx;
+DROP INDEX IF EXISTS transactions_account_category_idx;
+DROP INDEX IF EXISTS transactions_account_amount_idx;
+DROP INDEX IF EXISTS transactions_account_date_idx;
+
+ALTER TABLE transactions DROP COLUMN category;
@@ -0,0 +1,14 @@
+-- account holder profile
+ALTER TABLE accounts ADD COLUMN holder_name VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE accounts ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE accounts ADD COLUMN locale VARCHAR(16) NOT NULL DEFAULT 'en';
+ALTER TABLE accounts ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'active';
+
+-- contact emails of each account, position 0 is the primary address
+CREATE TABLE account_emails (
+    account_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    email VARCHAR(320) NOT NULL,
+    PRIMARY KEY (account_id, position),
+    FOREIGN KEY (account_id) REFERENCES accounts(account_id) ON DELETE CASCADE
+);
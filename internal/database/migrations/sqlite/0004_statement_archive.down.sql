@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS summary_account_generated_idx;
+
+ALTER TABLE summary DROP COLUMN recipients;
+ALTER TABLE summary DROP COLUMN html_body;
+ALTER TABLE summary DROP COLUMN subject;
+ALTER TABLE summary DROP COLUMN generated_at;
+ALTER TABLE summary DROP COLUMN period_end;
+ALTER TABLE summary DROP COLUMN period_start;
@@ -0,0 +1,7 @@
+-- retention rules of each account, NULL falls back to the global rule and 0 keeps the rows forever
+CREATE TABLE retention_policy (
+    account_id INTEGER PRIMARY KEY,
+    transaction_months INTEGER,
+    summary_months INTEGER,
+    FOREIGN KEY (account_id) REFERENCES accounts(account_id) ON DELETE CASCADE
+);
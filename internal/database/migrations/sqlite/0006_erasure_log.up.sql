@@ -0,0 +1,13 @@
+-- append-only log of the erasures of personal data. Each record holds the hash of the previous
+-- one, so editing or removing a record breaks the chain. It has no foreign key, the records
+-- outlive the accounts they refer to.
+CREATE TABLE erasure_log (
+    erasure_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    account_id INTEGER NOT NULL,
+    mode VARCHAR(16) NOT NULL,
+    reason TEXT NOT NULL,
+    requested_by VARCHAR(255) NOT NULL,
+    erased_at TIMESTAMP NOT NULL,
+    prev_hash VARCHAR(64) NOT NULL UNIQUE,
+    hash VARCHAR(64) NOT NULL
+);
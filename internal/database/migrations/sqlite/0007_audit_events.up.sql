@@ -0,0 +1,16 @@
+-- append-only audit log of the changes to the data and the emails sent
+CREATE TABLE audit_events (
+    event_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    occurred_at TIMESTAMP NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    action VARCHAR(32) NOT NULL,
+    entity VARCHAR(32) NOT NULL,
+    entity_id VARCHAR(255) NOT NULL,
+    before_hash VARCHAR(64) NOT NULL,
+    after_hash VARCHAR(64) NOT NULL,
+    details TEXT NOT NULL
+);
+
+-- indexes backing the filters of ListAuditEvents
+CREATE INDEX audit_events_entity_idx ON audit_events (entity, entity_id, event_id);
+CREATE INDEX audit_events_occurred_idx ON audit_events (occurred_at, event_id);
@@ -0,0 +1 @@
+ALTER TABLE summary DROP COLUMN text_body;
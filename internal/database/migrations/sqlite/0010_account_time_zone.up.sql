@@ -0,0 +1,2 @@
+-- time zone of each account, which dates without a zone are read in and months are grouped by
+ALTER TABLE accounts ADD COLUMN time_zone VARCHAR(64) NOT NULL DEFAULT 'UTC';
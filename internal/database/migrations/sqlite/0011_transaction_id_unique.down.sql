@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS transactions_account_id_idx;
+INSERT INTO transactions SELECT * FROM transactions_duplicates;
+DROP TABLE transactions_duplicates;
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+)
+
+// Options tune the connection pool and the retries of the SQL repositories.
+// Zero values take the defaults below; a negative MaxRetries disables retries.
+type Options struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// ConnectTimeout bounds the check that the database is reachable when the repository is created
+	ConnectTimeout time.Duration
+
+	// MaxRetries is how many times an operation that failed with a transient error is run again
+	MaxRetries int
+	// RetryBackoff is the delay before the first retry. It doubles on every attempt, up to MaxRetryBackoff.
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+}
+
+// Defaults of Options
+const (
+	DefaultMaxOpenConns    = 10
+	DefaultMaxIdleConns    = 5
+	DefaultConnMaxLifetime = 30 * time.Minute
+	DefaultConnMaxIdleTime = 5 * time.Minute
+	DefaultConnectTimeout  = 5 * time.Second
+	DefaultMaxRetries      = 3
+	DefaultRetryBackoff    = 100 * time.Millisecond
+	DefaultMaxRetryBackoff = 2 * time.Second
+)
+
+// withDefaults returns the options with the zero values replaced by the defaults
+func (o Options) withDefaults() Options {
+	if o.MaxOpenConns == 0 {
+		o.MaxOpenConns = DefaultMaxOpenConns
+	}
+	if o.MaxIdleConns == 0 {
+		o.MaxIdleConns = DefaultMaxIdleConns
+	}
+	if o.ConnMaxLifetime == 0 {
+		o.ConnMaxLifetime = DefaultConnMaxLifetime
+	}
+	if o.ConnMaxIdleTime == 0 {
+		o.ConnMaxIdleTime = DefaultConnMaxIdleTime
+	}
+	if o.ConnectTimeout == 0 {
+		o.ConnectTimeout = DefaultConnectTimeout
+	}
+	if o.MaxRetries == 0 {
+		o.MaxRetries = DefaultMaxRetries
+	} else if o.MaxRetries < 0 {
+		o.MaxRetries = 0
+	}
+	if o.RetryBackoff == 0 {
+		o.RetryBackoff = DefaultRetryBackoff
+	}
+	if o.MaxRetryBackoff == 0 {
+		o.MaxRetryBackoff = DefaultMaxRetryBackoff
+	}
+	return o
+}
+
+// OptionsFromEnv reads the options from the environment:
+//
+//	DB_MAX_OPEN_CONNS       maximum number of open connections
+//	DB_MAX_IDLE_CONNS       maximum number of idle connections kept in the pool
+//	DB_CONN_MAX_LIFETIME    maximum age of a connection, such as 30m
+//	DB_CONN_MAX_IDLE_TIME   maximum time a connection stays idle, such as 5m
+//	DB_CONNECT_TIMEOUT      timeout of the connectivity check at startup, such as 5s
+//	DB_MAX_RETRIES          retries of operations that fail with a transient error, -1 to disable
+//	DB_RETRY_BACKOFF        delay before the first retry, such as 100ms
+//	DB_MAX_RETRY_BACKOFF    longest delay between retries, such as 2s
+//
+// Durations can't be negative.
+func OptionsFromEnv() (Options, error) {
+	var o Options
+	ints := []struct {
+		name  string
+		value *int
+	}{
+		{"DB_MAX_OPEN_CONNS", &o.MaxOpenConns},
+		{"DB_MAX_IDLE_CONNS", &o.MaxIdleConns},
+		{"DB_MAX_RETRIES", &o.MaxRetries},
+	}
+	for _, v := range ints {
+		if s := os.Getenv(v.name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return o, apperrors.Invalid("invalid %s: %w", v.name, err)
+			}
+			*v.value = n
+		}
+	}
+
+	durations := []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"DB_CONN_MAX_LIFETIME", &o.ConnMaxLifetime},
+		{"DB_CONN_MAX_IDLE_TIME", &o.ConnMaxIdleTime},
+		{"DB_CONNECT_TIMEOUT", &o.ConnectTimeout},
+		{"DB_RETRY_BACKOFF", &o.RetryBackoff},
+		{"DB_MAX_RETRY_BACKOFF", &o.MaxRetryBackoff},
+	}
+	for _, v := range durations {
+		if s := os.Getenv(v.name); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return o, apperrors.Invalid("invalid %s: %w", v.name, err)
+			}
+			if d < 0 {
+				return o, apperrors.Invalid("invalid %s: %s is negative", v.name, s)
+			}
+			*v.value = d
+		}
+	}
+	return o, nil
+}
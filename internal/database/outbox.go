@@ -0,0 +1,262 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/models"
+	"github.com/aldaircoronel/email-summary/internal/repository"
+)
+
+// Columns read by scanOutboxMessage, in order
+const outboxColumns = `outbox_id, account_id, summary_id, payload, status, attempts, next_attempt_at, last_error, created_at, updated_at, sent_at`
+
+// scanOutboxMessage reads a row selected with outboxColumns
+func scanOutboxMessage(row interface{ Scan(...interface{}) error }) (*models.OutboxMessage, error) {
+	var m models.OutboxMessage
+	var summaryID sql.NullInt64
+	var sentAt sql.NullTime
+	err := row.Scan(
+		&m.OutboxID,
+		&m.AccountID,
+		&summaryID,
+		&m.Payload,
+		&m.Status,
+		&m.Attempts,
+		&m.NextAttemptAt,
+		&m.LastError,
+		&m.CreatedAt,
+		&m.UpdatedAt,
+		&sentAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	m.SummaryID = int(summaryID.Int64)
+	m.SentAt = sentAt.Time
+	return &m, nil
+}
+
+// outboxTime is how the times of the outbox are stored: in UTC, to the microsecond PostgreSQL keeps
+func outboxTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+// newOutboxMessage fills in the state of a message being queued
+func newOutboxMessage(msg *models.OutboxMessage) {
+	now := outboxTime(time.Now())
+	if msg.Status == "" {
+		msg.Status = models.OutboxPending
+	}
+	if msg.NextAttemptAt.IsZero() {
+		msg.NextAttemptAt = now
+	}
+	msg.NextAttemptAt = outboxTime(msg.NextAttemptAt)
+	msg.CreatedAt = now
+	msg.UpdatedAt = now
+}
+
+// insertOutboxMessage queues a message through tx
+func insertOutboxMessage(ctx context.Context, tx *sql.Tx, msg *models.OutboxMessage) error {
+	query := `
+		INSERT INTO email_outbox (account_id, summary_id, payload, status, attempts, next_attempt_at, last_error, created_at, updated_at, sent_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING outbox_id
+	`
+	newOutboxMessage(msg)
+	return tx.QueryRowContext(ctx, query,
+		msg.AccountID,
+		nullID(msg.SummaryID),
+		msg.Payload,
+		msg.Status,
+		msg.Attempts,
+		msg.NextAttemptAt,
+		msg.LastError,
+		msg.CreatedAt,
+		msg.UpdatedAt,
+		nullTime(msg.SentAt),
+	).Scan(&msg.OutboxID)
+}
+
+// nullID stores the ID 0 as NULL
+func nullID(id int) sql.NullInt64 {
+	if id == 0 {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(id), Valid: true}
+}
+
+// EnqueueStatement archives the delivered content of the summary and queues the message that delivers it, in one transaction
+func (pr *sqlRepository) EnqueueStatement(ctx context.Context, s *models.Summary, msg *models.OutboxMessage) error {
+	query := `UPDATE summary SET subject = $1, html_body = $2, text_body = $3, recipients = $4 WHERE summary_id = $5`
+
+	var found bool
+	err := pr.withTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, s.Subject, s.HTMLBody, s.TextBody, strings.Join(s.Recipients, ", "), s.SummaryID)
+		if err != nil {
+			return err
+		}
+		if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+			return err
+		}
+		found = true
+		return insertOutboxMessage(ctx, tx, msg)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to enqueue statement: %w", classify(err))
+	}
+	if !found {
+		return apperrors.NotFound("summary", s.SummaryID)
+	}
+	return nil
+}
+
+// EnqueueMessage queues a message for delivery
+func (pr *sqlRepository) EnqueueMessage(ctx context.Context, msg *models.OutboxMessage) error {
+	err := pr.withTx(ctx, func(tx *sql.Tx) error {
+		return insertOutboxMessage(ctx, tx, msg)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to enqueue message: %w", classify(err))
+	}
+	return nil
+}
+
+// GetOutboxMessage retrieves the outbox message with the given ID
+func (pr *sqlRepository) GetOutboxMessage(ctx context.Context, id int) (*models.OutboxMessage, error) {
+	query := `SELECT ` + outboxColumns + ` FROM email_outbox WHERE outbox_id = $1`
+	msg, err := scanOutboxMessage(pr.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, apperrors.NotFound("outbox message", id)
+		}
+		return nil, fmt.Errorf("failed to get outbox message: %w", classify(err))
+	}
+	return msg, nil
+}
+
+// ListOutboxMessages returns one page of the outbox messages matching the query, oldest first
+func (pr *sqlRepository) ListOutboxMessages(ctx context.Context, q repository.OutboxQuery) (*repository.OutboxPage, error) {
+	afterID, err := q.Normalize()
+	if err != nil {
+		return nil, fmt.Errorf("invalid outbox query: %w", err)
+	}
+
+	var conditions []string
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if q.AccountID != 0 {
+		conditions = append(conditions, "account_id = "+arg(q.AccountID))
+	}
+	if q.SummaryID != 0 {
+		conditions = append(conditions, "summary_id = "+arg(q.SummaryID))
+	}
+	if q.Status != "" {
+		conditions = append(conditions, "status = "+arg(q.Status))
+	}
+	if !q.Due.IsZero() {
+		conditions = append(conditions, "status IN ("+arg(models.OutboxPending)+", "+arg(models.OutboxSending)+")")
+		conditions = append(conditions, "next_attempt_at <= "+arg(outboxTime(q.Due)))
+	}
+	if afterID != 0 {
+		conditions = append(conditions, "outbox_id > "+arg(afterID))
+	}
+
+	query := `SELECT ` + outboxColumns + ` FROM email_outbox`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	// Fetch one extra row to know whether there is a next page
+	query += fmt.Sprintf(" ORDER BY outbox_id LIMIT %d", q.Limit+1)
+
+	rows, err := pr.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list outbox messages: %w", classify(err))
+	}
+	defer rows.Close()
+
+	messages := []*models.OutboxMessage{}
+	for rows.Next() {
+		msg, err := scanOutboxMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan outbox message: %w", classify(err))
+		}
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list outbox messages: %w", classify(err))
+	}
+
+	page := &repository.OutboxPage{Messages: messages}
+	if len(messages) > q.Limit {
+		page.Messages = messages[:q.Limit]
+		page.NextCursor = repository.NewOutboxCursor(page.Messages[q.Limit-1])
+	}
+	return page, nil
+}
+
+// UpdateOutboxMessage stores the delivery state of the message, unless another worker or an operator changed it first
+func (pr *sqlRepository) UpdateOutboxMessage(ctx context.Context, msg *models.OutboxMessage, prevStatus string, prevAttempts int) error {
+	query := `
+		UPDATE email_outbox SET status = $1, attempts = $2, next_attempt_at = $3, last_error = $4, updated_at = $5, sent_at = $6
+		WHERE outbox_id = $7 AND status = $8 AND attempts = $9
+	`
+	msg.NextAttemptAt = outboxTime(msg.NextAttemptAt)
+	msg.UpdatedAt = outboxTime(time.Now())
+	if !msg.SentAt.IsZero() {
+		msg.SentAt = outboxTime(msg.SentAt)
+	}
+
+	result, err := pr.db.ExecContext(ctx, query,
+		msg.Status,
+		msg.Attempts,
+		msg.NextAttemptAt,
+		msg.LastError,
+		msg.UpdatedAt,
+		nullTime(msg.SentAt),
+		msg.OutboxID,
+		prevStatus,
+		prevAttempts,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update outbox message: %w", classify(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update outbox message: %w", classify(err))
+	}
+	if rows == 0 {
+		// Tell a missing message from one that changed meanwhile
+		if _, err := pr.GetOutboxMessage(ctx, msg.OutboxID); err != nil {
+			return err
+		}
+		return &apperrors.ConflictError{Err: fmt.Errorf("outbox message %d changed since it was read", msg.OutboxID)}
+	}
+	return nil
+}
+
+// DeleteOutboxMessages deletes the outbox messages with the given IDs and returns how many were deleted
+func (pr *sqlRepository) DeleteOutboxMessages(ctx context.Context, ids []int) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	placeholders, args := idList(ids)
+	result, err := pr.db.ExecContext(ctx, `DELETE FROM email_outbox WHERE outbox_id IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete outbox messages: %w", classify(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete outbox messages: %w", classify(err))
+	}
+	return int(rows), nil
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aldaircoronel/email-summary/internal/models"
+	"github.com/aldaircoronel/email-summary/internal/repository"
+)
+
+// Implement the QueryTransactions method of the Repository interface
+func (r *sqlRepository) QueryTransactions(ctx context.Context, q repository.TransactionQuery) (*repository.TransactionPage, error) {
+	cursor, err := q.Normalize()
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction query: %w", err)
+	}
+
+	var conditions []string
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if q.AccountID != 0 {
+		conditions = append(conditions, "account_id = "+arg(q.AccountID))
+	}
+	if !q.From.IsZero() {
+		conditions = append(conditions, "date >= "+arg(q.From.UTC()))
+	}
+	if !q.To.IsZero() {
+		conditions = append(conditions, "date < "+arg(q.To.UTC()))
+	}
+	if q.MinAmount != nil {
+		conditions = append(conditions, "amount >= "+arg(*q.MinAmount))
+	}
+	if q.MaxAmount != nil {
+		conditions = append(conditions, "amount <= "+arg(*q.MaxAmount))
+	}
+	if q.Direction != repository.AnyDirection {
+		conditions = append(conditions, "is_credit = "+arg(q.Direction == repository.Credit))
+	}
+	if q.Category != "" {
+		conditions = append(conditions, "category = "+arg(q.Category))
+	}
+
+	// Keyset pagination: continue strictly after (sort column, transaction_id) of the cursor
+	op, order := ">", "ASC"
+	if q.Descending {
+		op, order = "<", "DESC"
+	}
+	if cursor != nil {
+		var value interface{}
+		switch q.SortBy {
+		case repository.SortByDate:
+			value = cursor.Date.UTC()
+		case repository.SortByAmount:
+			value = cursor.Amount
+		}
+		if value == nil {
+			conditions = append(conditions, "transaction_id "+op+" "+arg(cursor.TransactionID))
+		} else {
+			column := string(q.SortBy)
+			conditions = append(conditions, fmt.Sprintf("(%s %s %s OR (%s = %s AND transaction_id %s %s))",
+				column, op, arg(value), column, arg(value), op, arg(cursor.TransactionID)))
+		}
+	}
+
+	query := `SELECT transaction_id, account_id, id, date, amount, is_credit, category FROM transactions`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	if q.SortBy == repository.SortByID {
+		query += " ORDER BY transaction_id " + order
+	} else {
+		query += fmt.Sprintf(" ORDER BY %s %s, transaction_id %s", q.SortBy, order, order)
+	}
+
+	// Fetch one extra row to know whether there is a next page
+	query += " LIMIT " + arg(q.Limit+1)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transactions: %w", classify(err))
+	}
+	defer rows.Close()
+
+	transactions := []*models.Transaction{}
+	for rows.Next() {
+		trx := &models.Transaction{}
+		if err := rows.Scan(&trx.TransactionID, &trx.AccountID, &trx.ID, &trx.Date, &trx.Amount, &trx.IsCredit, &trx.Category); err != nil {
+			return nil, fmt.Errorf("failed to scan transaction: %w", classify(err))
+		}
+		transactions = append(transactions, trx)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate transactions: %w", classify(err))
+	}
+
+	page := &repository.TransactionPage{Transactions: transactions}
+	if len(transactions) > q.Limit {
+		page.Transactions = transactions[:q.Limit]
+		page.NextCursor = q.NewCursor(page.Transactions[q.Limit-1])
+	}
+	return page, nil
+}
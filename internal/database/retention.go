@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/models"
+)
+
+// idList returns the placeholders and arguments of an IN (...) list of IDs
+func idList(ids []int) (string, []interface{}) {
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = id
+	}
+	return strings.Join(placeholders, ", "), args
+}
+
+// DeleteTransactions deletes the transactions with the given IDs and returns how many were deleted
+func (pr *sqlRepository) DeleteTransactions(ctx context.Context, ids []int) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	placeholders, args := idList(ids)
+	result, err := pr.db.ExecContext(ctx, `DELETE FROM transactions WHERE transaction_id IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete transactions: %w", classify(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete transactions: %w", classify(err))
+	}
+	return int(rows), nil
+}
+
+// DeleteSummaries deletes the summaries with the given IDs along with their month summaries,
+// and returns how many summaries were deleted
+func (pr *sqlRepository) DeleteSummaries(ctx context.Context, ids []int) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	placeholders, args := idList(ids)
+
+	var deleted int64
+	err := pr.withTx(ctx, func(tx *sql.Tx) error {
+		// month_summary references summary, so it goes first
+		if _, err := tx.ExecContext(ctx, `DELETE FROM month_summary WHERE summary_id IN (`+placeholders+`)`, args...); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, `DELETE FROM summary WHERE summary_id IN (`+placeholders+`)`, args...)
+		if err != nil {
+			return err
+		}
+		deleted, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete summaries: %w", classify(err))
+	}
+	return int(deleted), nil
+}
+
+// GetRetentionPolicy returns the retention rules of an account
+func (pr *sqlRepository) GetRetentionPolicy(ctx context.Context, accountID int) (*models.RetentionPolicy, error) {
+	query := `SELECT account_id, transaction_months, summary_months FROM retention_policy WHERE account_id = $1`
+
+	var policy models.RetentionPolicy
+	var transactionMonths, summaryMonths sql.NullInt32
+	err := pr.db.QueryRowContext(ctx, query, accountID).Scan(&policy.AccountID, &transactionMonths, &summaryMonths)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, apperrors.NotFound("retention policy for account", accountID)
+		}
+		return nil, fmt.Errorf("failed to get retention policy: %w", classify(err))
+	}
+	policy.TransactionMonths = intPtr(transactionMonths)
+	policy.SummaryMonths = intPtr(summaryMonths)
+	return &policy, nil
+}
+
+// SaveRetentionPolicy creates or replaces the retention rules of an account
+func (pr *sqlRepository) SaveRetentionPolicy(ctx context.Context, policy *models.RetentionPolicy) error {
+	query := `
+		INSERT INTO retention_policy (account_id, transaction_months, summary_months) VALUES ($1, $2, $3)
+		ON CONFLICT (account_id) DO UPDATE SET transaction_months = excluded.transaction_months, summary_months = excluded.summary_months
+	`
+	_, err := pr.db.ExecContext(ctx, query, policy.AccountID, nullInt(policy.TransactionMonths), nullInt(policy.SummaryMonths))
+	if err != nil {
+		return fmt.Errorf("failed to save retention policy: %w", classify(err))
+	}
+	return nil
+}
+
+// DeleteRetentionPolicy removes the retention rules of an account, so the global rules apply to it
+func (pr *sqlRepository) DeleteRetentionPolicy(ctx context.Context, accountID int) error {
+	result, err := pr.db.ExecContext(ctx, `DELETE FROM retention_policy WHERE account_id = $1`, accountID)
+	if err != nil {
+		return fmt.Errorf("failed to delete retention policy: %w", classify(err))
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to delete retention policy: %w", classify(err))
+	} else if rows == 0 {
+		return apperrors.NotFound("retention policy for account", accountID)
+	}
+	return nil
+}
+
+// nullInt stores a nil rule as NULL
+func nullInt(value *int) sql.NullInt32 {
+	if value == nil {
+		return sql.NullInt32{}
+	}
+	return sql.NullInt32{Int32: int32(*value), Valid: true}
+}
+
+// intPtr reads a rule stored by nullInt
+func intPtr(value sql.NullInt32) *int {
+	if !value.Valid {
+		return nil
+	}
+	n := int(value.Int32)
+	return &n
+}
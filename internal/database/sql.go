@@ -0,0 +1,215 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/aldaircoronel/email-summary/internal/models"
+	"github.com/aldaircoronel/email-summary/internal/repository"
+)
+
+// Define the SQL repository struct. It holds the queries shared by the
+// PostgreSQL and SQLite backends; both accept $N placeholders and RETURNING.
+type sqlRepository struct {
+	db *conn
+
+	// Name of the directory under migrations/ holding the schema of this backend
+	dialect string
+}
+
+// withTx runs fn inside a database transaction, committing if it returns nil and rolling back otherwise.
+// A transaction that fails with a transient error is run again from the start. In a repository bound
+// to a transaction, fn runs in that one.
+func (r *sqlRepository) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	if r.db.tx != nil {
+		return fn(r.db.tx)
+	}
+	return r.db.retry(ctx, func() error {
+		tx, err := r.db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", classify(err))
+		}
+		if err := fn(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			// The commit may have been applied if the connection dropped while waiting for its result
+			if lostInFlight(err) {
+				err = &uncertainError{err: err}
+			}
+			return fmt.Errorf("failed to commit transaction: %w", classify(err))
+		}
+		return nil
+	})
+}
+
+// InTx runs fn with a copy of the repository bound to a database transaction
+func (r *sqlRepository) InTx(ctx context.Context, fn func(repo repository.Repository) error) error {
+	if r.db.tx != nil {
+		return fn(r)
+	}
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		return fn(&sqlRepository{db: &conn{DB: r.db.DB, options: r.db.options, tx: tx}, dialect: r.dialect})
+	})
+}
+
+// Implement the SaveTransaction method of the Repository interface
+func (pr *sqlRepository) SaveTransaction(ctx context.Context, trx *models.Transaction) error {
+	query := `INSERT INTO transactions (account_id, id, date, amount, is_credit, category) VALUES ($1, $2, $3, $4, $5, $6) RETURNING transaction_id`
+
+	// Dates are stored in UTC so they sort the same way in every backend
+	err := pr.db.QueryRowContext(ctx, query, trx.AccountID, trx.ID, trx.Date.UTC(), trx.Amount, trx.IsCredit, trx.Category).Scan(&trx.TransactionID)
+	if err != nil {
+		return fmt.Errorf("failed to save transaction: %w", classify(err))
+	}
+	return nil
+}
+
+// Implement the GetTransactionByAccountID method of the Repository interface
+func (pr *sqlRepository) GetTransactionByAccountID(ctx context.Context, accountID int) ([]*models.Transaction, error) {
+	query := `SELECT transaction_id, account_id, id, date, amount, is_credit, category FROM transactions WHERE account_id=$1`
+	rows, err := pr.db.QueryContext(ctx, query, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transactions: %w", classify(err))
+	}
+	defer rows.Close()
+
+	var transactions []*models.Transaction
+	for rows.Next() {
+		var transaction models.Transaction
+		if err := rows.Scan(&transaction.TransactionID, &transaction.AccountID, &transaction.ID, &transaction.Date, &transaction.Amount, &transaction.IsCredit, &transaction.Category); err != nil {
+			return nil, fmt.Errorf("failed to scan transaction row: %w", classify(err))
+		}
+		transactions = append(transactions, &transaction)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read transaction rows: %w", classify(err))
+	}
+	return transactions, nil
+}
+
+// Implement the ListTransactions method of the Repository interface
+func (pr *sqlRepository) ListTransactions(ctx context.Context) ([]*models.Transaction, error) {
+	query := `SELECT transaction_id, account_id, id, date, amount, is_credit, category FROM transactions ORDER BY date DESC`
+	rows, err := pr.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transactions: %w", classify(err))
+	}
+	defer rows.Close()
+
+	transactions := []*models.Transaction{}
+	for rows.Next() {
+		trx := &models.Transaction{}
+		if err := rows.Scan(&trx.TransactionID, &trx.AccountID, &trx.ID, &trx.Date, &trx.Amount, &trx.IsCredit, &trx.Category); err != nil {
+			return nil, fmt.Errorf("failed to scan transaction: %w", classify(err))
+		}
+		transactions = append(transactions, trx)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate transactions: %w", classify(err))
+	}
+
+	return transactions, nil
+}
+
+// Implement the SaveMonthSummary method of the Repository interface
+func (pr *sqlRepository) SaveMonthSummary(ctx context.Context, ms *models.MonthSummary, summaryID int) error {
+	query := `
+		INSERT INTO month_summary (
+			month, 
+			total_balance, 
+			total_transactions, 
+			num_of_credit_transactions, 
+			num_of_debit_transactions, 
+			average_credit, 
+			average_debit, 
+			summary_id
+		) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING month_summary_id
+	`
+	err := pr.db.QueryRowContext(
+		ctx,
+		query,
+		ms.Month,
+		ms.TotalBalance,
+		ms.TotalTransactions,
+		ms.NumOfCreditTransactions,
+		ms.NumOfDebitTransactions,
+		ms.AverageCredit,
+		ms.AverageDebit,
+		summaryID,
+	).Scan(&ms.MonthSummaryID)
+	if err != nil {
+		return fmt.Errorf("failed to save month summary: %w", classify(err))
+	}
+	return nil
+}
+
+// GetMonthSummaryBySummaryID returns a month summary by summary id
+func (pr *sqlRepository) GetMonthSummaryBySummaryID(ctx context.Context, summaryID int) ([]*models.MonthSummary, error) {
+	query := `
+		SELECT 
+			month_summary_id, 
+			month, 
+			total_balance, 
+			total_transactions, 
+			num_of_credit_transactions, 
+			num_of_debit_transactions, 
+			average_credit, 
+			average_debit,
+			summary_id
+		FROM month_summary
+		WHERE summary_id = $1
+	`
+	rows, err := pr.db.QueryContext(ctx, query, summaryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get month summary by summary id: %w", classify(err))
+	}
+	defer rows.Close()
+
+	var monthSummaries []*models.MonthSummary
+	for rows.Next() {
+		ms := new(models.MonthSummary)
+		err := rows.Scan(
+			&ms.MonthSummaryID,
+			&ms.Month,
+			&ms.TotalBalance,
+			&ms.TotalTransactions,
+			&ms.NumOfCreditTransactions,
+			&ms.NumOfDebitTransactions,
+			&ms.AverageCredit,
+			&ms.AverageDebit,
+			&ms.SummaryID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan month summary: %w", classify(err))
+		}
+		monthSummaries = append(monthSummaries, ms)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get month summary by summary id: %w", classify(err))
+	}
+
+	return monthSummaries, nil
+}
+
+// Ping checks that the database is reachable
+func (r *sqlRepository) Ping(ctx context.Context) error {
+	if err := r.db.ping(ctx); err != nil {
+		return fmt.Errorf("failed to ping database: %w", err)
+	}
+	return nil
+}
+
+// This function closes the database connection by calling the Close() function on the database object.
+// The repositories bound to a transaction share the connection of the one that opened it, and leave it open.
+func (r *sqlRepository) Close() error {
+	if r.db.tx != nil {
+		return nil
+	}
+	return r.db.Close()
+}
@@ -0,0 +1,37 @@
+package database
+
+import (
+	"context"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Define the SQLite repository struct
+type SQLiteRepository struct {
+	*sqlRepository
+}
+
+// Create a new SQLite repository instance backed by the database file at the given path.
+// The file is created if it doesn't exist yet; its tables are created by the migrations.
+func NewSQLiteRepository(ctx context.Context, path string, options Options) (*SQLiteRepository, error) {
+	// SQLite only enforces foreign keys when asked to
+	dsn := path
+	if strings.Contains(dsn, "?") {
+		dsn += "&_foreign_keys=on"
+	} else {
+		dsn += "?_foreign_keys=on"
+	}
+
+	// A single connection avoids "database is locked" errors between writers
+	options = options.withDefaults()
+	options.MaxOpenConns = 1
+	options.MaxIdleConns = 1
+
+	db, err := openConn(ctx, "sqlite3", dsn, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQLiteRepository{&sqlRepository{db: db, dialect: "sqlite"}}, nil
+}
@@ -0,0 +1,246 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/models"
+	"github.com/aldaircoronel/email-summary/internal/repository"
+)
+
+// Columns read by scanSummary, in order
+const summaryColumns = `
+	summary_id,
+	account_id,
+	total_balance,
+	total_transactions,
+	num_of_credit_transactions,
+	num_of_debit_transactions,
+	total_average_credit,
+	total_average_debit,
+	period_start,
+	period_end,
+	generated_at,
+	subject,
+	html_body,
+	text_body,
+	recipients
+`
+
+// scanSummary reads a row selected with summaryColumns
+func scanSummary(row interface{ Scan(...interface{}) error }) (*models.Summary, error) {
+	var s models.Summary
+	var periodStart, periodEnd sql.NullTime
+	var recipients string
+	err := row.Scan(
+		&s.SummaryID,
+		&s.AccountID,
+		&s.TotalBalance,
+		&s.TotalTransactions,
+		&s.NumOfCreditTransactions,
+		&s.NumOfDebitTransactions,
+		&s.TotalAverageCredit,
+		&s.TotalAverageDebit,
+		&periodStart,
+		&periodEnd,
+		&s.GeneratedAt,
+		&s.Subject,
+		&s.HTMLBody,
+		&s.TextBody,
+		&recipients,
+	)
+	if err != nil {
+		return nil, err
+	}
+	s.PeriodStart = periodStart.Time
+	s.PeriodEnd = periodEnd.Time
+	s.Recipients = splitRecipients(recipients)
+	return &s, nil
+}
+
+// nullTime stores the zero time as NULL, and any other time in UTC
+func nullTime(t time.Time) sql.NullTime {
+	if t.IsZero() {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+// splitRecipients parses the recipients column, a comma-separated list of addresses
+func splitRecipients(value string) []string {
+	var recipients []string
+	for _, recipient := range strings.Split(value, ",") {
+		if recipient = strings.TrimSpace(recipient); recipient != "" {
+			recipients = append(recipients, recipient)
+		}
+	}
+	return recipients
+}
+
+// Implement the SaveSummary method of the Repository interface
+func (pr *sqlRepository) SaveSummary(ctx context.Context, s *models.Summary) error {
+	query := `
+		INSERT INTO summary (
+			account_id,
+			total_balance,
+			total_transactions,
+			num_of_credit_transactions,
+			num_of_debit_transactions,
+			total_average_credit,
+			total_average_debit,
+			period_start,
+			period_end,
+			generated_at,
+			subject,
+			html_body,
+			text_body,
+			recipients
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		RETURNING summary_id
+	`
+	if s.GeneratedAt.IsZero() {
+		s.GeneratedAt = time.Now()
+	}
+	row := pr.db.QueryRowContext(
+		ctx,
+		query,
+		s.AccountID,
+		s.TotalBalance,
+		s.TotalTransactions,
+		s.NumOfCreditTransactions,
+		s.NumOfDebitTransactions,
+		s.TotalAverageCredit,
+		s.TotalAverageDebit,
+		nullTime(s.PeriodStart),
+		nullTime(s.PeriodEnd),
+		s.GeneratedAt.UTC(),
+		s.Subject,
+		s.HTMLBody,
+		s.TextBody,
+		strings.Join(s.Recipients, ", "),
+	)
+	if err := row.Scan(&s.SummaryID); err != nil {
+		return fmt.Errorf("failed to save summary: %w", classify(err))
+	}
+	return nil
+}
+
+// SaveSummaryContent stores the subject, bodies and recipients of the statement as it was delivered
+func (pr *sqlRepository) SaveSummaryContent(ctx context.Context, s *models.Summary) error {
+	query := `UPDATE summary SET subject = $1, html_body = $2, text_body = $3, recipients = $4 WHERE summary_id = $5`
+	result, err := pr.db.ExecContext(ctx, query, s.Subject, s.HTMLBody, s.TextBody, strings.Join(s.Recipients, ", "), s.SummaryID)
+	if err != nil {
+		return fmt.Errorf("failed to save summary content: %w", classify(err))
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to save summary content: %w", classify(err))
+	} else if rows == 0 {
+		return apperrors.NotFound("summary", s.SummaryID)
+	}
+	return nil
+}
+
+// Implement the GetSummaryByAccountID method of the Repository interface. It returns the latest summary of the account.
+func (pr *sqlRepository) GetSummaryByAccountID(ctx context.Context, accountID int) (*models.Summary, error) {
+	query := `SELECT ` + summaryColumns + `
+		FROM summary
+		WHERE account_id = $1
+		ORDER BY generated_at DESC, summary_id DESC
+		LIMIT 1
+	`
+	summary, err := scanSummary(pr.db.QueryRowContext(ctx, query, accountID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, apperrors.NotFound("summary for account", accountID)
+		}
+		return nil, fmt.Errorf("failed to get summary by account ID: %w", classify(err))
+	}
+
+	return summary, nil
+}
+
+// GetSummaryByID retrieves the summary with the given ID
+func (pr *sqlRepository) GetSummaryByID(ctx context.Context, summaryID int) (*models.Summary, error) {
+	query := `SELECT ` + summaryColumns + ` FROM summary WHERE summary_id = $1`
+	summary, err := scanSummary(pr.db.QueryRowContext(ctx, query, summaryID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, apperrors.NotFound("summary", summaryID)
+		}
+		return nil, fmt.Errorf("failed to get summary by id: %w", classify(err))
+	}
+	return summary, nil
+}
+
+// ListSummaries returns a list of all summaries for all accounts.
+func (pr *sqlRepository) ListSummaries(ctx context.Context) ([]*models.Summary, error) {
+	query := `SELECT ` + summaryColumns + ` FROM summary`
+	rows, err := pr.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list summaries: %w", classify(err))
+	}
+	defer rows.Close()
+
+	summaries := make([]*models.Summary, 0)
+	for rows.Next() {
+		summary, err := scanSummary(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan summary row: %w", classify(err))
+		}
+		summaries = append(summaries, summary)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list summaries: %w", classify(err))
+	}
+
+	return summaries, nil
+}
+
+// ListSummariesByAccount returns one page of the statements of an account, newest first
+func (pr *sqlRepository) ListSummariesByAccount(ctx context.Context, accountID int, page repository.SummaryPageRequest) (*repository.SummaryPage, error) {
+	cursor, err := page.Normalize()
+	if err != nil {
+		return nil, fmt.Errorf("invalid summary page: %w", err)
+	}
+
+	query := `SELECT ` + summaryColumns + ` FROM summary WHERE account_id = $1`
+	args := []interface{}{accountID}
+	if cursor != nil {
+		query += ` AND (generated_at < $2 OR (generated_at = $3 AND summary_id < $4))`
+		args = append(args, cursor.GeneratedAt.UTC(), cursor.GeneratedAt.UTC(), cursor.SummaryID)
+	}
+	// Fetch one extra row to know whether there is a next page
+	query += fmt.Sprintf(` ORDER BY generated_at DESC, summary_id DESC LIMIT %d`, page.Limit+1)
+
+	rows, err := pr.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list summaries: %w", classify(err))
+	}
+	defer rows.Close()
+
+	summaries := make([]*models.Summary, 0)
+	for rows.Next() {
+		summary, err := scanSummary(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan summary row: %w", classify(err))
+		}
+		summaries = append(summaries, summary)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list summaries: %w", classify(err))
+	}
+
+	result := &repository.SummaryPage{Summaries: summaries}
+	if len(summaries) > page.Limit {
+		result.Summaries = summaries[:page.Limit]
+		result.NextCursor = repository.NewSummaryCursor(result.Summaries[page.Limit-1])
+	}
+	return result, nil
+}
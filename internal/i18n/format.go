@@ -0,0 +1,88 @@
+package i18n
+
+// numberFormat are the conventions of a locale for numbers and amounts of money
+type numberFormat struct {
+	decimal string
+	group   string
+	// minGrouping is the number of digits the integer part needs above the first group to be grouped:
+	// 1 groups 1,234 and 2 leaves 1234 alone but groups 12.345
+	minGrouping int
+	// The currency symbol goes after the number, or before it separated by a space
+	symbolAfter bool
+	symbolSpace bool
+}
+
+var englishFormat = numberFormat{decimal: ".", group: ",", minGrouping: 1}
+
+// Spanish uses a decimal point in Mexico, the United States, Central America and Peru, and a decimal
+// comma elsewhere
+var (
+	spanishPointFormat = numberFormat{decimal: ".", group: ",", minGrouping: 2}
+	spanishCommaFormat = numberFormat{decimal: ",", group: ".", minGrouping: 2, symbolAfter: true}
+	// South American countries with a decimal comma put the symbol first
+	spanishSouthAmericaFormat = numberFormat{decimal: ",", group: ".", minGrouping: 2, symbolSpace: true}
+)
+
+var spanishRegionFormats = map[string]numberFormat{
+	"MX": spanishPointFormat,
+	"US": spanishPointFormat,
+	"GT": spanishPointFormat,
+	"HN": spanishPointFormat,
+	"NI": spanishPointFormat,
+	"PA": spanishPointFormat,
+	"PR": spanishPointFormat,
+	"DO": spanishPointFormat,
+	"SV": spanishPointFormat,
+	"PE": spanishPointFormat,
+	"AR": spanishSouthAmericaFormat,
+	"CL": spanishSouthAmericaFormat,
+	"CO": spanishSouthAmericaFormat,
+	"UY": spanishSouthAmericaFormat,
+	"VE": spanishSouthAmericaFormat,
+	"EC": spanishSouthAmericaFormat,
+	"BO": spanishSouthAmericaFormat,
+	"PY": spanishSouthAmericaFormat,
+}
+
+// formatOf returns the number format of a language and region
+func formatOf(language string, region string) numberFormat {
+	if language == "es" {
+		if format, ok := spanishRegionFormats[region]; ok {
+			return format
+		}
+		return spanishCommaFormat
+	}
+	return englishFormat
+}
+
+// currencySymbols are the symbols of the common currencies; the others are written with their code
+var currencySymbols = map[string]string{
+	"USD": "$",
+	"MXN": "$",
+	"ARS": "$",
+	"CLP": "$",
+	"COP": "$",
+	"CAD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+	"BRL": "R$",
+	"PEN": "S/",
+}
+
+// zeroDecimalCurrencies have no minor unit
+var zeroDecimalCurrencies = map[string]bool{
+	"JPY": true,
+	"KRW": true,
+	"CLP": true,
+	"VND": true,
+	"ISK": true,
+	"PYG": true,
+}
+
+func currencyDecimals(currency string) int {
+	if zeroDecimalCurrencies[currency] {
+		return 0
+	}
+	return 2
+}
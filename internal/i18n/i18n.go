@@ -0,0 +1,257 @@
+// Package i18n holds the message catalogs of the emails and formats numbers, amounts of money, month
+// names and dates the way the locale of an account expects.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/models"
+)
+
+// DefaultLanguage is the language of the locales without a catalog, and of the messages a catalog lacks
+const DefaultLanguage = "en"
+
+// catalogFiles are the message catalogs, one per language
+//
+//go:embed catalogs/*.json
+var catalogFiles embed.FS
+
+// catalog holds the messages of a language, as fmt format strings, and its month names and date patterns
+type catalog struct {
+	Months      [12]string        `json:"months"`
+	ShortMonths [12]string        `json:"short_months"`
+	Date        string            `json:"date"`
+	MonthYear   string            `json:"month_year"`
+	Messages    map[string]string `json:"messages"`
+}
+
+// catalogs are the parsed catalogs by language. A catalog that doesn't parse is a build mistake, so it panics.
+var catalogs = func() map[string]*catalog {
+	entries, err := catalogFiles.ReadDir("catalogs")
+	if err != nil {
+		panic(err)
+	}
+	parsed := make(map[string]*catalog)
+	for _, entry := range entries {
+		data, err := catalogFiles.ReadFile("catalogs/" + entry.Name())
+		if err != nil {
+			panic(err)
+		}
+		var c catalog
+		if err := json.Unmarshal(data, &c); err != nil {
+			panic(fmt.Sprintf("invalid catalog %s: %v", entry.Name(), err))
+		}
+		parsed[strings.TrimSuffix(entry.Name(), ".json")] = &c
+	}
+	return parsed
+}()
+
+// Languages returns the languages that have a catalog, sorted
+func Languages() []string {
+	languages := make([]string, 0, len(catalogs))
+	for language := range catalogs {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Locale formats text for a language and region
+type Locale struct {
+	// Tag is the language tag the locale was looked up with, e.g. es-MX
+	Tag string
+
+	catalog  *catalog
+	fallback *catalog
+	format   numberFormat
+}
+
+// Lookup returns the locale of a language tag such as "es", "es-MX" or "es_ES". Languages without a
+// catalog get the English messages and formats.
+func Lookup(tag string) *Locale {
+	language, region := splitTag(tag)
+	c, ok := catalogs[language]
+	if !ok {
+		language, region = DefaultLanguage, ""
+		c = catalogs[DefaultLanguage]
+	}
+	return &Locale{
+		Tag:      tag,
+		catalog:  c,
+		fallback: catalogs[DefaultLanguage],
+		format:   formatOf(language, region),
+	}
+}
+
+// splitTag returns the lowercase language and uppercase region of a tag, ignoring any script or variant
+func splitTag(tag string) (language string, region string) {
+	parts := strings.FieldsFunc(tag, func(r rune) bool { return r == '-' || r == '_' })
+	if len(parts) == 0 {
+		return "", ""
+	}
+	language = strings.ToLower(parts[0])
+	for _, part := range parts[1:] {
+		// Regions are two letters or three digits; scripts are four letters
+		if len(part) == 2 || len(part) == 3 && part[0] >= '0' && part[0] <= '9' {
+			return language, strings.ToUpper(part)
+		}
+	}
+	return language, ""
+}
+
+// T returns the message with the given key, formatted with args. Messages missing from the catalog
+// are taken from the English one, and unknown keys are returned as they are.
+func (l *Locale) T(key string, args ...interface{}) string {
+	message, ok := l.catalog.Messages[key]
+	if !ok {
+		if message, ok = l.fallback.Messages[key]; !ok {
+			return key
+		}
+	}
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
+
+// Month returns the name of a month
+func (l *Locale) Month(m time.Month) string {
+	return l.catalog.Months[m-1]
+}
+
+// ShortMonth returns the abbreviated name of a month
+func (l *Locale) ShortMonth(m time.Month) string {
+	return l.catalog.ShortMonths[m-1]
+}
+
+// MonthName translates the month of a month summary: "2023-03" becomes "March 2023" or "marzo de 2023",
+// and the English name older summaries store becomes the month name alone. Other names are returned as they are.
+func (l *Locale) MonthName(month string) string {
+	m, hasYear, err := models.ParseMonth(month)
+	if err != nil {
+		return month
+	}
+	if !hasYear {
+		return l.Month(m.Month())
+	}
+	return strings.NewReplacer(
+		"{month}", l.Month(m.Month()),
+		"{year}", strconv.Itoa(m.Year()),
+	).Replace(l.catalog.MonthYear)
+}
+
+// Date formats the day of t, e.g. "March 5, 2023" or "5 de marzo de 2023"
+func (l *Locale) Date(t time.Time) string {
+	return strings.NewReplacer(
+		"{day}", strconv.Itoa(t.Day()),
+		"{month}", l.Month(t.Month()),
+		"{year}", strconv.Itoa(t.Year()),
+	).Replace(l.catalog.Date)
+}
+
+// Number formats v with the given number of decimals and the separators of the locale
+func (l *Locale) Number(v float64, decimals int) string {
+	digits := strconv.FormatFloat(math.Abs(v), 'f', decimals, 64)
+	integer, fraction := digits, ""
+	if dot := strings.IndexByte(digits, '.'); dot >= 0 {
+		integer, fraction = digits[:dot], digits[dot+1:]
+	}
+
+	var b strings.Builder
+	if v < 0 && strings.Trim(digits, "0.") != "" {
+		b.WriteByte('-')
+	}
+	if len(integer) >= 3+l.format.minGrouping {
+		for i, digit := range integer {
+			if i > 0 && (len(integer)-i)%3 == 0 {
+				b.WriteString(l.format.group)
+			}
+			b.WriteRune(digit)
+		}
+	} else {
+		b.WriteString(integer)
+	}
+	if fraction != "" {
+		b.WriteString(l.format.decimal + fraction)
+	}
+	return b.String()
+}
+
+// Money formats an amount in the given ISO 4217 currency, with its symbol when it has a common one
+// and its code otherwise, e.g. "-$1,234.50", "1.234,50 €" or "CHF 12.00"
+func (l *Locale) Money(amount float64, currency string) string {
+	number := l.Number(math.Abs(amount), currencyDecimals(currency))
+	// Amounts that round to zero have no sign
+	sign := ""
+	if amount < 0 && strings.Trim(number, "0.,") != "" {
+		sign = "-"
+	}
+
+	symbol, ok := currencySymbols[currency]
+	if !ok {
+		symbol = currency
+	}
+	switch {
+	case l.format.symbolAfter:
+		return sign + number + " " + symbol
+	case !ok || l.format.symbolSpace:
+		return sign + symbol + " " + number
+	default:
+		return sign + symbol + number
+	}
+}
+
+// Funcs returns the template functions formatting for the locale, with money amounts in the given currency:
+//
+//	t "key" args...    the message with the given key
+//	number v [decimals] v with the separators of the locale, integers without decimals and others with 2 by default
+//	money v            v in the currency
+//	month "2023-03"    the month of a month summary with its year, translated
+//	date t             the day of t
+func (l *Locale) Funcs(currency string) map[string]interface{} {
+	return map[string]interface{}{
+		"t": l.T,
+		"number": func(v interface{}, decimals ...int) (string, error) {
+			f, isInt, err := toFloat(v)
+			if err != nil {
+				return "", err
+			}
+			d := 2
+			if isInt {
+				d = 0
+			}
+			if len(decimals) > 0 {
+				d = decimals[0]
+			}
+			return l.Number(f, d), nil
+		},
+		"money": func(amount float64) string { return l.Money(amount, currency) },
+		"month": l.MonthName,
+		"date":  l.Date,
+	}
+}
+
+// toFloat converts a number of any Go numeric type, reporting whether it is an integer type
+func toFloat(v interface{}) (float64, bool, error) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true, nil
+	case int64:
+		return float64(n), true, nil
+	case int32:
+		return float64(n), true, nil
+	case float64:
+		return n, false, nil
+	case float32:
+		return float64(n), false, nil
+	default:
+		return 0, false, fmt.Errorf("number: %v is not a number", v)
+	}
+}
@@ -0,0 +1,193 @@
+package i18n
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNumber(t *testing.T) {
+	tests := []struct {
+		tag      string
+		v        float64
+		decimals int
+		want     string
+	}{
+		{"en", 0, 2, "0.00"},
+		{"en", 123, 0, "123"},
+		{"en", 1234, 0, "1,234"},
+		{"en", 1234567.891, 2, "1,234,567.89"},
+		{"en", -1234.5, 2, "-1,234.50"},
+		// Rounding carries into a new group
+		{"en", 999.996, 2, "1,000.00"},
+		// Spanish only groups numbers of 5 digits or more
+		{"es", 1234, 0, "1234"},
+		{"es", 1234.5, 2, "1234,50"},
+		{"es", 12345, 0, "12.345"},
+		{"es", -1234567.891, 2, "-1.234.567,89"},
+		{"es-MX", 1234.5, 2, "1234.50"},
+		{"es-MX", 12345.5, 2, "12,345.50"},
+		{"es-AR", 12345.5, 2, "12.345,50"},
+		// Negatives that round to zero have no sign
+		{"en", -0.004, 2, "0.00"},
+		{"es", -0.4, 0, "0"},
+		{"en", -0.005001, 2, "-0.01"},
+	}
+	for _, tt := range tests {
+		if got := Lookup(tt.tag).Number(tt.v, tt.decimals); got != tt.want {
+			t.Errorf("Lookup(%q).Number(%v, %d) = %q, want %q", tt.tag, tt.v, tt.decimals, got, tt.want)
+		}
+	}
+}
+
+func TestMoney(t *testing.T) {
+	tests := []struct {
+		tag      string
+		amount   float64
+		currency string
+		want     string
+	}{
+		{"en", 1234.5, "USD", "$1,234.50"},
+		{"en", -1234.5, "USD", "-$1,234.50"},
+		{"en", 1234.5, "EUR", "€1,234.50"},
+		// Currencies without a symbol are written with their code and a non-breaking space
+		{"en", 12, "CHF", "CHF\u00a012.00"},
+		{"es-MX", 12345.5, "MXN", "$12,345.50"},
+		{"es-MX", -12, "MXN", "-$12.00"},
+		// Spain puts the symbol after the number, South America before it with a non-breaking space
+		{"es", 1234.5, "EUR", "1234,50\u00a0€"},
+		{"es-ES", -12345.5, "EUR", "-12.345,50\u00a0€"},
+		{"es", 12, "CHF", "12,00\u00a0CHF"},
+		{"es-AR", 12345.5, "ARS", "$\u00a012.345,50"},
+		{"es-AR", -12345.5, "ARS", "-$\u00a012.345,50"},
+		// Zero-decimal currencies are rounded to units
+		{"en", 1234.6, "JPY", "¥1,235"},
+		{"es-CL", 12345.4, "CLP", "$\u00a012.345"},
+		{"en", 1000, "KRW", "KRW\u00a01,000"},
+		// Negatives that round to zero have no sign
+		{"en", -0.004, "USD", "$0.00"},
+		{"es", -0.004, "EUR", "0,00\u00a0€"},
+		{"en", -0.4, "JPY", "¥0"},
+		{"es-AR", -0.001, "ARS", "$\u00a00,00"},
+	}
+	for _, tt := range tests {
+		if got := Lookup(tt.tag).Money(tt.amount, tt.currency); got != tt.want {
+			t.Errorf("Lookup(%q).Money(%v, %s) = %q, want %q", tt.tag, tt.amount, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestMonthName(t *testing.T) {
+	tests := []struct {
+		tag   string
+		month string
+		want  string
+	}{
+		{"en", "2023-03", "March 2023"},
+		{"es", "2023-03", "marzo de 2023"},
+		{"es-MX", "2022-12", "diciembre de 2022"},
+		// Older summaries store the English name without a year
+		{"en", "March", "March"},
+		{"es", "March", "marzo"},
+		// Other names are kept
+		{"es", "Q1 2023", "Q1 2023"},
+		{"en", "", ""},
+	}
+	for _, tt := range tests {
+		if got := Lookup(tt.tag).MonthName(tt.month); got != tt.want {
+			t.Errorf("Lookup(%q).MonthName(%q) = %q, want %q", tt.tag, tt.month, got, tt.want)
+		}
+	}
+}
+
+func TestDate(t *testing.T) {
+	day := time.Date(2023, time.March, 5, 23, 0, 0, 0, time.UTC)
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{"en", "March 5, 2023"},
+		{"es", "5 de marzo de 2023"},
+		{"es-MX", "5 de marzo de 2023"},
+		{"fr", "March 5, 2023"},
+	}
+	for _, tt := range tests {
+		if got := Lookup(tt.tag).Date(day); got != tt.want {
+			t.Errorf("Lookup(%q).Date = %q, want %q", tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		tag     string
+		subject string
+		amount  string
+	}{
+		{"en", "Transaction Summary", "1,234.50"},
+		{"en-GB", "Transaction Summary", "1,234.50"},
+		{"es", "Resumen de transacciones", "1234,50"},
+		// A region falls back to the catalog of its language, with its own number format
+		{"es-MX", "Resumen de transacciones", "1234.50"},
+		{"es_MX", "Resumen de transacciones", "1234.50"},
+		{"ES-mx", "Resumen de transacciones", "1234.50"},
+		{"es-419", "Resumen de transacciones", "1234,50"},
+		// Scripts are skipped to find the region
+		{"es-Latn-MX", "Resumen de transacciones", "1234.50"},
+		// Languages without a catalog get the English one
+		{"fr", "Transaction Summary", "1,234.50"},
+		{"fr-FR", "Transaction Summary", "1,234.50"},
+		{"", "Transaction Summary", "1,234.50"},
+	}
+	for _, tt := range tests {
+		locale := Lookup(tt.tag)
+		if locale.Tag != tt.tag {
+			t.Errorf("Lookup(%q).Tag = %q", tt.tag, locale.Tag)
+		}
+		if got := locale.T("subject"); got != tt.subject {
+			t.Errorf("Lookup(%q).T(subject) = %q, want %q", tt.tag, got, tt.subject)
+		}
+		if got := locale.Number(1234.5, 2); got != tt.amount {
+			t.Errorf("Lookup(%q).Number(1234.5, 2) = %q, want %q", tt.tag, got, tt.amount)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	es := Lookup("es")
+	if got, want := es.T("greeting", "Ana", 7), "Hola Ana, este es el resumen de la cuenta 7."; got != want {
+		t.Errorf("T(greeting) = %q, want %q", got, want)
+	}
+	if got := es.T("no_such_key"); got != "no_such_key" {
+		t.Errorf("T of an unknown key = %q, want the key", got)
+	}
+
+	// Messages missing from a catalog are taken from the English one
+	partial := &Locale{Tag: "xx", catalog: &catalog{Messages: map[string]string{"title": "Title"}}, fallback: catalogs[DefaultLanguage]}
+	if got := partial.T("title"); got != "Title" {
+		t.Errorf("T(title) = %q, want the message of the catalog", got)
+	}
+	if got := partial.T("subject"); got != "Transaction Summary" {
+		t.Errorf("T(subject) = %q, want the English message", got)
+	}
+}
+
+// TestCatalogs checks every language translates the months and the messages of the English catalog
+func TestCatalogs(t *testing.T) {
+	english := catalogs[DefaultLanguage]
+	for _, language := range Languages() {
+		c := catalogs[language]
+		for i := range c.Months {
+			if c.Months[i] == "" || c.ShortMonths[i] == "" {
+				t.Errorf("catalog %s has no name for month %d", language, i+1)
+			}
+		}
+		if c.Date == "" || c.MonthYear == "" {
+			t.Errorf("catalog %s has no date patterns", language)
+		}
+		for key := range english.Messages {
+			if _, ok := c.Messages[key]; !ok {
+				t.Errorf("catalog %s has no message %s", language, key)
+			}
+		}
+	}
+}
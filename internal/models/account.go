@@ -1,6 +1,108 @@
 package models
 
+import (
+	"net/mail"
+	"regexp"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+)
+
+// Defaults for the account profile fields that aren't given
+const (
+	DefaultTimeZone = "UTC"
+	DefaultCurrency = "USD"
+	DefaultLocale   = "en"
+)
+
+// Account statuses
+const (
+	AccountActive    = "active"
+	AccountSuspended = "suspended"
+	AccountClosed    = "closed"
+)
+
+var (
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+	localePattern   = regexp.MustCompile(`^[a-z]{2,3}([-_][A-Za-z0-9]{2,8})*$`)
+)
+
 // Account represents a user account
 type Account struct {
-	AccountID int
+	AccountID  int
+	HolderName string
+	// Contact emails, the first one is the primary address
+	Emails   []string
+	Currency string
+	Locale   string
+	TimeZone string
+	Status   string
+}
+
+// SetDefaults fills in the profile fields that were left empty
+func (a *Account) SetDefaults() {
+	if a.Currency == "" {
+		a.Currency = DefaultCurrency
+	}
+	if a.Locale == "" {
+		a.Locale = DefaultLocale
+	}
+	if a.TimeZone == "" {
+		a.TimeZone = DefaultTimeZone
+	}
+	if a.Status == "" {
+		a.Status = AccountActive
+	}
+}
+
+// Validate checks the account profile. Empty fields are valid, they take their defaults.
+func (a *Account) Validate() error {
+	for _, email := range a.Emails {
+		address, err := mail.ParseAddress(email)
+		if err != nil || address.Address != email {
+			return apperrors.Invalid("invalid email address %q", email)
+		}
+	}
+	if a.Currency != "" && !currencyPattern.MatchString(a.Currency) {
+		return apperrors.Invalid("invalid currency %q, expected an ISO 4217 code such as MXN", a.Currency)
+	}
+	if a.Locale != "" && !localePattern.MatchString(a.Locale) {
+		return apperrors.Invalid("invalid locale %q, expected a language tag such as es-MX", a.Locale)
+	}
+	if _, err := a.Location(); err != nil {
+		return err
+	}
+	switch a.Status {
+	case "", AccountActive, AccountSuspended, AccountClosed:
+	default:
+		return apperrors.Invalid("invalid account status %q", a.Status)
+	}
+	return nil
+}
+
+// Location returns the time zone of the account. Accounts without a time zone are treated as UTC.
+func (a *Account) Location() (*time.Location, error) {
+	if a.TimeZone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(a.TimeZone)
+	if err != nil {
+		return nil, apperrors.Invalid("invalid time zone %q: %w", a.TimeZone, err)
+	}
+	return loc, nil
+}
+
+// AuditState is the account as recorded in the audit log, without the holder name and the emails
+func (a *Account) AuditState() interface{} {
+	if a == nil {
+		return nil
+	}
+	state := *a
+	state.HolderName = ""
+	state.Emails = nil
+	return struct {
+		Account
+		HasHolderName bool
+		EmailCount    int
+	}{state, a.HolderName != "", len(a.Emails)}
 }
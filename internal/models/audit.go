@@ -0,0 +1,58 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// Audit actions
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+	AuditImport = "import"
+	AuditSend   = "send"
+	// AuditSendFailed records an email that couldn't be delivered
+	AuditSendFailed = "send_failed"
+)
+
+// AuditEvent is an entry of the append-only audit log: who changed what, and when
+type AuditEvent struct {
+	EventID    int
+	OccurredAt time.Time
+	Actor      string
+	Action     string
+
+	// Entity is the kind of row or object, such as account or transaction, and EntityID its ID
+	Entity   string
+	EntityID string
+
+	// Hashes of the entity before and after the change, empty when it didn't exist
+	BeforeHash string
+	AfterHash  string
+
+	// Details holds what the hashes can't tell, such as the number of rows of a bulk change
+	Details string
+}
+
+// auditStater is implemented by the entities holding personal data. Their audit state leaves it out,
+// as a plain hash of a name or an address could be confirmed by hashing a guess long after an erasure.
+type auditStater interface {
+	AuditState() interface{}
+}
+
+// StateHash returns the SHA-256 hash of the JSON encoding of a value, to record its state in an audit event
+// without copying its data. Entities holding personal data are hashed by their AuditState.
+func StateHash(value interface{}) string {
+	if stater, ok := value.(auditStater); ok {
+		value = stater.AuditState()
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Erasure modes
+const (
+	// ErasureDelete removes the personal data and the raw transactions of the account
+	ErasureDelete = "erase"
+	// ErasurePseudonymize replaces the personal data with irreversible pseudonyms and keeps the transactions
+	ErasurePseudonymize = "pseudonymize"
+)
+
+// GenesisHash is the PrevHash of the first record of the erasure log
+var GenesisHash = strings.Repeat("0", 64)
+
+// ErasureRecord is an entry of the append-only erasure log. It holds no personal data.
+type ErasureRecord struct {
+	ErasureID   int
+	AccountID   int
+	Mode        string
+	Reason      string
+	RequestedBy string
+	ErasedAt    time.Time
+
+	// Hash of the previous record, which chains the log so that changes to it can be detected
+	PrevHash string
+	Hash     string
+}
+
+// ComputeHash returns the SHA-256 hash of the record contents and the hash of the previous record
+func (r *ErasureRecord) ComputeHash() string {
+	fields := []string{
+		r.PrevHash,
+		strconv.Itoa(r.AccountID),
+		r.Mode,
+		r.Reason,
+		r.RequestedBy,
+		r.ErasedAt.UTC().Format(time.RFC3339Nano),
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// Delivery states of an outbox message
+const (
+	// OutboxPending messages wait for their next attempt
+	OutboxPending = "pending"
+	// OutboxSending messages are claimed by a worker until their next attempt time; a worker that
+	// stops while sending leaves them to be claimed again after that
+	OutboxSending = "sending"
+	OutboxSent    = "sent"
+	// OutboxDead messages failed permanently or ran out of attempts, and wait for an operator
+	OutboxDead      = "dead"
+	OutboxCancelled = "cancelled"
+)
+
+// OutboxMessage is a rendered email queued for delivery, with the state of its delivery attempts
+type OutboxMessage struct {
+	OutboxID  int
+	AccountID int
+	// SummaryID is the statement the message delivers, 0 when it has none or it was purged
+	SummaryID int
+
+	// Payload is the rendered message, as encoded by the view package
+	Payload []byte
+
+	Status   string
+	Attempts int
+	// NextAttemptAt is when a pending message is due, or when the claim of a sending message expires
+	NextAttemptAt time.Time
+	LastError     string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// SentAt is zero until the message is sent
+	SentAt time.Time
+}
+
+// Awaiting reports whether the message still waits to be delivered
+func (m *OutboxMessage) Awaiting() bool {
+	return m.Status == OutboxPending || m.Status == OutboxSending
+}
+
+// AuditState is the message as recorded in the audit log, without the rendered message, which holds
+// the holder name and the recipients
+func (m *OutboxMessage) AuditState() interface{} {
+	if m == nil {
+		return nil
+	}
+	state := *m
+	state.Payload = nil
+	return struct {
+		OutboxMessage
+		HasPayload bool
+	}{state, len(m.Payload) > 0}
+}
@@ -0,0 +1,22 @@
+package models
+
+import "github.com/aldaircoronel/email-summary/internal/apperrors"
+
+// RetentionPolicy holds the retention rules of one account, in months. A nil rule falls back
+// to the global rule and 0 keeps the rows forever.
+type RetentionPolicy struct {
+	AccountID         int
+	TransactionMonths *int
+	SummaryMonths     *int
+}
+
+// Validate checks that the rules aren't negative
+func (p *RetentionPolicy) Validate() error {
+	if p.TransactionMonths != nil && *p.TransactionMonths < 0 {
+		return apperrors.Invalid("invalid transaction retention %d, must not be negative", *p.TransactionMonths)
+	}
+	if p.SummaryMonths != nil && *p.SummaryMonths < 0 {
+		return apperrors.Invalid("invalid summary retention %d, must not be negative", *p.SummaryMonths)
+	}
+	return nil
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // This represents the summary information for a set of transaction
 type Summary struct {
 	SummaryID               int
@@ -10,11 +12,24 @@ type Summary struct {
 	NumOfDebitTransactions  int
 	TotalAverageCredit      float64
 	TotalAverageDebit       float64
+
+	// Statement period, the dates of the first and last transaction
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+	GeneratedAt time.Time
+
+	// The statement as it was delivered
+	Subject    string
+	HTMLBody   string
+	TextBody   string
+	Recipients []string
 }
 
 // This represents month summary
 type MonthSummary struct {
-	MonthSummaryID          int
+	MonthSummaryID int
+	// Month is the year and month in MonthLayout. Summaries stored before years were kept hold only
+	// the English name of the month, see ParseMonth.
 	Month                   string
 	TotalBalance            float64
 	TotalTransactions       int
@@ -24,3 +39,33 @@ type MonthSummary struct {
 	AverageDebit            float64
 	SummaryID               int
 }
+
+// MonthLayout is the time layout of MonthSummary.Month
+const MonthLayout = "2006-01"
+
+// ParseMonth parses the Month of a month summary. hasYear is false for the English month names of
+// older summaries, whose time is in year 0.
+func ParseMonth(month string) (t time.Time, hasYear bool, err error) {
+	if t, err := time.Parse(MonthLayout, month); err == nil {
+		return t, true, nil
+	}
+	t, err = time.Parse("January", month)
+	return t, false, err
+}
+
+// AuditState is the summary as recorded in the audit log, without the delivered statement, which
+// holds the holder name and the recipients
+func (s *Summary) AuditState() interface{} {
+	if s == nil {
+		return nil
+	}
+	state := *s
+	state.Subject = ""
+	state.HTMLBody = ""
+	state.TextBody = ""
+	state.Recipients = nil
+	return struct {
+		Summary
+		HasContent bool
+	}{state, s.Subject != "" || s.HTMLBody != "" || s.TextBody != "" || len(s.Recipients) > 0}
+}
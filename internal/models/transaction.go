@@ -10,4 +10,5 @@ type Transaction struct {
 	Date          time.Time
 	Amount        float64
 	IsCredit      bool
+	Category      string
 }
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/models"
+)
+
+// AuditQuery describes a filtered page of audit events, oldest first. Zero values mean "no filter".
+type AuditQuery struct {
+	Entity   string
+	EntityID string
+	Actor    string
+	Action   string
+
+	// Time range, From inclusive and To exclusive
+	From time.Time
+	To   time.Time
+
+	// Limit is the page size, DefaultPageSize when zero
+	Limit int
+
+	// Cursor is the NextCursor of the previous page, empty for the first page
+	Cursor string
+}
+
+// AuditPage is one page of ListAuditEvents results
+type AuditPage struct {
+	Events []*models.AuditEvent
+
+	// NextCursor fetches the following page; it is empty on the last page
+	NextCursor string
+}
+
+// auditCursor is the decoded position after the last event of a page
+type auditCursor struct {
+	EventID int `json:"i"`
+}
+
+// Normalize validates the query and fills in the defaults. It returns the ID of the event the page
+// starts after, 0 for the first page.
+func (q *AuditQuery) Normalize() (int, error) {
+	if q.Limit == 0 {
+		q.Limit = DefaultPageSize
+	}
+	if q.Limit < 0 || q.Limit > MaxPageSize {
+		return 0, apperrors.Invalid("invalid page size %d, must be between 1 and %d", q.Limit, MaxPageSize)
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To) {
+		return 0, apperrors.Invalid("invalid time range, from must be before to")
+	}
+	if q.Cursor == "" {
+		return 0, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return 0, apperrors.Invalid("invalid cursor: %w", err)
+	}
+	cursor := &auditCursor{}
+	if err := json.Unmarshal(data, cursor); err != nil {
+		return 0, apperrors.Invalid("invalid cursor: %w", err)
+	}
+	return cursor.EventID, nil
+}
+
+// Matches reports whether the event passes the filters of the query
+func (q *AuditQuery) Matches(event *models.AuditEvent) bool {
+	if q.Entity != "" && event.Entity != q.Entity {
+		return false
+	}
+	if q.EntityID != "" && event.EntityID != q.EntityID {
+		return false
+	}
+	if q.Actor != "" && event.Actor != q.Actor {
+		return false
+	}
+	if q.Action != "" && event.Action != q.Action {
+		return false
+	}
+	if !q.From.IsZero() && event.OccurredAt.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !event.OccurredAt.Before(q.To) {
+		return false
+	}
+	return true
+}
+
+// NewAuditCursor returns the cursor positioned after the given event
+func NewAuditCursor(last *models.AuditEvent) string {
+	data, _ := json.Marshal(auditCursor{EventID: last.EventID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
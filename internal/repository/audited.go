@@ -0,0 +1,285 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/models"
+)
+
+// auditedRepository records an audit event for every change made through the repository it wraps
+type auditedRepository struct {
+	Repository
+	actor string
+}
+
+// NewAuditedRepository wraps a repository so every change made through it is written to the audit log,
+// attributed to the given actor. Each change and its event are made in one transaction, so a change
+// whose event can't be recorded is rolled back.
+func NewAuditedRepository(repo Repository, actor string) Repository {
+	return &auditedRepository{Repository: repo, actor: actor}
+}
+
+// inTx runs fn with the repository bound to a transaction, which the change and its event are made in
+func (r *auditedRepository) inTx(ctx context.Context, fn func(tx *auditedRepository) error) error {
+	return r.Repository.InTx(ctx, func(repo Repository) error {
+		return fn(&auditedRepository{Repository: repo, actor: r.actor})
+	})
+}
+
+// InTx runs fn with the audited repository bound to a transaction
+func (r *auditedRepository) InTx(ctx context.Context, fn func(repo Repository) error) error {
+	return r.inTx(ctx, func(tx *auditedRepository) error {
+		return fn(tx)
+	})
+}
+
+// record saves an audit event for a change of the entity
+func (r *auditedRepository) record(ctx context.Context, action, entity, entityID, beforeHash, afterHash, details string) error {
+	event := &models.AuditEvent{
+		Action:     action,
+		Entity:     entity,
+		EntityID:   entityID,
+		BeforeHash: beforeHash,
+		AfterHash:  afterHash,
+		Details:    details,
+	}
+	if err := r.SaveAuditEvent(ctx, event); err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+	return nil
+}
+
+// idDetails lists the IDs of a bulk change
+func idDetails(deleted int, ids []int) string {
+	list := make([]string, len(ids))
+	for i, id := range ids {
+		list[i] = strconv.Itoa(id)
+	}
+	return fmt.Sprintf("%d deleted of ids %s", deleted, strings.Join(list, ","))
+}
+
+// SaveAuditEvent stores an event, attributing it to the actor of the repository unless it names one
+func (r *auditedRepository) SaveAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	if event.Actor == "" {
+		event.Actor = r.actor
+	}
+	return r.Repository.SaveAuditEvent(ctx, event)
+}
+
+func (r *auditedRepository) SaveAccount(ctx context.Context, account *models.Account) (int, error) {
+	var id int
+	err := r.inTx(ctx, func(tx *auditedRepository) error {
+		var err error
+		if id, err = tx.Repository.SaveAccount(ctx, account); err != nil {
+			return err
+		}
+		return tx.record(ctx, models.AuditCreate, "account", strconv.Itoa(id), "", models.StateHash(account), "")
+	})
+	return id, err
+}
+
+func (r *auditedRepository) UpdateAccount(ctx context.Context, account *models.Account) error {
+	return r.inTx(ctx, func(tx *auditedRepository) error {
+		before, err := tx.Repository.GetAccountByID(ctx, account.AccountID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Repository.UpdateAccount(ctx, account); err != nil {
+			return err
+		}
+		return tx.record(ctx, models.AuditUpdate, "account", strconv.Itoa(account.AccountID), models.StateHash(before), models.StateHash(account), "")
+	})
+}
+
+func (r *auditedRepository) DeleteAccount(ctx context.Context, id int) error {
+	return r.inTx(ctx, func(tx *auditedRepository) error {
+		before, err := tx.Repository.GetAccountByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := tx.Repository.DeleteAccount(ctx, id); err != nil {
+			return err
+		}
+		return tx.record(ctx, models.AuditDelete, "account", strconv.Itoa(id), models.StateHash(before), "", "")
+	})
+}
+
+func (r *auditedRepository) SaveTransaction(ctx context.Context, trx *models.Transaction) error {
+	return r.inTx(ctx, func(tx *auditedRepository) error {
+		if err := tx.Repository.SaveTransaction(ctx, trx); err != nil {
+			return err
+		}
+		return tx.record(ctx, models.AuditCreate, "transaction", strconv.Itoa(trx.TransactionID), "", models.StateHash(trx), "")
+	})
+}
+
+func (r *auditedRepository) DeleteTransactions(ctx context.Context, ids []int) (int, error) {
+	var deleted int
+	err := r.inTx(ctx, func(tx *auditedRepository) error {
+		var err error
+		if deleted, err = tx.Repository.DeleteTransactions(ctx, ids); err != nil || deleted == 0 {
+			return err
+		}
+		return tx.record(ctx, models.AuditDelete, "transaction", "", models.StateHash(ids), "", idDetails(deleted, ids))
+	})
+	return deleted, err
+}
+
+func (r *auditedRepository) SaveSummary(ctx context.Context, s *models.Summary) error {
+	return r.inTx(ctx, func(tx *auditedRepository) error {
+		if err := tx.Repository.SaveSummary(ctx, s); err != nil {
+			return err
+		}
+		return tx.record(ctx, models.AuditCreate, "summary", strconv.Itoa(s.SummaryID), "", models.StateHash(s), "")
+	})
+}
+
+func (r *auditedRepository) SaveSummaryContent(ctx context.Context, s *models.Summary) error {
+	return r.inTx(ctx, func(tx *auditedRepository) error {
+		before, err := tx.Repository.GetSummaryByID(ctx, s.SummaryID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Repository.SaveSummaryContent(ctx, s); err != nil {
+			return err
+		}
+		after, err := tx.Repository.GetSummaryByID(ctx, s.SummaryID)
+		if err != nil {
+			return err
+		}
+		return tx.record(ctx, models.AuditUpdate, "summary", strconv.Itoa(s.SummaryID), models.StateHash(before), models.StateHash(after), "")
+	})
+}
+
+func (r *auditedRepository) DeleteSummaries(ctx context.Context, ids []int) (int, error) {
+	var deleted int
+	err := r.inTx(ctx, func(tx *auditedRepository) error {
+		var err error
+		if deleted, err = tx.Repository.DeleteSummaries(ctx, ids); err != nil || deleted == 0 {
+			return err
+		}
+		return tx.record(ctx, models.AuditDelete, "summary", "", models.StateHash(ids), "", idDetails(deleted, ids))
+	})
+	return deleted, err
+}
+
+func (r *auditedRepository) SaveMonthSummary(ctx context.Context, ms *models.MonthSummary, summaryID int) error {
+	return r.inTx(ctx, func(tx *auditedRepository) error {
+		if err := tx.Repository.SaveMonthSummary(ctx, ms, summaryID); err != nil {
+			return err
+		}
+		return tx.record(ctx, models.AuditCreate, "month_summary", strconv.Itoa(ms.MonthSummaryID), "", models.StateHash(ms), fmt.Sprintf("summary %d", summaryID))
+	})
+}
+
+// retentionPolicyHash returns the state hash of the retention policy of an account, empty if it has none
+func (r *auditedRepository) retentionPolicyHash(ctx context.Context, accountID int) (string, error) {
+	policy, err := r.Repository.GetRetentionPolicy(ctx, accountID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return models.StateHash(policy), nil
+}
+
+func (r *auditedRepository) SaveRetentionPolicy(ctx context.Context, policy *models.RetentionPolicy) error {
+	return r.inTx(ctx, func(tx *auditedRepository) error {
+		before, err := tx.retentionPolicyHash(ctx, policy.AccountID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Repository.SaveRetentionPolicy(ctx, policy); err != nil {
+			return err
+		}
+		action := models.AuditUpdate
+		if before == "" {
+			action = models.AuditCreate
+		}
+		return tx.record(ctx, action, "retention_policy", strconv.Itoa(policy.AccountID), before, models.StateHash(policy), "")
+	})
+}
+
+func (r *auditedRepository) DeleteRetentionPolicy(ctx context.Context, accountID int) error {
+	return r.inTx(ctx, func(tx *auditedRepository) error {
+		before, err := tx.retentionPolicyHash(ctx, accountID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Repository.DeleteRetentionPolicy(ctx, accountID); err != nil {
+			return err
+		}
+		return tx.record(ctx, models.AuditDelete, "retention_policy", strconv.Itoa(accountID), before, "", "")
+	})
+}
+
+func (r *auditedRepository) AppendErasureRecord(ctx context.Context, record *models.ErasureRecord) error {
+	return r.inTx(ctx, func(tx *auditedRepository) error {
+		if err := tx.Repository.AppendErasureRecord(ctx, record); err != nil {
+			return err
+		}
+		return tx.record(ctx, models.AuditCreate, "erasure_record", strconv.Itoa(record.ErasureID), "", record.Hash,
+			fmt.Sprintf("%s of account %d", record.Mode, record.AccountID))
+	})
+}
+
+func (r *auditedRepository) EnqueueStatement(ctx context.Context, s *models.Summary, msg *models.OutboxMessage) error {
+	return r.inTx(ctx, func(tx *auditedRepository) error {
+		before, err := tx.Repository.GetSummaryByID(ctx, s.SummaryID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Repository.EnqueueStatement(ctx, s, msg); err != nil {
+			return err
+		}
+		after, err := tx.Repository.GetSummaryByID(ctx, s.SummaryID)
+		if err != nil {
+			return err
+		}
+		if err := tx.record(ctx, models.AuditUpdate, "summary", strconv.Itoa(s.SummaryID), models.StateHash(before), models.StateHash(after), ""); err != nil {
+			return err
+		}
+		return tx.record(ctx, models.AuditCreate, "outbox_message", strconv.Itoa(msg.OutboxID), "", models.StateHash(msg), fmt.Sprintf("summary %d", s.SummaryID))
+	})
+}
+
+func (r *auditedRepository) EnqueueMessage(ctx context.Context, msg *models.OutboxMessage) error {
+	return r.inTx(ctx, func(tx *auditedRepository) error {
+		if err := tx.Repository.EnqueueMessage(ctx, msg); err != nil {
+			return err
+		}
+		return tx.record(ctx, models.AuditCreate, "outbox_message", strconv.Itoa(msg.OutboxID), "", models.StateHash(msg), "")
+	})
+}
+
+func (r *auditedRepository) UpdateOutboxMessage(ctx context.Context, msg *models.OutboxMessage, prevStatus string, prevAttempts int) error {
+	return r.inTx(ctx, func(tx *auditedRepository) error {
+		before, err := tx.Repository.GetOutboxMessage(ctx, msg.OutboxID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Repository.UpdateOutboxMessage(ctx, msg, prevStatus, prevAttempts); err != nil {
+			return err
+		}
+		return tx.record(ctx, models.AuditUpdate, "outbox_message", strconv.Itoa(msg.OutboxID), models.StateHash(before), models.StateHash(msg),
+			fmt.Sprintf("%s to %s, attempt %d", prevStatus, msg.Status, msg.Attempts))
+	})
+}
+
+func (r *auditedRepository) DeleteOutboxMessages(ctx context.Context, ids []int) (int, error) {
+	var deleted int
+	err := r.inTx(ctx, func(tx *auditedRepository) error {
+		var err error
+		if deleted, err = tx.Repository.DeleteOutboxMessages(ctx, ids); err != nil || deleted == 0 {
+			return err
+		}
+		return tx.record(ctx, models.AuditDelete, "outbox_message", "", models.StateHash(ids), "", idDetails(deleted, ids))
+	})
+	return deleted, err
+}
@@ -0,0 +1,64 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aldaircoronel/email-summary/internal/database"
+	"github.com/aldaircoronel/email-summary/internal/models"
+	"github.com/aldaircoronel/email-summary/internal/repository"
+)
+
+// unavailableAuditLog is a repository whose audit log can't be written
+type unavailableAuditLog struct {
+	repository.Repository
+}
+
+func (r unavailableAuditLog) SaveAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	return errors.New("audit log unavailable")
+}
+
+func (r unavailableAuditLog) InTx(ctx context.Context, fn func(repo repository.Repository) error) error {
+	return r.Repository.InTx(ctx, func(repo repository.Repository) error {
+		return fn(unavailableAuditLog{repo})
+	})
+}
+
+func TestAuditedChangeRecordsEvent(t *testing.T) {
+	ctx := context.Background()
+	db := database.NewMemoryRepository()
+	repo := repository.NewAuditedRepository(db, "tester")
+
+	id, err := repo.SaveAccount(ctx, &models.Account{HolderName: "Ana", Emails: []string{"ana@example.com"}})
+	if err != nil {
+		t.Fatalf("SaveAccount: %v", err)
+	}
+	page, err := db.ListAuditEvents(ctx, repository.AuditQuery{Entity: "account"})
+	if err != nil {
+		t.Fatalf("ListAuditEvents: %v", err)
+	}
+	if len(page.Events) != 1 || page.Events[0].Action != models.AuditCreate || page.Events[0].Actor != "tester" {
+		t.Fatalf("audit events after SaveAccount = %+v, want one create by tester", page.Events)
+	}
+	if _, err := db.GetAccountByID(ctx, id); err != nil {
+		t.Errorf("GetAccountByID: %v", err)
+	}
+}
+
+func TestAuditedChangeRolledBackWithoutEvent(t *testing.T) {
+	ctx := context.Background()
+	db := database.NewMemoryRepository()
+	repo := repository.NewAuditedRepository(unavailableAuditLog{db}, "tester")
+
+	if _, err := repo.SaveAccount(ctx, &models.Account{HolderName: "Ana", Emails: []string{"ana@example.com"}}); err == nil {
+		t.Fatal("SaveAccount succeeded without an audit log")
+	}
+	accounts, err := db.ListAccounts(ctx)
+	if err != nil {
+		t.Fatalf("ListAccounts: %v", err)
+	}
+	if len(accounts) != 0 {
+		t.Errorf("ListAccounts = %d accounts, want the unaudited one rolled back", len(accounts))
+	}
+}
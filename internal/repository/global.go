@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aldaircoronel/email-summary/internal/models"
+)
+
+// ErrNoRepository is returned by the deprecated package-level functions when SetRepository was never called
+var ErrNoRepository = errors.New("repository: no implementation set, call SetRepository first")
+
+// Define the repository struct
+var implementation Repository
+
+// SetRepository sets the global repository implementation
+//
+// Deprecated: construct a Repository (see database.Open) and pass it explicitly to the code
+// that needs it, e.g. controller.NewTransactionController. The package-level functions below
+// only remain for backward compatibility.
+func SetRepository(repository Repository) {
+	implementation = repository
+}
+
+// SaveAccount saves the given account
+//
+// Deprecated: call the method on an injected Repository instead.
+func SaveAccount(ctx context.Context, account *models.Account) (int, error) {
+	if implementation == nil {
+		return 0, ErrNoRepository
+	}
+	return implementation.SaveAccount(ctx, account)
+}
+
+// GetAccountByID retrieves the account with the given ID
+//
+// Deprecated: call the method on an injected Repository instead.
+func GetAccountByID(ctx context.Context, id int) (*models.Account, error) {
+	if implementation == nil {
+		return nil, ErrNoRepository
+	}
+	return implementation.GetAccountByID(ctx, id)
+}
+
+// SaveTransaction saves the given transaction
+//
+// Deprecated: call the method on an injected Repository instead.
+func SaveTransaction(ctx context.Context, transaction *models.Transaction) error {
+	if implementation == nil {
+		return ErrNoRepository
+	}
+	return implementation.SaveTransaction(ctx, transaction)
+}
+
+// GetTransactionByAccountID retrieves the transaction with the given AccountID
+//
+// Deprecated: call the method on an injected Repository instead.
+func GetTransactionByAccountID(ctx context.Context, accountID int) ([]*models.Transaction, error) {
+	if implementation == nil {
+		return nil, ErrNoRepository
+	}
+	return implementation.GetTransactionByAccountID(ctx, accountID)
+}
+
+// ListTransactions retrieves a list of all transactions
+//
+// Deprecated: call the method on an injected Repository instead.
+func ListTransactions(ctx context.Context) ([]*models.Transaction, error) {
+	if implementation == nil {
+		return nil, ErrNoRepository
+	}
+	return implementation.ListTransactions(ctx)
+}
+
+// SaveSummary saves the given summary
+//
+// Deprecated: call the method on an injected Repository instead.
+func SaveSummary(ctx context.Context, s *models.Summary) error {
+	if implementation == nil {
+		return ErrNoRepository
+	}
+	return implementation.SaveSummary(ctx, s)
+}
+
+// GetSummaryByAccountID retrieves the latest summary of the account with the given ID
+//
+// Deprecated: call the method on an injected Repository instead.
+func GetSummaryByAccountID(ctx context.Context, accountID int) (*models.Summary, error) {
+	if implementation == nil {
+		return nil, ErrNoRepository
+	}
+	return implementation.GetSummaryByAccountID(ctx, accountID)
+}
+
+// SaveMonthSummary saves the given month summary for the given summary ID
+//
+// Deprecated: call the method on an injected Repository instead.
+func SaveMonthSummary(ctx context.Context, ms *models.MonthSummary, summaryID int) error {
+	if implementation == nil {
+		return ErrNoRepository
+	}
+	return implementation.SaveMonthSummary(ctx, ms, summaryID)
+}
+
+// GetMonthSummaryBySummaryID retrieves a list of month summaries for the given summary ID
+//
+// Deprecated: call the method on an injected Repository instead.
+func GetMonthSummaryBySummaryID(ctx context.Context, summaryID int) ([]*models.MonthSummary, error) {
+	if implementation == nil {
+		return nil, ErrNoRepository
+	}
+	return implementation.GetMonthSummaryBySummaryID(ctx, summaryID)
+}
+
+// Implement the Close method of the Repository interface
+//
+// Deprecated: call the method on an injected Repository instead.
+func Close() error {
+	if implementation == nil {
+		return ErrNoRepository
+	}
+	return implementation.Close()
+}
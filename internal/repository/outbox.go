@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/models"
+)
+
+// OutboxQuery describes a filtered page of outbox messages, oldest first. Zero values mean "no filter".
+type OutboxQuery struct {
+	AccountID int
+	SummaryID int
+	Status    string
+
+	// Due keeps the messages awaiting delivery whose next attempt is at or before it: pending
+	// messages, and sending messages whose claim expired
+	Due time.Time
+
+	// Limit is the page size, DefaultPageSize when zero
+	Limit int
+
+	// Cursor is the NextCursor of the previous page, empty for the first page
+	Cursor string
+}
+
+// OutboxPage is one page of ListOutboxMessages results
+type OutboxPage struct {
+	Messages []*models.OutboxMessage
+
+	// NextCursor fetches the following page; it is empty on the last page
+	NextCursor string
+}
+
+// outboxCursor is the decoded position after the last message of a page
+type outboxCursor struct {
+	OutboxID int `json:"i"`
+}
+
+// Normalize validates the query and fills in the defaults. It returns the ID of the message the page
+// starts after, 0 for the first page.
+func (q *OutboxQuery) Normalize() (int, error) {
+	if q.Limit == 0 {
+		q.Limit = DefaultPageSize
+	}
+	if q.Limit < 0 || q.Limit > MaxPageSize {
+		return 0, apperrors.Invalid("invalid page size %d, must be between 1 and %d", q.Limit, MaxPageSize)
+	}
+	switch q.Status {
+	case "", models.OutboxPending, models.OutboxSending, models.OutboxSent, models.OutboxDead, models.OutboxCancelled:
+	default:
+		return 0, apperrors.Invalid("invalid outbox status %q", q.Status)
+	}
+	if q.Cursor == "" {
+		return 0, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return 0, apperrors.Invalid("invalid cursor: %w", err)
+	}
+	cursor := &outboxCursor{}
+	if err := json.Unmarshal(data, cursor); err != nil {
+		return 0, apperrors.Invalid("invalid cursor: %w", err)
+	}
+	return cursor.OutboxID, nil
+}
+
+// Matches reports whether the message passes the filters of the query
+func (q *OutboxQuery) Matches(msg *models.OutboxMessage) bool {
+	if q.AccountID != 0 && msg.AccountID != q.AccountID {
+		return false
+	}
+	if q.SummaryID != 0 && msg.SummaryID != q.SummaryID {
+		return false
+	}
+	if q.Status != "" && msg.Status != q.Status {
+		return false
+	}
+	if !q.Due.IsZero() && (!msg.Awaiting() || msg.NextAttemptAt.After(q.Due)) {
+		return false
+	}
+	return true
+}
+
+// NewOutboxCursor returns the cursor positioned after the given message
+func NewOutboxCursor(last *models.OutboxMessage) string {
+	data, _ := json.Marshal(outboxCursor{OutboxID: last.OutboxID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
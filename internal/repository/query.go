@@ -0,0 +1,287 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/models"
+)
+
+// Direction filters transactions by credit or debit
+type Direction string
+
+const (
+	AnyDirection Direction = ""
+	Credit       Direction = "credit"
+	Debit        Direction = "debit"
+)
+
+// SortField is the column transactions are sorted by
+type SortField string
+
+const (
+	SortByDate   SortField = "date"
+	SortByAmount SortField = "amount"
+	SortByID     SortField = "transaction_id"
+)
+
+// Page size limits of QueryTransactions
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+// TransactionQuery describes a filtered, sorted page of transactions. Zero values mean "no filter".
+type TransactionQuery struct {
+	AccountID int
+
+	// Date range, From inclusive and To exclusive
+	From time.Time
+	To   time.Time
+
+	// Amount range, both inclusive, on the signed amount as stored
+	MinAmount *float64
+	MaxAmount *float64
+
+	Direction Direction
+	Category  string
+
+	SortBy     SortField
+	Descending bool
+
+	// Limit is the page size, DefaultPageSize when zero
+	Limit int
+
+	// Cursor is the NextCursor of the previous page, empty for the first page
+	Cursor string
+}
+
+// TransactionPage is one page of QueryTransactions results
+type TransactionPage struct {
+	Transactions []*models.Transaction
+
+	// NextCursor fetches the following page; it is empty on the last page
+	NextCursor string
+}
+
+// Cursor is the decoded position after the last transaction of a page. Pages are
+// ordered by (sort column, transaction_id), so the position is stable under inserts.
+type Cursor struct {
+	SortBy        SortField `json:"s"`
+	Descending    bool      `json:"d"`
+	Date          time.Time `json:"t,omitempty"`
+	Amount        float64   `json:"a,omitempty"`
+	TransactionID int       `json:"i"`
+}
+
+// Normalize validates the query and fills in the defaults. It returns the decoded cursor, or nil for the first page.
+func (q *TransactionQuery) Normalize() (*Cursor, error) {
+	switch q.SortBy {
+	case "":
+		q.SortBy = SortByDate
+	case SortByDate, SortByAmount, SortByID:
+	default:
+		return nil, apperrors.Invalid("invalid sort field %q", q.SortBy)
+	}
+
+	switch q.Direction {
+	case AnyDirection, Credit, Debit:
+	default:
+		return nil, apperrors.Invalid("invalid direction %q", q.Direction)
+	}
+
+	if q.Limit == 0 {
+		q.Limit = DefaultPageSize
+	}
+	if q.Limit < 0 || q.Limit > MaxPageSize {
+		return nil, apperrors.Invalid("invalid page size %d, must be between 1 and %d", q.Limit, MaxPageSize)
+	}
+
+	if !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To) {
+		return nil, apperrors.Invalid("invalid date range, from must be before to")
+	}
+	if q.MinAmount != nil && q.MaxAmount != nil && *q.MinAmount > *q.MaxAmount {
+		return nil, apperrors.Invalid("invalid amount range, min must not be greater than max")
+	}
+
+	if q.Cursor == "" {
+		return nil, nil
+	}
+	cursor, err := decodeCursor(q.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	// A cursor is only meaningful for the ordering it was produced with
+	if cursor.SortBy != q.SortBy || cursor.Descending != q.Descending {
+		return nil, apperrors.Invalid("invalid cursor: it belongs to a query with a different sort order")
+	}
+	return cursor, nil
+}
+
+// Matches reports whether the transaction passes the filters of the query
+func (q *TransactionQuery) Matches(trx *models.Transaction) bool {
+	if q.AccountID != 0 && trx.AccountID != q.AccountID {
+		return false
+	}
+	if !q.From.IsZero() && trx.Date.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !trx.Date.Before(q.To) {
+		return false
+	}
+	if q.MinAmount != nil && trx.Amount < *q.MinAmount {
+		return false
+	}
+	if q.MaxAmount != nil && trx.Amount > *q.MaxAmount {
+		return false
+	}
+	if q.Direction == Credit && !trx.IsCredit || q.Direction == Debit && trx.IsCredit {
+		return false
+	}
+	if q.Category != "" && trx.Category != q.Category {
+		return false
+	}
+	return true
+}
+
+// Less reports whether a sorts before b in the order requested by the query
+func (q *TransactionQuery) Less(a, b *models.Transaction) bool {
+	return compareTransactions(q.SortBy, a, b, q.Descending) < 0
+}
+
+// After reports whether the transaction comes after the cursor position
+func (c *Cursor) After(trx *models.Transaction) bool {
+	position := &models.Transaction{TransactionID: c.TransactionID, Date: c.Date, Amount: c.Amount}
+	return compareTransactions(c.SortBy, trx, position, c.Descending) > 0
+}
+
+// compareTransactions orders two transactions by the sort field, then by transaction_id
+func compareTransactions(sortBy SortField, a, b *models.Transaction, descending bool) int {
+	result := 0
+	switch sortBy {
+	case SortByDate:
+		if a.Date.Before(b.Date) {
+			result = -1
+		} else if a.Date.After(b.Date) {
+			result = 1
+		}
+	case SortByAmount:
+		if a.Amount < b.Amount {
+			result = -1
+		} else if a.Amount > b.Amount {
+			result = 1
+		}
+	}
+	if result == 0 {
+		if a.TransactionID < b.TransactionID {
+			result = -1
+		} else if a.TransactionID > b.TransactionID {
+			result = 1
+		}
+	}
+	if descending {
+		result = -result
+	}
+	return result
+}
+
+// NewCursor returns the cursor positioned after the given transaction
+func (q *TransactionQuery) NewCursor(last *models.Transaction) string {
+	cursor := Cursor{
+		SortBy:        q.SortBy,
+		Descending:    q.Descending,
+		TransactionID: last.TransactionID,
+	}
+	switch q.SortBy {
+	case SortByDate:
+		cursor.Date = last.Date.UTC()
+	case SortByAmount:
+		cursor.Amount = last.Amount
+	}
+
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor parses a cursor produced by NewCursor
+func decodeCursor(value string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, apperrors.Invalid("invalid cursor: %w", err)
+	}
+	cursor := &Cursor{}
+	if err := json.Unmarshal(data, cursor); err != nil {
+		return nil, apperrors.Invalid("invalid cursor: %w", err)
+	}
+	return cursor, nil
+}
+
+// SummaryPageRequest asks for one page of the statements of an account, newest first
+type SummaryPageRequest struct {
+	// Limit is the page size, DefaultPageSize when zero
+	Limit int
+
+	// Cursor is the NextCursor of the previous page, empty for the first page
+	Cursor string
+}
+
+// SummaryPage is one page of ListSummariesByAccount results
+type SummaryPage struct {
+	Summaries []*models.Summary
+
+	// NextCursor fetches the following page; it is empty on the last page
+	NextCursor string
+}
+
+// SummaryCursor is the decoded position after the last summary of a page
+type SummaryCursor struct {
+	GeneratedAt time.Time `json:"t"`
+	SummaryID   int       `json:"i"`
+}
+
+// Normalize validates the request and fills in the defaults. It returns the decoded cursor, or nil for the first page.
+func (p *SummaryPageRequest) Normalize() (*SummaryCursor, error) {
+	if p.Limit == 0 {
+		p.Limit = DefaultPageSize
+	}
+	if p.Limit < 0 || p.Limit > MaxPageSize {
+		return nil, apperrors.Invalid("invalid page size %d, must be between 1 and %d", p.Limit, MaxPageSize)
+	}
+	if p.Cursor == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(p.Cursor)
+	if err != nil {
+		return nil, apperrors.Invalid("invalid cursor: %w", err)
+	}
+	cursor := &SummaryCursor{}
+	if err := json.Unmarshal(data, cursor); err != nil {
+		return nil, apperrors.Invalid("invalid cursor: %w", err)
+	}
+	return cursor, nil
+}
+
+// NewSummaryCursor returns the cursor positioned after the given summary
+func NewSummaryCursor(last *models.Summary) string {
+	data, _ := json.Marshal(SummaryCursor{GeneratedAt: last.GeneratedAt.UTC(), SummaryID: last.SummaryID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// After reports whether the summary comes after the cursor position in newest-first order
+func (c *SummaryCursor) After(s *models.Summary) bool {
+	if s.GeneratedAt.Equal(c.GeneratedAt) {
+		return s.SummaryID < c.SummaryID
+	}
+	return s.GeneratedAt.Before(c.GeneratedAt)
+}
+
+// NewerSummary reports whether a comes before b in newest-first order
+func NewerSummary(a, b *models.Summary) bool {
+	if a.GeneratedAt.Equal(b.GeneratedAt) {
+		return a.SummaryID > b.SummaryID
+	}
+	return a.GeneratedAt.After(b.GeneratedAt)
+}
@@ -10,80 +10,65 @@ import (
 type Repository interface {
 
 	// AccountRepository methods
-	SaveAccount(ctx context.Context) (int, error)
+	SaveAccount(ctx context.Context, account *models.Account) (int, error)
 	GetAccountByID(ctx context.Context, id int) (*models.Account, error)
+	ListAccounts(ctx context.Context) ([]*models.Account, error)
+	UpdateAccount(ctx context.Context, account *models.Account) error
+	DeleteAccount(ctx context.Context, id int) error
 
 	// TransactionRepository methods
 	SaveTransaction(ctx context.Context, trx *models.Transaction) error
 	GetTransactionByAccountID(ctx context.Context, accountID int) ([]*models.Transaction, error)
 	ListTransactions(ctx context.Context) ([]*models.Transaction, error)
+	QueryTransactions(ctx context.Context, q TransactionQuery) (*TransactionPage, error)
+	DeleteTransactions(ctx context.Context, ids []int) (int, error)
 
 	// SummaryRepository methods
 	SaveSummary(ctx context.Context, s *models.Summary) error
 	GetSummaryByAccountID(ctx context.Context, accountID int) (*models.Summary, error)
+	GetSummaryByID(ctx context.Context, summaryID int) (*models.Summary, error)
 	ListSummaries(ctx context.Context) ([]*models.Summary, error)
+	ListSummariesByAccount(ctx context.Context, accountID int, page SummaryPageRequest) (*SummaryPage, error)
+	SaveSummaryContent(ctx context.Context, s *models.Summary) error
+	// DeleteSummaries deletes the summaries along with their month summaries
+	DeleteSummaries(ctx context.Context, ids []int) (int, error)
 
 	// MonthSummaryRepository methods
 	SaveMonthSummary(ctx context.Context, ms *models.MonthSummary, summaryID int) error
 	GetMonthSummaryBySummaryID(ctx context.Context, summaryID int) ([]*models.MonthSummary, error)
 
+	// RetentionPolicyRepository methods
+	GetRetentionPolicy(ctx context.Context, accountID int) (*models.RetentionPolicy, error)
+	SaveRetentionPolicy(ctx context.Context, policy *models.RetentionPolicy) error
+	DeleteRetentionPolicy(ctx context.Context, accountID int) error
+
+	// ErasureLogRepository methods
+	AppendErasureRecord(ctx context.Context, record *models.ErasureRecord) error
+	ListErasureRecords(ctx context.Context) ([]*models.ErasureRecord, error)
+
+	// AuditRepository methods
+	SaveAuditEvent(ctx context.Context, event *models.AuditEvent) error
+	ListAuditEvents(ctx context.Context, q AuditQuery) (*AuditPage, error)
+
+	// OutboxRepository methods
+	// EnqueueStatement stores the delivered content of the summary, as SaveSummaryContent does, and
+	// queues the message that delivers it, in one transaction
+	EnqueueStatement(ctx context.Context, s *models.Summary, msg *models.OutboxMessage) error
+	EnqueueMessage(ctx context.Context, msg *models.OutboxMessage) error
+	GetOutboxMessage(ctx context.Context, id int) (*models.OutboxMessage, error)
+	ListOutboxMessages(ctx context.Context, q OutboxQuery) (*OutboxPage, error)
+	// UpdateOutboxMessage stores the delivery state of the message if its stored status and attempts
+	// are still prevStatus and prevAttempts, and fails with a conflict error if another worker or an
+	// operator changed it first
+	UpdateOutboxMessage(ctx context.Context, msg *models.OutboxMessage, prevStatus string, prevAttempts int) error
+	DeleteOutboxMessages(ctx context.Context, ids []int) (int, error)
+
+	// InTx runs fn with a repository whose changes are all made in one transaction, committed if fn
+	// returns nil and rolled back otherwise. fn may run again when the transaction fails with a
+	// transient error. Within fn, InTx joins the transaction already open.
+	InTx(ctx context.Context, fn func(repo Repository) error) error
+
+	// Ping checks that the storage is reachable, for health checks
+	Ping(ctx context.Context) error
 	Close() error
 }
-
-// Define the repository struct
-var implementation Repository
-
-// SetRepository sets the global repository implementation
-func SetRepository(repository Repository) {
-	implementation = repository
-}
-
-// SaveAccount saves the given account
-func SaveAccount(ctx context.Context) (int, error) {
-	return implementation.SaveAccount(ctx)
-}
-
-// GetAccountByID retrieves the account with the given ID
-func GetAccountByID(ctx context.Context, id int) (*models.Account, error) {
-	return implementation.GetAccountByID(ctx, id)
-}
-
-// SaveTransaction saves the given transaction
-func SaveTransaction(ctx context.Context, transaction *models.Transaction) error {
-	return implementation.SaveTransaction(ctx, transaction)
-}
-
-// GetTransactionByAccountID retrieves the transaction with the given AccountID
-func GetTransactionByAccountID(ctx context.Context, accountID int) ([]*models.Transaction, error) {
-	return implementation.GetTransactionByAccountID(ctx, accountID)
-}
-
-// ListTransactions retrieves a list of all transactions
-func ListTransactions(ctx context.Context) ([]*models.Transaction, error) {
-	return implementation.ListTransactions(ctx)
-}
-
-// SaveSummary saves the given summary
-func SaveSummary(ctx context.Context, s *models.Summary) error {
-	return implementation.SaveSummary(ctx, s)
-}
-
-// GetSummaryByAccountID retrieves the summary with the given ID
-func GetSummaryByAccountID(ctx context.Context, accountID int) (*models.Summary, error) {
-	return implementation.GetSummaryByAccountID(ctx, accountID)
-}
-
-// SaveMonthSummary saves the given month summary for the given summary ID
-func SaveMonthSummary(ctx context.Context, ms *models.MonthSummary, summaryID int) error {
-	return implementation.SaveMonthSummary(ctx, ms, summaryID)
-}
-
-// GetMonthSummaryBySummaryID retrieves a list of month summaries for the given summary ID
-func GetMonthSummaryBySummaryID(ctx context.Context, summaryID int) ([]*models.MonthSummary, error) {
-	return implementation.GetMonthSummaryBySummaryID(ctx, summaryID)
-}
-
-// Implement the Close method of the Repository interface
-func Close() error {
-	return implementation.Close()
-}
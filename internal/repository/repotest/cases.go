@@ -0,0 +1,759 @@
+package repotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/models"
+	"github.com/aldaircoronel/email-summary/internal/repository"
+)
+
+// Cases are the conformance checks run by Run and Check
+var Cases = []Case{
+	{"AccountIDs", testAccountIDs},
+	{"AccountRoundTrip", testAccountRoundTrip},
+	{"TransactionIDs", testTransactionIDs},
+	{"SummaryIDs", testSummaryIDs},
+	{"NotFound", testNotFound},
+	{"ForeignKeys", testForeignKeys},
+	{"DuplicateTransactionID", testDuplicateTransactionID},
+	{"ListTransactionsOrder", testListTransactionsOrder},
+	{"TransactionsByAccount", testTransactionsByAccount},
+	{"QueryTransactionsPages", testQueryTransactionsPages},
+	{"SummaryMonthSummaryLinkage", testSummaryLinkage},
+	{"LatestSummary", testLatestSummary},
+	{"DeleteSummaries", testDeleteSummaries},
+	{"InTx", testInTx},
+	{"OutboxEnqueueStatement", testOutboxEnqueueStatement},
+	{"OutboxDueMessages", testOutboxDueMessages},
+	{"OutboxClaim", testOutboxClaim},
+	{"OutboxOutlivesSummary", testOutboxOutlivesSummary},
+	{"ConcurrentWrites", testConcurrentWrites},
+	{"Ping", testPing},
+}
+
+// missingID is an ID no row has
+const missingID = 1 << 30
+
+// baseTime is the reference date of the rows saved by the cases, in whole seconds so every backend keeps it exactly
+var baseTime = time.Date(2023, time.March, 15, 12, 0, 0, 0, time.UTC)
+
+func newAccount(t T, repo repository.Repository) *models.Account {
+	t.Helper()
+	account := &models.Account{HolderName: "Conformance", Emails: []string{"holder@example.com"}}
+	if _, err := repo.SaveAccount(context.Background(), account); err != nil {
+		t.Fatalf("SaveAccount: %v", err)
+	}
+	return account
+}
+
+// lastCSVID is the last ID from the CSV file given to a transaction, unique so the cases can save
+// any number of them in an account
+var lastCSVID int64
+
+func newTransaction(t T, repo repository.Repository, accountID int, date time.Time, amount float64) *models.Transaction {
+	t.Helper()
+	trx := &models.Transaction{AccountID: accountID, ID: int(atomic.AddInt64(&lastCSVID, 1)), Date: date, Amount: amount, IsCredit: amount > 0}
+	if err := repo.SaveTransaction(context.Background(), trx); err != nil {
+		t.Fatalf("SaveTransaction: %v", err)
+	}
+	return trx
+}
+
+func newSummary(t T, repo repository.Repository, accountID int, generatedAt time.Time) *models.Summary {
+	t.Helper()
+	summary := &models.Summary{
+		AccountID:         accountID,
+		TotalBalance:      10.5,
+		TotalTransactions: 2,
+		PeriodStart:       baseTime.AddDate(0, -1, 0),
+		PeriodEnd:         baseTime,
+		GeneratedAt:       generatedAt,
+		Subject:           "Transaction Summary",
+		HTMLBody:          "<p>summary</p>",
+		Recipients:        []string{"holder@example.com", "other@example.com"},
+	}
+	if err := repo.SaveSummary(context.Background(), summary); err != nil {
+		t.Fatalf("SaveSummary: %v", err)
+	}
+	return summary
+}
+
+func newMonthSummary(t T, repo repository.Repository, summaryID int, month string) *models.MonthSummary {
+	t.Helper()
+	ms := &models.MonthSummary{Month: month, TotalBalance: 5, TotalTransactions: 1, NumOfCreditTransactions: 1, AverageCredit: 5}
+	if err := repo.SaveMonthSummary(context.Background(), ms, summaryID); err != nil {
+		t.Fatalf("SaveMonthSummary: %v", err)
+	}
+	return ms
+}
+
+func testAccountIDs(t T, repo repository.Repository) {
+	first := newAccount(t, repo)
+	second := newAccount(t, repo)
+	if first.AccountID <= 0 {
+		t.Errorf("SaveAccount assigned ID %d, want a positive ID", first.AccountID)
+	}
+	if second.AccountID <= first.AccountID {
+		t.Errorf("SaveAccount assigned ID %d after %d, want increasing IDs", second.AccountID, first.AccountID)
+	}
+
+	account := &models.Account{}
+	id, err := repo.SaveAccount(context.Background(), account)
+	if err != nil {
+		t.Fatalf("SaveAccount: %v", err)
+	}
+	if id != account.AccountID {
+		t.Errorf("SaveAccount returned ID %d but set AccountID %d", id, account.AccountID)
+	}
+}
+
+func testAccountRoundTrip(t T, repo repository.Repository) {
+	ctx := context.Background()
+	account := &models.Account{
+		HolderName: "Ana López",
+		Emails:     []string{"ana@example.com", "ana@work.example.com"},
+		Currency:   "MXN",
+		Locale:     "es-MX",
+		TimeZone:   "America/Mexico_City",
+	}
+	if _, err := repo.SaveAccount(ctx, account); err != nil {
+		t.Fatalf("SaveAccount: %v", err)
+	}
+	if account.Status != models.AccountActive {
+		t.Errorf("SaveAccount left status %q, want the default %q", account.Status, models.AccountActive)
+	}
+
+	got, err := repo.GetAccountByID(ctx, account.AccountID)
+	if err != nil {
+		t.Fatalf("GetAccountByID: %v", err)
+	}
+	if !reflect.DeepEqual(got, account) {
+		t.Errorf("GetAccountByID = %+v, want %+v", got, account)
+	}
+
+	// The emails keep their order and the copy is independent of the stored account
+	got.Emails[0] = "changed@example.com"
+	got.Emails = got.Emails[:1]
+	got.Status = models.AccountSuspended
+	if err := repo.UpdateAccount(ctx, got); err != nil {
+		t.Fatalf("UpdateAccount: %v", err)
+	}
+	updated, err := repo.GetAccountByID(ctx, account.AccountID)
+	if err != nil {
+		t.Fatalf("GetAccountByID: %v", err)
+	}
+	if !reflect.DeepEqual(updated, got) {
+		t.Errorf("GetAccountByID after UpdateAccount = %+v, want %+v", updated, got)
+	}
+}
+
+func testTransactionIDs(t T, repo repository.Repository) {
+	account := newAccount(t, repo)
+	previous := 0
+	for i := 0; i < 3; i++ {
+		trx := newTransaction(t, repo, account.AccountID, baseTime, 1)
+		if trx.TransactionID <= previous {
+			t.Errorf("SaveTransaction assigned ID %d after %d, want increasing positive IDs", trx.TransactionID, previous)
+		}
+		previous = trx.TransactionID
+	}
+}
+
+func testSummaryIDs(t T, repo repository.Repository) {
+	account := newAccount(t, repo)
+	first := newSummary(t, repo, account.AccountID, baseTime)
+	second := newSummary(t, repo, account.AccountID, baseTime)
+	if first.SummaryID <= 0 || second.SummaryID <= first.SummaryID {
+		t.Errorf("SaveSummary assigned IDs %d and %d, want increasing positive IDs", first.SummaryID, second.SummaryID)
+	}
+
+	january := newMonthSummary(t, repo, first.SummaryID, "January")
+	february := newMonthSummary(t, repo, first.SummaryID, "February")
+	if january.MonthSummaryID <= 0 || february.MonthSummaryID <= january.MonthSummaryID {
+		t.Errorf("SaveMonthSummary assigned IDs %d and %d, want increasing positive IDs", january.MonthSummaryID, february.MonthSummaryID)
+	}
+
+	// A summary saved without a generation time gets the current one
+	summary := &models.Summary{AccountID: account.AccountID}
+	if err := repo.SaveSummary(context.Background(), summary); err != nil {
+		t.Fatalf("SaveSummary: %v", err)
+	}
+	if summary.GeneratedAt.IsZero() {
+		t.Errorf("SaveSummary left GeneratedAt zero")
+	}
+}
+
+func testNotFound(t T, repo repository.Repository) {
+	ctx := context.Background()
+	account := newAccount(t, repo)
+
+	calls := []struct {
+		name string
+		call func() error
+	}{
+		{"GetAccountByID", func() error {
+			_, err := repo.GetAccountByID(ctx, missingID)
+			return err
+		}},
+		{"UpdateAccount", func() error {
+			return repo.UpdateAccount(ctx, &models.Account{AccountID: missingID})
+		}},
+		{"DeleteAccount", func() error {
+			return repo.DeleteAccount(ctx, missingID)
+		}},
+		{"GetSummaryByID", func() error {
+			_, err := repo.GetSummaryByID(ctx, missingID)
+			return err
+		}},
+		{"GetSummaryByAccountID without summaries", func() error {
+			_, err := repo.GetSummaryByAccountID(ctx, account.AccountID)
+			return err
+		}},
+		{"SaveSummaryContent", func() error {
+			return repo.SaveSummaryContent(ctx, &models.Summary{SummaryID: missingID})
+		}},
+		{"GetRetentionPolicy", func() error {
+			_, err := repo.GetRetentionPolicy(ctx, account.AccountID)
+			return err
+		}},
+		{"DeleteRetentionPolicy", func() error {
+			return repo.DeleteRetentionPolicy(ctx, account.AccountID)
+		}},
+	}
+	for _, c := range calls {
+		if err := c.call(); !errors.Is(err, apperrors.ErrNotFound) {
+			t.Errorf("%s: got error %v, want one matching apperrors.ErrNotFound", c.name, err)
+		}
+	}
+
+	// Empty results are not errors
+	transactions, err := repo.GetTransactionByAccountID(ctx, account.AccountID)
+	if err != nil || len(transactions) != 0 {
+		t.Errorf("GetTransactionByAccountID of an account without transactions = %v, %v; want no transactions and no error", transactions, err)
+	}
+	months, err := repo.GetMonthSummaryBySummaryID(ctx, missingID)
+	if err != nil || len(months) != 0 {
+		t.Errorf("GetMonthSummaryBySummaryID of a missing summary = %v, %v; want no month summaries and no error", months, err)
+	}
+}
+
+func testForeignKeys(t T, repo repository.Repository) {
+	ctx := context.Background()
+	account := newAccount(t, repo)
+	newTransaction(t, repo, account.AccountID, baseTime, 1)
+
+	calls := []struct {
+		name string
+		call func() error
+	}{
+		{"SaveTransaction of a missing account", func() error {
+			return repo.SaveTransaction(ctx, &models.Transaction{AccountID: missingID, Date: baseTime})
+		}},
+		{"SaveSummary of a missing account", func() error {
+			return repo.SaveSummary(ctx, &models.Summary{AccountID: missingID})
+		}},
+		{"SaveMonthSummary of a missing summary", func() error {
+			return repo.SaveMonthSummary(ctx, &models.MonthSummary{Month: "January"}, missingID)
+		}},
+		{"DeleteAccount with transactions", func() error {
+			return repo.DeleteAccount(ctx, account.AccountID)
+		}},
+	}
+	for _, c := range calls {
+		if err := c.call(); !errors.Is(err, apperrors.ErrConflict) {
+			t.Errorf("%s: got error %v, want one matching apperrors.ErrConflict", c.name, err)
+		}
+	}
+}
+
+func testDuplicateTransactionID(t T, repo repository.Repository) {
+	ctx := context.Background()
+	account := newAccount(t, repo)
+	other := newAccount(t, repo)
+	trx := newTransaction(t, repo, account.AccountID, baseTime, 1)
+
+	duplicate := &models.Transaction{AccountID: account.AccountID, ID: trx.ID, Date: baseTime, Amount: 2}
+	if err := repo.SaveTransaction(ctx, duplicate); !errors.Is(err, apperrors.ErrConflict) {
+		t.Errorf("SaveTransaction of an ID the account has: got error %v, want one matching apperrors.ErrConflict", err)
+	}
+	// The ID is only unique within an account
+	if err := repo.SaveTransaction(ctx, &models.Transaction{AccountID: other.AccountID, ID: trx.ID, Date: baseTime, Amount: 2}); err != nil {
+		t.Errorf("SaveTransaction of the ID in another account: %v", err)
+	}
+
+	transactions, err := repo.GetTransactionByAccountID(ctx, account.AccountID)
+	if err != nil {
+		t.Fatalf("GetTransactionByAccountID: %v", err)
+	}
+	if len(transactions) != 1 {
+		t.Errorf("GetTransactionByAccountID returned %d transactions after saving an ID twice, want 1", len(transactions))
+	}
+}
+
+func testListTransactionsOrder(t T, repo repository.Repository) {
+	account := newAccount(t, repo)
+	offsets := []int{3, -2, 10, 0, 7}
+	saved := make(map[int]bool)
+	for _, days := range offsets {
+		trx := newTransaction(t, repo, account.AccountID, baseTime.AddDate(0, 0, days), float64(days))
+		saved[trx.TransactionID] = true
+	}
+
+	transactions, err := repo.ListTransactions(context.Background())
+	if err != nil {
+		t.Fatalf("ListTransactions: %v", err)
+	}
+	found := 0
+	for i, trx := range transactions {
+		if i > 0 && trx.Date.After(transactions[i-1].Date) {
+			t.Errorf("ListTransactions: transaction %d dated %s follows one dated %s, want newest first",
+				trx.TransactionID, trx.Date, transactions[i-1].Date)
+		}
+		if saved[trx.TransactionID] {
+			found++
+		}
+	}
+	if found != len(offsets) {
+		t.Errorf("ListTransactions returned %d of the %d saved transactions", found, len(offsets))
+	}
+}
+
+func testTransactionsByAccount(t T, repo repository.Repository) {
+	ctx := context.Background()
+	account := newAccount(t, repo)
+	other := newAccount(t, repo)
+	want := newTransaction(t, repo, account.AccountID, baseTime, -4.25)
+	want.Category = ""
+	newTransaction(t, repo, other.AccountID, baseTime, 1)
+
+	transactions, err := repo.GetTransactionByAccountID(ctx, account.AccountID)
+	if err != nil {
+		t.Fatalf("GetTransactionByAccountID: %v", err)
+	}
+	if len(transactions) != 1 {
+		t.Fatalf("GetTransactionByAccountID returned %d transactions, want 1", len(transactions))
+	}
+	got := transactions[0]
+	if got.TransactionID != want.TransactionID || got.AccountID != want.AccountID || !got.Date.Equal(want.Date) ||
+		got.Amount != want.Amount || got.IsCredit != want.IsCredit {
+		t.Errorf("GetTransactionByAccountID = %+v, want %+v", got, want)
+	}
+}
+
+func testQueryTransactionsPages(t T, repo repository.Repository) {
+	account := newAccount(t, repo)
+	for _, days := range []int{4, 1, 3, 0, 2} {
+		newTransaction(t, repo, account.AccountID, baseTime.AddDate(0, 0, days), float64(days))
+	}
+
+	query := repository.TransactionQuery{AccountID: account.AccountID, SortBy: repository.SortByDate, Limit: 2}
+	var dates []time.Time
+	seen := make(map[int]bool)
+	pages := 0
+	for {
+		page, err := repo.QueryTransactions(context.Background(), query)
+		if err != nil {
+			t.Fatalf("QueryTransactions: %v", err)
+		}
+		pages++
+		for _, trx := range page.Transactions {
+			if seen[trx.TransactionID] {
+				t.Errorf("QueryTransactions returned transaction %d twice", trx.TransactionID)
+			}
+			seen[trx.TransactionID] = true
+			dates = append(dates, trx.Date)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		if pages > 5 {
+			t.Fatalf("QueryTransactions keeps returning pages")
+		}
+		query.Cursor = page.NextCursor
+	}
+
+	if len(dates) != 5 || pages != 3 {
+		t.Fatalf("QueryTransactions returned %d transactions in %d pages, want 5 in 3", len(dates), pages)
+	}
+	for i, date := range dates {
+		if want := baseTime.AddDate(0, 0, i); !date.Equal(want) {
+			t.Errorf("QueryTransactions row %d dated %s, want %s", i, date, want)
+		}
+	}
+}
+
+func testSummaryLinkage(t T, repo repository.Repository) {
+	ctx := context.Background()
+	account := newAccount(t, repo)
+	first := newSummary(t, repo, account.AccountID, baseTime)
+	second := newSummary(t, repo, account.AccountID, baseTime.Add(time.Hour))
+	newMonthSummary(t, repo, first.SummaryID, "January")
+	newMonthSummary(t, repo, first.SummaryID, "February")
+	newMonthSummary(t, repo, second.SummaryID, "March")
+
+	for summaryID, want := range map[int][]string{first.SummaryID: {"January", "February"}, second.SummaryID: {"March"}} {
+		months, err := repo.GetMonthSummaryBySummaryID(ctx, summaryID)
+		if err != nil {
+			t.Fatalf("GetMonthSummaryBySummaryID: %v", err)
+		}
+		var got []string
+		for _, ms := range months {
+			if ms.SummaryID != summaryID {
+				t.Errorf("GetMonthSummaryBySummaryID(%d) returned a month summary of summary %d", summaryID, ms.SummaryID)
+			}
+			got = append(got, ms.Month)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("GetMonthSummaryBySummaryID(%d) months = %v, want %v", summaryID, got, want)
+		}
+	}
+
+	got, err := repo.GetSummaryByID(ctx, first.SummaryID)
+	if err != nil {
+		t.Fatalf("GetSummaryByID: %v", err)
+	}
+	if got.AccountID != account.AccountID || !got.GeneratedAt.Equal(first.GeneratedAt) ||
+		!got.PeriodStart.Equal(first.PeriodStart) || !got.PeriodEnd.Equal(first.PeriodEnd) ||
+		got.HTMLBody != first.HTMLBody || fmt.Sprint(got.Recipients) != fmt.Sprint(first.Recipients) {
+		t.Errorf("GetSummaryByID = %+v, want %+v", got, first)
+	}
+}
+
+func testLatestSummary(t T, repo repository.Repository) {
+	ctx := context.Background()
+	account := newAccount(t, repo)
+	middle := newSummary(t, repo, account.AccountID, baseTime)
+	newest := newSummary(t, repo, account.AccountID, baseTime.Add(time.Hour))
+	oldest := newSummary(t, repo, account.AccountID, baseTime.Add(-time.Hour))
+
+	latest, err := repo.GetSummaryByAccountID(ctx, account.AccountID)
+	if err != nil {
+		t.Fatalf("GetSummaryByAccountID: %v", err)
+	}
+	if latest.SummaryID != newest.SummaryID {
+		t.Errorf("GetSummaryByAccountID returned summary %d, want the latest one, %d", latest.SummaryID, newest.SummaryID)
+	}
+
+	page, err := repo.ListSummariesByAccount(ctx, account.AccountID, repository.SummaryPageRequest{})
+	if err != nil {
+		t.Fatalf("ListSummariesByAccount: %v", err)
+	}
+	var got []int
+	for _, s := range page.Summaries {
+		got = append(got, s.SummaryID)
+	}
+	want := []int{newest.SummaryID, middle.SummaryID, oldest.SummaryID}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("ListSummariesByAccount = %v, want newest first %v", got, want)
+	}
+}
+
+func testInTx(t T, repo repository.Repository) {
+	ctx := context.Background()
+	failure := errors.New("rolled back")
+
+	var account *models.Account
+	var trx *models.Transaction
+	err := repo.InTx(ctx, func(tx repository.Repository) error {
+		account = newAccount(t, tx)
+		// InTx within the transaction joins it
+		return tx.InTx(ctx, func(tx repository.Repository) error {
+			trx = newTransaction(t, tx, account.AccountID, baseTime, 1)
+			return failure
+		})
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("InTx returned %v, want the error of fn", err)
+	}
+	if _, err := repo.GetAccountByID(ctx, account.AccountID); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("GetAccountByID of an account saved in a rolled back transaction: got error %v, want not found", err)
+	}
+
+	err = repo.InTx(ctx, func(tx repository.Repository) error {
+		account = newAccount(t, tx)
+		trx = newTransaction(t, tx, account.AccountID, baseTime, 1)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("InTx: %v", err)
+	}
+	transactions, err := repo.GetTransactionByAccountID(ctx, account.AccountID)
+	if err != nil {
+		t.Fatalf("GetTransactionByAccountID: %v", err)
+	}
+	if len(transactions) != 1 || transactions[0].TransactionID != trx.TransactionID {
+		t.Errorf("GetTransactionByAccountID after a committed transaction = %v, want transaction %d", transactions, trx.TransactionID)
+	}
+}
+
+func testDeleteSummaries(t T, repo repository.Repository) {
+	ctx := context.Background()
+	account := newAccount(t, repo)
+	deleted := newSummary(t, repo, account.AccountID, baseTime)
+	kept := newSummary(t, repo, account.AccountID, baseTime)
+	newMonthSummary(t, repo, deleted.SummaryID, "January")
+	newMonthSummary(t, repo, kept.SummaryID, "January")
+
+	n, err := repo.DeleteSummaries(ctx, []int{deleted.SummaryID, missingID})
+	if err != nil {
+		t.Fatalf("DeleteSummaries: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("DeleteSummaries deleted %d summaries, want 1", n)
+	}
+	if _, err := repo.GetSummaryByID(ctx, deleted.SummaryID); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("GetSummaryByID of a deleted summary: got error %v, want one matching apperrors.ErrNotFound", err)
+	}
+	if months, _ := repo.GetMonthSummaryBySummaryID(ctx, deleted.SummaryID); len(months) != 0 {
+		t.Errorf("DeleteSummaries kept %d month summaries of the deleted summary", len(months))
+	}
+	if months, _ := repo.GetMonthSummaryBySummaryID(ctx, kept.SummaryID); len(months) != 1 {
+		t.Errorf("DeleteSummaries changed the month summaries of another summary, %d left", len(months))
+	}
+}
+
+func newOutboxMessage(t T, repo repository.Repository, accountID int, nextAttemptAt time.Time) *models.OutboxMessage {
+	t.Helper()
+	msg := &models.OutboxMessage{AccountID: accountID, Payload: []byte("{\"Subject\":\"Hola\"}\x00\xff"), NextAttemptAt: nextAttemptAt}
+	if err := repo.EnqueueMessage(context.Background(), msg); err != nil {
+		t.Fatalf("EnqueueMessage: %v", err)
+	}
+	return msg
+}
+
+func testOutboxEnqueueStatement(t T, repo repository.Repository) {
+	ctx := context.Background()
+	account := newAccount(t, repo)
+	summary := newSummary(t, repo, account.AccountID, baseTime)
+
+	summary.Subject = "Resumen de transacciones"
+	summary.TextBody = "resumen"
+	msg := &models.OutboxMessage{AccountID: account.AccountID, SummaryID: summary.SummaryID, Payload: []byte("payload")}
+	if err := repo.EnqueueStatement(ctx, summary, msg); err != nil {
+		t.Fatalf("EnqueueStatement: %v", err)
+	}
+	if msg.OutboxID == 0 || msg.Status != models.OutboxPending || msg.NextAttemptAt.IsZero() {
+		t.Errorf("EnqueueStatement queued a message with ID %d, status %q and next attempt %v, want an ID, pending and a time",
+			msg.OutboxID, msg.Status, msg.NextAttemptAt)
+	}
+
+	stored, err := repo.GetSummaryByID(ctx, summary.SummaryID)
+	if err != nil {
+		t.Fatalf("GetSummaryByID: %v", err)
+	}
+	if stored.Subject != summary.Subject || stored.TextBody != summary.TextBody {
+		t.Errorf("EnqueueStatement stored subject %q and text %q, want %q and %q", stored.Subject, stored.TextBody, summary.Subject, summary.TextBody)
+	}
+	got, err := repo.GetOutboxMessage(ctx, msg.OutboxID)
+	if err != nil {
+		t.Fatalf("GetOutboxMessage: %v", err)
+	}
+	if got.SummaryID != summary.SummaryID || string(got.Payload) != "payload" || !got.NextAttemptAt.Equal(msg.NextAttemptAt) {
+		t.Errorf("GetOutboxMessage = %+v, want %+v", got, msg)
+	}
+
+	// Neither is stored when the other fails
+	missing := *summary
+	missing.SummaryID = missingID
+	if err := repo.EnqueueStatement(ctx, &missing, &models.OutboxMessage{AccountID: account.AccountID, Payload: []byte("x")}); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("EnqueueStatement of a missing summary: got error %v, want one matching apperrors.ErrNotFound", err)
+	}
+	orphan := &models.OutboxMessage{AccountID: missingID, Payload: []byte("x")}
+	summary.Subject = "changed"
+	if err := repo.EnqueueStatement(ctx, summary, orphan); !errors.Is(err, apperrors.ErrConflict) {
+		t.Errorf("EnqueueStatement of a message of a missing account: got error %v, want one matching apperrors.ErrConflict", err)
+	}
+	if stored, _ := repo.GetSummaryByID(ctx, summary.SummaryID); stored != nil && stored.Subject == "changed" {
+		t.Errorf("EnqueueStatement stored the summary content although queueing the message failed")
+	}
+	page, err := repo.ListOutboxMessages(ctx, repository.OutboxQuery{AccountID: account.AccountID})
+	if err != nil {
+		t.Fatalf("ListOutboxMessages: %v", err)
+	}
+	if len(page.Messages) != 1 {
+		t.Errorf("ListOutboxMessages returned %d messages of the account, want 1", len(page.Messages))
+	}
+
+	// A message queued later for the statement, as a resend is, comes after the one that delivered it
+	other := newSummary(t, repo, account.AccountID, baseTime)
+	if err := repo.EnqueueMessage(ctx, &models.OutboxMessage{AccountID: account.AccountID, SummaryID: other.SummaryID, Payload: []byte("other")}); err != nil {
+		t.Fatalf("EnqueueMessage: %v", err)
+	}
+	resent := &models.OutboxMessage{AccountID: account.AccountID, SummaryID: summary.SummaryID, Payload: []byte("resent")}
+	if err := repo.EnqueueMessage(ctx, resent); err != nil {
+		t.Fatalf("EnqueueMessage: %v", err)
+	}
+	page, err = repo.ListOutboxMessages(ctx, repository.OutboxQuery{SummaryID: summary.SummaryID})
+	if err != nil {
+		t.Fatalf("ListOutboxMessages: %v", err)
+	}
+	if len(page.Messages) != 2 || page.Messages[0].OutboxID != msg.OutboxID || page.Messages[1].OutboxID != resent.OutboxID {
+		t.Errorf("ListOutboxMessages of the summary returned %v, want messages %d and %d", page.Messages, msg.OutboxID, resent.OutboxID)
+	}
+}
+
+func testOutboxDueMessages(t T, repo repository.Repository) {
+	ctx := context.Background()
+	account := newAccount(t, repo)
+	due := newOutboxMessage(t, repo, account.AccountID, baseTime)
+	later := newOutboxMessage(t, repo, account.AccountID, baseTime.Add(time.Hour))
+	sent := newOutboxMessage(t, repo, account.AccountID, baseTime)
+	sent.Status = models.OutboxSent
+	sent.SentAt = baseTime
+	if err := repo.UpdateOutboxMessage(ctx, sent, models.OutboxPending, 0); err != nil {
+		t.Fatalf("UpdateOutboxMessage: %v", err)
+	}
+
+	page, err := repo.ListOutboxMessages(ctx, repository.OutboxQuery{AccountID: account.AccountID, Due: baseTime.Add(time.Minute)})
+	if err != nil {
+		t.Fatalf("ListOutboxMessages: %v", err)
+	}
+	if len(page.Messages) != 1 || page.Messages[0].OutboxID != due.OutboxID {
+		t.Errorf("ListOutboxMessages of the due messages returned %d messages, want only message %d", len(page.Messages), due.OutboxID)
+	}
+	if string(page.Messages[0].Payload) != string(due.Payload) {
+		t.Errorf("ListOutboxMessages returned payload %q, want %q", page.Messages[0].Payload, due.Payload)
+	}
+
+	// Pages of one message, oldest first
+	var ids []int
+	q := repository.OutboxQuery{AccountID: account.AccountID, Limit: 1}
+	for {
+		page, err := repo.ListOutboxMessages(ctx, q)
+		if err != nil {
+			t.Fatalf("ListOutboxMessages: %v", err)
+		}
+		for _, msg := range page.Messages {
+			ids = append(ids, msg.OutboxID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	if want := []int{due.OutboxID, later.OutboxID, sent.OutboxID}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("ListOutboxMessages pages returned messages %v, want %v", ids, want)
+	}
+
+	page, err = repo.ListOutboxMessages(ctx, repository.OutboxQuery{AccountID: account.AccountID, Status: models.OutboxSent})
+	if err != nil {
+		t.Fatalf("ListOutboxMessages: %v", err)
+	}
+	if len(page.Messages) != 1 || !page.Messages[0].SentAt.Equal(baseTime) {
+		t.Errorf("ListOutboxMessages of the sent messages = %v, want message %d sent at %v", page.Messages, sent.OutboxID, baseTime)
+	}
+}
+
+func testOutboxClaim(t T, repo repository.Repository) {
+	ctx := context.Background()
+	account := newAccount(t, repo)
+	msg := newOutboxMessage(t, repo, account.AccountID, baseTime)
+
+	first, second := *msg, *msg
+	first.Status, first.Attempts = models.OutboxSending, 1
+	second.Status, second.Attempts = models.OutboxSending, 1
+	if err := repo.UpdateOutboxMessage(ctx, &first, models.OutboxPending, 0); err != nil {
+		t.Fatalf("UpdateOutboxMessage: %v", err)
+	}
+	if err := repo.UpdateOutboxMessage(ctx, &second, models.OutboxPending, 0); !errors.Is(err, apperrors.ErrConflict) {
+		t.Errorf("UpdateOutboxMessage of a message claimed meanwhile: got error %v, want one matching apperrors.ErrConflict", err)
+	}
+	missing := *msg
+	missing.OutboxID = missingID
+	if err := repo.UpdateOutboxMessage(ctx, &missing, models.OutboxPending, 0); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("UpdateOutboxMessage of a missing message: got error %v, want one matching apperrors.ErrNotFound", err)
+	}
+
+	got, err := repo.GetOutboxMessage(ctx, msg.OutboxID)
+	if err != nil {
+		t.Fatalf("GetOutboxMessage: %v", err)
+	}
+	if got.Status != models.OutboxSending || got.Attempts != 1 {
+		t.Errorf("GetOutboxMessage after a claim: status %q and %d attempts, want sending and 1", got.Status, got.Attempts)
+	}
+
+	n, err := repo.DeleteOutboxMessages(ctx, []int{msg.OutboxID, missingID})
+	if err != nil {
+		t.Fatalf("DeleteOutboxMessages: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("DeleteOutboxMessages deleted %d messages, want 1", n)
+	}
+}
+
+func testOutboxOutlivesSummary(t T, repo repository.Repository) {
+	ctx := context.Background()
+	account := newAccount(t, repo)
+	summary := newSummary(t, repo, account.AccountID, baseTime)
+	msg := &models.OutboxMessage{AccountID: account.AccountID, SummaryID: summary.SummaryID, Payload: []byte("payload")}
+	if err := repo.EnqueueMessage(ctx, msg); err != nil {
+		t.Fatalf("EnqueueMessage: %v", err)
+	}
+
+	if _, err := repo.DeleteSummaries(ctx, []int{summary.SummaryID}); err != nil {
+		t.Fatalf("DeleteSummaries: %v", err)
+	}
+	got, err := repo.GetOutboxMessage(ctx, msg.OutboxID)
+	if err != nil {
+		t.Fatalf("GetOutboxMessage after deleting its summary: %v", err)
+	}
+	if got.SummaryID != 0 {
+		t.Errorf("GetOutboxMessage after deleting its summary: summary %d, want 0", got.SummaryID)
+	}
+}
+
+func testConcurrentWrites(t T, repo repository.Repository) {
+	const workers, perWorker = 8, 10
+	ctx := context.Background()
+	account := newAccount(t, repo)
+
+	var mu sync.Mutex
+	ids := make(map[int]bool)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				trx := &models.Transaction{AccountID: account.AccountID, ID: w*perWorker + i, Date: baseTime, Amount: 1, IsCredit: true}
+				if err := repo.SaveTransaction(ctx, trx); err != nil {
+					t.Errorf("SaveTransaction from worker %d: %v", w, err)
+					return
+				}
+				// Reads interleave with the writes
+				if _, err := repo.GetAccountByID(ctx, account.AccountID); err != nil {
+					t.Errorf("GetAccountByID from worker %d: %v", w, err)
+					return
+				}
+				mu.Lock()
+				if ids[trx.TransactionID] {
+					t.Errorf("SaveTransaction assigned ID %d twice", trx.TransactionID)
+				}
+				ids[trx.TransactionID] = true
+				mu.Unlock()
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	transactions, err := repo.GetTransactionByAccountID(ctx, account.AccountID)
+	if err != nil {
+		t.Fatalf("GetTransactionByAccountID: %v", err)
+	}
+	if len(transactions) != workers*perWorker {
+		t.Errorf("GetTransactionByAccountID returned %d transactions after %d concurrent saves", len(transactions), workers*perWorker)
+	}
+}
+
+func testPing(t T, repo repository.Repository) {
+	if err := repo.Ping(context.Background()); err != nil {
+		t.Errorf("Ping: %v", err)
+	}
+}
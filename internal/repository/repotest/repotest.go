@@ -0,0 +1,115 @@
+// Package repotest is a conformance suite for implementations of repository.Repository. It checks
+// that a backend behaves like the PostgreSQL one: how IDs are assigned, which errors report missing
+// rows, the ordering of the listings, the link between summaries and month summaries, and
+// concurrent use.
+//
+// The suite runs under go test:
+//
+//	func TestConformance(t *testing.T) {
+//		repotest.Run(t, func(t repotest.T) repository.Repository {
+//			return database.NewMemoryRepository()
+//		})
+//	}
+//
+// or from any program through Check, which is how the conformance command runs it against a
+// disposable database.
+//
+// The cases don't assume the repository is empty, so one repository may be shared by all of them.
+package repotest
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/repository"
+)
+
+// T is the part of testing.T the cases use, so they can also run outside go test
+type T interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+}
+
+// Factory returns the repository a case runs against
+type Factory func(t T) repository.Repository
+
+// Case is one conformance check
+type Case struct {
+	Name string
+	Test func(t T, repo repository.Repository)
+}
+
+// Runner is the part of testing.T that runs subtests. Run takes it instead of *testing.T so this
+// package doesn't import testing, which has no place in the programs that run Check.
+type Runner[R any] interface {
+	T
+	Run(name string, f func(t R)) bool
+}
+
+// Run runs every case as a subtest of t, a *testing.T
+func Run[R Runner[R]](t R, newRepo Factory) {
+	for _, c := range Cases {
+		c := c
+		t.Run(c.Name, func(t R) {
+			c.Test(t, newRepo(t))
+		})
+	}
+}
+
+// Check runs every case outside go test, writing one line per case to out. It returns the number of failed cases.
+func Check(newRepo Factory, out io.Writer) int {
+	failed := 0
+	for _, c := range Cases {
+		ct := &checkT{}
+		start := time.Now()
+		ct.run(func() {
+			c.Test(ct, newRepo(ct))
+		})
+
+		status := "ok  "
+		if ct.failed {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Fprintf(out, "%s %s (%s)\n", status, c.Name, time.Since(start).Round(time.Millisecond))
+		for _, message := range ct.messages {
+			fmt.Fprintf(out, "    %s\n", message)
+		}
+	}
+	return failed
+}
+
+// checkT implements T for Check. Fatalf stops the case the way testing.T does, by exiting its goroutine.
+type checkT struct {
+	mu       sync.Mutex
+	failed   bool
+	messages []string
+}
+
+func (t *checkT) run(test func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		test()
+	}()
+	<-done
+}
+
+func (t *checkT) Helper() {}
+
+func (t *checkT) Errorf(format string, args ...interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.failed = true
+	t.messages = append(t.messages, strings.TrimSpace(fmt.Sprintf(format, args...)))
+}
+
+func (t *checkT) Fatalf(format string, args ...interface{}) {
+	t.Errorf(format, args...)
+	runtime.Goexit()
+}
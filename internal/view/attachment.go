@@ -0,0 +1,94 @@
+package view
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/models"
+)
+
+// Kinds of statement attachment
+const (
+	AttachmentCSV = "csv"
+	AttachmentPDF = "pdf"
+)
+
+// StatementAttachments renders the requested attachments of a statement email: AttachmentCSV, the
+// transactions of the statement period, and AttachmentPDF, the statement itself
+func StatementAttachments(kinds []string, account *models.Account, summary *models.Summary, monthSummaries []*models.MonthSummary, transactions []*models.Transaction) ([]Attachment, error) {
+	if err := CheckAttachmentKinds(kinds); err != nil {
+		return nil, err
+	}
+
+	var attachments []Attachment
+	for _, kind := range kinds {
+		switch kind {
+		case AttachmentCSV:
+			data, err := RenderTransactionsCSV(account, transactions)
+			if err != nil {
+				return nil, err
+			}
+			attachments = append(attachments, Attachment{
+				Filename:    fmt.Sprintf("transactions-%d.csv", summary.SummaryID),
+				ContentType: "text/csv",
+				Data:        data,
+			})
+		case AttachmentPDF:
+			data, err := RenderStatementPDF(account, summary, monthSummaries)
+			if err != nil {
+				return nil, err
+			}
+			attachments = append(attachments, Attachment{
+				Filename:    fmt.Sprintf("statement-%d.pdf", summary.SummaryID),
+				ContentType: "application/pdf",
+				Data:        data,
+			})
+		}
+	}
+	return attachments, nil
+}
+
+// CheckAttachmentKinds returns a validation error if a kind of attachment is unknown
+func CheckAttachmentKinds(kinds []string) error {
+	for _, kind := range kinds {
+		if kind != AttachmentCSV && kind != AttachmentPDF {
+			return apperrors.Invalid("unknown attachment %q, expected %s or %s", kind, AttachmentCSV, AttachmentPDF)
+		}
+	}
+	return nil
+}
+
+// RenderTransactionsCSV renders transactions as CSV, with the dates in the time zone of the account.
+// Debits have negative amounts and credits positive ones, whatever the sign they were stored with.
+func RenderTransactionsCSV(account *models.Account, transactions []*models.Transaction) ([]byte, error) {
+	loc, err := account.Location()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"Id", "Date", "Amount", "Type", "Category"})
+	for _, trx := range transactions {
+		kind, amount := "debit", -math.Abs(trx.Amount)
+		if trx.IsCredit {
+			kind, amount = "credit", math.Abs(trx.Amount)
+		}
+		w.Write([]string{
+			strconv.Itoa(trx.ID),
+			trx.Date.In(loc).Format("2006-01-02"),
+			strconv.FormatFloat(amount, 'f', 2, 64),
+			kind,
+			trx.Category,
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("failed to render transactions csv: %w", err)
+	}
+	return buf.Bytes(), nil
+}
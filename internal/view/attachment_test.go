@@ -0,0 +1,88 @@
+package view
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/models"
+)
+
+// attachmentTestAccount is an account in a time zone behind UTC, so dates can fall on the previous day
+func attachmentTestAccount() *models.Account {
+	return &models.Account{AccountID: 1, HolderName: "Ana López", Currency: "MXN", Locale: "es", TimeZone: "America/Mexico_City"}
+}
+
+func TestRenderTransactionsCSV(t *testing.T) {
+	account := attachmentTestAccount()
+	transactions := []*models.Transaction{
+		{ID: 0, Date: time.Date(2023, time.January, 1, 3, 0, 0, 0, time.UTC), Amount: 60.5, IsCredit: true, Category: "Salary"},
+		// Amounts read from a CSV file keep their sign
+		{ID: 1, Date: time.Date(2023, time.January, 2, 18, 0, 0, 0, time.UTC), Amount: -10.3, Category: `Food, "fast"`},
+		// and other sources may store debits without it
+		{ID: 2, Date: time.Date(2023, time.January, 3, 18, 0, 0, 0, time.UTC), Amount: 20, Category: "Rent\nJanuary"},
+		{ID: 3, Date: time.Date(2023, time.January, 4, 18, 0, 0, 0, time.UTC), Amount: 0.005, IsCredit: true},
+	}
+	data, err := RenderTransactionsCSV(account, transactions)
+	if err != nil {
+		t.Fatalf("RenderTransactionsCSV: %v", err)
+	}
+
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		t.Fatalf("the attachment isn't valid CSV: %v\n%s", err, data)
+	}
+	want := [][]string{
+		{"Id", "Date", "Amount", "Type", "Category"},
+		{"0", "2022-12-31", "60.50", "credit", "Salary"},
+		{"1", "2023-01-02", "-10.30", "debit", `Food, "fast"`},
+		{"2", "2023-01-03", "-20.00", "debit", "Rent\nJanuary"},
+		{"3", "2023-01-04", "0.01", "credit", ""},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("CSV rows = %q, want %q", rows, want)
+	}
+	if !bytes.Contains(data, []byte(`"Food, ""fast"""`)) {
+		t.Errorf("the category with a comma and quotes isn't quoted: %s", data)
+	}
+
+	// Only the header without transactions
+	data, err = RenderTransactionsCSV(account, nil)
+	if err != nil {
+		t.Fatalf("RenderTransactionsCSV: %v", err)
+	}
+	if string(data) != "Id,Date,Amount,Type,Category\n" {
+		t.Errorf("CSV without transactions = %q, want only the header", data)
+	}
+}
+
+func TestStatementAttachments(t *testing.T) {
+	account := attachmentTestAccount()
+	summary := &models.Summary{SummaryID: 7, TotalTransactions: 1}
+	transactions := []*models.Transaction{{ID: 0, Date: time.Date(2023, time.January, 10, 0, 0, 0, 0, time.UTC), Amount: 1, IsCredit: true}}
+
+	attachments, err := StatementAttachments([]string{AttachmentPDF, AttachmentCSV}, account, summary, nil, transactions)
+	if err != nil {
+		t.Fatalf("StatementAttachments: %v", err)
+	}
+	if len(attachments) != 2 {
+		t.Fatalf("StatementAttachments returned %d attachments, want 2", len(attachments))
+	}
+	if a := attachments[0]; a.Filename != "statement-7.pdf" || a.ContentType != "application/pdf" || !bytes.HasPrefix(a.Data, []byte("%PDF-")) {
+		t.Errorf("first attachment = %s, %s, want the PDF statement", a.Filename, a.ContentType)
+	}
+	if a := attachments[1]; a.Filename != "transactions-7.csv" || a.ContentType != "text/csv" || !bytes.HasPrefix(a.Data, []byte("Id,Date")) {
+		t.Errorf("second attachment = %s, %s, want the CSV of transactions", a.Filename, a.ContentType)
+	}
+
+	if attachments, err := StatementAttachments(nil, account, summary, nil, transactions); err != nil || len(attachments) != 0 {
+		t.Errorf("StatementAttachments without kinds = %d attachments, %v, want none", len(attachments), err)
+	}
+	if _, err := StatementAttachments([]string{AttachmentCSV, "xlsx"}, account, summary, nil, transactions); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("StatementAttachments of an unknown kind returned %v, want a validation error", err)
+	}
+}
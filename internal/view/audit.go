@@ -0,0 +1,47 @@
+package view
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aldaircoronel/email-summary/internal/models"
+)
+
+// AuditRecorder stores audit events. The repositories implement it.
+type AuditRecorder interface {
+	SaveAuditEvent(ctx context.Context, event *models.AuditEvent) error
+}
+
+// auditedEmailService records an audit event for every email sent through the service it wraps
+type auditedEmailService struct {
+	EmailService
+	recorder AuditRecorder
+}
+
+// NewAuditedEmailService wraps an email service so every email sent, or that failed to send, is written to the audit log.
+// The event holds the message ID and the number of recipients, neither the addresses nor a hash of the bodies,
+// which hold the name of the account holder.
+func NewAuditedEmailService(service EmailService, recorder AuditRecorder) EmailService {
+	return &auditedEmailService{EmailService: service, recorder: recorder}
+}
+
+func (s *auditedEmailService) SendMessage(msg *Message) error {
+	sendErr := s.EmailService.SendMessage(msg)
+
+	event := &models.AuditEvent{
+		Action:   models.AuditSend,
+		Entity:   "email",
+		EntityID: msg.MessageID,
+		Details:  fmt.Sprintf("%d recipients", len(msg.To)),
+	}
+	if len(msg.Attachments) > 0 {
+		event.Details += fmt.Sprintf(", %d attachments", len(msg.Attachments))
+	}
+	if sendErr != nil {
+		event.Action = models.AuditSendFailed
+	}
+	if err := s.recorder.SaveAuditEvent(context.Background(), event); err != nil && sendErr == nil {
+		return fmt.Errorf("email sent, but failed to record audit event: %w", err)
+	}
+	return sendErr
+}
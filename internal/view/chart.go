@@ -0,0 +1,332 @@
+package view
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/aldaircoronel/email-summary/internal/i18n"
+	"github.com/aldaircoronel/email-summary/internal/models"
+)
+
+// Content IDs of the charts. They are fixed so a statement archived with its HTML body can be re-sent
+// with the charts drawn again from its month summaries.
+const (
+	BalanceChartID = "balance-chart@email-summary"
+	VolumeChartID  = "volume-chart@email-summary"
+)
+
+// chartRef is a chart as the email template shows it
+type chartRef struct {
+	Src     template.URL
+	Alt     string
+	Caption string
+}
+
+// chartRefs returns the charts the email template shows, none when there are no months to chart
+func chartRefs(locale *i18n.Locale, monthSummaries []*models.MonthSummary) []chartRef {
+	if len(monthSummaries) == 0 {
+		return nil
+	}
+	return []chartRef{
+		{Src: template.URL("cid:" + BalanceChartID), Alt: locale.T("balance_chart_alt"), Caption: locale.T("balance_chart_caption")},
+		{Src: template.URL("cid:" + VolumeChartID), Alt: locale.T("volume_chart_alt"), Caption: locale.T("volume_chart_caption")},
+	}
+}
+
+// Size of the charts, in pixels
+const (
+	chartWidth  = 560
+	chartHeight = 220
+)
+
+var (
+	chartBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	chartGrid       = color.RGBA{0xe0, 0xe0, 0xe0, 0xff}
+	chartAxis       = color.RGBA{0x88, 0x88, 0x88, 0xff}
+	chartText       = color.RGBA{0x55, 0x55, 0x55, 0xff}
+	chartBalance    = color.RGBA{0x1f, 0x6f, 0xb2, 0xff}
+	chartCredit     = color.RGBA{0x2e, 0x9d, 0x5b, 0xff}
+	chartDebit      = color.RGBA{0xd6, 0x45, 0x45, 0xff}
+)
+
+// RenderCharts draws the monthly figures as PNG images to be sent inline with the email: a line chart of
+// the balance and a bar chart of the credit and debit volumes, labeled in the locale of the account.
+// There are none when there are no months.
+func RenderCharts(account *models.Account, monthSummaries []*models.MonthSummary) ([]Attachment, error) {
+	if len(monthSummaries) == 0 {
+		return nil, nil
+	}
+	monthSummaries = sortByMonth(monthSummaries)
+	locale := i18n.Lookup(account.Locale)
+
+	labels := make([]string, len(monthSummaries))
+	balances := make([]float64, len(monthSummaries))
+	credits := make([]float64, len(monthSummaries))
+	debits := make([]float64, len(monthSummaries))
+	for i, ms := range monthSummaries {
+		labels[i] = monthLabel(locale, ms.Month)
+		balances[i] = ms.TotalBalance
+		credits[i] = ms.AverageCredit * float64(ms.NumOfCreditTransactions)
+		debits[i] = math.Abs(ms.AverageDebit * float64(ms.NumOfDebitTransactions))
+	}
+
+	balance := newChart(locale, labels, balances)
+	balance.line(balances, chartBalance)
+	volume := newChart(locale, labels, credits, debits)
+	volume.bars(chartCredit, credits, chartDebit, debits)
+
+	var charts []Attachment
+	for _, c := range []struct {
+		id, name string
+		chart    *chart
+	}{
+		{BalanceChartID, "balance.png", balance},
+		{VolumeChartID, "volume.png", volume},
+	} {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, c.chart.img); err != nil {
+			return nil, fmt.Errorf("failed to encode chart: %w", err)
+		}
+		charts = append(charts, Attachment{Filename: c.name, ContentType: "image/png", ContentID: c.id, Data: buf.Bytes()})
+	}
+	return charts, nil
+}
+
+// ReferencedImages returns the images the HTML body shows through cid: URLs
+func ReferencedImages(html string, images []Attachment) []Attachment {
+	var referenced []Attachment
+	for _, img := range images {
+		if strings.Contains(html, "cid:"+img.ContentID) {
+			referenced = append(referenced, img)
+		}
+	}
+	return referenced
+}
+
+// EmbedImages replaces the cid: URLs of the HTML body with data: URLs of the images, so it shows them
+// on its own, outside of an email
+func EmbedImages(html string, images []Attachment) string {
+	for _, img := range images {
+		url := "data:" + img.ContentType + ";base64," + base64.StdEncoding.EncodeToString(img.Data)
+		html = strings.ReplaceAll(html, "cid:"+img.ContentID, url)
+	}
+	return html
+}
+
+// monthLabel returns the abbreviated name of the month of a month summary, in capitals as the chart
+// font has no lowercase letters
+func monthLabel(locale *i18n.Locale, month string) string {
+	if m, _, err := models.ParseMonth(month); err == nil {
+		return strings.ToUpper(locale.ShortMonth(m.Month()))
+	}
+	runes := []rune(strings.ToUpper(month))
+	if len(runes) > 3 {
+		runes = runes[:3]
+	}
+	return string(runes)
+}
+
+// chart is a plot area with a value axis on the left and a slot per month along the bottom
+type chart struct {
+	img *image.RGBA
+	// Plot area
+	left, top, right, bottom int
+	// Value range of the axis
+	lo, hi float64
+	n      int
+}
+
+// newChart draws the background, the grid and the labels of a chart fitting all the series
+func newChart(locale *i18n.Locale, labels []string, series ...[]float64) *chart {
+	c := &chart{
+		img:    image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight)),
+		left:   56,
+		top:    10,
+		right:  chartWidth - 10,
+		bottom: chartHeight - 22,
+		n:      len(labels),
+	}
+	draw.Draw(c.img, c.img.Bounds(), &image.Uniform{chartBackground}, image.Point{}, draw.Src)
+
+	// The axis always shows zero, with some room above and below the values
+	for _, values := range series {
+		for _, v := range values {
+			c.lo = math.Min(c.lo, v)
+			c.hi = math.Max(c.hi, v)
+		}
+	}
+	if c.hi == c.lo {
+		c.hi = c.lo + 1
+	}
+	margin := (c.hi - c.lo) * 0.1
+	if c.lo < 0 {
+		c.lo -= margin
+	}
+	if c.hi > 0 {
+		c.hi += margin
+	}
+
+	for _, v := range []float64{c.lo, c.hi} {
+		y := c.y(v)
+		c.hline(y, chartGrid)
+		c.label(locale.Number(v, 0), c.left-6, y, true)
+	}
+	c.hline(c.y(0), chartAxis)
+	c.label("0", c.left-6, c.y(0), true)
+
+	for i, label := range labels {
+		c.label(label, c.slotCenter(i), c.bottom+12, false)
+	}
+	return c
+}
+
+// y returns the pixel row of a value
+func (c *chart) y(v float64) int {
+	return c.bottom - int(math.Round((v-c.lo)/(c.hi-c.lo)*float64(c.bottom-c.top)))
+}
+
+func (c *chart) slotWidth() float64 {
+	return float64(c.right-c.left) / float64(c.n)
+}
+
+func (c *chart) slotCenter(i int) int {
+	return c.left + int((float64(i)+0.5)*c.slotWidth())
+}
+
+func (c *chart) hline(y int, col color.Color) {
+	c.fill(c.left, y, c.right, y+1, col)
+}
+
+func (c *chart) fill(x0, y0, x1, y1 int, col color.Color) {
+	draw.Draw(c.img, image.Rect(x0, y0, x1, y1), &image.Uniform{col}, image.Point{}, draw.Src)
+}
+
+// line draws the values as a line through the middle of the slots, with a dot on every value
+func (c *chart) line(values []float64, col color.Color) {
+	for i, v := range values {
+		x, y := c.slotCenter(i), c.y(v)
+		if i > 0 {
+			c.segment(c.slotCenter(i-1), c.y(values[i-1]), x, y, col)
+		}
+		c.fill(x-3, y-3, x+4, y+4, col)
+	}
+}
+
+// segment draws a line two pixels thick from (x0, y0) to (x1, y1)
+func (c *chart) segment(x0, y0, x1, y1 int, col color.Color) {
+	steps := int(math.Max(math.Abs(float64(x1-x0)), math.Abs(float64(y1-y0))))
+	for s := 0; s <= steps; s++ {
+		t := float64(s) / math.Max(float64(steps), 1)
+		x := x0 + int(math.Round(t*float64(x1-x0)))
+		y := y0 + int(math.Round(t*float64(y1-y0)))
+		c.fill(x, y, x+2, y+2, col)
+	}
+}
+
+// bars draws two bars per slot, side by side, from zero to each value
+func (c *chart) bars(leftColor color.Color, leftValues []float64, rightColor color.Color, rightValues []float64) {
+	width := int(c.slotWidth() * 0.3)
+	if width < 2 {
+		width = 2
+	}
+	zero := c.y(0)
+	for i := 0; i < c.n; i++ {
+		center := c.slotCenter(i)
+		c.bar(center-width-1, width, zero, c.y(leftValues[i]), leftColor)
+		c.bar(center+1, width, zero, c.y(rightValues[i]), rightColor)
+	}
+}
+
+func (c *chart) bar(x, width, zero, y int, col color.Color) {
+	if y > zero {
+		zero, y = y, zero
+	}
+	c.fill(x, y, x+width, zero, col)
+}
+
+// Glyphs of the chart font, 3 by 5 pixels drawn at twice their size
+const (
+	glyphScale   = 2
+	glyphWidth   = 3 * glyphScale
+	glyphHeight  = 5 * glyphScale
+	glyphAdvance = glyphWidth + glyphScale
+)
+
+var glyphs = map[rune][5]string{
+	'0': {"###", "#.#", "#.#", "#.#", "###"},
+	'1': {".#.", "##.", ".#.", ".#.", "###"},
+	'2': {"###", "..#", "###", "#..", "###"},
+	'3': {"###", "..#", "###", "..#", "###"},
+	'4': {"#.#", "#.#", "###", "..#", "..#"},
+	'5': {"###", "#..", "###", "..#", "###"},
+	'6': {"###", "#..", "###", "#.#", "###"},
+	'7': {"###", "..#", "..#", "..#", "..#"},
+	'8': {"###", "#.#", "###", "#.#", "###"},
+	'9': {"###", "#.#", "###", "..#", "###"},
+	'-': {"...", "...", "###", "...", "..."},
+	'.': {"...", "...", "...", "...", ".#."},
+	',': {"...", "...", "...", ".#.", "#.."},
+	'A': {".#.", "#.#", "###", "#.#", "#.#"},
+	'B': {"##.", "#.#", "##.", "#.#", "##."},
+	'C': {"###", "#..", "#..", "#..", "###"},
+	'D': {"##.", "#.#", "#.#", "#.#", "##."},
+	'E': {"###", "#..", "##.", "#..", "###"},
+	'F': {"###", "#..", "##.", "#..", "#.."},
+	'G': {"###", "#..", "#.#", "#.#", "###"},
+	'H': {"#.#", "#.#", "###", "#.#", "#.#"},
+	'I': {"###", ".#.", ".#.", ".#.", "###"},
+	'J': {"..#", "..#", "..#", "#.#", "###"},
+	'K': {"#.#", "#.#", "##.", "#.#", "#.#"},
+	'L': {"#..", "#..", "#..", "#..", "###"},
+	'M': {"#.#", "###", "###", "#.#", "#.#"},
+	'N': {"##.", "#.#", "#.#", "#.#", "#.#"},
+	'O': {"###", "#.#", "#.#", "#.#", "###"},
+	'P': {"###", "#.#", "###", "#..", "#.."},
+	'Q': {"###", "#.#", "#.#", "###", "..#"},
+	'R': {"##.", "#.#", "##.", "#.#", "#.#"},
+	'S': {"###", "#..", "###", "..#", "###"},
+	'T': {"###", ".#.", ".#.", ".#.", ".#."},
+	'U': {"#.#", "#.#", "#.#", "#.#", "###"},
+	'V': {"#.#", "#.#", "#.#", "#.#", ".#."},
+	'W': {"#.#", "#.#", "###", "###", "#.#"},
+	'X': {"#.#", "#.#", ".#.", "#.#", "#.#"},
+	'Y': {"#.#", "#.#", ".#.", ".#.", ".#."},
+	'Z': {"###", "..#", ".#.", "#..", "###"},
+}
+
+// label writes text vertically centered on y, ending at x when alignRight is set and centered on x otherwise.
+// Characters the font lacks are left blank.
+func (c *chart) label(text string, x, y int, alignRight bool) {
+	runes := []rune(text)
+	width := len(runes)*glyphAdvance - glyphScale
+	if alignRight {
+		x -= width
+	} else {
+		x -= width / 2
+	}
+	y -= glyphHeight / 2
+
+	for i, r := range runes {
+		glyph, ok := glyphs[unicode.ToUpper(r)]
+		if !ok {
+			continue
+		}
+		gx := x + i*glyphAdvance
+		for row, bits := range glyph {
+			for col, bit := range bits {
+				if bit == '#' {
+					c.fill(gx+col*glyphScale, y+row*glyphScale, gx+(col+1)*glyphScale, y+(row+1)*glyphScale, chartText)
+				}
+			}
+		}
+	}
+}
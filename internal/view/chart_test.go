@@ -0,0 +1,181 @@
+package view
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aldaircoronel/email-summary/internal/models"
+)
+
+var cidURL = regexp.MustCompile(`cid:([^"'\s)]+)`)
+
+// decodeChart decodes a chart and checks its size
+func decodeChart(t *testing.T, chart Attachment) image.Image {
+	t.Helper()
+	if chart.ContentType != "image/png" || !strings.HasSuffix(chart.Filename, ".png") {
+		t.Errorf("chart %s has type %s, want a PNG file", chart.Filename, chart.ContentType)
+	}
+	img, err := png.Decode(bytes.NewReader(chart.Data))
+	if err != nil {
+		t.Fatalf("chart %s isn't a PNG image: %v", chart.Filename, err)
+	}
+	if size := img.Bounds().Size(); size.X != chartWidth || size.Y != chartHeight {
+		t.Errorf("chart %s is %dx%d, want %dx%d", chart.Filename, size.X, size.Y, chartWidth, chartHeight)
+	}
+	return img
+}
+
+// countPixels returns the number of pixels of the image in the color
+func countPixels(img image.Image, col color.RGBA) int {
+	n := 0
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if color.RGBAModel.Convert(img.At(x, y)) == col {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func TestRenderCharts(t *testing.T) {
+	account, _, monthSummaries := SampleStatement()
+	charts, err := RenderCharts(account, monthSummaries)
+	if err != nil {
+		t.Fatalf("RenderCharts: %v", err)
+	}
+	if len(charts) != 2 || charts[0].ContentID != BalanceChartID || charts[1].ContentID != VolumeChartID {
+		t.Fatalf("RenderCharts returned %d charts, want the balance and volume charts", len(charts))
+	}
+
+	balance := decodeChart(t, charts[0])
+	if countPixels(balance, chartBalance) == 0 {
+		t.Error("the balance chart has no balance line")
+	}
+	volume := decodeChart(t, charts[1])
+	// Debits are stored with negative averages, and drawn as bars of their volume
+	if countPixels(volume, chartCredit) == 0 || countPixels(volume, chartDebit) == 0 {
+		t.Error("the volume chart is missing the credit or debit bars")
+	}
+}
+
+func TestRenderChartsSingleMonth(t *testing.T) {
+	account, _, _ := SampleStatement()
+	tests := []struct {
+		name  string
+		month *models.MonthSummary
+	}{
+		{"with transactions", &models.MonthSummary{Month: "2023-01", TotalBalance: 40, TotalTransactions: 2, NumOfCreditTransactions: 1, NumOfDebitTransactions: 1, AverageCredit: 50, AverageDebit: -10}},
+		// A month whose figures are all zero must not divide by an empty value range
+		{"without transactions", &models.MonthSummary{Month: "2023-01"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			charts, err := RenderCharts(account, []*models.MonthSummary{tt.month})
+			if err != nil {
+				t.Fatalf("RenderCharts: %v", err)
+			}
+			if len(charts) != 2 {
+				t.Fatalf("RenderCharts returned %d charts, want 2", len(charts))
+			}
+			// The single value is drawn as a dot in the middle of the only slot
+			if img := decodeChart(t, charts[0]); countPixels(img, chartBalance) == 0 {
+				t.Error("the balance chart doesn't show the month")
+			}
+			volume := decodeChart(t, charts[1])
+			if bars := countPixels(volume, chartCredit) + countPixels(volume, chartDebit); (bars > 0) != (tt.month.TotalTransactions > 0) {
+				t.Errorf("the volume chart has %d pixels of bars for %d transactions", bars, tt.month.TotalTransactions)
+			}
+		})
+	}
+}
+
+func TestRenderChartsWithoutMonths(t *testing.T) {
+	account, summary, _ := SampleStatement()
+	charts, err := RenderCharts(account, nil)
+	if err != nil || len(charts) != 0 {
+		t.Fatalf("RenderCharts without months = %d charts, %v, want none", len(charts), err)
+	}
+
+	templates, err := LoadTemplates("")
+	if err != nil {
+		t.Fatalf("LoadTemplates: %v", err)
+	}
+	html, err := templates.RenderEmailBody(account, summary, nil)
+	if err != nil {
+		t.Fatalf("RenderEmailBody: %v", err)
+	}
+	if strings.Contains(html, "cid:") {
+		t.Errorf("the email without months shows charts:\n%s", html)
+	}
+}
+
+// TestChartContentIDs checks every cid: URL of the HTML body is an image of the multipart/related
+// part, so no client shows a broken image, and that no unused image is sent
+func TestChartContentIDs(t *testing.T) {
+	account, summary, monthSummaries := SampleStatement()
+	templates, err := LoadTemplates("")
+	if err != nil {
+		t.Fatalf("LoadTemplates: %v", err)
+	}
+	html, err := templates.RenderEmailBody(account, summary, monthSummaries)
+	if err != nil {
+		t.Fatalf("RenderEmailBody: %v", err)
+	}
+	charts, err := RenderCharts(account, monthSummaries)
+	if err != nil {
+		t.Fatalf("RenderCharts: %v", err)
+	}
+	// An image the body doesn't show is left out
+	charts = append(charts, Attachment{Filename: "unused.png", ContentType: "image/png", ContentID: "unused@email-summary", Data: charts[0].Data})
+
+	msg := testMessage()
+	msg.HTML = html
+	msg.Inline = ReferencedImages(html, charts)
+	data, err := msg.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+	_, body := parseMessage(t, data)
+	related := body.find("multipart/related")
+	if related == nil {
+		t.Fatalf("the message has no multipart/related part: %s", body.structure())
+	}
+
+	var referenced []string
+	for _, match := range cidURL.FindAllStringSubmatch(string(related.find("text/html").content), -1) {
+		referenced = append(referenced, match[1])
+	}
+	var contentIDs []string
+	for _, p := range related.parts[1:] {
+		contentIDs = append(contentIDs, strings.Trim(p.header.Get("Content-ID"), "<>"))
+		decodeChart(t, Attachment{Filename: p.params["name"], ContentType: p.mediaType, Data: p.content})
+	}
+	sort.Strings(referenced)
+	sort.Strings(contentIDs)
+	if want := []string{BalanceChartID, VolumeChartID}; strings.Join(referenced, ",") != strings.Join(want, ",") {
+		t.Errorf("the HTML body refers to %v, want %v", referenced, want)
+	}
+	if strings.Join(contentIDs, ",") != strings.Join(referenced, ",") {
+		t.Errorf("the related part holds the images %v, the HTML body refers to %v", contentIDs, referenced)
+	}
+}
+
+func TestEmbedImages(t *testing.T) {
+	account, _, monthSummaries := SampleStatement()
+	charts, err := RenderCharts(account, monthSummaries)
+	if err != nil {
+		t.Fatalf("RenderCharts: %v", err)
+	}
+	html := EmbedImages(`<img src="cid:`+BalanceChartID+`"><img src="cid:`+VolumeChartID+`">`, charts)
+	if strings.Contains(html, "cid:") || strings.Count(html, `src="data:image/png;base64,`) != 2 {
+		t.Errorf("EmbedImages left a cid: URL or missed an image")
+	}
+}
@@ -0,0 +1,209 @@
+package view
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+)
+
+// Signer signs a formatted message, returning it with the signature header added
+type Signer interface {
+	Sign(data []byte) ([]byte, error)
+}
+
+// DKIMConfig contains configuration options for the DKIM signer.
+type DKIMConfig struct {
+	// Domain is the signing domain, which receivers look the public key up in and should be the
+	// domain of the sender for DMARC
+	Domain string
+	// Selector names the key in the domain: its public key is the TXT record <selector>._domainkey.<domain>
+	Selector string
+	// KeyFile holds the PEM RSA private key, in PKCS #1 or PKCS #8
+	KeyFile string
+}
+
+// DKIMSigner signs messages with DKIM (RFC 6376), with rsa-sha256 and relaxed canonicalization of
+// both the header and the body
+type DKIMSigner struct {
+	domain   string
+	selector string
+	key      *rsa.PrivateKey
+}
+
+// dkimHeaders are the header fields signed when the message has them. The body signature covers
+// the rest of the content headers, since they are in the MIME parts.
+var dkimHeaders = []string{"From", "To", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type", "Content-Transfer-Encoding"}
+
+// Constructor that creates a new DKIMSigner, loading its private key
+func NewDKIMSigner(cfg *DKIMConfig) (*DKIMSigner, error) {
+	if cfg.Domain == "" || cfg.Selector == "" {
+		return nil, apperrors.Invalid("DKIM signing requires a domain and a selector")
+	}
+	data, err := os.ReadFile(cfg.KeyFile)
+	if err != nil {
+		return nil, apperrors.Invalid("failed to read DKIM private key: %w", err)
+	}
+	key, err := parseRSAPrivateKey(data)
+	if err != nil {
+		return nil, apperrors.Invalid("invalid DKIM private key %s: %w", cfg.KeyFile, err)
+	}
+	return &DKIMSigner{domain: cfg.Domain, selector: cfg.Selector, key: key}, nil
+}
+
+// parseRSAPrivateKey decodes a PEM RSA private key in PKCS #1 or PKCS #8
+func parseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%T is not an RSA key", key)
+	}
+	return rsaKey, nil
+}
+
+// Sign adds a DKIM-Signature header on top of the message
+func (s *DKIMSigner) Sign(data []byte) ([]byte, error) {
+	header, body, ok := bytes.Cut(data, []byte("\r\n\r\n"))
+	if !ok {
+		return nil, errors.New("failed to sign email: the message has no body")
+	}
+	fields := splitHeaderFields(string(header))
+	bodyHash := sha256.Sum256(relaxedBody(body))
+
+	// The hash covers the signed fields and then the signature field itself, with an empty signature
+	hash := sha256.New()
+	var signed []string
+	for _, name := range dkimHeaders {
+		if field, ok := lastHeaderField(fields, name); ok {
+			hash.Write([]byte(relaxedHeader(field)))
+			signed = append(signed, strings.ToLower(name))
+		}
+	}
+	field := fmt.Sprintf("DKIM-Signature: v=1; a=rsa-sha256; c=relaxed/relaxed; d=%s; s=%s;\r\n\tt=%d; h=%s;\r\n\tbh=%s;\r\n\tb=",
+		s.domain, s.selector, time.Now().Unix(), strings.Join(signed, ":"), base64.StdEncoding.EncodeToString(bodyHash[:]))
+	hash.Write([]byte(strings.TrimSuffix(relaxedHeader(field), "\r\n")))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, hash.Sum(nil))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign email: %w", err)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(field)
+	// Receivers ignore the whitespace folding the signature
+	b := base64.StdEncoding.EncodeToString(signature)
+	for len(b) > 72 {
+		buf.WriteString(b[:72] + "\r\n\t")
+		b = b[72:]
+	}
+	buf.WriteString(b + "\r\n")
+	buf.Write(data)
+	return buf.Bytes(), nil
+}
+
+// splitHeaderFields splits a message header into its fields, each with its folded lines
+func splitHeaderFields(header string) []string {
+	var fields []string
+	for _, line := range strings.Split(header, "\r\n") {
+		if len(fields) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			fields[len(fields)-1] += "\r\n" + line
+			continue
+		}
+		fields = append(fields, line)
+	}
+	return fields
+}
+
+// lastHeaderField returns the last field with the given name, the one DKIM signs first
+func lastHeaderField(fields []string, name string) (string, bool) {
+	for i := len(fields) - 1; i >= 0; i-- {
+		if colon := strings.IndexByte(fields[i], ':'); colon >= 0 && strings.EqualFold(strings.TrimSpace(fields[i][:colon]), name) {
+			return fields[i], true
+		}
+	}
+	return "", false
+}
+
+// relaxedHeader canonicalizes a header field with the relaxed algorithm: the name in lower case,
+// the value unfolded with every run of whitespace as one space and none around it
+func relaxedHeader(field string) string {
+	name, value, _ := strings.Cut(field, ":")
+	value = strings.ReplaceAll(value, "\r\n", "")
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.TrimSpace(collapseWhitespace(value)) + "\r\n"
+}
+
+// relaxedBody canonicalizes a message body with the relaxed algorithm: every run of whitespace in
+// a line as one space, none at the end of the lines and no empty lines at the end
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(collapseWhitespace(line), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// collapseWhitespace replaces every run of spaces and tabs with one space
+func collapseWhitespace(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// signingEmailService signs every message sent through the service it wraps
+type signingEmailService struct {
+	EmailService
+	signer Signer
+}
+
+// NewSigningEmailService wraps an email service so every message it sends is signed. The transports
+// that format messages themselves sign them as formatted; the http transport also posts the signed
+// message, in its raw field.
+func NewSigningEmailService(service EmailService, signer Signer) EmailService {
+	return &signingEmailService{EmailService: service, signer: signer}
+}
+
+func (s *signingEmailService) SendMessage(msg *Message) error {
+	msg.signer = s.signer
+	return s.EmailService.SendMessage(msg)
+}
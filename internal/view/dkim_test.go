@@ -0,0 +1,237 @@
+package view
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// dkimTestKey is shared by the tests, since generating an RSA key is slow
+var dkimTestKey = func() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+// newTestDKIMSigner writes the test key to a PEM file, in PKCS #8 or PKCS #1, and loads a signer from it
+func newTestDKIMSigner(t *testing.T, pkcs8 bool) *DKIMSigner {
+	t.Helper()
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(dkimTestKey)}
+	if pkcs8 {
+		der, err := x509.MarshalPKCS8PrivateKey(dkimTestKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+	keyFile := filepath.Join(t.TempDir(), "dkim.pem")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewDKIMSigner(&DKIMConfig{Domain: "example.com", Selector: "stori", KeyFile: keyFile})
+	if err != nil {
+		t.Fatalf("NewDKIMSigner: %v", err)
+	}
+	return signer
+}
+
+// The verifier below follows RFC 6376 on its own, rather than reusing the canonicalization of the signer,
+// so both can't agree on the same mistake
+
+var (
+	wsp          = regexp.MustCompile(`[ \t]+`)
+	wspAtEOL     = regexp.MustCompile(`[ \t]+\r\n`)
+	emptyAtEnd   = regexp.MustCompile(`(\r\n)+$`)
+	signatureTag = regexp.MustCompile(`(^|;)(\s*b\s*=)[^;]*`)
+)
+
+// canonicalBody is the relaxed body canonicalization of RFC 6376 section 3.4.4
+func canonicalBody(body string) string {
+	body = wspAtEOL.ReplaceAllString(body, "\r\n")
+	body = wsp.ReplaceAllString(body, " ")
+	body = strings.TrimRight(body, " ")
+	body = emptyAtEnd.ReplaceAllString(body, "")
+	if body == "" {
+		return ""
+	}
+	return body + "\r\n"
+}
+
+// canonicalHeader is the relaxed header canonicalization of RFC 6376 section 3.4.2
+func canonicalHeader(field string) string {
+	colon := strings.Index(field, ":")
+	name := strings.ToLower(strings.TrimRight(field[:colon], " \t"))
+	value := strings.NewReplacer("\r\n ", " ", "\r\n\t", "\t").Replace(field[colon+1:])
+	value = strings.Trim(wsp.ReplaceAllString(value, " "), " ")
+	return name + ":" + value + "\r\n"
+}
+
+// verifyDKIM checks the DKIM-Signature field on top of a relaxed/relaxed rsa-sha256 signed message
+func verifyDKIM(message []byte, key *rsa.PublicKey) (map[string]string, error) {
+	header, body, ok := strings.Cut(string(message), "\r\n\r\n")
+	if !ok {
+		return nil, errors.New("the message has no body")
+	}
+	header += "\r\n"
+
+	// Fields are the lines up to the next one that doesn't start with whitespace
+	var fields []string
+	for _, line := range strings.SplitAfter(header, "\r\n") {
+		if line == "" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			fields[len(fields)-1] += line
+		} else {
+			fields = append(fields, line)
+		}
+	}
+	for i := range fields {
+		fields[i] = strings.TrimSuffix(fields[i], "\r\n")
+	}
+
+	signature := fields[0]
+	if !strings.HasPrefix(strings.ToLower(signature), "dkim-signature:") {
+		return nil, fmt.Errorf("the message starts with %q, not a signature", signature)
+	}
+	tags := map[string]string{}
+	for _, tag := range strings.Split(signature[len("DKIM-Signature:"):], ";") {
+		name, value, _ := strings.Cut(tag, "=")
+		tags[strings.TrimSpace(name)] = strings.Join(strings.Fields(value), "")
+	}
+	if tags["v"] != "1" || tags["a"] != "rsa-sha256" || tags["c"] != "relaxed/relaxed" {
+		return tags, fmt.Errorf("unexpected signature tags %v", tags)
+	}
+
+	bodyHash := sha256.Sum256([]byte(canonicalBody(body)))
+	if bh := base64.StdEncoding.EncodeToString(bodyHash[:]); tags["bh"] != bh {
+		return tags, fmt.Errorf("bh=%s, but the body hashes to %s", tags["bh"], bh)
+	}
+
+	// Each name in h= signs the last field with that name not signed yet, from the bottom up
+	hash := sha256.New()
+	used := map[int]bool{}
+	for _, name := range strings.Split(tags["h"], ":") {
+		for i := len(fields) - 1; i > 0; i-- {
+			if !used[i] && strings.EqualFold(strings.TrimSpace(fields[i][:strings.Index(fields[i], ":")]), name) {
+				used[i] = true
+				hash.Write([]byte(canonicalHeader(fields[i])))
+				break
+			}
+		}
+	}
+	unsigned := signatureTag.ReplaceAllString(signature, "$1$2")
+	hash.Write([]byte(strings.TrimSuffix(canonicalHeader(unsigned), "\r\n")))
+
+	b, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		return tags, fmt.Errorf("b= isn't base64: %w", err)
+	}
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hash.Sum(nil), b); err != nil {
+		return tags, fmt.Errorf("b= doesn't verify: %w", err)
+	}
+	return tags, nil
+}
+
+// dkimTestMessage has a To field folded over many lines, runs of whitespace in its subject and its
+// text, and blank lines at the end of its body
+func dkimTestMessage() *Message {
+	msg := testMessage()
+	for i := 0; i < 8; i++ {
+		msg.To = append(msg.To, fmt.Sprintf("Cliente %d <cliente%d@example.com>", i, i))
+	}
+	msg.Subject = "Resumen   de\t transacciones"
+	msg.Text = "Total balance:    39.74\r\nAverage debit amount:\t\t-15.38\r\n\r\n\r\n\r\n"
+	return msg
+}
+
+func TestDKIMSignerSign(t *testing.T) {
+	tests := []struct {
+		name  string
+		pkcs8 bool
+		msg   func() *Message
+		// signed is the h= tag, the fields of the message among those DKIM signs
+		signed string
+	}{
+		{"multipart message", true, dkimTestMessage, "from:to:subject:date:message-id:mime-version:content-type"},
+		{"text message", false, func() *Message {
+			// The text body alone is the whole message body, with its blank lines at the end
+			msg := dkimTestMessage()
+			msg.HTML, msg.Inline, msg.Attachments = "", nil, nil
+			return msg
+		}, "from:to:subject:date:message-id:mime-version:content-type:content-transfer-encoding"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := tt.msg()
+			msg.signer = newTestDKIMSigner(t, tt.pkcs8)
+			data, err := msg.Bytes()
+			if err != nil {
+				t.Fatalf("Bytes: %v", err)
+			}
+			if !bytes.Contains(data, []byte(",\r\n \"Cliente 0\"")) {
+				t.Fatalf("the To field isn't folded:\n%s", data)
+			}
+
+			tags, err := verifyDKIM(data, &dkimTestKey.PublicKey)
+			if err != nil {
+				t.Fatalf("the signature doesn't verify: %v\n%s", err, data)
+			}
+			if tags["d"] != "example.com" || tags["s"] != "stori" {
+				t.Errorf("d=%s s=%s, want the domain and selector of the signer", tags["d"], tags["s"])
+			}
+			if tags["h"] != tt.signed {
+				t.Errorf("h=%s, want %s", tags["h"], tt.signed)
+			}
+
+			// Relaxed canonicalization survives relays that refold fields and change whitespace...
+			relayed := bytes.Replace(data, []byte(",\r\n \"Cliente 0\""), []byte(",\r\n\t  \"Cliente 0\""), 1)
+			relayed = bytes.Replace(relayed, []byte("Resumen   de\t transacciones"), []byte("Resumen de transacciones"), 1)
+			relayed = append(relayed, "\r\n\r\n"...)
+			if _, err := verifyDKIM(relayed, &dkimTestKey.PublicKey); err != nil {
+				t.Errorf("the signature doesn't verify after whitespace changes: %v", err)
+			}
+
+			// ...but not changes to the content
+			for _, tampered := range [][]byte{
+				bytes.Replace(data, []byte("39.74"), []byte("93.74"), 1),
+				bytes.Replace(data, []byte("Resumen   de"), []byte("Resumen de la"), 1),
+				bytes.Replace(data, []byte("cliente7@example.com"), []byte("mallory@example.com"), 1),
+			} {
+				if _, err := verifyDKIM(tampered, &dkimTestKey.PublicKey); err == nil {
+					t.Error("the signature verifies a tampered message")
+				}
+			}
+		})
+	}
+}
+
+func TestNewDKIMSignerInvalidConfig(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "dkim.pem")
+	if err := os.WriteFile(keyFile, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, cfg := range []DKIMConfig{
+		{Selector: "stori", KeyFile: keyFile},
+		{Domain: "example.com", Selector: "stori", KeyFile: filepath.Join(t.TempDir(), "missing.pem")},
+		{Domain: "example.com", Selector: "stori", KeyFile: keyFile},
+	} {
+		if _, err := NewDKIMSigner(&cfg); err == nil {
+			t.Errorf("NewDKIMSigner(%+v) succeeded", cfg)
+		}
+	}
+}
@@ -1,91 +1,257 @@
 package view
 
 import (
-	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
-	"html/template"
+	"net"
+	"net/mail"
 	"net/smtp"
+	"net/textproto"
+	"os"
 	"sort"
-	"strings"
 	"time"
 
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
 	"github.com/aldaircoronel/email-summary/internal/models"
 )
 
 // Interface that represents an email service.
 type EmailService interface {
-	SendEmail(to []string, subject string, body string) error
+	// SendMessage sends the message, filling in its sender, date and message ID when they are empty
+	SendMessage(msg *Message) error
 }
 
+// TLS modes of SMTPConfig.TLS
+const (
+	// TLSNone never encrypts the connection
+	TLSNone = "none"
+	// TLSOpportunistic upgrades the connection with STARTTLS when the server offers it
+	TLSOpportunistic = "opportunistic"
+	// TLSStartTLS upgrades the connection with STARTTLS and fails if the server doesn't offer it
+	TLSStartTLS = "starttls"
+	// TLSImplicit connects with TLS from the start, as servers on port 465 expect
+	TLSImplicit = "tls"
+)
+
+// defaultSMTPTimeout bounds a connection to the mail server without a timeout
+const defaultSMTPTimeout = 30 * time.Second
+
 // SMTPConfig contains configuration options for the SMTP service.
 type SMTPConfig struct {
 	Host     string
 	Port     string
 	Username string
+	// Password is the OAuth 2.0 access token with the XOAUTH2 mechanism
 	Password string
-	From     string
+	// From is the sender address, optionally with a display name: "Stori <statements@example.com>"
+	From string
+
+	// TLS is one of the TLS modes, TLSOpportunistic when empty
+	TLS string
+	// CAFile holds PEM certificates trusted to sign the certificate of the server, besides the system ones
+	CAFile string
+	// CertFile and KeyFile hold the PEM client certificate and key, for servers that require one
+	CertFile string
+	KeyFile  string
+	// Auth is one of the authentication mechanisms, AuthPlain when empty. There is no authentication
+	// without a Username.
+	Auth string
+	// Timeout bounds the whole conversation with the server, 30 seconds when 0
+	Timeout time.Duration
 }
 
 // SMTPService is the implementation of the EmailService interface that sends email through SMTP
 type SMTPService struct {
-	smtpHost string
-	smtpPort string
-	auth     smtp.Auth
-	from     string
+	smtpHost  string
+	smtpPort  string
+	auth      smtp.Auth
+	from      string
+	tlsMode   string
+	tlsConfig *tls.Config
+	timeout   time.Duration
 }
 
-// Constructor that creates a new SMTPService
-func NewSMTPService(cfg *SMTPConfig) *SMTPService {
-	auth := smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+// Constructor that creates a new SMTPService. It fails when the configuration is invalid or its
+// certificates can't be loaded.
+func NewSMTPService(cfg *SMTPConfig) (*SMTPService, error) {
+	tlsMode := cfg.TLS
+	switch tlsMode {
+	case "":
+		tlsMode = TLSOpportunistic
+	case TLSNone, TLSOpportunistic, TLSStartTLS, TLSImplicit:
+	default:
+		return nil, apperrors.Invalid("unknown SMTP TLS mode %q, expected none, opportunistic, starttls or tls", cfg.TLS)
+	}
+	auth, err := newSMTPAuth(cfg.Auth, cfg.Username, cfg.Password, cfg.Host)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultSMTPTimeout
+	}
 	return &SMTPService{
-		smtpHost: cfg.Host,
-		smtpPort: cfg.Port,
-		auth:     auth,
-		from:     cfg.From,
+		smtpHost:  cfg.Host,
+		smtpPort:  cfg.Port,
+		auth:      auth,
+		from:      cfg.From,
+		tlsMode:   tlsMode,
+		tlsConfig: tlsConfig,
+		timeout:   timeout,
+	}, nil
+}
+
+// newTLSConfig builds the TLS configuration of the connections to the server, verifying it with the
+// system certificates and those of CAFile
+func newTLSConfig(cfg *SMTPConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{ServerName: cfg.Host, MinVersion: tls.VersionTLS12}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, apperrors.Invalid("failed to read SMTP CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, apperrors.Invalid("SMTP CA file %s holds no PEM certificate", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, apperrors.Invalid("failed to load SMTP client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
 	}
+	return tlsConfig, nil
 }
 
-func sortByMonth(monthSummaries []*models.MonthSummary) {
-	sort.Slice(monthSummaries, func(i, j int) bool {
-		m1, _ := time.Parse("January", monthSummaries[i].Month)
-		m2, _ := time.Parse("January", monthSummaries[j].Month)
+// sortByMonth returns the month summaries oldest first, leaving the caller's slice in its order
+func sortByMonth(monthSummaries []*models.MonthSummary) []*models.MonthSummary {
+	sorted := make([]*models.MonthSummary, len(monthSummaries))
+	copy(sorted, monthSummaries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		m1, _, _ := models.ParseMonth(sorted[i].Month)
+		m2, _, _ := models.ParseMonth(sorted[j].Month)
 		return m1.Before(m2)
 	})
+	return sorted
 }
 
-func RenderEmailBody(summary *models.Summary, monthSummaries []*models.MonthSummary) (string, error) {
-	sortByMonth(monthSummaries)
-
-	tmpl, err := template.ParseFiles("internal/view/email-template.html")
+// SendMessage sends a message through SMTP
+func (s *SMTPService) SendMessage(msg *Message) error {
+	if msg.From == "" {
+		msg.From = s.from
+	}
+	sender, err := mail.ParseAddress(msg.From)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse email template: %v", err)
+		return apperrors.Invalid("invalid sender address %q: %w", msg.From, err)
+	}
+	recipients, err := msg.Recipients()
+	if err != nil {
+		return err
+	}
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
 	}
 
-	var body bytes.Buffer
-	if err := tmpl.Execute(&body, struct {
-		Summary        *models.Summary
-		MonthSummaries []*models.MonthSummary
-	}{
-		Summary:        summary,
-		MonthSummaries: monthSummaries,
-	}); err != nil {
-		return "", fmt.Errorf("failed to execute email template: %v", err)
+	if err := s.send(sender.Address, recipients, data); err != nil {
+		return deliveryError(err)
 	}
 
-	return body.String(), nil
+	return nil
 }
 
-// SendEmail sends an email through SMTP
-func (s *SMTPService) SendEmail(to []string, subject string, body string) error {
-	msg := []byte("To: " + strings.Join(to, ",") + "\r\n" +
-		"Subject: " + subject + "\r\n" +
-		"MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n\n" +
-		body + "\r\n")
+// send delivers the formatted message in one SMTP session, securing the connection as the TLS
+// mode requires. A certificate the server presents that can't be verified always fails, even in the
+// opportunistic mode, rather than sending the email in clear.
+func (s *SMTPService) send(sender string, recipients []string, data []byte) error {
+	addr := net.JoinHostPort(s.smtpHost, s.smtpPort)
+	dialer := &net.Dialer{Timeout: s.timeout}
 
-	addr := s.smtpHost + ":" + s.smtpPort
-	if err := smtp.SendMail(addr, s.auth, s.from, to, msg); err != nil {
-		return fmt.Errorf("failed to send email: %v", err)
+	var conn net.Conn
+	var err error
+	if s.tlsMode == TLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, s.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
 	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to mail server %s: %w", addr, err)
+	}
+	if err := conn.SetDeadline(time.Now().Add(s.timeout)); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to connect to mail server %s: %w", addr, err)
+	}
+
+	c, err := smtp.NewClient(conn, s.smtpHost)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to greet mail server %s: %w", addr, err)
+	}
+	defer c.Close()
 
+	if s.tlsMode == TLSOpportunistic || s.tlsMode == TLSStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(s.tlsConfig); err != nil {
+				return fmt.Errorf("failed to start TLS with mail server %s: %w", addr, err)
+			}
+		} else if s.tlsMode == TLSStartTLS {
+			return fmt.Errorf("mail server %s doesn't offer STARTTLS, which the starttls mode requires", addr)
+		}
+	}
+	if s.auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return fmt.Errorf("mail server %s doesn't offer authentication", addr)
+		}
+		if err := c.Auth(s.auth); err != nil {
+			return fmt.Errorf("failed to authenticate with mail server %s: %w", addr, err)
+		}
+	}
+
+	if err := c.Mail(sender); err != nil {
+		return fmt.Errorf("mail server %s refused the sender: %w", addr, err)
+	}
+	for _, rcpt := range recipients {
+		if err := c.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("mail server %s refused recipient %s: %w", addr, rcpt, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("mail server %s refused the message: %w", addr, err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to send the message to mail server %s: %w", addr, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("mail server %s refused the message: %w", addr, err)
+	}
+	// The server took responsibility for the message when it accepted the data, so a failed QUIT
+	// mustn't fail the delivery and have the email sent again
+	c.Quit()
 	return nil
 }
+
+// deliveryError wraps an error from the mail server as a DeliveryError, marking it transient
+// when retrying may succeed: 4xx SMTP replies and network failures
+func deliveryError(err error) error {
+	delivery := &apperrors.DeliveryError{Err: err}
+
+	var tpErr *textproto.Error
+	var netErr net.Error
+	if errors.As(err, &tpErr) && tpErr.Code >= 400 && tpErr.Code < 500 || errors.As(err, &netErr) {
+		return &apperrors.TransientError{Err: delivery}
+	}
+	return delivery
+}
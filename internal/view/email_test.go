@@ -0,0 +1,356 @@
+package view
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+)
+
+// fakeSMTPServer is a mail server on a local port that accepts one SMTP session and records it
+type fakeSMTPServer struct {
+	listener net.Listener
+	sessions chan *smtpSession
+
+	// tlsConfig holds the certificate of the server, which offers STARTTLS when it is set
+	tlsConfig *tls.Config
+	// implicitTLS starts the session with TLS, as on port 465
+	implicitTLS bool
+	// noSTARTTLS doesn't offer STARTTLS even with a certificate
+	noSTARTTLS bool
+	// prompts are the challenges of the server to the AUTH command, after which it replies authReply
+	prompts   []string
+	authReply string
+	// quitReply answers QUIT, and the server hangs up without answering when it is empty
+	quitReply string
+}
+
+// smtpSession is what a client sent to the fake server
+type smtpSession struct {
+	tls       bool
+	mechanism string
+	// responses are the decoded responses of the client to the AUTH challenges, its initial response first
+	responses []string
+	from      string
+	rcpt      []string
+	data      string
+}
+
+// smtpConn is the side of the fake server of an SMTP connection
+type smtpConn struct {
+	*textproto.Conn
+}
+
+func newSMTPConn(conn net.Conn) *smtpConn {
+	return &smtpConn{Conn: textproto.NewConn(conn)}
+}
+
+// reply writes a reply line, ignoring that the client may have hung up
+func (c *smtpConn) reply(line string) {
+	c.PrintfLine("%s", line)
+}
+
+// newFakeSMTPServer starts a server, configured by setup, and returns it with the configuration of a
+// client that connects to it
+func newFakeSMTPServer(t *testing.T, setup func(s *fakeSMTPServer)) (*fakeSMTPServer, *SMTPConfig) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	s := &fakeSMTPServer{
+		listener:  listener,
+		sessions:  make(chan *smtpSession, 1),
+		authReply: "235 2.7.0 Authentication successful",
+		quitReply: "221 2.0.0 Bye",
+	}
+	if setup != nil {
+		setup(s)
+	}
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			close(s.sessions)
+			return
+		}
+		s.sessions <- s.serve(conn)
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	return s, &SMTPConfig{Host: host, Port: port, From: "statements@example.com", Timeout: 5 * time.Second}
+}
+
+// session returns the session of the client, once it hung up
+func (s *fakeSMTPServer) session(t *testing.T) *smtpSession {
+	t.Helper()
+	select {
+	case session, ok := <-s.sessions:
+		if !ok {
+			t.Fatal("the client never connected")
+		}
+		return session
+	case <-time.After(5 * time.Second):
+		t.Fatal("the client didn't end the session")
+	}
+	return nil
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn) *smtpSession {
+	session := &smtpSession{}
+	if s.implicitTLS {
+		conn = tls.Server(conn, s.tlsConfig)
+		session.tls = true
+	}
+	defer func() { conn.Close() }()
+	tp := newSMTPConn(conn)
+
+	tp.reply("220 127.0.0.1 ESMTP fake")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return session
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			extensions := []string{"127.0.0.1"}
+			if s.tlsConfig != nil && !session.tls && !s.noSTARTTLS {
+				extensions = append(extensions, "STARTTLS")
+			}
+			extensions = append(extensions, "AUTH PLAIN LOGIN CRAM-MD5 XOAUTH2")
+			for i, ext := range extensions {
+				sep := "-"
+				if i == len(extensions)-1 {
+					sep = " "
+				}
+				tp.reply("250" + sep + ext)
+			}
+		case "STARTTLS":
+			tp.reply("220 2.0.0 Ready to start TLS")
+			conn = tls.Server(conn, s.tlsConfig)
+			tp = newSMTPConn(conn)
+			session.tls = true
+		case "AUTH":
+			if !s.authenticate(tp, arg, session) {
+				continue
+			}
+		case "MAIL":
+			session.from = arg
+			tp.reply("250 2.1.0 Ok")
+		case "RCPT":
+			session.rcpt = append(session.rcpt, arg)
+			tp.reply("250 2.1.5 Ok")
+		case "DATA":
+			tp.reply("354 End data with <CR><LF>.<CR><LF>")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return session
+			}
+			session.data = string(data)
+			tp.reply("250 2.0.0 Ok: queued")
+		case "QUIT":
+			if s.quitReply != "" {
+				tp.reply(s.quitReply)
+			}
+			return session
+		default:
+			tp.reply("502 5.5.2 Command not recognized")
+		}
+	}
+}
+
+// authenticate runs the exchange of an AUTH command, reporting whether it succeeded
+func (s *fakeSMTPServer) authenticate(tp *smtpConn, arg string, session *smtpSession) bool {
+	mechanism, initial, hasInitial := strings.Cut(arg, " ")
+	session.mechanism = mechanism
+	if hasInitial {
+		decoded, _ := base64.StdEncoding.DecodeString(initial)
+		session.responses = append(session.responses, string(decoded))
+	}
+	for _, prompt := range s.prompts {
+		tp.reply("334 " + base64.StdEncoding.EncodeToString([]byte(prompt)))
+		line, err := tp.ReadLine()
+		if err != nil {
+			return false
+		}
+		if line == "*" {
+			tp.reply("501 5.7.0 Authentication aborted")
+			return false
+		}
+		decoded, _ := base64.StdEncoding.DecodeString(line)
+		session.responses = append(session.responses, string(decoded))
+	}
+	tp.reply(s.authReply)
+	return strings.HasPrefix(s.authReply, "2")
+}
+
+// testCA issues the certificate of the fake server for 127.0.0.1 from a new CA, which it writes to a PEM
+// file for SMTPConfig.CAFile
+func testCA(t *testing.T) (*tls.Config, string) {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}, caFile
+}
+
+func TestSMTPServiceTLSModes(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        string
+		implicitTLS bool
+		noSTARTTLS  bool
+		// untrusted leaves the CA of the server out of the configuration of the client
+		untrusted bool
+		tls       bool
+		delivered bool
+	}{
+		{name: "none ignores STARTTLS", mode: TLSNone, delivered: true},
+		{name: "opportunistic upgrades", mode: TLSOpportunistic, tls: true, delivered: true},
+		{name: "opportunistic is the default", mode: "", tls: true, delivered: true},
+		{name: "opportunistic without STARTTLS", mode: TLSOpportunistic, noSTARTTLS: true, delivered: true},
+		{name: "opportunistic with an untrusted certificate", mode: TLSOpportunistic, untrusted: true},
+		{name: "starttls upgrades", mode: TLSStartTLS, tls: true, delivered: true},
+		{name: "starttls without STARTTLS", mode: TLSStartTLS, noSTARTTLS: true},
+		{name: "tls", mode: TLSImplicit, implicitTLS: true, tls: true, delivered: true},
+		{name: "tls with an untrusted certificate", mode: TLSImplicit, implicitTLS: true, untrusted: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverTLS, caFile := testCA(t)
+			server, cfg := newFakeSMTPServer(t, func(s *fakeSMTPServer) {
+				s.tlsConfig = serverTLS
+				s.implicitTLS = tt.implicitTLS
+				s.noSTARTTLS = tt.noSTARTTLS
+			})
+			cfg.TLS = tt.mode
+			if !tt.untrusted {
+				cfg.CAFile = caFile
+			}
+			service, err := NewSMTPService(cfg)
+			if err != nil {
+				t.Fatalf("NewSMTPService: %v", err)
+			}
+
+			msg := testMessage()
+			err = service.SendMessage(msg)
+			session := server.session(t)
+			if !tt.delivered {
+				if !errors.Is(err, apperrors.ErrDelivery) {
+					t.Fatalf("SendMessage returned %v, want a delivery error", err)
+				}
+				if session.data != "" {
+					t.Error("the message was sent even though the connection couldn't be secured")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SendMessage: %v", err)
+			}
+			if session.tls != tt.tls {
+				t.Errorf("session encrypted = %v, want %v", session.tls, tt.tls)
+			}
+			if session.from != "FROM:<statements@example.com>" {
+				t.Errorf("MAIL %s, want the address of the sender", session.from)
+			}
+			if want := []string{"TO:<ana@example.com>", "TO:<bob@example.com>"}; strings.Join(session.rcpt, ",") != strings.Join(want, ",") {
+				t.Errorf("RCPT %q, want %q", session.rcpt, want)
+			}
+			if !strings.Contains(session.data, "Message-ID: "+msg.MessageID) {
+				t.Errorf("DATA %q doesn't hold the message", session.data)
+			}
+		})
+	}
+}
+
+func TestNewSMTPServiceInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  SMTPConfig
+	}{
+		{"unknown TLS mode", SMTPConfig{TLS: "ssl"}},
+		{"missing CA file", SMTPConfig{CAFile: "/nonexistent/ca.pem"}},
+		{"unknown authentication", SMTPConfig{Username: "ana", Auth: "digest-md5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSMTPService(&tt.cfg); !errors.Is(err, apperrors.ErrValidation) {
+				t.Errorf("NewSMTPService returned %v, want a validation error", err)
+			}
+		})
+	}
+}
+
+func TestSMTPServiceQuitFailure(t *testing.T) {
+	// The server hangs up on QUIT instead of replying, after it accepted the message
+	server, cfg := newFakeSMTPServer(t, func(s *fakeSMTPServer) { s.quitReply = "" })
+	cfg.TLS = TLSNone
+	service, err := NewSMTPService(cfg)
+	if err != nil {
+		t.Fatalf("NewSMTPService: %v", err)
+	}
+	if err := service.SendMessage(testMessage()); err != nil {
+		t.Errorf("SendMessage of an accepted message returned %v, want it delivered", err)
+	}
+	if server.session(t).data == "" {
+		t.Error("the server received no message")
+	}
+}
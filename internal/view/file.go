@@ -0,0 +1,99 @@
+package view
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+)
+
+// FileConfig contains configuration options for the file service.
+type FileConfig struct {
+	// Dir is the directory the messages are written to, created if it doesn't exist
+	Dir string
+	// Maildir writes the messages to the new/ subdirectory of a Maildir, as read by mail clients,
+	// instead of .eml files in Dir itself
+	Maildir bool
+	// From is the sender address, optionally with a display name: "Stori <statements@example.com>"
+	From string
+}
+
+// FileService is the implementation of the EmailService interface that writes every message to a
+// file instead of sending it, for development and to keep a copy of what would be sent.
+// The files hold personal data and are readable only by their owner.
+type FileService struct {
+	dir     string
+	maildir bool
+	from    string
+}
+
+// Constructor that creates a new FileService
+func NewFileService(cfg *FileConfig) *FileService {
+	return &FileService{dir: cfg.Dir, maildir: cfg.Maildir, from: cfg.From}
+}
+
+// SendMessage writes a message to a new file. The file is written under a temporary name and renamed
+// when complete, so readers of the directory never see part of a message.
+func (s *FileService) SendMessage(msg *Message) error {
+	if msg.From == "" {
+		msg.From = s.from
+	}
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+	name, err := uniqueFileName()
+	if err != nil {
+		return err
+	}
+
+	tmpDir, dir := s.dir, s.dir
+	if s.maildir {
+		tmpDir, dir = filepath.Join(s.dir, "tmp"), filepath.Join(s.dir, "new")
+		if err := os.MkdirAll(filepath.Join(s.dir, "cur"), 0o700); err != nil {
+			return &apperrors.DeliveryError{Err: fmt.Errorf("failed to create maildir: %w", err)}
+		}
+	} else {
+		name += ".eml"
+	}
+	for _, d := range []string{tmpDir, dir} {
+		if err := os.MkdirAll(d, 0o700); err != nil {
+			return &apperrors.DeliveryError{Err: fmt.Errorf("failed to create mail directory: %w", err)}
+		}
+	}
+
+	tmp := filepath.Join(tmpDir, "."+name+".tmp")
+	if s.maildir {
+		tmp = filepath.Join(tmpDir, name)
+	}
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		os.Remove(tmp)
+		return &apperrors.DeliveryError{Err: fmt.Errorf("failed to write email: %w", err)}
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, name)); err != nil {
+		os.Remove(tmp)
+		return &apperrors.DeliveryError{Err: fmt.Errorf("failed to write email: %w", err)}
+	}
+	return nil
+}
+
+// uniqueFileName returns a file name no other message gets, in the format of Maildir:
+// the time, a random part and the host name
+func uniqueFileName() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate file name: %w", err)
+	}
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "localhost"
+	}
+	// Maildir escapes the characters of the host name that have a meaning in file names
+	host = strings.NewReplacer("/", `\057`, ":", `\072`).Replace(host)
+	return fmt.Sprintf("%d.%s.%s", time.Now().UnixNano(), hex.EncodeToString(b), host), nil
+}
@@ -0,0 +1,80 @@
+package view
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readDir returns the names of the files in dir, none when it doesn't exist
+func readDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestFileServiceWritesEML(t *testing.T) {
+	dir := t.TempDir()
+	msg := testMessage()
+	if err := NewFileService(&FileConfig{Dir: dir}).SendMessage(msg); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+
+	names := readDir(t, dir)
+	if len(names) != 1 || !strings.HasSuffix(names[0], ".eml") || strings.HasPrefix(names[0], ".") {
+		t.Fatalf("directory holds %q, want one .eml file and no temporary one", names)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, names[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Multipart boundaries are random, so the message is checked for its headers and parts
+	for _, want := range []string{"Message-ID: " + msg.MessageID, "Subject: " + msg.Subject, "chart.png", "transactions.csv"} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("file holds no %q", want)
+		}
+	}
+	info, err := os.Stat(filepath.Join(dir, names[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("file permissions = %o, want 600", perm)
+	}
+}
+
+func TestFileServiceMaildir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Maildir")
+	service := NewFileService(&FileConfig{Dir: dir, Maildir: true})
+	for i := 0; i < 2; i++ {
+		if err := service.SendMessage(testMessage()); err != nil {
+			t.Fatalf("SendMessage: %v", err)
+		}
+	}
+
+	// Messages are written to tmp/ and renamed to new/ when complete
+	if names := readDir(t, filepath.Join(dir, "tmp")); len(names) != 0 {
+		t.Errorf("tmp/ holds %q after delivery, want it empty", names)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cur")); err != nil {
+		t.Errorf("cur/ wasn't created: %v", err)
+	}
+	names := readDir(t, filepath.Join(dir, "new"))
+	if len(names) != 2 || names[0] == names[1] {
+		t.Fatalf("new/ holds %q, want two messages with unique names", names)
+	}
+	for _, name := range names {
+		if strings.HasSuffix(name, ".eml") || strings.Count(name, ".") < 2 {
+			t.Errorf("message file %q isn't named time.unique.host as Maildir expects", name)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package view
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+)
+
+// HTTPConfig contains configuration options for the HTTP service.
+type HTTPConfig struct {
+	// URL is the endpoint of the provider that messages are posted to
+	URL string
+	// APIKey is sent as a bearer token, when set
+	APIKey string
+	// From is the sender address, optionally with a display name: "Stori <statements@example.com>"
+	From string
+	// Timeout bounds every request, 30 seconds when 0
+	Timeout time.Duration
+}
+
+// HTTPService is the implementation of the EmailService interface that posts every message as JSON
+// to the API of an email provider, in the style of SES or SendGrid:
+//
+//	{
+//	  "from": "Stori <statements@example.com>",
+//	  "to": ["ana@example.com"],
+//	  "subject": "...",
+//	  "text": "...",
+//	  "html": "...",
+//	  "headers": {"Date": "...", "Message-ID": "<...>"},
+//	  "attachments": [{"filename": "...", "content_type": "...", "content_id": "...", "disposition": "inline", "content": "<base64>"}],
+//	  "raw": "<base64>"
+//	}
+//
+// raw is the formatted message, only posted when it is signed, for the provider to send as is instead
+// of formatting it from the other fields. Any 2xx response means the provider accepted the message.
+type HTTPService struct {
+	url    string
+	apiKey string
+	from   string
+	client *http.Client
+}
+
+// defaultHTTPTimeout bounds the requests of an HTTPService without a timeout
+const defaultHTTPTimeout = 30 * time.Second
+
+// maxHTTPErrorBytes bounds how much of a rejected request's response is kept in the error
+const maxHTTPErrorBytes = 512
+
+// Constructor that creates a new HTTPService
+func NewHTTPService(cfg *HTTPConfig) *HTTPService {
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultHTTPTimeout
+	}
+	return &HTTPService{
+		url:    cfg.URL,
+		apiKey: cfg.APIKey,
+		from:   cfg.From,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// httpMessage is the request body of HTTPService
+type httpMessage struct {
+	From        string            `json:"from"`
+	To          []string          `json:"to"`
+	Subject     string            `json:"subject"`
+	Text        string            `json:"text,omitempty"`
+	HTML        string            `json:"html,omitempty"`
+	Headers     map[string]string `json:"headers"`
+	Attachments []httpAttachment  `json:"attachments,omitempty"`
+	// Raw is the formatted message, sent only when it is signed so the provider can send it as is
+	Raw []byte `json:"raw,omitempty"`
+}
+
+// httpAttachment is a file of an httpMessage, its content encoded in base64
+type httpAttachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	ContentID   string `json:"content_id,omitempty"`
+	Disposition string `json:"disposition"`
+	Content     []byte `json:"content"`
+}
+
+// newHTTPAttachment converts an attachment of a message with the given disposition, inline or attachment
+func newHTTPAttachment(a Attachment, disposition string) httpAttachment {
+	contentType := a.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return httpAttachment{
+		Filename:    a.Filename,
+		ContentType: contentType,
+		ContentID:   a.ContentID,
+		Disposition: disposition,
+		Content:     a.Data,
+	}
+}
+
+// SendMessage posts a message to the provider
+func (s *HTTPService) SendMessage(msg *Message) error {
+	if msg.From == "" {
+		msg.From = s.from
+	}
+	from, to, err := msg.envelope()
+	if err != nil {
+		return err
+	}
+
+	body := httpMessage{
+		From:    from.String(),
+		Subject: msg.Subject,
+		Text:    msg.Text,
+		HTML:    msg.HTML,
+		Headers: map[string]string{
+			"Date":       msg.Date.Format(time.RFC1123Z),
+			"Message-ID": msg.MessageID,
+		},
+	}
+	for _, a := range to {
+		body.To = append(body.To, a.String())
+	}
+	for _, img := range msg.Inline {
+		body.Attachments = append(body.Attachments, newHTTPAttachment(img, "inline"))
+	}
+	for _, a := range msg.Attachments {
+		body.Attachments = append(body.Attachments, newHTTPAttachment(a, "attachment"))
+	}
+	if msg.signer != nil {
+		if body.Raw, err = msg.Bytes(); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode email: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return apperrors.Invalid("invalid email provider URL %q: %w", s.url, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return deliveryError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	return httpDeliveryError(resp)
+}
+
+// httpDeliveryError wraps a response rejecting a message as a DeliveryError, marking it transient
+// when retrying may succeed: timeouts, rate limits and server errors
+func httpDeliveryError(resp *http.Response) error {
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, maxHTTPErrorBytes))
+	err := fmt.Errorf("email provider replied %s", resp.Status)
+	if message := strings.TrimSpace(string(detail)); message != "" {
+		err = fmt.Errorf("email provider replied %s: %s", resp.Status, message)
+	}
+
+	delivery := &apperrors.DeliveryError{Err: err}
+	if resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return &apperrors.TransientError{Err: delivery}
+	}
+	return delivery
+}
@@ -0,0 +1,129 @@
+package view
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+)
+
+func TestHTTPServiceRequest(t *testing.T) {
+	var got httpMessage
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		header = r.Header
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("failed to decode request body: %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	msg := testMessage()
+	service := NewHTTPService(&HTTPConfig{URL: server.URL, APIKey: "secret-key"})
+	if err := service.SendMessage(msg); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+
+	if auth := header.Get("Authorization"); auth != "Bearer secret-key" {
+		t.Errorf("Authorization = %q, want the bearer token", auth)
+	}
+	if contentType := header.Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", contentType)
+	}
+
+	// Display names are encoded as in message headers
+	want := httpMessage{
+		From:    `"Stori" <statements@example.com>`,
+		To:      []string{"=?utf-8?q?Ana_L=C3=B3pez?= <ana@example.com>", "<bob@example.com>"},
+		Subject: msg.Subject,
+		Text:    msg.Text,
+		HTML:    msg.HTML,
+		Headers: map[string]string{
+			"Date":       msg.Date.Format(time.RFC1123Z),
+			"Message-ID": msg.MessageID,
+		},
+		Attachments: []httpAttachment{
+			{Filename: "chart.png", ContentType: "image/png", ContentID: "chart@example.com", Disposition: "inline", Content: msg.Inline[0].Data},
+			{Filename: "transactions.csv", ContentType: "text/csv", Disposition: "attachment", Content: msg.Attachments[0].Data},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("request body = %+v, want %+v", got, want)
+	}
+	if msg.MessageID == "" {
+		t.Error("SendMessage posted no Message-ID")
+	}
+}
+
+func TestHTTPServiceWithoutAPIKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("Authorization = %q, want none without an API key", auth)
+		}
+	}))
+	defer server.Close()
+
+	if err := NewHTTPService(&HTTPConfig{URL: server.URL}).SendMessage(testMessage()); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+}
+
+func TestHTTPServiceStatus(t *testing.T) {
+	tests := []struct {
+		status    int
+		delivered bool
+		transient bool
+	}{
+		{http.StatusOK, true, false},
+		{http.StatusAccepted, true, false},
+		{http.StatusBadRequest, false, false},
+		{http.StatusUnauthorized, false, false},
+		{http.StatusUnprocessableEntity, false, false},
+		{http.StatusRequestTimeout, false, true},
+		{http.StatusTooManyRequests, false, true},
+		{http.StatusInternalServerError, false, true},
+		{http.StatusServiceUnavailable, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "provider says no", tt.status)
+			}))
+			defer server.Close()
+
+			err := NewHTTPService(&HTTPConfig{URL: server.URL}).SendMessage(testMessage())
+			if tt.delivered {
+				if err != nil {
+					t.Fatalf("SendMessage: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, apperrors.ErrDelivery) {
+				t.Fatalf("SendMessage returned %v, want a delivery error", err)
+			}
+			if errors.Is(err, apperrors.ErrTransient) != tt.transient {
+				t.Errorf("SendMessage returned %v, transient = %v, want %v", err, !tt.transient, tt.transient)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	err := NewHTTPService(&HTTPConfig{URL: url}).SendMessage(testMessage())
+	if !errors.Is(err, apperrors.ErrTransient) {
+		t.Errorf("SendMessage to a closed server returned %v, want a transient error", err)
+	}
+}
@@ -0,0 +1,302 @@
+package view
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+)
+
+// Message is an email with an HTML body and its plain-text rendering. Bytes formats it as an
+// RFC 5322 message with MIME (RFC 2045) bodies.
+type Message struct {
+	// From and To are addresses as accepted by net/mail, with or without a display name,
+	// e.g. "Stori <statements@example.com>"
+	From string
+	To   []string
+
+	Subject string
+	Text    string
+	HTML    string
+
+	// Inline are the images the HTML body shows through cid: URLs of their ContentID
+	Inline []Attachment
+
+	// Attachments are sent as files next to the body
+	Attachments []Attachment
+
+	// Date and MessageID are set when the message is formatted if they are empty
+	Date      time.Time
+	MessageID string
+
+	// signer signs the formatted message, see NewSigningEmailService
+	signer Signer
+}
+
+// Attachment is a file attached to a message
+type Attachment struct {
+	Filename string
+	// ContentType is the media type of the file, application/octet-stream when empty
+	ContentType string
+	// ContentID identifies an inline image, e.g. "chart@example.com" for <img src="cid:chart@example.com">
+	ContentID string
+	Data      []byte
+}
+
+// Recipients returns the bare addresses of the recipients, as used for the SMTP envelope
+func (m *Message) Recipients() ([]string, error) {
+	addresses, err := parseAddresses(m.To)
+	if err != nil {
+		return nil, err
+	}
+	recipients := make([]string, len(addresses))
+	for i, a := range addresses {
+		recipients[i] = a.Address
+	}
+	return recipients, nil
+}
+
+// Bytes formats the message with CRLF line endings. The body is multipart/alternative when the
+// message has both a text and an HTML rendering, with the text first as RFC 2046 requires. The
+// HTML is wrapped in multipart/related with its inline images, and the whole body in multipart/mixed
+// with the attachments. The message is signed when it is sent through a signing email service.
+func (m *Message) Bytes() ([]byte, error) {
+	from, to, err := m.envelope()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := m.body()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writeHeader(&buf, "From", from.String())
+	writeHeader(&buf, "To", joinAddresses(to))
+	writeHeader(&buf, "Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	writeHeader(&buf, "Date", m.Date.Format(time.RFC1123Z))
+	writeHeader(&buf, "Message-ID", m.MessageID)
+	writeHeader(&buf, "MIME-Version", "1.0")
+	writeHeader(&buf, "Content-Type", body.header.Get("Content-Type"))
+	if encoding := body.header.Get("Content-Transfer-Encoding"); encoding != "" {
+		writeHeader(&buf, "Content-Transfer-Encoding", encoding)
+	}
+	buf.WriteString("\r\n")
+	buf.Write(body.content)
+
+	if m.signer != nil {
+		return m.signer.Sign(buf.Bytes())
+	}
+	return buf.Bytes(), nil
+}
+
+// envelope checks the message can be sent and returns its parsed sender and recipients, setting its
+// date and message ID if they are empty
+func (m *Message) envelope() (*mail.Address, []*mail.Address, error) {
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return nil, nil, apperrors.Invalid("invalid sender address %q: %w", m.From, err)
+	}
+	to, err := parseAddresses(m.To)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(to) == 0 {
+		return nil, nil, apperrors.Invalid("the message has no recipients")
+	}
+	if m.Text == "" && m.HTML == "" {
+		return nil, nil, apperrors.Invalid("the message has no body")
+	}
+	if m.Date.IsZero() {
+		m.Date = time.Now()
+	}
+	if m.MessageID == "" {
+		if m.MessageID, err = newMessageID(from.Address); err != nil {
+			return nil, nil, err
+		}
+	}
+	return from, to, nil
+}
+
+// body builds the MIME tree of the message:
+//
+//	multipart/mixed
+//	  multipart/alternative
+//	    text/plain
+//	    multipart/related
+//	      text/html
+//	      inline images
+//	  attachments
+//
+// leaving out every multipart level with a single part.
+func (m *Message) body() (*part, error) {
+	var html *part
+	if m.HTML != "" {
+		html = textPart("text/html", m.HTML)
+		if len(m.Inline) > 0 {
+			parts := []*part{html}
+			for _, img := range m.Inline {
+				if img.ContentID == "" {
+					return nil, apperrors.Invalid("an inline image has no content ID")
+				}
+				parts = append(parts, inlinePart(img))
+			}
+			var err error
+			if html, err = multipartPart("related", parts...); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var body *part
+	switch {
+	case m.Text != "" && html != nil:
+		var err error
+		if body, err = multipartPart("alternative", textPart("text/plain", m.Text), html); err != nil {
+			return nil, err
+		}
+	case html != nil:
+		body = html
+	default:
+		body = textPart("text/plain", m.Text)
+	}
+
+	if len(m.Attachments) == 0 {
+		return body, nil
+	}
+	parts := []*part{body}
+	for _, a := range m.Attachments {
+		if a.Filename == "" {
+			return nil, apperrors.Invalid("an attachment has no file name")
+		}
+		parts = append(parts, attachmentPart(a))
+	}
+	return multipartPart("mixed", parts...)
+}
+
+// writeHeader writes one header field. Values are already encoded, so they are plain ASCII.
+func writeHeader(buf *bytes.Buffer, name string, value string) {
+	buf.WriteString(name + ": " + value + "\r\n")
+}
+
+// part is a MIME entity: its header and its encoded content
+type part struct {
+	header  textproto.MIMEHeader
+	content []byte
+}
+
+// textPart encodes a UTF-8 text body as quoted-printable, which keeps the lines short and turns
+// its line breaks into CRLF
+func textPart(mediaType string, content string) *part {
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", mime.FormatMediaType(mediaType, map[string]string{"charset": "utf-8"}))
+	h.Set("Content-Transfer-Encoding", "quoted-printable")
+
+	var buf bytes.Buffer
+	qp := quotedprintable.NewWriter(&buf)
+	// Writing to a bytes.Buffer doesn't fail
+	io.WriteString(qp, content)
+	qp.Close()
+	return &part{header: h, content: buf.Bytes()}
+}
+
+// attachmentPart encodes a file as base64, in lines of 76 characters as RFC 2045 requires
+func attachmentPart(a Attachment) *part {
+	contentType := a.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", mime.FormatMediaType(contentType, map[string]string{"name": a.Filename}))
+	h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename}))
+	h.Set("Content-Transfer-Encoding", "base64")
+	return &part{header: h, content: base64Lines(a.Data)}
+}
+
+// inlinePart encodes an image shown by the HTML body, which refers to it by its Content-ID
+func inlinePart(img Attachment) *part {
+	p := attachmentPart(img)
+	p.header.Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": img.Filename}))
+	p.header.Set("Content-ID", "<"+img.ContentID+">")
+	return p
+}
+
+func base64Lines(data []byte) []byte {
+	const lineLength = 76
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var buf bytes.Buffer
+	for len(encoded) > lineLength {
+		buf.WriteString(encoded[:lineLength] + "\r\n")
+		encoded = encoded[lineLength:]
+	}
+	buf.WriteString(encoded + "\r\n")
+	return buf.Bytes()
+}
+
+// multipartPart joins parts into a multipart entity of the given subtype
+func multipartPart(subtype string, parts ...*part) (*part, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, p := range parts {
+		w, err := mw.CreatePart(p.header)
+		if err != nil {
+			return nil, fmt.Errorf("failed to format message: %w", err)
+		}
+		if _, err := w.Write(p.content); err != nil {
+			return nil, fmt.Errorf("failed to format message: %w", err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to format message: %w", err)
+	}
+
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", mime.FormatMediaType("multipart/"+subtype, map[string]string{"boundary": mw.Boundary()}))
+	return &part{header: h, content: buf.Bytes()}, nil
+}
+
+func parseAddresses(list []string) ([]*mail.Address, error) {
+	addresses := make([]*mail.Address, 0, len(list))
+	for _, s := range list {
+		a, err := mail.ParseAddress(s)
+		if err != nil {
+			return nil, apperrors.Invalid("invalid recipient address %q: %w", s, err)
+		}
+		addresses = append(addresses, a)
+	}
+	return addresses, nil
+}
+
+// joinAddresses formats an address list header value, folded so every line stays short
+func joinAddresses(addresses []*mail.Address) string {
+	formatted := make([]string, len(addresses))
+	for i, a := range addresses {
+		formatted[i] = a.String()
+	}
+	return strings.Join(formatted, ",\r\n ")
+}
+
+// newMessageID returns a unique Message-ID in the domain of the sender
+func newMessageID(from string) (string, error) {
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = from[at+1:]
+	}
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate message ID: %w", err)
+	}
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(b), domain), nil
+}
@@ -0,0 +1,311 @@
+package view
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+)
+
+// testMessage returns a message with every part set, as the transports are given statements
+func testMessage() *Message {
+	return &Message{
+		From:    "Stori <statements@example.com>",
+		To:      []string{"Ana López <ana@example.com>", "bob@example.com"},
+		Subject: "Resumen de transacciones",
+		Text:    "Total balance: 39.74\r\n",
+		HTML:    `<p>Total balance: 39.74</p><img src="cid:chart@example.com">`,
+		Inline: []Attachment{
+			{Filename: "chart.png", ContentType: "image/png", ContentID: "chart@example.com", Data: []byte("\x89PNG chart")},
+		},
+		Attachments: []Attachment{
+			{Filename: "transactions.csv", ContentType: "text/csv", Data: []byte("Id,Date,Transaction\n0,7/15,+60.5\n")},
+		},
+	}
+}
+
+func TestMessageRecipients(t *testing.T) {
+	recipients, err := testMessage().Recipients()
+	if err != nil {
+		t.Fatalf("Recipients: %v", err)
+	}
+	if want := []string{"ana@example.com", "bob@example.com"}; !reflect.DeepEqual(recipients, want) {
+		t.Errorf("Recipients = %q, want %q", recipients, want)
+	}
+
+	msg := testMessage()
+	msg.To = []string{"not an address"}
+	if _, err := msg.Recipients(); err == nil {
+		t.Error("Recipients of an invalid address succeeded")
+	}
+}
+
+// mimePart is a parsed MIME entity, with its content decoded
+type mimePart struct {
+	mediaType string
+	params    map[string]string
+	header    textproto.MIMEHeader
+	content   []byte
+	parts     []*mimePart
+}
+
+// parseMessage parses a formatted message into its header and MIME tree
+func parseMessage(t *testing.T, data []byte) (mail.Header, *mimePart) {
+	t.Helper()
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	return msg.Header, parsePart(t, textproto.MIMEHeader(msg.Header), msg.Body)
+}
+
+// parsePart parses a MIME entity, and its parts when it is multipart
+func parsePart(t *testing.T, header textproto.MIMEHeader, body io.Reader) *mimePart {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("Content-Type %q: %v", header.Get("Content-Type"), err)
+	}
+	p := &mimePart{mediaType: mediaType, params: params, header: header}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			raw, err := reader.NextRawPart()
+			if err == io.EOF {
+				return p
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", mediaType, err)
+			}
+			p.parts = append(p.parts, parsePart(t, raw.Header, raw))
+		}
+	}
+
+	switch encoding := header.Get("Content-Transfer-Encoding"); encoding {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "":
+	default:
+		t.Fatalf("%s: unexpected Content-Transfer-Encoding %q", mediaType, encoding)
+	}
+	if p.content, err = io.ReadAll(body); err != nil {
+		t.Fatalf("%s: %v", mediaType, err)
+	}
+	return p
+}
+
+// structure describes the MIME tree, e.g. multipart/alternative(text/plain,text/html)
+func (p *mimePart) structure() string {
+	if len(p.parts) == 0 {
+		return p.mediaType
+	}
+	children := make([]string, len(p.parts))
+	for i, child := range p.parts {
+		children[i] = child.structure()
+	}
+	return p.mediaType + "(" + strings.Join(children, ",") + ")"
+}
+
+// find returns the first part of the tree with the media type, nil if there is none
+func (p *mimePart) find(mediaType string) *mimePart {
+	if p.mediaType == mediaType {
+		return p
+	}
+	for _, child := range p.parts {
+		if found := child.find(mediaType); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func TestMessageBytes(t *testing.T) {
+	msg := testMessage()
+	msg.Subject = "Resumen de transacciones de julio: 39.74 $ – ¡gracias!"
+	data, err := msg.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+
+	for i, line := range strings.Split(string(data), "\r\n") {
+		if strings.Contains(line, "\n") {
+			t.Fatalf("line %d has a bare line feed: %q", i+1, line)
+		}
+		if len(line) > 998 {
+			t.Errorf("line %d is %d characters long, over the limit of RFC 5322", i+1, len(line))
+		}
+		for _, r := range line {
+			if r > 127 {
+				t.Fatalf("line %d isn't ASCII: %q", i+1, line)
+			}
+		}
+	}
+
+	header, body := parseMessage(t, data)
+	if got := header.Get("MIME-Version"); got != "1.0" {
+		t.Errorf("MIME-Version = %q, want 1.0", got)
+	}
+	if from, err := header.AddressList("From"); err != nil || len(from) != 1 || from[0].Name != "Stori" || from[0].Address != "statements@example.com" {
+		t.Errorf("From = %v, %v, want Stori <statements@example.com>", from, err)
+	}
+	to, err := header.AddressList("To")
+	if err != nil || len(to) != 2 || to[0].Name != "Ana López" || to[0].Address != "ana@example.com" || to[1].Address != "bob@example.com" {
+		t.Errorf("To = %v, %v, want Ana López and bob", to, err)
+	}
+	if raw := header.Get("Subject"); !strings.HasPrefix(raw, "=?utf-8?q?") {
+		t.Errorf("Subject = %q, want a Q-encoded word", raw)
+	}
+	if subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject")); err != nil || subject != msg.Subject {
+		t.Errorf("decoded Subject = %q, %v, want %q", subject, err, msg.Subject)
+	}
+	if date, err := header.Date(); err != nil || !date.Equal(msg.Date.Truncate(time.Second)) {
+		t.Errorf("Date = %v, %v, want %v", date, err, msg.Date)
+	}
+	if id := header.Get("Message-ID"); !strings.HasPrefix(id, "<") || !strings.HasSuffix(id, "@example.com>") || id != msg.MessageID {
+		t.Errorf("Message-ID = %q, want a unique ID in the domain of the sender", id)
+	}
+
+	// The text comes first in multipart/alternative, so clients that can show HTML pick the last part
+	want := "multipart/mixed(multipart/alternative(text/plain,multipart/related(text/html,image/png)),text/csv)"
+	if got := body.structure(); got != want {
+		t.Fatalf("MIME structure = %s, want %s", got, want)
+	}
+	text := body.find("text/plain")
+	if string(text.content) != msg.Text || text.params["charset"] != "utf-8" {
+		t.Errorf("text part = %q, %v, want %q in utf-8", text.content, text.params, msg.Text)
+	}
+	if html := body.find("text/html"); string(html.content) != msg.HTML {
+		t.Errorf("HTML part = %q, want %q", html.content, msg.HTML)
+	}
+	image := body.find("image/png")
+	if image.header.Get("Content-ID") != "<chart@example.com>" || !bytes.Equal(image.content, msg.Inline[0].Data) {
+		t.Errorf("inline image = %v, %q, want the chart with its Content-ID", image.header, image.content)
+	}
+	if disposition, params, _ := mime.ParseMediaType(image.header.Get("Content-Disposition")); disposition != "inline" || params["filename"] != "chart.png" {
+		t.Errorf("inline image Content-Disposition = %q", image.header.Get("Content-Disposition"))
+	}
+	csv := body.find("text/csv")
+	if disposition, params, _ := mime.ParseMediaType(csv.header.Get("Content-Disposition")); disposition != "attachment" || params["filename"] != "transactions.csv" {
+		t.Errorf("attachment Content-Disposition = %q", csv.header.Get("Content-Disposition"))
+	}
+	if !bytes.Equal(csv.content, msg.Attachments[0].Data) {
+		t.Errorf("attachment = %q, want %q", csv.content, msg.Attachments[0].Data)
+	}
+}
+
+func TestMessageStructure(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(msg *Message)
+		want string
+	}{
+		{"text only", func(msg *Message) {
+			msg.HTML, msg.Inline, msg.Attachments = "", nil, nil
+		}, "text/plain"},
+		{"HTML only", func(msg *Message) {
+			msg.Text, msg.Inline, msg.Attachments = "", nil, nil
+		}, "text/html"},
+		{"text and HTML", func(msg *Message) {
+			msg.Inline, msg.Attachments = nil, nil
+		}, "multipart/alternative(text/plain,text/html)"},
+		{"HTML with an image", func(msg *Message) {
+			msg.Text, msg.Attachments = "", nil
+		}, "multipart/related(text/html,image/png)"},
+		{"text with an attachment", func(msg *Message) {
+			msg.HTML, msg.Inline = "", nil
+		}, "multipart/mixed(text/plain,text/csv)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := testMessage()
+			tt.edit(msg)
+			data, err := msg.Bytes()
+			if err != nil {
+				t.Fatalf("Bytes: %v", err)
+			}
+			if _, body := parseMessage(t, data); body.structure() != tt.want {
+				t.Errorf("MIME structure = %s, want %s", body.structure(), tt.want)
+			}
+		})
+	}
+}
+
+func TestMessageBoundaries(t *testing.T) {
+	msg := testMessage()
+	// A body with lines that look like boundaries must not end its part
+	msg.Text = "--\r\n--boundary\r\n--boundary--\r\n"
+	first, err := msg.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+	_, body := parseMessage(t, first)
+	if text := body.find("text/plain"); string(text.content) != msg.Text {
+		t.Errorf("text part = %q, want %q", text.content, msg.Text)
+	}
+
+	boundaries := make(map[string]bool)
+	var collect func(p *mimePart)
+	collect = func(p *mimePart) {
+		if boundary := p.params["boundary"]; boundary != "" {
+			if len(boundary) > 70 {
+				t.Errorf("boundary %q is longer than the 70 characters of RFC 2046", boundary)
+			}
+			if boundaries[boundary] {
+				t.Errorf("boundary %q is used by two multipart levels", boundary)
+			}
+			boundaries[boundary] = true
+		}
+		for _, child := range p.parts {
+			collect(child)
+		}
+	}
+	collect(body)
+	if len(boundaries) != 3 {
+		t.Errorf("found %d boundaries, want one per multipart level", len(boundaries))
+	}
+
+	// Every message gets new boundaries
+	second, err := testMessage().Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+	if _, other := parseMessage(t, second); boundaries[other.params["boundary"]] {
+		t.Errorf("two messages share the boundary %q", other.params["boundary"])
+	}
+}
+
+func TestMessageInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(msg *Message)
+	}{
+		{"invalid sender", func(msg *Message) { msg.From = "not an address" }},
+		{"no recipients", func(msg *Message) { msg.To = nil }},
+		{"invalid recipient", func(msg *Message) { msg.To = []string{"ana@"} }},
+		{"no body", func(msg *Message) { msg.Text, msg.HTML = "", "" }},
+		{"inline image without a content ID", func(msg *Message) { msg.Inline[0].ContentID = "" }},
+		{"attachment without a file name", func(msg *Message) { msg.Attachments[0].Filename = "" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := testMessage()
+			tt.edit(msg)
+			if _, err := msg.Bytes(); !errors.Is(err, apperrors.ErrValidation) {
+				t.Errorf("Bytes returned %v, want a validation error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package view
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/models"
+)
+
+// EncodeOutboxPayload encodes a message to be queued in the outbox. Its date and message ID are set
+// now if they are empty, so every attempt sends the same message and receivers can tell a retry from
+// a new email; the sender is left empty when it is, and is filled in by the email service on delivery.
+func EncodeOutboxPayload(msg *Message) ([]byte, error) {
+	if msg.Date.IsZero() {
+		msg.Date = time.Now()
+	}
+	if msg.MessageID == "" {
+		domain := msg.From
+		if from, err := mail.ParseAddress(msg.From); err == nil {
+			domain = from.Address
+		}
+		id, err := newMessageID(domain)
+		if err != nil {
+			return nil, err
+		}
+		msg.MessageID = id
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode outbox message: %w", err)
+	}
+	return data, nil
+}
+
+// DecodeOutboxPayload decodes a message encoded by EncodeOutboxPayload
+func DecodeOutboxPayload(payload []byte) (*Message, error) {
+	msg := &Message{}
+	if err := json.Unmarshal(payload, msg); err != nil {
+		return nil, fmt.Errorf("failed to decode outbox message: %w", err)
+	}
+	return msg, nil
+}
+
+// OutboxSender delivers the messages of the outbox through an email service
+type OutboxSender struct {
+	service EmailService
+}
+
+// NewOutboxSender creates an OutboxSender sending through the given service
+func NewOutboxSender(service EmailService) *OutboxSender {
+	return &OutboxSender{service: service}
+}
+
+// Send decodes the message and sends it
+func (s *OutboxSender) Send(msg *models.OutboxMessage) error {
+	email, err := DecodeOutboxPayload(msg.Payload)
+	if err != nil {
+		return err
+	}
+	return s.service.SendMessage(email)
+}
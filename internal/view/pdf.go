@@ -0,0 +1,219 @@
+package view
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/aldaircoronel/email-summary/internal/i18n"
+	"github.com/aldaircoronel/email-summary/internal/models"
+)
+
+// A4 page size and margin, in points
+const (
+	pdfPageWidth  = 595
+	pdfPageHeight = 842
+	pdfMargin     = 50
+)
+
+// Fonts of the PDF documents, all of them standard Type 1 fonts every reader has, so none is embedded
+const (
+	pdfHelvetica     = "F1"
+	pdfHelveticaBold = "F2"
+	pdfCourier       = "F3"
+	pdfCourierBold   = "F4"
+)
+
+var pdfFonts = []struct{ name, baseFont string }{
+	{pdfHelvetica, "Helvetica"},
+	{pdfHelveticaBold, "Helvetica-Bold"},
+	{pdfCourier, "Courier"},
+	{pdfCourierBold, "Courier-Bold"},
+}
+
+// pdfCourierWidth is the advance of every Courier glyph, in units of the font size
+const pdfCourierWidth = 0.6
+
+// RenderStatementPDF renders the statement as a PDF document: the account, the statement period and
+// the same monthly and total figures as the email, in the language and formats of the account
+func RenderStatementPDF(account *models.Account, summary *models.Summary, monthSummaries []*models.MonthSummary) ([]byte, error) {
+	loc, err := account.Location()
+	if err != nil {
+		return nil, err
+	}
+	monthSummaries = sortByMonth(monthSummaries)
+	locale := i18n.Lookup(account.Locale)
+	money := func(amount float64) string { return locale.Money(amount, account.Currency) }
+	count := func(n int) string { return locale.Number(float64(n), 0) }
+
+	doc := newPDFDocument()
+	doc.line(18)
+	doc.text(pdfMargin, pdfHelveticaBold, 18, locale.T("statement_title"))
+	doc.line(10)
+
+	details := []string{locale.T("account", account.AccountID)}
+	if account.HolderName != "" {
+		details = append(details, locale.T("holder", account.HolderName))
+	}
+	details = append(details, locale.T("currency", account.Currency))
+	if !summary.PeriodStart.IsZero() && !summary.PeriodEnd.IsZero() {
+		details = append(details, locale.T("period",
+			locale.Date(summary.PeriodStart.In(loc)), locale.Date(summary.PeriodEnd.In(loc))))
+	}
+	generated := summary.GeneratedAt.In(loc)
+	details = append(details, locale.T("generated", locale.Date(generated)+generated.Format(" 15:04 MST")))
+	for _, detail := range details {
+		doc.line(16)
+		doc.text(pdfMargin, pdfHelvetica, 11, detail)
+	}
+
+	// Month, then the right edges of the numeric columns
+	columns := []float64{pdfMargin, 190, 270, 338, 406, 475, 544}
+	header := []string{
+		locale.T("month"), locale.T("balance"), locale.T("transactions"), locale.T("credits"),
+		locale.T("debits"), locale.T("avg_credit"), locale.T("avg_debit"),
+	}
+
+	doc.line(30)
+	doc.text(pdfMargin, pdfHelveticaBold, 12, locale.T("monthly_summary"))
+	doc.line(20)
+	doc.row(columns, pdfCourierBold, header)
+	for _, ms := range monthSummaries {
+		doc.line(14)
+		doc.row(columns, pdfCourier, []string{
+			locale.MonthName(ms.Month),
+			money(ms.TotalBalance),
+			count(ms.TotalTransactions),
+			count(ms.NumOfCreditTransactions),
+			count(ms.NumOfDebitTransactions),
+			money(ms.AverageCredit),
+			money(ms.AverageDebit),
+		})
+	}
+
+	doc.line(30)
+	doc.text(pdfMargin, pdfHelveticaBold, 12, locale.T("total"))
+	doc.line(20)
+	doc.row(columns, pdfCourierBold, append([]string{""}, header[1:]...))
+	doc.line(14)
+	doc.row(columns, pdfCourier, []string{
+		"",
+		money(summary.TotalBalance),
+		count(summary.TotalTransactions),
+		count(summary.NumOfCreditTransactions),
+		count(summary.NumOfDebitTransactions),
+		money(summary.TotalAverageCredit),
+		money(summary.TotalAverageDebit),
+	})
+
+	return doc.bytes(), nil
+}
+
+// pdfDocument lays out lines of text on A4 pages, top to bottom, and writes them as a PDF 1.4 file
+type pdfDocument struct {
+	pages []*bytes.Buffer
+	// y is the baseline of the current line, from the bottom of the page
+	y float64
+}
+
+func newPDFDocument() *pdfDocument {
+	doc := &pdfDocument{}
+	doc.newPage()
+	return doc
+}
+
+func (d *pdfDocument) newPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = pdfPageHeight - pdfMargin
+}
+
+// line moves down to the next line, starting a new page when it doesn't fit
+func (d *pdfDocument) line(height float64) {
+	d.y -= height
+	if d.y < pdfMargin {
+		d.newPage()
+		d.y -= height
+	}
+}
+
+// text writes s on the current line, starting at x
+func (d *pdfDocument) text(x float64, font string, size float64, s string) {
+	fmt.Fprintf(d.pages[len(d.pages)-1], "BT /%s %g Tf %g %g Td %s Tj ET\n", font, size, x, d.y, pdfString(s))
+}
+
+// row writes a table row in a Courier font: the first cell starts at columns[0], and the others end at
+// their column, so the numbers line up on the right
+func (d *pdfDocument) row(columns []float64, font string, cells []string) {
+	const size = 9
+	for i, cell := range cells {
+		x := columns[i]
+		if i > 0 {
+			x -= float64(len([]rune(cell))) * pdfCourierWidth * size
+		}
+		d.text(x, font, size, cell)
+	}
+}
+
+// bytes writes the document: the catalog, the page tree and the fonts, then a page and its content
+// stream for every page, and the cross-reference table with the offset of every object
+func (d *pdfDocument) bytes() []byte {
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	// Objects 1 and 2 are the catalog and the page tree, followed by the fonts and then the pages,
+	// each one its page object followed by its content stream
+	firstPage := 3 + len(pdfFonts)
+	var kids bytes.Buffer
+	for i := range d.pages {
+		fmt.Fprintf(&kids, "%d 0 R ", firstPage+2*i)
+	}
+	var fonts bytes.Buffer
+	for i, font := range pdfFonts {
+		fmt.Fprintf(&fonts, "/%s %d 0 R ", font.name, 3+i)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", kids.String(), len(d.pages)))
+	for _, font := range pdfFonts {
+		object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", font.baseFont))
+	}
+	for i, content := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << %s>> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, fonts.String(), firstPage+2*i+1))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return buf.Bytes()
+}
+
+// pdfString encodes s as a PDF literal string in WinAnsiEncoding, the encoding of the fonts. Characters
+// the encoding lacks are replaced with a question mark.
+func pdfString(s string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('(')
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r >= 0x20 && r < 0x7f || r >= 0xa0 && r <= 0xff:
+			buf.WriteByte(byte(r))
+		case r == '€':
+			buf.WriteByte(0x80)
+		default:
+			buf.WriteByte('?')
+		}
+	}
+	buf.WriteByte(')')
+	return buf.String()
+}
@@ -0,0 +1,179 @@
+package view
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/i18n"
+	"github.com/aldaircoronel/email-summary/internal/models"
+)
+
+var (
+	pdfStartXref = regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`)
+	pdfStream    = regexp.MustCompile(`/Length (\d+) >>\nstream\n`)
+	pdfText      = regexp.MustCompile(`\((?:[^()\\]|\\.)*\) Tj`)
+)
+
+// excerpt returns up to n bytes of data from offset, for error messages
+func excerpt(data []byte, offset int, n int) []byte {
+	if offset+n > len(data) {
+		return data[offset:]
+	}
+	return data[offset : offset+n]
+}
+
+// checkPDFStructure checks the cross-reference table of a PDF file points at each of its objects,
+// the trailer and the stream lengths, and returns the number of objects
+func checkPDFStructure(t *testing.T, data []byte) int {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte("%PDF-1.")) {
+		t.Fatalf("the document starts with %q, want a PDF header", excerpt(data, 0, 8))
+	}
+	match := pdfStartXref.FindSubmatch(data)
+	if match == nil {
+		t.Fatalf("the document doesn't end with startxref and %%%%EOF")
+	}
+	xref, _ := strconv.Atoi(string(match[1]))
+	var size int
+	if _, err := fmt.Sscanf(string(data[xref:]), "xref\n0 %d\n", &size); err != nil {
+		t.Fatalf("startxref %d doesn't point at the xref table: %v", xref, err)
+	}
+	entries := data[xref+len(fmt.Sprintf("xref\n0 %d\n", size)):]
+	// Every entry is 20 bytes long, the first one is the head of the free list
+	if string(entries[:20]) != "0000000000 65535 f \n" {
+		t.Errorf("first xref entry = %q", entries[:20])
+	}
+	for i := 1; i < size; i++ {
+		entry := string(entries[20*i : 20*(i+1)])
+		offset, err := strconv.Atoi(entry[:10])
+		if err != nil || entry[10:] != " 00000 n \n" {
+			t.Fatalf("xref entry %d = %q", i, entry)
+		}
+		if want := fmt.Sprintf("%d 0 obj\n", i); !bytes.HasPrefix(data[offset:], []byte(want)) {
+			t.Errorf("xref entry %d points at %q, want object %d", i, excerpt(data, offset, 10), i)
+		}
+	}
+	trailer := fmt.Sprintf("trailer\n<< /Size %d /Root 1 0 R >>\n", size)
+	if !bytes.HasPrefix(entries[20*size:], []byte(trailer)) {
+		t.Errorf("trailer = %q, want %q", excerpt(entries, 20*size, len(trailer)), trailer)
+	}
+
+	for _, loc := range pdfStream.FindAllSubmatchIndex(data, -1) {
+		length, _ := strconv.Atoi(string(data[loc[2]:loc[3]]))
+		if end := loc[1] + length; !bytes.HasPrefix(data[end:], []byte("\nendstream")) {
+			t.Errorf("a stream of /Length %d is followed by %q, want endstream", length, excerpt(data, end, 10))
+		}
+	}
+	return size - 1
+}
+
+// pdfTexts returns the strings the content streams show, decoded from WinAnsiEncoding
+func pdfTexts(data []byte) []string {
+	var texts []string
+	for _, match := range pdfText.FindAll(data, -1) {
+		literal := match[1 : len(match)-len(") Tj")]
+		var s strings.Builder
+		for i := 0; i < len(literal); i++ {
+			b := literal[i]
+			if b == '\\' {
+				i++
+				b = literal[i]
+			}
+			switch {
+			case b == 0x80:
+				s.WriteRune('€')
+			default:
+				s.WriteRune(rune(b))
+			}
+		}
+		texts = append(texts, s.String())
+	}
+	return texts
+}
+
+func TestRenderStatementPDF(t *testing.T) {
+	account := attachmentTestAccount()
+	account.HolderName = "Ana (López)"
+	summary := &models.Summary{
+		SummaryID:               7,
+		TotalBalance:            1234.5,
+		TotalTransactions:       4,
+		NumOfCreditTransactions: 3,
+		NumOfDebitTransactions:  1,
+		TotalAverageCredit:      415.5,
+		TotalAverageDebit:       -12,
+		PeriodStart:             time.Date(2023, time.January, 5, 12, 0, 0, 0, time.UTC),
+		PeriodEnd:               time.Date(2023, time.February, 20, 12, 0, 0, 0, time.UTC),
+		GeneratedAt:             time.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC),
+	}
+	monthSummaries := []*models.MonthSummary{
+		{Month: "2023-02", TotalBalance: -12, TotalTransactions: 1, NumOfDebitTransactions: 1, AverageDebit: -12},
+		{Month: "2023-01", TotalBalance: 1246.5, TotalTransactions: 3, NumOfCreditTransactions: 3, AverageCredit: 415.5},
+	}
+
+	data, err := RenderStatementPDF(account, summary, monthSummaries)
+	if err != nil {
+		t.Fatalf("RenderStatementPDF: %v", err)
+	}
+	// The catalog, the page tree, 4 fonts and one page with its contents
+	if objects := checkPDFStructure(t, data); objects != 8 {
+		t.Errorf("the document has %d objects, want 8", objects)
+	}
+	if !bytes.Contains(data, []byte("/Count 1 >>")) {
+		t.Errorf("the page tree doesn't count one page")
+	}
+
+	texts := strings.Join(pdfTexts(data), "\n")
+	locale := i18n.Lookup("es")
+	for _, want := range []string{
+		locale.T("statement_title"),
+		locale.T("holder", "Ana (López)"),
+		locale.T("period", locale.Date(summary.PeriodStart), locale.Date(summary.PeriodEnd)),
+		locale.MonthName("2023-01"),
+		locale.MonthName("2023-02"),
+		// The totals
+		locale.Money(1234.5, "MXN"),
+		locale.Money(415.5, "MXN"),
+		locale.Money(-12, "MXN"),
+	} {
+		if !strings.Contains(texts, want) {
+			t.Errorf("the PDF doesn't show %q in:\n%s", want, texts)
+		}
+	}
+	// Months are listed in order
+	if strings.Index(texts, locale.MonthName("2023-01")) > strings.Index(texts, locale.MonthName("2023-02")) {
+		t.Errorf("February is listed before January:\n%s", texts)
+	}
+}
+
+func TestRenderStatementPDFPages(t *testing.T) {
+	account := attachmentTestAccount()
+	summary := &models.Summary{GeneratedAt: time.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC)}
+	var monthSummaries []*models.MonthSummary
+	for i := 0; i < 60; i++ {
+		month := time.Date(2018+i/12, time.Month(i%12+1), 1, 0, 0, 0, 0, time.UTC)
+		monthSummaries = append(monthSummaries, &models.MonthSummary{Month: month.Format(models.MonthLayout), TotalTransactions: 1})
+	}
+
+	data, err := RenderStatementPDF(account, summary, monthSummaries)
+	if err != nil {
+		t.Fatalf("RenderStatementPDF: %v", err)
+	}
+	objects := checkPDFStructure(t, data)
+	// Every page adds its page object and its content stream to the catalog, the page tree and the fonts
+	pages := (objects - 6) / 2
+	if pages < 2 {
+		t.Fatalf("60 months fit on %d page, want them to flow onto the next", pages)
+	}
+	if want := fmt.Sprintf("/Count %d >>", pages); !bytes.Contains(data, []byte(want)) {
+		t.Errorf("the page tree doesn't list the %d pages", pages)
+	}
+	if texts := strings.Join(pdfTexts(data), "\n"); !strings.Contains(texts, i18n.Lookup("es").MonthName("2022-12")) {
+		t.Errorf("the last month is missing from:\n%s", texts)
+	}
+}
@@ -0,0 +1,81 @@
+package view
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/mail"
+	"os/exec"
+	"strings"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+)
+
+// DefaultSendmailPath is where the sendmail binary is usually installed
+const DefaultSendmailPath = "/usr/sbin/sendmail"
+
+// exTempFail is the exit code of sendmail for failures that may pass, EX_TEMPFAIL of sysexits.h
+const exTempFail = 75
+
+// SendmailConfig contains configuration options for the sendmail service.
+type SendmailConfig struct {
+	// Path is the sendmail binary, DefaultSendmailPath when empty
+	Path string
+	// From is the sender address, optionally with a display name: "Stori <statements@example.com>"
+	From string
+}
+
+// SendmailService is the implementation of the EmailService interface that hands every message to
+// the local sendmail binary, as provided by Postfix, Exim or msmtp
+type SendmailService struct {
+	path string
+	from string
+}
+
+// Constructor that creates a new SendmailService
+func NewSendmailService(cfg *SendmailConfig) *SendmailService {
+	path := cfg.Path
+	if path == "" {
+		path = DefaultSendmailPath
+	}
+	return &SendmailService{path: path, from: cfg.From}
+}
+
+// SendMessage pipes a message to sendmail, with the envelope on the command line
+func (s *SendmailService) SendMessage(msg *Message) error {
+	if msg.From == "" {
+		msg.From = s.from
+	}
+	sender, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		return apperrors.Invalid("invalid sender address %q: %w", msg.From, err)
+	}
+	recipients, err := msg.Recipients()
+	if err != nil {
+		return err
+	}
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	// -i keeps a line with a single dot from ending the message, and -- keeps a recipient from being read as an option
+	args := append([]string{"-i", "-f", sender.Address, "--"}, recipients...)
+	cmd := exec.Command(s.path, args...)
+	cmd.Stdin = bytes.NewReader(data)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			err = fmt.Errorf("%w: %s", err, message)
+		}
+		err = fmt.Errorf("sendmail failed: %w", err)
+
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == exTempFail {
+			return &apperrors.TransientError{Err: &apperrors.DeliveryError{Err: err}}
+		}
+		return &apperrors.DeliveryError{Err: err}
+	}
+	return nil
+}
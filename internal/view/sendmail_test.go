@@ -0,0 +1,86 @@
+package view
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+)
+
+// fakeSendmail writes a sendmail that saves its arguments and the message it reads in dir, then exits
+// with the given code
+func fakeSendmail(t *testing.T, dir string, exitCode string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake sendmail is a shell script")
+	}
+	script := "#!/bin/sh\n" +
+		`printf '%s\n' "$@" > "` + filepath.Join(dir, "args") + "\"\n" +
+		`cat > "` + filepath.Join(dir, "message") + "\"\n" +
+		"echo 'sendmail: exiting with " + exitCode + "' >&2\n" +
+		"exit " + exitCode + "\n"
+	path := filepath.Join(dir, "sendmail")
+	if err := os.WriteFile(path, []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSendmailServiceSendsMessage(t *testing.T) {
+	dir := t.TempDir()
+	service := NewSendmailService(&SendmailConfig{Path: fakeSendmail(t, dir, "0")})
+
+	msg := testMessage()
+	if err := service.SendMessage(msg); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+
+	args, err := os.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "-i\n-f\nstatements@example.com\n--\nana@example.com\nbob@example.com\n"; string(args) != want {
+		t.Errorf("sendmail arguments = %q, want %q", args, want)
+	}
+	message, err := os.ReadFile(filepath.Join(dir, "message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Multipart boundaries are random, so the message is checked for its headers and parts
+	for _, want := range []string{"Message-ID: " + msg.MessageID, "Subject: " + msg.Subject, "chart.png", "transactions.csv"} {
+		if !bytes.Contains(message, []byte(want)) {
+			t.Errorf("sendmail read no %q", want)
+		}
+	}
+}
+
+func TestSendmailServiceExitCodes(t *testing.T) {
+	tests := []struct {
+		exitCode  string
+		transient bool
+	}{
+		{"75", true},  // EX_TEMPFAIL
+		{"1", false},  // generic failure
+		{"67", false}, // EX_NOUSER
+	}
+	for _, tt := range tests {
+		t.Run("exit "+tt.exitCode, func(t *testing.T) {
+			service := NewSendmailService(&SendmailConfig{Path: fakeSendmail(t, t.TempDir(), tt.exitCode)})
+			err := service.SendMessage(testMessage())
+			if !errors.Is(err, apperrors.ErrDelivery) {
+				t.Fatalf("SendMessage returned %v, want a delivery error", err)
+			}
+			if errors.Is(err, apperrors.ErrTransient) != tt.transient {
+				t.Errorf("SendMessage returned %v, transient = %v, want %v", err, !tt.transient, tt.transient)
+			}
+			if !strings.Contains(err.Error(), "exiting with "+tt.exitCode) {
+				t.Errorf("SendMessage returned %q, want it to include what sendmail wrote to stderr", err)
+			}
+		})
+	}
+}
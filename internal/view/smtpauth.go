@@ -0,0 +1,103 @@
+package view
+
+import (
+	"errors"
+	"fmt"
+	"net/smtp"
+	"strings"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+)
+
+// SMTP authentication mechanisms of SMTPConfig.Auth
+const (
+	AuthPlain   = "plain"
+	AuthLogin   = "login"
+	AuthCRAMMD5 = "cram-md5"
+	AuthXOAuth2 = "xoauth2"
+)
+
+// newSMTPAuth returns the authentication of the given mechanism, PLAIN when it is empty,
+// or nil when there is no username to authenticate with
+func newSMTPAuth(mechanism, username, password, host string) (smtp.Auth, error) {
+	if username == "" {
+		return nil, nil
+	}
+	switch strings.ToLower(mechanism) {
+	case "", AuthPlain:
+		return smtp.PlainAuth("", username, password, host), nil
+	case AuthLogin:
+		return &loginAuth{username: username, password: password, host: host}, nil
+	case AuthCRAMMD5:
+		return smtp.CRAMMD5Auth(username, password), nil
+	case AuthXOAuth2:
+		return &xoauth2Auth{username: username, token: password, host: host}, nil
+	}
+	return nil, apperrors.Invalid("unknown SMTP authentication %q, expected plain, login, cram-md5 or xoauth2", mechanism)
+}
+
+// checkCleartext refuses to send credentials over a connection that isn't encrypted, unless the server
+// is on this machine, as smtp.PlainAuth does
+func checkCleartext(server *smtp.ServerInfo, host string) error {
+	if server.Name != host {
+		return errors.New("wrong host name")
+	}
+	if !server.TLS && server.Name != "localhost" && server.Name != "127.0.0.1" && server.Name != "::1" {
+		return errors.New("unencrypted connection")
+	}
+	return nil
+}
+
+// loginAuth implements the LOGIN mechanism, which sends the username and password as answers to the
+// prompts of the server. It is obsolete but still the only one some servers accept.
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if err := checkCleartext(server, a.host); err != nil {
+		return "", nil, err
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	// Servers differ on the prompts: "Username:", or "User Name" ended with a NUL as in the LOGIN draft
+	prompt := strings.TrimSpace(strings.TrimRight(string(fromServer), "\x00"))
+	switch strings.ToLower(prompt) {
+	case "username:", "user name":
+		return []byte(a.username), nil
+	case "password:", "password":
+		return []byte(a.password), nil
+	}
+	return nil, fmt.Errorf("unexpected LOGIN prompt %q", fromServer)
+}
+
+// xoauth2Auth implements the XOAUTH2 mechanism of Gmail and Outlook, which authenticates with an
+// OAuth 2.0 access token instead of a password
+type xoauth2Auth struct {
+	username string
+	token    string
+	host     string
+}
+
+func (a *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if err := checkCleartext(server, a.host); err != nil {
+		return "", nil, err
+	}
+	return "XOAUTH2", []byte("user=" + a.username + "\x01auth=Bearer " + a.token + "\x01\x01"), nil
+}
+
+// Next answers the error details the server sends when it rejects the token with an empty response,
+// after which the server replies with the error code
+func (a *xoauth2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		return []byte{}, nil
+	}
+	return nil, nil
+}
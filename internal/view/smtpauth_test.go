@@ -0,0 +1,143 @@
+package view
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"net/smtp"
+	"reflect"
+	"testing"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+)
+
+func TestSMTPServiceAuth(t *testing.T) {
+	const challenge = "<1896.697170952@postoffice.example.net>"
+	mac := hmac.New(md5.New, []byte("s3cret"))
+	mac.Write([]byte(challenge))
+
+	tests := []struct {
+		name      string
+		auth      string
+		prompts   []string
+		authReply string
+		mechanism string
+		responses []string
+		// fails is the error SendMessage returns, nil when the message is delivered
+		fails error
+	}{
+		{
+			name:      "plain",
+			mechanism: "PLAIN",
+			responses: []string{"\x00ana@example.com\x00s3cret"},
+		},
+		{
+			name:      "login",
+			auth:      AuthLogin,
+			prompts:   []string{"Username:", "Password:"},
+			mechanism: "LOGIN",
+			responses: []string{"ana@example.com", "s3cret"},
+		},
+		{
+			name:      "login with NUL-terminated prompts",
+			auth:      AuthLogin,
+			prompts:   []string{"User Name\x00", "Password\x00"},
+			mechanism: "LOGIN",
+			responses: []string{"ana@example.com", "s3cret"},
+		},
+		{
+			name:      "login with an unexpected prompt",
+			auth:      AuthLogin,
+			prompts:   []string{"Username:", "One-time code:"},
+			mechanism: "LOGIN",
+			responses: []string{"ana@example.com"},
+			fails:     apperrors.ErrDelivery,
+		},
+		{
+			name:      "cram-md5",
+			auth:      AuthCRAMMD5,
+			prompts:   []string{challenge},
+			mechanism: "CRAM-MD5",
+			responses: []string{"ana@example.com " + hex.EncodeToString(mac.Sum(nil))},
+		},
+		{
+			name:      "xoauth2",
+			auth:      AuthXOAuth2,
+			mechanism: "XOAUTH2",
+			responses: []string{"user=ana@example.com\x01auth=Bearer s3cret\x01\x01"},
+		},
+		{
+			// The server sends the error details as a challenge, which the client answers empty
+			name:      "xoauth2 with an expired token",
+			auth:      AuthXOAuth2,
+			prompts:   []string{`{"status":"401","schemes":"bearer","scope":"https://mail.google.com/"}`},
+			authReply: "535 5.7.8 Username and Password not accepted",
+			mechanism: "XOAUTH2",
+			responses: []string{"user=ana@example.com\x01auth=Bearer s3cret\x01\x01", ""},
+			fails:     apperrors.ErrDelivery,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, cfg := newFakeSMTPServer(t, func(s *fakeSMTPServer) {
+				s.prompts = tt.prompts
+				if tt.authReply != "" {
+					s.authReply = tt.authReply
+				}
+			})
+			cfg.TLS = TLSNone
+			cfg.Auth = tt.auth
+			cfg.Username = "ana@example.com"
+			cfg.Password = "s3cret"
+			service, err := NewSMTPService(cfg)
+			if err != nil {
+				t.Fatalf("NewSMTPService: %v", err)
+			}
+
+			err = service.SendMessage(testMessage())
+			session := server.session(t)
+			if tt.fails == nil && err != nil {
+				t.Errorf("SendMessage: %v", err)
+			}
+			if tt.fails != nil {
+				if !errors.Is(err, tt.fails) || errors.Is(err, apperrors.ErrTransient) {
+					t.Errorf("SendMessage returned %v, want a permanent %v", err, tt.fails)
+				}
+				if session.data != "" {
+					t.Error("the message was sent without authenticating")
+				}
+			}
+			if session.mechanism != tt.mechanism {
+				t.Errorf("AUTH %s, want %s", session.mechanism, tt.mechanism)
+			}
+			if !reflect.DeepEqual(session.responses, tt.responses) {
+				t.Errorf("the client answered %q, want %q", session.responses, tt.responses)
+			}
+		})
+	}
+}
+
+func TestSMTPAuthCleartext(t *testing.T) {
+	tests := []struct {
+		host   string
+		server smtp.ServerInfo
+		ok     bool
+	}{
+		{"smtp.example.com", smtp.ServerInfo{Name: "smtp.example.com", TLS: true}, true},
+		{"smtp.example.com", smtp.ServerInfo{Name: "smtp.example.com"}, false},
+		{"smtp.example.com", smtp.ServerInfo{Name: "mx.example.com", TLS: true}, false},
+		{"localhost", smtp.ServerInfo{Name: "localhost"}, true},
+		{"::1", smtp.ServerInfo{Name: "::1"}, true},
+	}
+	for _, tt := range tests {
+		for _, auth := range []smtp.Auth{
+			&loginAuth{username: "ana", password: "s3cret", host: tt.host},
+			&xoauth2Auth{username: "ana", token: "s3cret", host: tt.host},
+		} {
+			if _, _, err := auth.Start(&tt.server); (err == nil) != tt.ok {
+				t.Errorf("%T.Start(%+v) for %s returned %v, want success %v", auth, tt.server, tt.host, err, tt.ok)
+			}
+		}
+	}
+}
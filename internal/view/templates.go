@@ -0,0 +1,202 @@
+package view
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/i18n"
+	"github.com/aldaircoronel/email-summary/internal/models"
+)
+
+// defaultTemplates are the email templates built into the binary
+//
+//go:embed templates
+var defaultTemplates embed.FS
+
+// The HTML email is the "layout" template, which includes the "content" template defined by
+// summary.html. The text email is summary.txt. Both may use the templates defined in partials/.
+const (
+	htmlEntry = "layout"
+	textEntry = "summary.txt"
+)
+
+// emailData is the data the email templates are executed with
+type emailData struct {
+	Account        *models.Account
+	Summary        *models.Summary
+	MonthSummaries []*models.MonthSummary
+	// Charts are the images RenderCharts draws, shown by the HTML template
+	Charts []chartRef
+}
+
+// Templates are the parsed email templates. They are safe for concurrent use.
+type Templates struct {
+	html *template.Template
+	text *texttemplate.Template
+}
+
+// LoadTemplates parses the embedded email templates. The .html and .txt files of dir, when it is not
+// empty, replace the embedded ones with the same path, and new files add templates, such as partials
+// used by a replaced layout. The templates are checked by rendering a sample statement, so mistakes are
+// reported when the program starts rather than when the first email is sent.
+func LoadTemplates(dir string) (*Templates, error) {
+	files, err := templateFiles(defaultTemplates, "templates")
+	if err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return nil, apperrors.Invalid("invalid template directory %q: not a directory", dir)
+		}
+		overrides, err := templateFiles(os.DirFS(dir), ".")
+		if err != nil {
+			return nil, err
+		}
+		for name, content := range overrides {
+			files[name] = content
+		}
+	}
+
+	// The functions are bound to the locale of the account when a template is executed; these only
+	// declare them for parsing
+	funcs := i18n.Lookup(i18n.DefaultLanguage).Funcs(models.DefaultCurrency)
+	t := &Templates{
+		html: template.New("email").Funcs(funcs),
+		text: texttemplate.New("email").Funcs(funcs),
+	}
+	// Parsing in a fixed order makes the template that wins a duplicate define predictable
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch path.Ext(name) {
+		case ".html":
+			_, err = t.html.New(name).Parse(files[name])
+		case ".txt":
+			_, err = t.text.New(name).Parse(files[name])
+		}
+		if err != nil {
+			return nil, apperrors.Invalid("invalid email template: %w", err)
+		}
+	}
+
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// templateFiles reads the .html and .txt files under root, by their path relative to it
+func templateFiles(fsys fs.FS, root string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := fs.WalkDir(fsys, root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ext := path.Ext(name); d.IsDir() || ext != ".html" && ext != ".txt" {
+			return nil
+		}
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		files[strings.TrimPrefix(strings.TrimPrefix(name, root), "/")] = string(content)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read email templates: %w", err)
+	}
+	return files, nil
+}
+
+// check renders a sample statement with both templates, in every language
+func (t *Templates) check() error {
+	data := sampleEmailData()
+	for _, language := range i18n.Languages() {
+		data.Account.Locale = language
+		if _, err := t.RenderEmailBody(data.Account, data.Summary, data.MonthSummaries); err != nil {
+			return apperrors.Invalid("invalid email template: %w", err)
+		}
+		if _, err := t.RenderEmailText(data.Account, data.Summary, data.MonthSummaries); err != nil {
+			return apperrors.Invalid("invalid email template: %w", err)
+		}
+	}
+	return nil
+}
+
+// sampleEmailData is a statement with every field set, used to check the templates
+func sampleEmailData() emailData {
+	account := &models.Account{AccountID: 1, HolderName: "Sample Holder", Emails: []string{"holder@example.com"}}
+	account.SetDefaults()
+	monthSummaries := []*models.MonthSummary{
+		{Month: "2023-01", TotalBalance: 120.5, TotalTransactions: 3, NumOfCreditTransactions: 2, NumOfDebitTransactions: 1, AverageCredit: 80.25, AverageDebit: -40},
+		{Month: "2023-02", TotalBalance: -15.75, TotalTransactions: 2, NumOfCreditTransactions: 1, NumOfDebitTransactions: 1, AverageCredit: 10, AverageDebit: -25.75},
+	}
+	end := time.Date(2023, time.February, 28, 0, 0, 0, 0, time.UTC)
+	summary := &models.Summary{
+		SummaryID: 1, AccountID: 1, TotalBalance: 104.75, TotalTransactions: 5, NumOfCreditTransactions: 3,
+		NumOfDebitTransactions: 2, TotalAverageCredit: 56.83, TotalAverageDebit: -32.88,
+		PeriodStart: end.AddDate(0, -2, 1), PeriodEnd: end, GeneratedAt: end,
+	}
+	return emailData{Account: account, Summary: summary, MonthSummaries: monthSummaries}
+}
+
+// SampleStatement returns the sample statement the templates are checked with, to preview them
+// without stored data
+func SampleStatement() (*models.Account, *models.Summary, []*models.MonthSummary) {
+	data := sampleEmailData()
+	return data.Account, data.Summary, data.MonthSummaries
+}
+
+// RenderEmailBody renders the HTML summary email of the account, in its language and with its
+// number and currency formats
+func (t *Templates) RenderEmailBody(account *models.Account, summary *models.Summary, monthSummaries []*models.MonthSummary) (string, error) {
+	monthSummaries = sortByMonth(monthSummaries)
+	locale := i18n.Lookup(account.Locale)
+
+	// Executing a clone keeps the parsed templates free of the functions of one locale
+	tmpl, err := t.html.Clone()
+	if err != nil {
+		return "", fmt.Errorf("failed to execute email template: %w", err)
+	}
+	var body bytes.Buffer
+	data := emailData{Account: account, Summary: summary, MonthSummaries: monthSummaries, Charts: chartRefs(locale, monthSummaries)}
+	if err := tmpl.Funcs(locale.Funcs(account.Currency)).ExecuteTemplate(&body, htmlEntry, data); err != nil {
+		return "", fmt.Errorf("failed to execute email template: %w", err)
+	}
+	return body.String(), nil
+}
+
+// RenderEmailText renders the plain-text version of the summary email, sent next to the HTML one
+func (t *Templates) RenderEmailText(account *models.Account, summary *models.Summary, monthSummaries []*models.MonthSummary) (string, error) {
+	monthSummaries = sortByMonth(monthSummaries)
+	locale := i18n.Lookup(account.Locale)
+
+	tmpl, err := t.text.Clone()
+	if err != nil {
+		return "", fmt.Errorf("failed to execute email text template: %w", err)
+	}
+	var body bytes.Buffer
+	data := emailData{Account: account, Summary: summary, MonthSummaries: monthSummaries}
+	if err := tmpl.Funcs(locale.Funcs(account.Currency)).ExecuteTemplate(&body, textEntry, data); err != nil {
+		return "", fmt.Errorf("failed to execute email text template: %w", err)
+	}
+	return body.String(), nil
+}
+
+// Subject returns the subject of the summary email in the language of the account
+func (t *Templates) Subject(account *models.Account) string {
+	return i18n.Lookup(account.Locale).T("subject")
+}
@@ -0,0 +1,169 @@
+package view
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aldaircoronel/email-summary/internal/apperrors"
+	"github.com/aldaircoronel/email-summary/internal/models"
+)
+
+// templateDir writes the template files, by their path relative to the directory, to a new directory
+func templateDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadTemplatesOverride(t *testing.T) {
+	dir := templateDir(t, map[string]string{
+		// A replaced text template, and a replaced HTML page using a new partial
+		"summary.txt":             `Custom statement of account {{ .Account.AccountID }}: {{ money .Summary.TotalBalance }}`,
+		"summary.html":            `{{ define "content" }}<p class="custom">{{ template "signature" . }}</p>{{ end }}`,
+		"partials/signature.html": `{{ define "signature" }}{{ t "total" }} {{ money .Summary.TotalBalance }}{{ end }}`,
+		// Other files are ignored
+		"README.md": `{{ broken`,
+	})
+	templates, err := LoadTemplates(dir)
+	if err != nil {
+		t.Fatalf("LoadTemplates: %v", err)
+	}
+
+	account, summary, monthSummaries := SampleStatement()
+	text, err := templates.RenderEmailText(account, summary, monthSummaries)
+	if err != nil {
+		t.Fatalf("RenderEmailText: %v", err)
+	}
+	if want := "Custom statement of account 1: "; !strings.HasPrefix(text, want) {
+		t.Errorf("text body = %q, want the overriding template", text)
+	}
+	html, err := templates.RenderEmailBody(account, summary, monthSummaries)
+	if err != nil {
+		t.Fatalf("RenderEmailBody: %v", err)
+	}
+	// The embedded layout wraps the overriding content
+	if !strings.Contains(html, `<p class="custom">`) || !strings.Contains(html, "<!DOCTYPE html>") {
+		t.Errorf("HTML body doesn't wrap the overriding content in the layout:\n%s", html)
+	}
+	if strings.Contains(html, `class="chart"`) {
+		t.Errorf("HTML body still shows the embedded content:\n%s", html)
+	}
+
+	// The embedded templates are kept when no directory is given
+	defaults, err := LoadTemplates("")
+	if err != nil {
+		t.Fatalf("LoadTemplates: %v", err)
+	}
+	if text, err := defaults.RenderEmailText(account, summary, monthSummaries); err != nil || strings.HasPrefix(text, "Custom") {
+		t.Errorf("embedded text body = %q, %v", text, err)
+	}
+}
+
+func TestLoadTemplatesInvalid(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "summary.txt")
+	if err := os.WriteFile(file, []byte("text"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		dir  string
+		want string
+	}{
+		{"missing directory", filepath.Join(t.TempDir(), "missing"), "not a directory"},
+		{"file instead of a directory", file, "not a directory"},
+		{"syntax error", templateDir(t, map[string]string{
+			"summary.txt": `{{ .Summary.TotalBalance `,
+		}), "invalid email template"},
+		// The next ones parse, and fail when check renders the sample statement
+		{"unknown field", templateDir(t, map[string]string{
+			"summary.txt": `{{ .Summary.Balance }}`,
+		}), "Balance"},
+		{"missing partial", templateDir(t, map[string]string{
+			"summary.html": `{{ define "content" }}{{ template "footer" . }}{{ end }}`,
+		}), "footer"},
+		{"function error", templateDir(t, map[string]string{
+			"summary.txt": `{{ money "many" }}`,
+		}), "invalid email template"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadTemplates(tt.dir)
+			if !errors.Is(err, apperrors.ErrValidation) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadTemplates returned %v, want a validation error with %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortByMonth(t *testing.T) {
+	monthSummaries := []*models.MonthSummary{
+		{Month: "2023-01", TotalTransactions: 1},
+		{Month: "2022-11"},
+		{Month: "2023-01", TotalTransactions: 2},
+		{Month: "2022-12"},
+	}
+	given := append([]*models.MonthSummary(nil), monthSummaries...)
+
+	sorted := sortByMonth(monthSummaries)
+	var months []string
+	for _, ms := range sorted {
+		months = append(months, ms.Month)
+	}
+	if got, want := strings.Join(months, ","), "2022-11,2022-12,2023-01,2023-01"; got != want {
+		t.Errorf("sortByMonth = %s, want %s", got, want)
+	}
+	// Months of the same name keep their order
+	if sorted[2].TotalTransactions != 1 || sorted[3].TotalTransactions != 2 {
+		t.Errorf("sortByMonth swapped the two summaries of 2023-01")
+	}
+	for i := range given {
+		if monthSummaries[i] != given[i] {
+			t.Fatalf("sortByMonth reordered the caller's slice")
+		}
+	}
+}
+
+func TestRenderKeepsMonthOrder(t *testing.T) {
+	templates, err := LoadTemplates("")
+	if err != nil {
+		t.Fatalf("LoadTemplates: %v", err)
+	}
+	account, summary, monthSummaries := SampleStatement()
+	// Newest first, as the repositories may return them
+	monthSummaries[0], monthSummaries[1] = monthSummaries[1], monthSummaries[0]
+	first := monthSummaries[0]
+
+	text, err := templates.RenderEmailText(account, summary, monthSummaries)
+	if err != nil {
+		t.Fatalf("RenderEmailText: %v", err)
+	}
+	if _, err := templates.RenderEmailBody(account, summary, monthSummaries); err != nil {
+		t.Fatalf("RenderEmailBody: %v", err)
+	}
+	if _, err := RenderCharts(account, monthSummaries); err != nil {
+		t.Fatalf("RenderCharts: %v", err)
+	}
+	if _, err := RenderStatementPDF(account, summary, monthSummaries); err != nil {
+		t.Fatalf("RenderStatementPDF: %v", err)
+	}
+	if monthSummaries[0] != first {
+		t.Errorf("rendering the statement reordered the month summaries of the caller")
+	}
+	// The email lists them oldest first all the same
+	if january, february := strings.Index(text, "January"), strings.Index(text, "February"); january < 0 || january > february {
+		t.Errorf("text body doesn't list January before February:\n%s", text)
+	}
+}